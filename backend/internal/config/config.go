@@ -3,16 +3,68 @@ package config
 import "os"
 
 type Config struct {
-	Port     string
-	GinMode  string
-	DataPath string
+	Port      string
+	GinMode   string
+	DataPath  string
+	StatePath string // writable directory for saved searches and other persisted state
+
+	WorkspacesDataPath string // directory holding the data of workspaces other than the default; defaults to DATA_PATH/workspaces
+
+	AlertWebhooks string // comma-separated URLs used by rules without their own webhooks
+	AlertInterval string // e.g. "15m"; empty evaluates alerts on data loads only
+
+	SMTPHost     string // empty writes digests to the dry-run directory instead
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	DigestDryRun string // directory for rendered digests; set to dry-run even with SMTP configured
+
+	ExportTTL     string // how long finished export files are kept, e.g. "24h"
+	ExportWorkers string // number of exports written concurrently
+
+	ExportAuditRetention string // how long export audit entries are kept, e.g. "2160h"
+
+	RedactionConfig string // JSON file of redaction policies; defaults to redaction.json in StatePath
+	RedactionSalt   string // secret mixed into hashed emails
+
+	CORSOrigins string // comma-separated origins allowed to call the API from a browser
+	JWTSecret   string // HS256 key for bearer tokens; empty accepts API keys only
+	JWTIssuer   string // required iss claim, if set
+	JWTAudience string // required aud claim, if set
 }
 
 func Load() *Config {
 	return &Config{
-		Port:     getEnv("PORT", "8080"),
-		GinMode:  getEnv("GIN_MODE", "debug"),
-		DataPath: getEnv("DATA_PATH", "/app/data"),
+		Port:      getEnv("PORT", "8080"),
+		GinMode:   getEnv("GIN_MODE", "debug"),
+		DataPath:  getEnv("DATA_PATH", "/app/data"),
+		StatePath: getEnv("STATE_PATH", "/app/state"),
+
+		WorkspacesDataPath: getEnv("WORKSPACES_DATA_PATH", ""),
+
+		AlertWebhooks: getEnv("ALERT_WEBHOOK_URLS", ""),
+		AlertInterval: getEnv("ALERT_INTERVAL", ""),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "25"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "analytics@localhost"),
+		DigestDryRun: getEnv("DIGEST_DRY_RUN_DIR", ""),
+
+		ExportTTL:     getEnv("EXPORT_TTL", "24h"),
+		ExportWorkers: getEnv("EXPORT_WORKERS", "2"),
+
+		ExportAuditRetention: getEnv("EXPORT_AUDIT_RETENTION", "2160h"),
+
+		RedactionConfig: getEnv("REDACTION_CONFIG", ""),
+		RedactionSalt:   getEnv("REDACTION_SALT", ""),
+
+		CORSOrigins: getEnv("CORS_ORIGINS", "http://localhost:3000"),
+		JWTSecret:   getEnv("JWT_SECRET", ""),
+		JWTIssuer:   getEnv("JWT_ISSUER", ""),
+		JWTAudience: getEnv("JWT_AUDIENCE", ""),
 	}
 }
 
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	codeInvalidRule = "invalid_rule"
+	codeInvalidURL  = "invalid_url"
+)
+
+type AlertHandler struct {
+	service *services.AlertService
+}
+
+func NewAlertHandler(service *services.AlertService) *AlertHandler {
+	return &AlertHandler{service: service}
+}
+
+func (h *AlertHandler) ListAlerts(c *gin.Context) {
+	state := strings.TrimSpace(c.Query("state"))
+	switch state {
+	case "", models.AlertFiring, models.AlertResolved:
+	default:
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", utils.FieldError{
+			Field:   "state",
+			Code:    codeUnknownValue,
+			Message: "must be firing or resolved",
+		})
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", scopeAlerts(c, h.service.Alerts(state)))
+}
+
+// scopeAlerts leaves out the alerts of companies the caller may not see.
+func scopeAlerts(c *gin.Context, alerts []models.Alert) []models.Alert {
+	scoped := []models.Alert{}
+	for _, alert := range alerts {
+		if inScope(c, alert.CompanyID) {
+			scoped = append(scoped, alert)
+		}
+	}
+	return scoped
+}
+
+func (h *AlertHandler) GetHistory(c *gin.Context) {
+	var errs utils.ValidationErrors
+	limit := defaultHistoryLimit
+	if value := parseIntParam(c.Query("limit"), "limit", &errs); value != nil {
+		if *value < 1 || *value > maxSearchLimit {
+			errs.Add("limit", codeOutOfRange, fmt.Sprintf("must be between 1 and %d", maxSearchLimit))
+		} else {
+			limit = *value
+		}
+	}
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", errs...)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", h.service.History(strings.TrimSpace(c.Query("rule_id")), limit, scope(c)))
+}
+
+func (h *AlertHandler) Evaluate(c *gin.Context) {
+	if err := h.service.Evaluate(); err != nil {
+		respondError(c, "Alert evaluation failed", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Alerts evaluated", scopeAlerts(c, h.service.Alerts(models.AlertFiring)))
+}
+
+// ListRules lists alert rules; scoped callers only see the rules limited to
+// their own companies.
+func (h *AlertHandler) ListRules(c *gin.Context) {
+	rules := []models.AlertRule{}
+	for _, rule := range h.service.ListRules() {
+		if coversScope(c, rule.CompanyIDs) {
+			rules = append(rules, rule)
+		}
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", rules)
+}
+
+// userRule looks up a rule the caller may see. Rules covering companies
+// outside their scope are reported as not found.
+func (h *AlertHandler) userRule(c *gin.Context) (models.AlertRule, error) {
+	rule, err := h.service.GetRule(c.Param("id"))
+	if err == nil && !coversScope(c, rule.CompanyIDs) {
+		err = fmt.Errorf("alert rule %s: %w", rule.ID, services.ErrNotFound)
+	}
+	return rule, err
+}
+
+func (h *AlertHandler) GetRule(c *gin.Context) {
+	rule, err := h.userRule(c)
+	if err != nil {
+		respondError(c, "Alert rule not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", rule)
+}
+
+func (h *AlertHandler) CreateRule(c *gin.Context) {
+	request, ok := bindAlertRuleRequest(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.service.CreateRule(request)
+	if err != nil {
+		respondError(c, "Failed to create alert rule", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusCreated, "Alert rule created", rule)
+}
+
+func (h *AlertHandler) UpdateRule(c *gin.Context) {
+	request, ok := bindAlertRuleRequest(c)
+	if !ok {
+		return
+	}
+	if _, err := h.userRule(c); err != nil {
+		respondError(c, "Failed to update alert rule", err)
+		return
+	}
+
+	rule, err := h.service.UpdateRule(c.Param("id"), request)
+	if err != nil {
+		respondError(c, "Failed to update alert rule", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Alert rule updated", rule)
+}
+
+func (h *AlertHandler) DeleteRule(c *gin.Context) {
+	if _, err := h.userRule(c); err != nil {
+		respondError(c, "Failed to delete alert rule", err)
+		return
+	}
+	if err := h.service.DeleteRule(c.Param("id")); err != nil {
+		respondError(c, "Failed to delete alert rule", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Alert rule deleted", nil)
+}
+
+// TestRule sends a sample notification to the rule's webhooks.
+func (h *AlertHandler) TestRule(c *gin.Context) {
+	if _, err := h.userRule(c); err != nil {
+		respondError(c, "Failed to test alert rule", err)
+		return
+	}
+	deliveries, err := h.service.TestRule(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, "Failed to test alert rule", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Test notification sent", deliveries)
+}
+
+func bindAlertRuleRequest(c *gin.Context) (models.AlertRuleRequest, bool) {
+	var request models.AlertRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid alert rule", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return request, false
+	}
+
+	var errs utils.ValidationErrors
+	if strings.TrimSpace(request.Kind) == "" {
+		errs.Add("kind", codeRequired, "is required")
+	} else if !services.IsAlertKind(strings.TrimSpace(request.Kind)) {
+		errs.Add("kind", codeUnknownValue, fmt.Sprintf("unknown kind %q; use one of %s",
+			request.Kind, strings.Join(services.AlertKinds(), ", ")))
+	}
+	if request.Threshold != nil && *request.Threshold < 0 {
+		errs.Add("threshold", codeOutOfRange, "must not be negative")
+	}
+	if request.CooldownMinutes != nil && *request.CooldownMinutes < 0 {
+		errs.Add("cooldown_minutes", codeOutOfRange, "must not be negative")
+	}
+	for i, webhook := range request.Webhooks {
+		if !isWebhookURL(webhook) {
+			errs.Add(fmt.Sprintf("webhooks[%d]", i), codeInvalidURL, "must be an absolute http or https URL")
+		}
+	}
+	request.CompanyIDs = scopeCompanies(c, "company_ids", request.CompanyIDs, &errs)
+
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid alert rule", errs...)
+		return request, false
+	}
+	return request, true
+}
+
+func isWebhookURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -4,126 +4,329 @@ import (
 	"assembly-dashboard-backend/internal/models"
 	"assembly-dashboard-backend/internal/services"
 	"assembly-dashboard-backend/pkg/utils"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AnalyticsHandler struct {
-	service *services.AnalyticsService
+	service       *services.AnalyticsService
+	savedSearches *services.SavedSearchService
+	exportJobs    *services.ExportJobService
+	audit         *services.ExportAuditLog
+	redactor      *services.Redactor
 }
 
-func NewAnalyticsHandler(service *services.AnalyticsService) *AnalyticsHandler {
-	return &AnalyticsHandler{service: service}
+func NewAnalyticsHandler(service *services.AnalyticsService, savedSearches *services.SavedSearchService, exportJobs *services.ExportJobService, audit *services.ExportAuditLog, redactor *services.Redactor) *AnalyticsHandler {
+	return &AnalyticsHandler{service: service, savedSearches: savedSearches, exportJobs: exportJobs, audit: audit, redactor: redactor}
 }
 
 func (h *AnalyticsHandler) GetDashboardSummary(c *gin.Context) {
-	summary := h.service.GetDashboardSummary()
+	filters, err := h.parseFilterParams(c)
+	if err != nil {
+		respondError(c, "Invalid filter parameters", err)
+		return
+	}
+
+	if filters, err = h.applySegment(c, c.Query("segment_id"), filters); err != nil {
+		respondError(c, "Invalid segment", err)
+		return
+	}
+	filters.Scope = scope(c)
+	redaction := h.redaction(c, services.RedactSummary)
+	if err = redaction.CheckFilters(filters); err != nil {
+		respondError(c, "Invalid filter parameters", err)
+		return
+	}
+
+	summary, err := h.service.GetDashboardSummary(filters)
+	if err != nil {
+		respondError(c, "Summary failed", err)
+		return
+	}
+	redaction.Summary(summary)
+
 	utils.JSONResponse(c, http.StatusOK, "success", summary)
 }
 
 func (h *AnalyticsHandler) SearchEvents(c *gin.Context) {
 	filters, err := h.parseFilterParams(c)
 	if err != nil {
-		utils.JSONResponse(c, http.StatusBadRequest, "Invalid filter parameters", gin.H{"error": err.Error()})
+		respondError(c, "Invalid filter parameters", err)
 		return
 	}
 
-	results := h.service.SearchEvents(filters)
+	if filters, err = h.applySegment(c, c.Query("segment_id"), filters); err != nil {
+		respondError(c, "Invalid segment", err)
+		return
+	}
+	filters.Scope = scope(c)
+	redaction := h.redaction(c, services.RedactSearch)
+	if err = redaction.CheckFilters(filters); err != nil {
+		respondError(c, "Invalid filter parameters", err)
+		return
+	}
+
+	results, err := h.service.SearchEvents(filters)
+	if err != nil {
+		respondError(c, "Search failed", err)
+		return
+	}
+	redaction.Results(&results)
+
 	utils.JSONResponse(c, http.StatusOK, "success", results)
 }
 
+// GetCompanyTimeline returns one company's activity over time with the
+// annotations covering it. The usual filter parameters narrow it down.
+func (h *AnalyticsHandler) GetCompanyTimeline(c *gin.Context) {
+	filters, err := h.parseFilterParams(c)
+	if err != nil {
+		respondError(c, "Invalid filter parameters", err)
+		return
+	}
+	filters.Scope = scope(c)
+	// The timeline only returns counts, but its filters are those of a
+	// search, so they are held to the search policy
+	if err = h.redaction(c, services.RedactSearch).CheckFilters(filters); err != nil {
+		respondError(c, "Invalid filter parameters", err)
+		return
+	}
+
+	timeline, err := h.service.GetCompanyTimeline(c.Param("id"), filters)
+	if err != nil {
+		respondError(c, "Timeline failed", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", timeline)
+}
+
 func (h *AnalyticsHandler) ExportData(c *gin.Context) {
-	var request models.ExportRequest
-	if err := c.ShouldBindJSON(&request); err != nil {
-		utils.JSONResponse(c, http.StatusBadRequest, "Invalid export request", gin.H{"error": err.Error()})
+	request, ok := h.bindExportRequest(c)
+	if !ok {
 		return
 	}
 
-	// Validate format
-	if request.Format != "csv" && request.Format != "json" {
-		utils.JSONResponse(c, http.StatusBadRequest, "Invalid export format", gin.H{
-			"error": "Format must be 'csv' or 'json'",
-		})
+	export, err := h.service.PrepareExport(request)
+	if err != nil {
+		respondError(c, "Export failed", err)
 		return
 	}
+	export.Redact(h.redaction(c, services.RedactExport))
+
+	// Rows are streamed as they are written, so the response has no
+	// Content-Length and is sent with chunked transfer encoding
+	c.Header("Content-Type", export.ContentType)
+	c.Header("Content-Disposition", "attachment; filename=\""+export.Filename+"\"")
+	c.Header("Vary", "Accept-Encoding")
+
+	var w io.Writer = c.Writer
+	flush := c.Writer.Flush
+	var gz *gzip.Writer
+	if !request.Compress && acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Header("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(c.Writer)
+		w = gz
+		flush = func() {
+			gz.Flush()
+			c.Writer.Flush()
+		}
+	}
+	c.Status(http.StatusOK)
+
+	rows := 0
+	err = h.service.WriteExport(c.Request.Context(), w, export, func(written int) {
+		rows = written
+		flush()
+	})
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+
+	// The entry is written once the stream has ended, so that it records
+	// what the client was actually sent
+	entry := export.AuditEntry()
+	entry.Rows = rows
+	switch {
+	case err == nil:
+		entry.Status = models.ExportCompleted
+	case c.Request.Context().Err() != nil:
+		entry.Status = models.ExportCancelled
+		entry.Error = "client disconnected"
+	default:
+		entry.Status = models.ExportFailed
+		entry.Error = err.Error()
+	}
+	if auditErr := h.audit.Record(callerAuditEntry(c, models.AuditExport, entry)); auditErr != nil {
+		log.Printf("Warning: failed to record export in the audit log: %v", auditErr)
+	}
 
-	data, contentType, filename, err := h.service.ExportData(request)
 	if err != nil {
-		utils.JSONResponse(c, http.StatusInternalServerError, "Export failed", gin.H{"error": err.Error()})
+		if entry.Status == models.ExportFailed {
+			log.Printf("Warning: export stream failed: %v", err)
+		}
+		// The status line has already been sent. Dropping the connection
+		// before the final chunk lets the client tell the download is
+		// incomplete.
+		if conn, _, hijackErr := c.Writer.Hijack(); hijackErr == nil {
+			conn.Close()
+		}
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		params = strings.ReplaceAll(params, " ", "")
+		return params != "q=0" && params != "q=0.0" && params != "q=0.00" && params != "q=0.000"
+	}
+	return false
+}
+
+func (h *AnalyticsHandler) ReloadData(c *gin.Context) {
+	if err := h.service.Reload(); err != nil {
+		respondError(c, "Reload failed", err)
 		return
 	}
 
-	c.Header("Content-Type", contentType)
-	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
-	c.Data(http.StatusOK, contentType, data)
+	utils.JSONResponse(c, http.StatusOK, "Data reloaded", h.service.GetDatasetInfo())
 }
 
-func (h *AnalyticsHandler) HealthCheck(c *gin.Context) {
+func HealthCheck(c *gin.Context) {
 	utils.JSONResponse(c, http.StatusOK, "healthy", gin.H{
 		"service":  "assembly-analytics-api",
 		"version":  "1.0.0",
-		"features": []string{"filtering", "search", "export"},
+		"features": []string{"filtering", "search", "sorting", "cursor-pagination", "query-language", "full-text-index", "facets", "highlighting", "saved-searches", "dynamic-segments", "company-directory", "annotations", "alerts", "digests", "export", "export-jobs", "export-audit", "company-reports", "redaction", "api-keys", "jwt", "rbac", "company-scoping", "workspaces"},
 	})
 }
 
-func (h *AnalyticsHandler) parseFilterParams(c *gin.Context) (models.FilterParams, error) {
-	filters := models.FilterParams{}
+// bindExportRequest parses and validates an export request, resolving its
+// segment into filters, limiting it to the caller's scope and checking it
+// against the caller's redaction policy.
+func (h *AnalyticsHandler) bindExportRequest(c *gin.Context) (models.ExportRequest, bool) {
+	var request models.ExportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid export request", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return request, false
+	}
 
-	// Parse date range
-	if startDateStr := c.Query("start_date"); startDateStr != "" {
-		if startDate, err := time.Parse("2006-01-02", startDateStr); err == nil {
-			filters.StartDate = &startDate
-		}
+	if errs := h.validateExportRequest(request); len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid export request", errs...)
+		return request, false
+	}
+	if err := services.CheckParquetColumns(request); err != nil {
+		respondError(c, "Invalid export request", err)
+		return request, false
 	}
 
-	if endDateStr := c.Query("end_date"); endDateStr != "" {
-		if endDate, err := time.Parse("2006-01-02", endDateStr); err == nil {
-			// Set to end of day
-			endDate = endDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-			filters.EndDate = &endDate
-		}
+	var err error
+	if request.Filters, err = h.applySegment(c, request.SegmentID, request.Filters); err != nil {
+		respondError(c, "Invalid segment", err)
+		return request, false
+	}
+	request.Filters.Scope = scope(c)
+	if err = h.redaction(c, services.RedactExport).CheckFilters(request.Filters); err != nil {
+		respondError(c, "Invalid export request", err)
+		return request, false
 	}
+	return request, true
+}
+
+func (h *AnalyticsHandler) validateExportRequest(request models.ExportRequest) utils.ValidationErrors {
+	var errs utils.ValidationErrors
 
-	// Parse company IDs
-	if companyIDsStr := c.Query("company_ids"); companyIDsStr != "" {
-		filters.CompanyIDs = strings.Split(companyIDsStr, ",")
-		// Clean up whitespace
-		for i, id := range filters.CompanyIDs {
-			filters.CompanyIDs[i] = strings.TrimSpace(id)
+	switch request.Format {
+	case "csv", "json", "ndjson", "xlsx", "parquet":
+	default:
+		errs.Add("format", codeUnsupported, "must be 'csv', 'json', 'ndjson', 'xlsx' or 'parquet'")
+	}
+	if request.Kind != "" && !services.IsExportKind(request.Kind) {
+		errs.Add("kind", codeUnknownValue, fmt.Sprintf("use one of %s", strings.Join(services.ExportKinds(), ", ")))
+	} else if request.Kind != "" && request.Kind != services.ExportKindEvents {
+		// Aggregate exports have their own fixed columns
+		if len(request.Columns) > 0 {
+			errs.Add("columns", codeConflict, "only applies to event exports")
+		}
+		if len(request.Headers) > 0 {
+			errs.Add("headers", codeConflict, "only applies to event exports")
+		}
+		if request.IncludeAnnotations {
+			errs.Add("include_annotations", codeConflict, "only applies to event exports")
 		}
 	}
 
-	// Parse event types
-	if eventTypesStr := c.Query("event_types"); eventTypesStr != "" {
-		filters.EventTypes = strings.Split(eventTypesStr, ",")
-		// Clean up whitespace
-		for i, eventType := range filters.EventTypes {
-			filters.EventTypes[i] = strings.TrimSpace(eventType)
+	seen := make(map[string]bool)
+	for i, column := range request.Columns {
+		field := fmt.Sprintf("columns[%d]", i)
+		switch {
+		case !services.IsExportColumn(column):
+			errs.Add(field, codeUnknownValue, fmt.Sprintf("unknown column %q; use one of %s", column, strings.Join(services.ExportColumns(), ", ")))
+		case seen[column]:
+			errs.Add(field, codeConflict, fmt.Sprintf("column %q is listed twice", column))
 		}
+		seen[column] = true
 	}
-
-	// Parse search text
-	filters.SearchText = strings.TrimSpace(c.Query("search"))
-
-	// Parse pagination
-	if limitStr := c.Query("limit"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			filters.Limit = limit
+	for column := range request.Headers {
+		if !services.IsExportColumn(column) {
+			errs.Add("headers."+column, codeUnknownValue, fmt.Sprintf("unknown column %q", column))
 		}
 	}
-	if filters.Limit <= 0 {
-		filters.Limit = 50 // Default limit
+	if request.TimestampFormat != "" && !services.IsExportTimestampFormat(strings.ToLower(request.TimestampFormat)) {
+		errs.Add("timestamp_format", codeUnknownValue, fmt.Sprintf("use one of %s", strings.Join(services.ExportTimestampFormats(), ", ")))
 	}
-
-	if offsetStr := c.Query("offset"); offsetStr != "" {
-		if offset, err := strconv.Atoi(offsetStr); err == nil && offset >= 0 {
-			filters.Offset = offset
+	if request.Timezone != "" {
+		if _, err := time.LoadLocation(request.Timezone); err != nil {
+			errs.Add("timezone", codeUnknownValue, fmt.Sprintf("unknown time zone %q", request.Timezone))
 		}
 	}
+	if request.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(request.Delimiter)
+		if size != len(request.Delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			errs.Add("delimiter", codeUnknownValue, "must be a single character other than a quote or line break")
+		}
+	}
+	switch strings.ToLower(request.Quote) {
+	case "", services.QuoteMinimal, services.QuoteAll, services.QuoteNone:
+	default:
+		errs.Add("quote", codeUnknownValue, "must be minimal, all or none")
+	}
+
+	return append(errs, h.validateFilters(request.Filters, "filters.")...)
+}
 
-	return filters, nil
+// applySegment replaces the request's filters with those of the saved search
+// identified by segmentID, if any and if the caller may see it.
+func (h *AnalyticsHandler) applySegment(c *gin.Context, segmentID string, filters models.FilterParams) (models.FilterParams, error) {
+	segmentID = strings.TrimSpace(segmentID)
+	if segmentID == "" {
+		return filters, nil
+	}
+
+	if filters.HasConditions() {
+		return filters, utils.ValidationErrors{{
+			Field:   "segment_id",
+			Code:    codeConflict,
+			Message: "cannot be combined with inline filters",
+		}}
+	}
+
+	if _, err := h.userSavedSearch(c, segmentID); err != nil {
+		return filters, err
+	}
+	return h.savedSearches.ResolveFilters(segmentID, filters)
 }
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnnotationHandler struct {
+	service *services.AnnotationService
+}
+
+func NewAnnotationHandler(service *services.AnnotationService) *AnnotationHandler {
+	return &AnnotationHandler{service: service}
+}
+
+// ListAnnotations returns annotations for a company (including the global
+// ones) overlapping start_date..end_date.
+func (h *AnnotationHandler) ListAnnotations(c *gin.Context) {
+	var errs utils.ValidationErrors
+	query := models.AnnotationQuery{
+		CompanyIDs: parseList(c.Query("company_ids")),
+		From:       parseDateParam(c.Query("start_date"), "start_date", false, &errs),
+		To:         parseDateParam(c.Query("end_date"), "end_date", true, &errs),
+		Scope:      scope(c),
+	}
+	if query.From != nil && query.To != nil && query.From.After(*query.To) {
+		errs.Add("end_date", codeInvalidRange, "must not be before start_date")
+	}
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", errs...)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", h.service.List(query))
+}
+
+// userAnnotation looks up an annotation the caller may see: a global one, or
+// one for a company in their scope.
+func (h *AnnotationHandler) userAnnotation(c *gin.Context) (models.Annotation, error) {
+	annotation, err := h.service.Get(c.Param("id"))
+	if err == nil && annotation.CompanyID != "" && !inScope(c, annotation.CompanyID) {
+		err = fmt.Errorf("annotation %s: %w", annotation.ID, services.ErrNotFound)
+	}
+	return annotation, err
+}
+
+func (h *AnnotationHandler) GetAnnotation(c *gin.Context) {
+	annotation, err := h.userAnnotation(c)
+	if err != nil {
+		respondError(c, "Annotation not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", annotation)
+}
+
+func (h *AnnotationHandler) CreateAnnotation(c *gin.Context) {
+	var request models.AnnotationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid annotation", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var errs utils.ValidationErrors
+	if strings.TrimSpace(request.Text) == "" {
+		errs.Add("text", codeRequired, "is required")
+	}
+
+	startDate := parseDateParam(request.StartDate, "start_date", false, &errs)
+	endDate := parseDateParam(request.EndDate, "end_date", true, &errs)
+	if strings.TrimSpace(request.EndDate) == "" && startDate != nil {
+		// A single date marks that day; a timestamp marks that instant
+		endDate = parseDateParam(request.StartDate, "start_date", true, &errs)
+	}
+	if startDate == nil && strings.TrimSpace(request.StartDate) == "" && endDate != nil {
+		errs.Add("start_date", codeRequired, "is required when end_date is set")
+	}
+	if startDate != nil && endDate != nil && startDate.After(*endDate) {
+		errs.Add("end_date", codeInvalidRange, "must not be before start_date")
+	}
+	if strings.TrimSpace(request.CompanyID) == "" && strings.TrimSpace(request.StartDate) == "" {
+		errs.Add("company_id", codeRequired, "company_id or start_date is required")
+	}
+	// Global annotations show up for everyone, so scoped callers can only
+	// annotate their own companies
+	if companyID := strings.TrimSpace(request.CompanyID); scope(c) != nil && !inScope(c, companyID) {
+		if companyID == "" {
+			errs.Add("company_id", codeRequired, "is required when limited to companies")
+		} else {
+			errs.Add("company_id", codeNotFound, fmt.Sprintf("unknown company %q", companyID))
+		}
+	}
+
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid annotation", errs...)
+		return
+	}
+
+	annotation, err := h.service.Create(request, startDate, endDate)
+	if err != nil {
+		respondError(c, "Failed to create annotation", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusCreated, "Annotation created", annotation)
+}
+
+func (h *AnnotationHandler) DeleteAnnotation(c *gin.Context) {
+	annotation, err := h.userAnnotation(c)
+	if err != nil {
+		respondError(c, "Failed to delete annotation", err)
+		return
+	}
+	if annotation.CompanyID == "" && scope(c) != nil {
+		utils.ErrorResponse(c, http.StatusForbidden, "Permission denied", utils.FieldError{
+			Code:    codeForbidden,
+			Message: "global annotations cannot be deleted when limited to companies",
+		})
+		return
+	}
+	if err := h.service.Delete(c.Param("id")); err != nil {
+		respondError(c, "Failed to delete annotation", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Annotation deleted", nil)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey is the context key holding the authenticated caller.
+const principalKey = "principal"
+
+const (
+	codeUnauthenticated = "unauthenticated"
+	codeForbidden       = "forbidden"
+)
+
+type AuthHandler struct {
+	service    *services.AuthService
+	workspaces *services.WorkspaceService // checks the workspaces keys are limited to; may be nil
+}
+
+func NewAuthHandler(service *services.AuthService) *AuthHandler {
+	return &AuthHandler{service: service}
+}
+
+// SetWorkspaces sets the workspaces keys can be limited to.
+func (h *AuthHandler) SetWorkspaces(workspaces *services.WorkspaceService) {
+	h.workspaces = workspaces
+}
+
+// Authenticate rejects requests without a valid API key or JWT. Either is
+// sent as "Authorization: Bearer <credential>"; API keys may also be sent in
+// an X-API-Key header.
+func (h *AuthHandler) Authenticate(c *gin.Context) {
+	credential := strings.TrimSpace(c.GetHeader("X-API-Key"))
+	if scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		credential = strings.TrimSpace(token)
+	}
+	if credential == "" {
+		unauthorized(c)
+		return
+	}
+
+	// Why a credential failed stays in the server log; telling callers
+	// would help anyone guessing keys or forging tokens
+	principal, err := h.service.Authenticate(credential)
+	if err != nil {
+		log.Printf("Rejected credentials from %s: %v", c.ClientIP(), err)
+		unauthorized(c)
+		return
+	}
+
+	c.Set(principalKey, principal)
+	c.Set(roleKey, principal.Role)
+	c.Next()
+}
+
+func unauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Bearer realm="assembly-analytics-api"`)
+	utils.ErrorResponse(c, http.StatusUnauthorized, "Authentication required", utils.FieldError{
+		Code:    codeUnauthenticated,
+		Message: services.ErrUnauthenticated.Error(),
+	})
+	c.Abort()
+}
+
+// Require only lets callers with at least the given role through. It runs
+// after Authenticate.
+func Require(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !services.HasRole(principal(c).Role, role) {
+			utils.ErrorResponse(c, http.StatusForbidden, "Permission denied", utils.FieldError{
+				Code:    codeForbidden,
+				Message: "requires the " + role + " role",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// principal returns the authenticated caller of a request.
+func principal(c *gin.Context) models.Principal {
+	value, _ := c.Get(principalKey)
+	principal, _ := value.(models.Principal)
+	return principal
+}
+
+// GetCurrentPrincipal describes the caller: who they are and their role.
+func (h *AuthHandler) GetCurrentPrincipal(c *gin.Context) {
+	utils.JSONResponse(c, http.StatusOK, "success", principal(c))
+}
+
+func (h *AuthHandler) ListKeys(c *gin.Context) {
+	utils.JSONResponse(c, http.StatusOK, "success", h.service.ListKeys())
+}
+
+func (h *AuthHandler) GetKey(c *gin.Context) {
+	key, err := h.service.GetKey(c.Param("id"))
+	if err != nil {
+		respondError(c, "API key not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", key)
+}
+
+// CreateKey issues an API key. The response is the only time the key's
+// secret is shown.
+func (h *AuthHandler) CreateKey(c *gin.Context) {
+	var request models.APIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid API key", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var errs utils.ValidationErrors
+	if strings.TrimSpace(request.Name) == "" {
+		errs.Add("name", codeRequired, "is required")
+	}
+	if !services.IsRole(request.Role) {
+		errs.Add("role", codeUnknownValue, "must be viewer, analyst or admin")
+	}
+	if request.CompanyIDs != nil {
+		switch {
+		case len(request.CompanyIDs) == 0:
+			errs.Add("company_ids", codeRequired, "must list at least one company, or be left out for every company")
+		case request.Role == models.RoleAdmin:
+			errs.Add("company_ids", codeConflict, "admin keys cannot be limited to companies")
+		}
+		for i, id := range request.CompanyIDs {
+			if strings.TrimSpace(id) == "" {
+				errs.Add(fmt.Sprintf("company_ids[%d]", i), codeRequired, "must not be empty")
+			}
+		}
+	}
+	if request.Workspaces != nil {
+		switch {
+		case len(request.Workspaces) == 0:
+			errs.Add("workspaces", codeRequired, "must list at least one workspace, or be left out for every workspace")
+		case request.Role == models.RoleAdmin:
+			errs.Add("workspaces", codeConflict, "admin keys cannot be limited to workspaces")
+		}
+		for i, id := range request.Workspaces {
+			if h.workspaces != nil && !h.workspaces.Exists(strings.TrimSpace(id)) {
+				errs.Add(fmt.Sprintf("workspaces[%d]", i), codeNotFound, fmt.Sprintf("unknown workspace %q", id))
+			}
+		}
+	}
+	if len(request.CompanyIDs) > 0 && request.Role != models.RoleAdmin &&
+		!services.CompanyScopeFits(request.CompanyIDs, request.Workspaces) {
+		errs.Add("workspaces", codeRequired, "must list exactly one workspace when the key is limited to companies")
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		errs.Add("expires_at", codeInvalidRange, "must be in the future")
+	}
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid API key", errs...)
+		return
+	}
+
+	key, err := h.service.CreateKey(request, principal(c).Subject)
+	if err != nil {
+		respondError(c, "Failed to create API key", err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/auth/keys/"+key.ID)
+	utils.JSONResponse(c, http.StatusCreated, "API key created", key)
+}
+
+// RevokeKey disables a key. A caller cannot revoke the key they are using,
+// so an admin cannot lock themselves out by mistake.
+func (h *AuthHandler) RevokeKey(c *gin.Context) {
+	if id := c.Param("id"); id == principal(c).KeyID {
+		utils.ErrorResponse(c, http.StatusConflict, "Failed to revoke API key", utils.FieldError{
+			Code:    codeConflict,
+			Message: "cannot revoke the key used for this request",
+		})
+		return
+	}
+
+	key, err := h.service.RevokeKey(c.Param("id"))
+	if err != nil {
+		respondError(c, "Failed to revoke API key", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "API key revoked", key)
+}
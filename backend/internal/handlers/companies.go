@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const codeInvalidMetadata = "invalid_metadata"
+
+type CompanyHandler struct {
+	directory *services.CompanyDirectory
+	segments  *services.DynamicSegmentService
+}
+
+func NewCompanyHandler(directory *services.CompanyDirectory, segments *services.DynamicSegmentService) *CompanyHandler {
+	return &CompanyHandler{directory: directory, segments: segments}
+}
+
+// ListCompanies returns every company with its directory entry and activity
+// aggregates, optionally narrowed down by metadata. Scoped callers only see
+// their own companies.
+func (h *CompanyHandler) ListCompanies(c *gin.Context) {
+	matched := h.directory.MatchCompanies(
+		parseList(c.Query("csm_owners")),
+		parseList(c.Query("plans")),
+		parseList(c.Query("regions")),
+	)
+
+	companies := []models.CompanyAggregate{}
+	for _, aggregate := range h.segments.Companies() {
+		if (matched == nil || matched[aggregate.CompanyID]) && inScope(c, aggregate.CompanyID) {
+			companies = append(companies, aggregate)
+		}
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", companies)
+}
+
+func (h *CompanyHandler) GetCompany(c *gin.Context) {
+	aggregate, err := h.segments.Company(c.Param("id"))
+	if err == nil && !inScope(c, aggregate.CompanyID) {
+		err = outOfScope(aggregate.CompanyID)
+	}
+	if err != nil {
+		respondError(c, "Company not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", aggregate)
+}
+
+// ImportMetadata accepts a CSV file (Content-Type text/csv) or a JSON array
+// of company metadata. mode=replace drops metadata missing from the upload;
+// the default merges it into what is already stored.
+func (h *CompanyHandler) ImportMetadata(c *gin.Context) {
+	mode := strings.ToLower(strings.TrimSpace(c.DefaultQuery("mode", "merge")))
+	if mode != "merge" && mode != "replace" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", utils.FieldError{
+			Field:   "mode",
+			Code:    codeUnknownValue,
+			Message: "must be merge or replace",
+		})
+		return
+	}
+
+	var records []models.CompanyMetadata
+	var err error
+	switch contentType := c.ContentType(); contentType {
+	case "text/csv", "application/csv":
+		records, err = services.ParseCompanyMetadataCSV(c.Request.Body)
+	case "application/json", "":
+		records, err = services.ParseCompanyMetadataJSON(c.Request.Body)
+	default:
+		utils.ErrorResponse(c, http.StatusUnsupportedMediaType, "Unsupported content type", utils.FieldError{
+			Code:    codeUnsupported,
+			Message: "upload text/csv or application/json, got " + contentType,
+		})
+		return
+	}
+	if err != nil {
+		respondError(c, "Invalid company metadata", err)
+		return
+	}
+
+	result, err := h.directory.Import(records, mode == "replace")
+	if err != nil {
+		respondError(c, "Failed to import company metadata", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Company metadata imported", result)
+}
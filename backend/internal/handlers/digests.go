@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	codeInvalidCron  = "invalid_cron"
+	codeInvalidEmail = "invalid_email"
+)
+
+type DigestHandler struct {
+	service *services.DigestService
+}
+
+func NewDigestHandler(service *services.DigestService) *DigestHandler {
+	return &DigestHandler{service: service}
+}
+
+// ListDigests lists digest schedules; scoped callers only see the ones
+// limited to their own companies.
+func (h *DigestHandler) ListDigests(c *gin.Context) {
+	schedules := []models.DigestSchedule{}
+	for _, schedule := range h.service.List() {
+		if coversScope(c, schedule.CompanyIDs) {
+			schedules = append(schedules, schedule)
+		}
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", schedules)
+}
+
+// userDigest looks up a schedule the caller may see. Schedules covering
+// companies outside their scope are reported as not found.
+func (h *DigestHandler) userDigest(c *gin.Context) (models.DigestSchedule, error) {
+	schedule, err := h.service.Get(c.Param("id"))
+	if err == nil && !coversScope(c, schedule.CompanyIDs) {
+		err = fmt.Errorf("digest schedule %s: %w", schedule.ID, services.ErrNotFound)
+	}
+	return schedule, err
+}
+
+func (h *DigestHandler) GetDigest(c *gin.Context) {
+	schedule, err := h.userDigest(c)
+	if err != nil {
+		respondError(c, "Digest schedule not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", schedule)
+}
+
+func (h *DigestHandler) CreateDigest(c *gin.Context) {
+	request, ok := bindDigestRequest(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.Create(request)
+	if err != nil {
+		respondError(c, "Failed to create digest schedule", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusCreated, "Digest schedule created", schedule)
+}
+
+func (h *DigestHandler) UpdateDigest(c *gin.Context) {
+	request, ok := bindDigestRequest(c)
+	if !ok {
+		return
+	}
+	if _, err := h.userDigest(c); err != nil {
+		respondError(c, "Failed to update digest schedule", err)
+		return
+	}
+
+	schedule, err := h.service.Update(c.Param("id"), request)
+	if err != nil {
+		respondError(c, "Failed to update digest schedule", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Digest schedule updated", schedule)
+}
+
+func (h *DigestHandler) DeleteDigest(c *gin.Context) {
+	if _, err := h.userDigest(c); err != nil {
+		respondError(c, "Failed to delete digest schedule", err)
+		return
+	}
+	if err := h.service.Delete(c.Param("id")); err != nil {
+		respondError(c, "Failed to delete digest schedule", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Digest schedule deleted", nil)
+}
+
+// SendDigest sends the digest now, regardless of its schedule.
+func (h *DigestHandler) SendDigest(c *gin.Context) {
+	if _, err := h.userDigest(c); err != nil {
+		respondError(c, "Failed to send digest", err)
+		return
+	}
+	delivery, err := h.service.Send(c.Param("id"))
+	if err != nil {
+		respondError(c, "Failed to send digest", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Digest sent", delivery)
+}
+
+// PreviewDigest renders the digest without sending it. format=html and
+// format=text return the email bodies; the default is the digest as JSON.
+func (h *DigestHandler) PreviewDigest(c *gin.Context) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "json")))
+	if format != "json" && format != "html" && format != "text" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", utils.FieldError{
+			Field:   "format",
+			Code:    codeUnsupported,
+			Message: "must be json, html or text",
+		})
+		return
+	}
+
+	if _, err := h.userDigest(c); err != nil {
+		respondError(c, "Failed to build digest", err)
+		return
+	}
+	digest, err := h.service.Build(c.Param("id"))
+	if err != nil {
+		respondError(c, "Failed to build digest", err)
+		return
+	}
+	if format == "json" {
+		utils.JSONResponse(c, http.StatusOK, "success", digest)
+		return
+	}
+
+	text, html, err := services.RenderDigest(digest)
+	if err != nil {
+		respondError(c, "Failed to render digest", err)
+		return
+	}
+	if format == "html" {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+}
+
+func bindDigestRequest(c *gin.Context) (models.DigestScheduleRequest, bool) {
+	var request models.DigestScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid digest schedule", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return request, false
+	}
+
+	var errs utils.ValidationErrors
+	if strings.TrimSpace(request.Name) == "" {
+		errs.Add("name", codeRequired, "is required")
+	}
+	if strings.TrimSpace(request.Cron) == "" {
+		errs.Add("cron", codeRequired, "is required")
+	} else if _, err := services.ParseCron(request.Cron); err != nil {
+		errs.Add("cron", codeInvalidCron, strings.TrimPrefix(err.Error(), services.ErrInvalidCron.Error()+": "))
+	}
+	if timezone := strings.TrimSpace(request.Timezone); timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			errs.Add("timezone", codeUnknownValue, fmt.Sprintf("unknown time zone %q", timezone))
+		}
+	}
+	if len(request.Recipients) == 0 {
+		errs.Add("recipients", codeRequired, "at least one recipient is required")
+	}
+	for i, recipient := range request.Recipients {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			errs.Add(fmt.Sprintf("recipients[%d]", i), codeInvalidEmail, fmt.Sprintf("%q is not a valid email address", recipient))
+		}
+	}
+	request.CompanyIDs = scopeCompanies(c, "company_ids", request.CompanyIDs, &errs)
+
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid digest schedule", errs...)
+		return request, false
+	}
+	return request, true
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultHistoryLimit = 100
+
+type DynamicSegmentHandler struct {
+	service *services.DynamicSegmentService
+}
+
+func NewDynamicSegmentHandler(service *services.DynamicSegmentService) *DynamicSegmentHandler {
+	return &DynamicSegmentHandler{service: service}
+}
+
+func (h *DynamicSegmentHandler) ListSegments(c *gin.Context) {
+	segments := h.service.List()
+	for i := range segments {
+		segments[i] = scopeSegment(c, segments[i])
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", segments)
+}
+
+// scopeSegment leaves the companies the caller may not see out of a
+// segment's members.
+func scopeSegment(c *gin.Context, segment models.DynamicSegment) models.DynamicSegment {
+	if scope(c) == nil {
+		return segment
+	}
+	members := []string{}
+	for _, companyID := range segment.Members {
+		if inScope(c, companyID) {
+			members = append(members, companyID)
+		}
+	}
+	segment.Members = members
+	return segment
+}
+
+func (h *DynamicSegmentHandler) GetSegment(c *gin.Context) {
+	segment, err := h.service.Get(c.Param("id"))
+	if err != nil {
+		respondError(c, "Dynamic segment not found", err)
+		return
+	}
+
+	members, err := h.service.Members(segment.ID, scope(c))
+	if err != nil {
+		respondError(c, "Dynamic segment not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", gin.H{
+		"segment":   scopeSegment(c, segment),
+		"companies": members,
+	})
+}
+
+func (h *DynamicSegmentHandler) GetSegmentHistory(c *gin.Context) {
+	var errs utils.ValidationErrors
+	limit := defaultHistoryLimit
+	if value := parseIntParam(c.Query("limit"), "limit", &errs); value != nil {
+		if *value < 1 || *value > maxSearchLimit {
+			errs.Add("limit", codeOutOfRange, fmt.Sprintf("must be between 1 and %d", maxSearchLimit))
+		} else {
+			limit = *value
+		}
+	}
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", errs...)
+		return
+	}
+
+	history, err := h.service.History(c.Param("id"), limit, scope(c))
+	if err != nil {
+		respondError(c, "Dynamic segment not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", history)
+}
+
+func (h *DynamicSegmentHandler) CreateSegment(c *gin.Context) {
+	request, ok := bindDynamicSegmentRequest(c)
+	if !ok {
+		return
+	}
+
+	segment, err := h.service.Create(request)
+	if err != nil {
+		respondError(c, "Failed to create dynamic segment", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusCreated, "Dynamic segment created", scopeSegment(c, segment))
+}
+
+// canChangeSegments refuses changes to segments from callers limited to
+// companies, unless they are admins. Segments are shared by every team and
+// such callers only see part of their members.
+func canChangeSegments(c *gin.Context, action string) bool {
+	if scope(c) == nil || principal(c).Role == models.RoleAdmin {
+		return true
+	}
+	utils.ErrorResponse(c, http.StatusForbidden, "Permission denied", utils.FieldError{
+		Code:    codeForbidden,
+		Message: "dynamic segments cannot be " + action + " when limited to companies",
+	})
+	return false
+}
+
+func (h *DynamicSegmentHandler) UpdateSegment(c *gin.Context) {
+	request, ok := bindDynamicSegmentRequest(c)
+	if !ok || !canChangeSegments(c, "updated") {
+		return
+	}
+
+	segment, err := h.service.Update(c.Param("id"), request)
+	if err != nil {
+		respondError(c, "Failed to update dynamic segment", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Dynamic segment updated", scopeSegment(c, segment))
+}
+
+func (h *DynamicSegmentHandler) DeleteSegment(c *gin.Context) {
+	if !canChangeSegments(c, "deleted") {
+		return
+	}
+	if err := h.service.Delete(c.Param("id")); err != nil {
+		respondError(c, "Failed to delete dynamic segment", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Dynamic segment deleted", nil)
+}
+
+func bindDynamicSegmentRequest(c *gin.Context) (models.DynamicSegmentRequest, bool) {
+	var request models.DynamicSegmentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid dynamic segment", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return request, false
+	}
+
+	var errs utils.ValidationErrors
+	if strings.TrimSpace(request.Name) == "" {
+		errs.Add("name", codeRequired, "is required")
+	}
+
+	switch strings.ToLower(strings.TrimSpace(request.Match)) {
+	case "", services.SegmentMatchAll, services.SegmentMatchAny:
+	default:
+		errs.Add("match", codeUnknownValue, "must be all or any")
+	}
+
+	if len(request.Conditions) == 0 {
+		errs.Add("conditions", codeRequired, "at least one condition is required")
+	}
+	for i, condition := range request.Conditions {
+		field := fmt.Sprintf("conditions[%d]", i)
+		if !services.IsSegmentMetric(condition.Metric) {
+			errs.Add(field+".metric", codeUnknownValue, fmt.Sprintf("unknown metric %q; use one of %s",
+				condition.Metric, strings.Join(services.SegmentMetrics(), ", ")))
+		}
+		if !services.IsSegmentOperator(condition.Operator) {
+			errs.Add(field+".op", codeUnknownValue, fmt.Sprintf("unknown operator %q; use >, >=, <, <=, = or !=", condition.Operator))
+		}
+	}
+
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid dynamic segment", errs...)
+		return request, false
+	}
+	return request, true
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetExportAudit lists recorded exports, newest first, filtered by
+// requester, action, format, job_id and start_date..end_date.
+func (h *AnalyticsHandler) GetExportAudit(c *gin.Context) {
+	var errs utils.ValidationErrors
+	query := models.ExportAuditQuery{
+		Requester: strings.TrimSpace(c.Query("requester")),
+		Action:    strings.TrimSpace(c.Query("action")),
+		Format:    strings.ToLower(strings.TrimSpace(c.Query("format"))),
+		JobID:     strings.TrimSpace(c.Query("job_id")),
+		From:      parseDateParam(c.Query("start_date"), "start_date", false, &errs),
+		To:        parseDateParam(c.Query("end_date"), "end_date", true, &errs),
+		Limit:     defaultHistoryLimit,
+	}
+	switch query.Action {
+	case "", models.AuditExport, models.AuditJob, models.AuditDownload:
+	default:
+		errs.Add("action", codeUnknownValue, "must be export, job or download")
+	}
+	if query.From != nil && query.To != nil && query.From.After(*query.To) {
+		errs.Add("end_date", codeInvalidRange, "must not be before start_date")
+	}
+	if value := parseIntParam(c.Query("limit"), "limit", &errs); value != nil {
+		if *value < 1 || *value > maxSearchLimit {
+			errs.Add("limit", codeOutOfRange, fmt.Sprintf("must be between 1 and %d", maxSearchLimit))
+		} else {
+			query.Limit = *value
+		}
+	}
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", errs...)
+		return
+	}
+
+	entries, err := h.audit.Query(query)
+	if err != nil {
+		respondError(c, "Failed to read export audit log", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", entries)
+}
+
+// recordExport adds an entry for the caller to the audit log. Exports that
+// cannot be recorded are refused rather than served unaudited, so on failure
+// the error response has been written and false is returned.
+func (h *AnalyticsHandler) recordExport(c *gin.Context, action string, entry models.ExportAuditEntry) bool {
+	if err := h.audit.Record(callerAuditEntry(c, action, entry)); err != nil {
+		respondError(c, "Export could not be recorded in the audit log", err)
+		return false
+	}
+	return true
+}
+
+// callerAuditEntry fills in the action and who asked for the export.
+func callerAuditEntry(c *gin.Context, action string, entry models.ExportAuditEntry) models.ExportAuditEntry {
+	entry.Action = action
+	entry.Requester = principal(c).Subject
+	entry.KeyID = principal(c).KeyID
+	entry.ClientIP = c.ClientIP()
+	return entry
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	codeNotReady  = "export_not_ready"
+	codeFinished  = "export_finished"
+	codeQueueFull = "export_queue_full"
+)
+
+// ListExports lists the caller's exports; admins see everyone's.
+func (h *AnalyticsHandler) ListExports(c *gin.Context) {
+	jobs := []models.ExportJob{}
+	for _, job := range h.exportJobs.List() {
+		if ownsExport(c, job) {
+			jobs = append(jobs, job)
+		}
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", jobs)
+}
+
+// ownsExport reports whether the caller may see a job: their own, or any
+// job for admins. Jobs are matched by identity rather than subject, since
+// two keys may share a name, and jobs saved before owners were recorded are
+// left to admins. Either way the job must not cover companies outside the
+// caller's scope.
+func ownsExport(c *gin.Context, job models.ExportJob) bool {
+	caller := principal(c)
+	if !coversScope(c, job.Scope) {
+		return false
+	}
+	return caller.Role == models.RoleAdmin || (job.Owner != "" && job.Owner == caller.Identity())
+}
+
+// userExport looks up a job the caller may see. Other people's jobs are
+// reported as not found rather than forbidden, so their IDs are not
+// confirmed.
+func (h *AnalyticsHandler) userExport(c *gin.Context) (models.ExportJob, error) {
+	job, err := h.exportJobs.Get(c.Param("id"))
+	if err == nil && !ownsExport(c, job) {
+		err = fmt.Errorf("export %s: %w", job.ID, services.ErrNotFound)
+	}
+	return job, err
+}
+
+// CreateExport queues an export job; poll GetExport for progress and fetch
+// the file from DownloadExport once it has completed.
+func (h *AnalyticsHandler) CreateExport(c *gin.Context) {
+	request, ok := h.bindExportRequest(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.exportJobs.Create(request, principal(c), c.ClientIP(), h.redaction(c, services.RedactExport).Name())
+	if err != nil {
+		respondExportError(c, "Failed to create export", err)
+		return
+	}
+
+	// Relative to the request, as it may have been made in a workspace
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+job.ID)
+	utils.JSONResponse(c, http.StatusAccepted, "Export queued", job)
+}
+
+func (h *AnalyticsHandler) GetExport(c *gin.Context) {
+	job, err := h.userExport(c)
+	if err != nil {
+		respondError(c, "Export not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", job)
+}
+
+func (h *AnalyticsHandler) DownloadExport(c *gin.Context) {
+	if _, err := h.userExport(c); err != nil {
+		respondError(c, "Export not available", err)
+		return
+	}
+	job, path, err := h.exportJobs.File(c.Param("id"))
+	if err != nil {
+		respondExportError(c, "Export not available", err)
+		return
+	}
+	if !h.recordExport(c, models.AuditDownload, job.AuditEntry()) {
+		return
+	}
+
+	c.Header("Content-Type", job.ContentType)
+	c.FileAttachment(path, job.Filename)
+}
+
+func (h *AnalyticsHandler) CancelExport(c *gin.Context) {
+	if _, err := h.userExport(c); err != nil {
+		respondError(c, "Failed to cancel export", err)
+		return
+	}
+	job, err := h.exportJobs.Cancel(c.Param("id"))
+	if err != nil {
+		respondExportError(c, "Failed to cancel export", err)
+		return
+	}
+
+	message := "Export cancelled"
+	if job.Status == models.ExportRunning {
+		message = "Export cancellation requested"
+	}
+	utils.JSONResponse(c, http.StatusOK, message, job)
+}
+
+func (h *AnalyticsHandler) DeleteExport(c *gin.Context) {
+	if _, err := h.userExport(c); err != nil {
+		respondError(c, "Failed to delete export", err)
+		return
+	}
+	if err := h.exportJobs.Delete(c.Param("id")); err != nil {
+		respondError(c, "Failed to delete export", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Export deleted", nil)
+}
+
+// respondExportError reports job state conflicts as 409s and a full queue as
+// a 503, deferring to respondError for everything else.
+func respondExportError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrExportNotReady):
+		utils.ErrorResponse(c, http.StatusConflict, message, utils.FieldError{Code: codeNotReady, Message: err.Error()})
+	case errors.Is(err, services.ErrExportFinished):
+		utils.ErrorResponse(c, http.StatusConflict, message, utils.FieldError{Code: codeFinished, Message: err.Error()})
+	case errors.Is(err, services.ErrExportQueueFull):
+		utils.ErrorResponse(c, http.StatusServiceUnavailable, message, utils.FieldError{Code: codeQueueFull, Message: err.Error()})
+	default:
+		respondError(c, message, err)
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleKey is the context key holding the caller's role, set by
+// Authenticate.
+const roleKey = "role"
+
+// codeRedacted marks filters that would search content the caller's
+// redaction policy hides.
+const codeRedacted = "redacted"
+
+// redaction returns the policy that applies to this request and names it in
+// the X-Redaction-Policy response header.
+func (h *AnalyticsHandler) redaction(c *gin.Context, endpoint string) *services.Redaction {
+	redaction := h.redactor.For(endpoint, c.GetString(roleKey))
+	c.Header("X-Redaction-Policy", redaction.Name())
+	return redaction
+}
+
+// GetRedactionConfig describes the redaction policies and where they apply.
+func (h *AnalyticsHandler) GetRedactionConfig(c *gin.Context) {
+	utils.JSONResponse(c, http.StatusOK, "success", h.redactor.Config())
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCompanyReport renders the account review of a company for
+// start_date..end_date (by default the 90 days up to the latest data).
+// format=html (the default) and format=pdf return files to download;
+// format=json returns the underlying figures.
+func (h *AnalyticsHandler) GetCompanyReport(c *gin.Context) {
+	var errs utils.ValidationErrors
+	from := parseDateParam(c.Query("start_date"), "start_date", false, &errs)
+	to := parseDateParam(c.Query("end_date"), "end_date", true, &errs)
+	if from != nil && to != nil && from.After(*to) {
+		errs.Add("end_date", codeInvalidRange, "must not be before start_date")
+	}
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "html")))
+	if format != "html" && format != "pdf" && format != "json" {
+		errs.Add("format", codeUnsupported, "must be html, pdf or json")
+	}
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid parameters", errs...)
+		return
+	}
+
+	if !inScope(c, c.Param("id")) {
+		respondError(c, "Report failed", outOfScope(c.Param("id")))
+		return
+	}
+
+	report, err := h.service.CompanyReport(c.Param("id"), from, to)
+	if err != nil {
+		respondError(c, "Report failed", err)
+		return
+	}
+	h.redaction(c, services.RedactReport).Report(report)
+	if format == "json" {
+		utils.JSONResponse(c, http.StatusOK, "success", report)
+		return
+	}
+
+	var body []byte
+	contentType := "text/html; charset=utf-8"
+	if format == "pdf" {
+		body, err = services.RenderReportPDF(report)
+		contentType = "application/pdf"
+	} else {
+		body, err = services.RenderReportHTML(report)
+	}
+	if err != nil {
+		respondError(c, "Failed to render report", err)
+		return
+	}
+
+	name := report.Company.Name
+	if name == "" {
+		name = report.Company.ID
+	}
+	filename := fmt.Sprintf("%s_report_%s_%s.%s", reportSlug(name), report.From.Format("20060102"), report.To.Format("20060102"), format)
+	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// reportSlug makes a company name safe for a file name.
+func reportSlug(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, name)
+	return strings.Trim(slug, "_")
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSavedSearches lists saved searches; scoped callers only see the ones
+// limited to their own companies.
+func (h *AnalyticsHandler) ListSavedSearches(c *gin.Context) {
+	searches := []models.SavedSearch{}
+	for _, search := range h.savedSearches.List() {
+		if coversScope(c, search.Filters.CompanyIDs) {
+			searches = append(searches, search)
+		}
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", searches)
+}
+
+// userSavedSearch looks up a saved search the caller may see. Searches
+// covering companies outside their scope are reported as not found.
+func (h *AnalyticsHandler) userSavedSearch(c *gin.Context, id string) (models.SavedSearch, error) {
+	search, err := h.savedSearches.Get(id)
+	if err == nil && !coversScope(c, search.Filters.CompanyIDs) {
+		err = fmt.Errorf("saved search %s: %w", search.ID, services.ErrNotFound)
+	}
+	return search, err
+}
+
+// canChangeSavedSearch only lets the owner of a saved search, or an admin,
+// change it. Searches saved before owners were recorded are left to admins.
+func canChangeSavedSearch(c *gin.Context, search models.SavedSearch, action string) bool {
+	caller := principal(c)
+	if caller.Role == models.RoleAdmin || (search.Owner != "" && search.Owner == caller.Identity()) {
+		return true
+	}
+	utils.ErrorResponse(c, http.StatusForbidden, "Permission denied", utils.FieldError{
+		Code:    codeForbidden,
+		Message: "only its owner or an admin may " + action + " a saved search",
+	})
+	return false
+}
+
+func (h *AnalyticsHandler) GetSavedSearch(c *gin.Context) {
+	search, err := h.userSavedSearch(c, c.Param("id"))
+	if err != nil {
+		respondError(c, "Saved search not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", search)
+}
+
+func (h *AnalyticsHandler) CreateSavedSearch(c *gin.Context) {
+	request, ok := h.bindSavedSearchRequest(c)
+	if !ok {
+		return
+	}
+
+	search, err := h.savedSearches.Create(request, principal(c).Identity())
+	if err != nil {
+		respondError(c, "Failed to save search", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusCreated, "Saved search created", search)
+}
+
+func (h *AnalyticsHandler) UpdateSavedSearch(c *gin.Context) {
+	request, ok := h.bindSavedSearchRequest(c)
+	if !ok {
+		return
+	}
+	previous, err := h.userSavedSearch(c, c.Param("id"))
+	if err != nil {
+		respondError(c, "Failed to update saved search", err)
+		return
+	}
+	if !canChangeSavedSearch(c, previous, "update") {
+		return
+	}
+
+	search, err := h.savedSearches.Update(c.Param("id"), request)
+	if err != nil {
+		respondError(c, "Failed to update saved search", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Saved search updated", search)
+}
+
+func (h *AnalyticsHandler) DeleteSavedSearch(c *gin.Context) {
+	search, err := h.userSavedSearch(c, c.Param("id"))
+	if err != nil {
+		respondError(c, "Failed to delete saved search", err)
+		return
+	}
+	if !canChangeSavedSearch(c, search, "delete") {
+		return
+	}
+	if err := h.savedSearches.Delete(c.Param("id")); err != nil {
+		respondError(c, "Failed to delete saved search", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Saved search deleted", nil)
+}
+
+func (h *AnalyticsHandler) bindSavedSearchRequest(c *gin.Context) (models.SavedSearchRequest, bool) {
+	var request models.SavedSearchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid saved search", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return request, false
+	}
+
+	var errs utils.ValidationErrors
+	if strings.TrimSpace(request.Name) == "" {
+		errs.Add("name", codeRequired, "is required")
+	}
+	if request.Query != "" {
+		if err := validateQuery(request.Query); err != nil {
+			errs = append(errs, queryFieldError("query", err))
+		}
+	}
+	errs = append(errs, h.validateFilters(request.Filters, "filters.")...)
+	request.Filters.CompanyIDs = scopeCompanies(c, "filters.company_ids", request.Filters.CompanyIDs, &errs)
+
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid saved search", errs...)
+		return request, false
+	}
+	return request, true
+}
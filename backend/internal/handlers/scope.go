@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scope returns the companies the caller is limited to, or nil when they may
+// see every company.
+func scope(c *gin.Context) []string {
+	if ids := principal(c).CompanyIDs; len(ids) > 0 {
+		return ids
+	}
+	return nil
+}
+
+// inScope reports whether the caller may see a company's data.
+func inScope(c *gin.Context, companyID string) bool {
+	ids := scope(c)
+	if ids == nil {
+		return true
+	}
+	for _, id := range ids {
+		if id == companyID {
+			return true
+		}
+	}
+	return false
+}
+
+// outOfScope is the error for a company the caller may not see. It reads as
+// not found, like a company that does not exist, so IDs cannot be probed.
+func outOfScope(companyID string) error {
+	return fmt.Errorf("company %s: %w", companyID, services.ErrNotFound)
+}
+
+// coversScope reports whether the caller may see a resource covering
+// companyIDs, where none means every company. Scoped callers only see
+// resources limited to companies in their scope.
+func coversScope(c *gin.Context, companyIDs []string) bool {
+	if scope(c) == nil {
+		return true
+	}
+	if len(companyIDs) == 0 {
+		return false
+	}
+	for _, id := range companyIDs {
+		if !inScope(c, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// scopeCompanies checks the companies a caller wants a resource to cover,
+// such as an alert rule or a digest, against their scope. Scoped callers
+// may only name companies in it, and naming none means all of them rather
+// than every company.
+func scopeCompanies(c *gin.Context, field string, companyIDs []string, errs *utils.ValidationErrors) []string {
+	if scope(c) == nil {
+		return companyIDs
+	}
+	if len(companyIDs) == 0 {
+		return append([]string(nil), scope(c)...)
+	}
+	for i, id := range companyIDs {
+		if !inScope(c, strings.TrimSpace(id)) {
+			errs.Add(fmt.Sprintf("%s[%d]", field, i), codeNotFound, fmt.Sprintf("unknown company %q", id))
+		}
+	}
+	return companyIDs
+}
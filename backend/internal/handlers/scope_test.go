@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	companyA = "0196217a-30d6-77e9-be9e-75b799fb4297"
+	companyB = "0196217c-c242-751f-9252-5029f7abc91e"
+	companyC = "081e763c-822b-41ed-b1a1-e23a9e2e8c7a"
+
+	testJWTSecret = "scope-test-secret"
+)
+
+// eventsPerCompany is how many events the test dataset has for each company.
+var eventsPerCompany = map[string]int{companyA: 5, companyB: 7, companyC: 3}
+
+type scopeTestServer struct {
+	t      *testing.T
+	router *gin.Engine
+	auth   *services.AuthService
+}
+
+// newScopeTestServer serves the analytics routes over a small dataset of
+// three companies, wired up like a workspace in main.
+func newScopeTestServer(t *testing.T) *scopeTestServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	data := filepath.Join(dir, "data")
+	if err := os.Mkdir(data, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "created_at", "company_id", "type", "content", "attribute", "updated_at", "original_timestamp", "value"})
+	day := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, company := range []string{companyA, companyB, companyC} {
+		for i := 0; i < eventsPerCompany[company]; i++ {
+			at := day.AddDate(0, 0, i).Format(time.RFC3339)
+			content := fmt.Sprintf("User active CMMS - user%d@%s.example.com /work-orders/%d", i, company[:8], i)
+			w.Write([]string{fmt.Sprintf("%s-%d", company[:8], i), at, company, "Action", content, "UserActiveCMMS", at, at, "null"})
+		}
+	}
+	w.Flush()
+	if err := os.WriteFile(filepath.Join(data, "assembly-takehome1.shortened.csv"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	state := filepath.Join(dir, "state")
+	directory, err := services.NewCompanyDirectory(filepath.Join(state, "company_metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations, err := services.NewAnnotationService(filepath.Join(state, "annotations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	analytics := services.NewAnalyticsService(directory, annotations)
+	if err := analytics.Initialize(data); err != nil {
+		t.Fatal(err)
+	}
+	savedSearches, err := services.NewSavedSearchService(filepath.Join(state, "saved_searches.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor, err := services.NewRedactor(filepath.Join(state, "redaction.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := services.NewExportAuditLog(filepath.Join(state, "export_audit.log"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportJobs, err := services.NewExportJobService(filepath.Join(state, "exports"), time.Hour, analytics, audit, redactor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, err := services.NewDynamicSegmentService(filepath.Join(state, "dynamic_segments.json"), filepath.Join(state, "segment_history.json"), directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	go exportJobs.Run(ctx, 1)
+	t.Cleanup(stop)
+
+	auth, err := services.NewAuthService(filepath.Join(state, "api_keys.json"), services.JWTConfig{Secret: []byte(testJWTSecret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authHandler := NewAuthHandler(auth)
+	analyticsHandler := NewAnalyticsHandler(analytics, savedSearches, exportJobs, audit, redactor)
+	segmentHandler := NewDynamicSegmentHandler(segments)
+
+	router := gin.New()
+	router.Use(LimitBody(1 << 20))
+	viewer := router.Group("/api/v1", authHandler.Authenticate, Require(models.RoleViewer))
+	analyst := router.Group("/api/v1", authHandler.Authenticate, Require(models.RoleAnalyst))
+	admin := router.Group("/api/v1", authHandler.Authenticate, Require(models.RoleAdmin))
+	admin.POST("/auth/keys", authHandler.CreateKey)
+	viewer.GET("/dashboard/summary", analyticsHandler.GetDashboardSummary)
+	viewer.GET("/events/search", analyticsHandler.SearchEvents)
+	viewer.GET("/companies/:id/timeline", analyticsHandler.GetCompanyTimeline)
+	analyst.POST("/export", analyticsHandler.ExportData)
+	analyst.GET("/exports", analyticsHandler.ListExports)
+	analyst.POST("/exports", analyticsHandler.CreateExport)
+	analyst.GET("/exports/:id", analyticsHandler.GetExport)
+	analyst.GET("/exports/:id/download", analyticsHandler.DownloadExport)
+	viewer.GET("/segments", analyticsHandler.ListSavedSearches)
+	analyst.POST("/segments", analyticsHandler.CreateSavedSearch)
+	viewer.GET("/segments/:id", analyticsHandler.GetSavedSearch)
+	analyst.PUT("/segments/:id", analyticsHandler.UpdateSavedSearch)
+	analyst.DELETE("/segments/:id", analyticsHandler.DeleteSavedSearch)
+	viewer.GET("/dynamic-segments", segmentHandler.ListSegments)
+	analyst.POST("/dynamic-segments", segmentHandler.CreateSegment)
+	analyst.PUT("/dynamic-segments/:id", segmentHandler.UpdateSegment)
+	analyst.DELETE("/dynamic-segments/:id", segmentHandler.DeleteSegment)
+
+	return &scopeTestServer{t: t, router: router, auth: auth}
+}
+
+// key creates an API key and returns its secret. Keys limited to companies
+// are limited to the default workspace too, as they must be.
+func (s *scopeTestServer) key(name, role string, companyIDs ...string) string {
+	s.t.Helper()
+	request := models.APIKeyRequest{Name: name, Role: role, CompanyIDs: companyIDs}
+	if len(companyIDs) > 0 {
+		request.Workspaces = []string{models.DefaultWorkspace}
+	}
+	key, err := s.auth.CreateKey(request, "")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return key.Key
+}
+
+// token signs an HS256 token for subject.
+func (s *scopeTestServer) token(subject, role string) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." +
+		encode(map[string]interface{}{"sub": subject, "role": role, "exp": time.Now().Add(time.Hour).Unix()})
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// do sends a request and returns the status and body.
+func (s *scopeTestServer) do(credential, method, path string, body interface{}) (int, []byte) {
+	s.t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+credential)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.Bytes()
+}
+
+// data sends a request that must succeed and decodes its data into v.
+func (s *scopeTestServer) data(credential, method, path string, body, v interface{}) {
+	s.t.Helper()
+	status, response := s.do(credential, method, path, body)
+	if status >= 300 {
+		s.t.Fatalf("%s %s: status %d: %s", method, path, status, response)
+	}
+	envelope := struct{ Data interface{} }{Data: v}
+	if err := json.Unmarshal(response, &envelope); err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+}
+
+// waitForExport polls a job until it has finished.
+func (s *scopeTestServer) waitForExport(credential, id string) models.ExportJob {
+	s.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var job models.ExportJob
+		s.data(credential, http.MethodGet, "/api/v1/exports/"+id, nil, &job)
+		if job.Finished() {
+			if job.Status != models.ExportCompleted {
+				s.t.Fatalf("export %s %s: %s", id, job.Status, job.Error)
+			}
+			return job
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("export %s still %s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// csvCompanies returns the company IDs of the rows in a CSV export.
+func csvCompanies(t *testing.T, data []byte) map[string]int {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil || len(records) == 0 {
+		t.Fatalf("bad CSV export (%v): %s", err, data)
+	}
+	column := -1
+	for i, name := range records[0] {
+		if strings.EqualFold(name, "company id") || name == "company_id" {
+			column = i
+		}
+	}
+	if column < 0 {
+		t.Fatalf("no company column in %v", records[0])
+	}
+	companies := make(map[string]int)
+	for _, record := range records[1:] {
+		companies[record[column]]++
+	}
+	return companies
+}
+
+func TestScopedPrincipalsOnlySeeTheirCompanies(t *testing.T) {
+	s := newScopeTestServer(t)
+	scoped := s.key("team-a", models.RoleAnalyst, companyA)
+	want := eventsPerCompany[companyA]
+
+	var results models.FilteredResults
+	s.data(scoped, http.MethodGet, "/api/v1/events/search?facets=company_id,type&limit=100", nil, &results)
+	if results.FilteredCount != want || results.TotalCount != want {
+		t.Errorf("search: %d of %d events, want %d of %d", results.FilteredCount, results.TotalCount, want, want)
+	}
+	for _, event := range results.Events {
+		if event.CompanyID != companyA {
+			t.Errorf("search returned an event of %s", event.CompanyID)
+		}
+	}
+	if facet := results.Facets["company_id"]; len(facet) != 1 || facet[0].Value != companyA || facet[0].Count != want {
+		t.Errorf("company facet %+v, want only %s", facet, companyA)
+	}
+	if facet := results.Facets["type"]; len(facet) != 1 || facet[0].Count != want {
+		t.Errorf("type facet %+v counts events of other companies", facet)
+	}
+
+	// Asking for another company by filter or query finds nothing
+	for _, query := range []string{"company_ids=" + companyB, "q=company:" + companyB, "search=" + companyB[:8]} {
+		var results models.FilteredResults
+		s.data(scoped, http.MethodGet, "/api/v1/events/search?"+query, nil, &results)
+		if results.FilteredCount != 0 {
+			t.Errorf("search %s: found %d events", query, results.FilteredCount)
+		}
+	}
+
+	var summary models.DashboardSummary
+	s.data(scoped, http.MethodGet, "/api/v1/dashboard/summary", nil, &summary)
+	if summary.TotalEvents != want || summary.UniqueCompanies != 1 {
+		t.Errorf("summary: %d events of %d companies, want %d of 1", summary.TotalEvents, summary.UniqueCompanies, want)
+	}
+	if companies := summary.AvailableFilters.Companies; len(companies) != 1 || companies[0] != companyA {
+		t.Errorf("summary offers companies %v", companies)
+	}
+	for _, event := range summary.RecentEvents {
+		if event.CompanyID != companyA {
+			t.Errorf("summary shows a recent event of %s", event.CompanyID)
+		}
+	}
+
+	var timeline models.CompanyTimeline
+	s.data(scoped, http.MethodGet, "/api/v1/companies/"+companyA+"/timeline", nil, &timeline)
+	if timeline.TotalEvents != want {
+		t.Errorf("own timeline: %d events, want %d", timeline.TotalEvents, want)
+	}
+	if status, _ := s.do(scoped, http.MethodGet, "/api/v1/companies/"+companyB+"/timeline", nil); status != http.StatusNotFound {
+		t.Errorf("timeline of another company: status %d, want 404", status)
+	}
+
+	request := models.ExportRequest{Format: "csv", Filters: models.FilterParams{CompanyIDs: []string{companyA, companyB}}}
+	status, body := s.do(scoped, http.MethodPost, "/api/v1/export", request)
+	if status != http.StatusOK {
+		t.Fatalf("export: status %d: %s", status, body)
+	}
+	if companies := csvCompanies(t, body); len(companies) != 1 || companies[companyA] != want {
+		t.Errorf("export rows by company %v, want %d of %s only", companies, want, companyA)
+	}
+
+	var job models.ExportJob
+	s.data(scoped, http.MethodPost, "/api/v1/exports", request, &job)
+	s.waitForExport(scoped, job.ID)
+	status, body = s.do(scoped, http.MethodGet, "/api/v1/exports/"+job.ID+"/download", nil)
+	if status != http.StatusOK {
+		t.Fatalf("export job download: status %d: %s", status, body)
+	}
+	if companies := csvCompanies(t, body); len(companies) != 1 || companies[companyA] != want {
+		t.Errorf("export job rows by company %v, want %d of %s only", companies, want, companyA)
+	}
+}
+
+func TestExportJobsStayWithTheirOwner(t *testing.T) {
+	s := newScopeTestServer(t)
+
+	// Keys and tokens can share a subject; none of them may use another's job
+	owner := s.key("reports", models.RoleAnalyst)
+	sameName := s.key("reports", models.RoleAnalyst, companyA)
+	sameNameUnscoped := s.key("reports", models.RoleAnalyst)
+	sameSubject := s.token("reports", models.RoleAnalyst)
+	admin := s.key("admin", models.RoleAdmin)
+	scopedAdmin := s.key("admin-a", models.RoleAdmin, companyA)
+
+	var job models.ExportJob
+	s.data(owner, http.MethodPost, "/api/v1/exports", models.ExportRequest{Format: "csv"}, &job)
+	s.waitForExport(owner, job.ID)
+
+	for name, credential := range map[string]string{"owner": owner, "admin": admin} {
+		if status, _ := s.do(credential, http.MethodGet, "/api/v1/exports/"+job.ID+"/download", nil); status != http.StatusOK {
+			t.Errorf("%s download: status %d, want 200", name, status)
+		}
+	}
+
+	others := map[string]string{
+		"scoped key with the same name":   sameName,
+		"unscoped key with the same name": sameNameUnscoped,
+		"token with the same subject":     sameSubject,
+		"admin limited to one company":    scopedAdmin,
+	}
+	for name, credential := range others {
+		for _, path := range []string{"/api/v1/exports/" + job.ID, "/api/v1/exports/" + job.ID + "/download"} {
+			if status, _ := s.do(credential, http.MethodGet, path, nil); status != http.StatusNotFound {
+				t.Errorf("%s: GET %s status %d, want 404", name, path, status)
+			}
+		}
+		var jobs []models.ExportJob
+		s.data(credential, http.MethodGet, "/api/v1/exports", nil, &jobs)
+		if len(jobs) != 0 {
+			t.Errorf("%s: lists %d exports, want none", name, len(jobs))
+		}
+	}
+
+	// A scoped admin still sees jobs limited to companies in their scope
+	var scopedJob models.ExportJob
+	s.data(sameName, http.MethodPost, "/api/v1/exports", models.ExportRequest{Format: "csv"}, &scopedJob)
+	s.waitForExport(sameName, scopedJob.ID)
+	if status, _ := s.do(scopedAdmin, http.MethodGet, "/api/v1/exports/"+scopedJob.ID, nil); status != http.StatusOK {
+		t.Errorf("scoped admin, job within their scope: status %d, want 200", status)
+	}
+}
+
+func TestCompanyScopedKeysNeedOneWorkspace(t *testing.T) {
+	s := newScopeTestServer(t)
+	admin := s.key("admin", models.RoleAdmin)
+
+	tests := []struct {
+		name       string
+		workspaces []string
+		status     int
+	}{
+		{"every workspace", nil, http.StatusBadRequest},
+		{"two workspaces", []string{models.DefaultWorkspace, "other"}, http.StatusBadRequest},
+		{"one workspace", []string{models.DefaultWorkspace}, http.StatusCreated},
+	}
+	for _, test := range tests {
+		request := models.APIKeyRequest{Name: "team-a", Role: models.RoleViewer, CompanyIDs: []string{"A"}, Workspaces: test.workspaces}
+		if status, body := s.do(admin, http.MethodPost, "/api/v1/auth/keys", request); status != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, status, test.status, body)
+		}
+	}
+}
+
+func TestRequestBodiesAreLimited(t *testing.T) {
+	s := newScopeTestServer(t)
+	analyst := s.key("analyst", models.RoleAnalyst)
+
+	query := strings.Repeat("(", 2<<20) + "a" + strings.Repeat(")", 2<<20)
+	request := models.ExportRequest{Format: "csv", Filters: models.FilterParams{Query: query}}
+	if status, body := s.do(analyst, http.MethodPost, "/api/v1/export", request); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: status %d, want 413: %.200s", status, body)
+	}
+
+	// Within the body limit, the query limits still apply
+	request.Filters.Query = strings.Repeat("(", 100) + "a" + strings.Repeat(")", 100)
+	if status, body := s.do(analyst, http.MethodPost, "/api/v1/exports", request); status != http.StatusBadRequest || !strings.Contains(string(body), codeInvalidQuery) {
+		t.Errorf("deeply nested query: status %d, want 400 %s: %s", status, codeInvalidQuery, body)
+	}
+}
+
+func TestScopedPrincipalsCannotChangeSharedSegments(t *testing.T) {
+	s := newScopeTestServer(t)
+	analyst := s.key("analyst", models.RoleAnalyst)
+	scoped := s.key("team-a", models.RoleAnalyst, companyA)
+	scopedAdmin := s.key("admin-a", models.RoleAdmin, companyA)
+
+	request := models.DynamicSegmentRequest{
+		Name:       "Busy",
+		Conditions: []models.SegmentCondition{{Metric: "events_last_7_days", Operator: ">=", Value: 0}},
+	}
+	var segment models.DynamicSegment
+	s.data(analyst, http.MethodPost, "/api/v1/dynamic-segments", request, &segment)
+
+	request.Name = "Renamed"
+	path := "/api/v1/dynamic-segments/" + segment.ID
+	if status, _ := s.do(scoped, http.MethodPut, path, request); status != http.StatusForbidden {
+		t.Errorf("scoped analyst update: status %d, want 403", status)
+	}
+	if status, _ := s.do(scoped, http.MethodDelete, path, nil); status != http.StatusForbidden {
+		t.Errorf("scoped analyst delete: status %d, want 403", status)
+	}
+	var segments []models.DynamicSegment
+	s.data(analyst, http.MethodGet, "/api/v1/dynamic-segments", nil, &segments)
+	if len(segments) != 1 || segments[0].Name != "Busy" {
+		t.Fatalf("segments after refused changes: %+v", segments)
+	}
+
+	s.data(scopedAdmin, http.MethodPut, path, request, &segment)
+	if segment.Name != "Renamed" {
+		t.Errorf("scoped admin update: name %q", segment.Name)
+	}
+	if status, _ := s.do(analyst, http.MethodDelete, path, nil); status != http.StatusOK {
+		t.Errorf("unscoped analyst delete: status %d, want 200", status)
+	}
+}
+
+func TestFailedAuthenticationIsNotExplained(t *testing.T) {
+	s := newScopeTestServer(t)
+	token := s.token("jane", models.RoleViewer)
+	forged := token[:strings.LastIndex(token, ".")+1] + base64.RawURLEncoding.EncodeToString([]byte("not the signature"))
+
+	// However a credential fails, callers get the same answer
+	var want string
+	for _, credential := range []string{"", "ak_unknown", forged, token + "x"} {
+		status, body := s.do(credential, http.MethodGet, "/api/v1/dashboard/summary", nil)
+		if status != http.StatusUnauthorized {
+			t.Errorf("%q: status %d, want 401: %s", credential, status, body)
+		}
+		if want == "" {
+			want = string(body)
+		}
+		if string(body) != want || strings.Contains(string(body), "signature") {
+			t.Errorf("%q: response %s, want %s", credential, body, want)
+		}
+	}
+	if status, _ := s.do(token, http.MethodGet, "/api/v1/dashboard/summary", nil); status != http.StatusOK {
+		t.Errorf("valid token: status %d, want 200", status)
+	}
+}
+
+func TestSavedSearchesBelongToTheirCreator(t *testing.T) {
+	s := newScopeTestServer(t)
+	owner := s.token("jane", models.RoleAnalyst)
+	analyst := s.key("analyst", models.RoleAnalyst)
+	admin := s.key("admin", models.RoleAdmin)
+
+	// The owner is whoever saves the search, whatever the body says
+	var search models.SavedSearch
+	s.data(owner, http.MethodPost, "/api/v1/segments", map[string]interface{}{"name": "Mine", "owner": "api_key:someone-else"}, &search)
+	if search.Owner != "jwt:jane" {
+		t.Fatalf("owner %q, want jwt:jane", search.Owner)
+	}
+
+	path := "/api/v1/segments/" + search.ID
+	if status, _ := s.do(analyst, http.MethodPut, path, map[string]interface{}{"name": "Taken", "owner": "api_key:someone-else"}); status != http.StatusForbidden {
+		t.Errorf("other analyst update: status %d, want 403", status)
+	}
+	if status, _ := s.do(analyst, http.MethodDelete, path, nil); status != http.StatusForbidden {
+		t.Errorf("other analyst delete: status %d, want 403", status)
+	}
+
+	// Admins may change anyone's search, which stays with its owner
+	s.data(admin, http.MethodPut, path, map[string]interface{}{"name": "Renamed", "owner": "api_key:someone-else"}, &search)
+	if search.Name != "Renamed" || search.Owner != "jwt:jane" {
+		t.Errorf("admin update gave %+v", search)
+	}
+	s.data(owner, http.MethodPut, path, map[string]interface{}{"name": "Mine again"}, &search)
+	if search.Name != "Mine again" {
+		t.Errorf("owner update gave %+v", search)
+	}
+	if status, body := s.do(owner, http.MethodDelete, path, nil); status != http.StatusOK {
+		t.Errorf("owner delete: status %d, want 200: %s", status, body)
+	}
+}
+
+func TestScopedPrincipalsOnlySeeTheirSavedSearches(t *testing.T) {
+	s := newScopeTestServer(t)
+	analyst := s.key("analyst", models.RoleAnalyst)
+	scoped := s.key("team-a", models.RoleAnalyst, companyA)
+
+	var everyone, teamB, teamA models.SavedSearch
+	s.data(analyst, http.MethodPost, "/api/v1/segments", models.SavedSearchRequest{Name: "Everyone"}, &everyone)
+	s.data(analyst, http.MethodPost, "/api/v1/segments", models.SavedSearchRequest{Name: "Team B", Filters: models.FilterParams{CompanyIDs: []string{companyB}}}, &teamB)
+
+	// A scoped caller's search is limited to their companies
+	s.data(scoped, http.MethodPost, "/api/v1/segments", models.SavedSearchRequest{Name: "Team A"}, &teamA)
+	if len(teamA.Filters.CompanyIDs) != 1 || teamA.Filters.CompanyIDs[0] != companyA {
+		t.Errorf("scoped search covers %v, want %s", teamA.Filters.CompanyIDs, companyA)
+	}
+	request := models.SavedSearchRequest{Name: "Spying", Filters: models.FilterParams{CompanyIDs: []string{companyB}}}
+	if status, body := s.do(scoped, http.MethodPost, "/api/v1/segments", request); status != http.StatusBadRequest {
+		t.Errorf("scoped search of another company: status %d, want 400: %s", status, body)
+	}
+
+	var searches []models.SavedSearch
+	s.data(scoped, http.MethodGet, "/api/v1/segments", nil, &searches)
+	if len(searches) != 1 || searches[0].ID != teamA.ID {
+		t.Errorf("scoped list %+v, want only %s", searches, teamA.Name)
+	}
+	s.data(analyst, http.MethodGet, "/api/v1/segments", nil, &searches)
+	if len(searches) != 3 {
+		t.Errorf("unscoped list has %d searches, want 3", len(searches))
+	}
+
+	// Searches covering other companies, or every company, read as missing
+	for _, search := range []models.SavedSearch{everyone, teamB} {
+		if status, _ := s.do(scoped, http.MethodGet, "/api/v1/segments/"+search.ID, nil); status != http.StatusNotFound {
+			t.Errorf("scoped get of %s: status %d, want 404", search.Name, status)
+		}
+		if status, _ := s.do(scoped, http.MethodGet, "/api/v1/events/search?segment_id="+search.ID, nil); status != http.StatusNotFound {
+			t.Errorf("scoped search with %s: status %d, want 404", search.Name, status)
+		}
+		if status, _ := s.do(scoped, http.MethodDelete, "/api/v1/segments/"+search.ID, nil); status != http.StatusNotFound {
+			t.Errorf("scoped delete of %s: status %d, want 404", search.Name, status)
+		}
+	}
+	if status, body := s.do(scoped, http.MethodGet, "/api/v1/events/search?segment_id="+teamA.ID, nil); status != http.StatusOK {
+		t.Errorf("scoped search with their own segment: status %d: %s", status, body)
+	}
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+)
+
+// Error codes returned in FieldError.Code for malformed query parameters.
+// Codes specific to one resource live next to its handler.
+const (
+	codeInvalidDate    = "invalid_date"
+	codeInvalidRange   = "invalid_range"
+	codeInvalidInteger = "invalid_integer"
+	codeInvalidNumber  = "invalid_number"
+	codeInvalidBoolean = "invalid_boolean"
+	codeOutOfRange     = "out_of_range"
+	codeUnknownValue   = "unknown_value"
+	codeInvalidSort    = "invalid_sort"
+	codeInvalidCursor  = "invalid_cursor"
+	codeStaleCursor    = "stale_cursor"
+	codeInvalidQuery   = "invalid_query"
+	codeInvalidFacet   = "invalid_facet"
+	codeInvalidFilter  = "invalid_filter"
+	codeUnsupported    = "unsupported_format"
+)
+
+// Error codes shared by every handler.
+const (
+	codeInvalidJSON = "invalid_json"
+	codeRequired    = "required"
+	codeConflict    = "conflicting_parameters"
+	codeNotFound    = "not_found"
+	codeInternal    = "internal_error"
+	codeTooLarge    = "too_large"
+)
+
+// LimitBody caps request bodies at limit bytes. Bodies that announce a larger
+// size are refused outright; others fail to decode once they pass the limit.
+func LimitBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Request body too large", utils.FieldError{
+				Code:    codeTooLarge,
+				Message: fmt.Sprintf("must not exceed %d bytes", limit),
+			})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// parseFilterParams reads search filters from the query string. Every
+// malformed parameter is reported instead of being silently ignored.
+func (h *AnalyticsHandler) parseFilterParams(c *gin.Context) (models.FilterParams, error) {
+	filters := models.FilterParams{}
+	var errs utils.ValidationErrors
+
+	// Parse date range
+	filters.StartDate = parseDateParam(c.Query("start_date"), "start_date", false, &errs)
+	filters.EndDate = parseDateParam(c.Query("end_date"), "end_date", true, &errs)
+	filters.DateField = strings.TrimSpace(c.Query("date_field"))
+
+	// Parse inclusion and exclusion lists, including company metadata
+	filters.CompanyIDs = parseList(c.Query("company_ids"))
+	filters.EventTypes = parseList(c.Query("event_types"))
+	filters.ExcludeCompanyIDs = parseList(c.Query("exclude_company_ids"))
+	filters.CSMOwners = parseList(c.Query("csm_owners"))
+	filters.Plans = parseList(c.Query("plans"))
+	filters.Regions = parseList(c.Query("regions"))
+	filters.ExcludeEventTypes = parseList(c.Query("exclude_event_types"))
+	filters.Attributes = parseList(c.Query("attributes"))
+	filters.ExcludeAttributes = parseList(c.Query("exclude_attributes"))
+
+	// Parse value filters
+	filters.ValueMin = parseFloatParam(c.Query("value_min"), "value_min", &errs)
+	filters.ValueMax = parseFloatParam(c.Query("value_max"), "value_max", &errs)
+	filters.ValueIsNull = parseBoolParam(c.Query("is_null"), "is_null", &errs)
+
+	// Parse search text and structured query
+	filters.SearchText = strings.TrimSpace(c.Query("search"))
+	filters.Query = strings.TrimSpace(c.Query("q"))
+	if caseSensitive := parseBoolParam(c.Query("case_sensitive"), "case_sensitive", &errs); caseSensitive != nil {
+		filters.CaseSensitive = *caseSensitive
+	}
+	if wholeWord := parseBoolParam(c.Query("whole_word"), "whole_word", &errs); wholeWord != nil {
+		filters.WholeWord = *wholeWord
+	}
+
+	// Parse pagination
+	filters.Limit = defaultSearchLimit
+	if limit := parseIntParam(c.Query("limit"), "limit", &errs); limit != nil {
+		if *limit < 1 || *limit > maxSearchLimit {
+			errs.Add("limit", codeOutOfRange, fmt.Sprintf("must be between 1 and %d", maxSearchLimit))
+		} else {
+			filters.Limit = *limit
+		}
+	}
+	if offset := parseIntParam(c.Query("offset"), "offset", &errs); offset != nil {
+		if *offset < 0 {
+			errs.Add("offset", codeOutOfRange, "must not be negative")
+		} else {
+			filters.Offset = *offset
+		}
+	}
+
+	// Parse sorting and cursor-based pagination
+	filters.Sort = strings.TrimSpace(c.Query("sort"))
+	filters.Cursor = strings.TrimSpace(c.Query("cursor"))
+	if filters.Cursor != "" && filters.Offset > 0 {
+		errs.Add("offset", codeInvalidRange, "cannot be combined with cursor")
+	}
+
+	// Parse requested facets
+	filters.Facets = parseList(c.Query("facets"))
+	filters.FacetDateBucket = strings.TrimSpace(c.Query("facet_date_bucket"))
+
+	errs = append(errs, h.validateFilters(filters, "")...)
+	if len(errs) > 0 {
+		return filters, errs
+	}
+	return filters, nil
+}
+
+// validateFilters checks the semantics shared by query-string and JSON
+// filters. prefix is prepended to field names, e.g. "filters." for exports.
+func (h *AnalyticsHandler) validateFilters(filters models.FilterParams, prefix string) utils.ValidationErrors {
+	var errs utils.ValidationErrors
+
+	if filters.StartDate != nil && filters.EndDate != nil && filters.StartDate.After(*filters.EndDate) {
+		errs.Add(prefix+"end_date", codeInvalidRange, "must not be before start_date")
+	}
+
+	switch filters.DateField {
+	case "", "created_at", "updated_at", "original_timestamp":
+	default:
+		errs.Add(prefix+"date_field", codeUnknownValue, "must be one of created_at, updated_at, original_timestamp")
+	}
+
+	knownTypes := h.knownEventTypes()
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{"event_types", filters.EventTypes},
+		{"exclude_event_types", filters.ExcludeEventTypes},
+	} {
+		for _, eventType := range field.values {
+			if !knownTypes[eventType] {
+				errs.Add(prefix+field.name, codeUnknownValue, fmt.Sprintf("unknown event type %q", eventType))
+			}
+		}
+	}
+
+	if filters.ValueMin != nil && filters.ValueMax != nil && *filters.ValueMin > *filters.ValueMax {
+		errs.Add(prefix+"value_max", codeInvalidRange, "must not be less than value_min")
+	}
+
+	if filters.Limit < 0 {
+		errs.Add(prefix+"limit", codeOutOfRange, "must not be negative")
+	}
+	if filters.Offset < 0 {
+		errs.Add(prefix+"offset", codeOutOfRange, "must not be negative")
+	}
+
+	if err := services.ValidateSort(filters.Sort); err != nil {
+		errs.Add(prefix+"sort", codeInvalidSort, strings.TrimPrefix(err.Error(), services.ErrInvalidSort.Error()+": "))
+	}
+	if err := services.ValidateFacets(filters.Facets, filters.FacetDateBucket); err != nil {
+		errs.Add(prefix+"facets", codeInvalidFacet, strings.TrimPrefix(err.Error(), services.ErrInvalidFacet.Error()+": "))
+	}
+	if filters.Query != "" {
+		if err := validateQuery(filters.Query); err != nil {
+			errs = append(errs, queryFieldError(prefix+"q", err))
+		}
+	}
+
+	return errs
+}
+
+func validateQuery(query string) error {
+	_, err := services.ParseQuery(query)
+	return err
+}
+
+func (h *AnalyticsHandler) knownEventTypes() map[string]bool {
+	known := map[string]bool{
+		models.EventTypeAction:           true,
+		models.EventTypeMetric:           true,
+		models.EventTypeCumulativeMetric: true,
+	}
+	for _, eventType := range h.service.EventTypes() {
+		known[eventType] = true
+	}
+	return known
+}
+
+// parseDateParam accepts RFC3339 timestamps and YYYY-MM-DD dates. A date-only
+// end bound covers the whole day.
+func parseDateParam(value, field string, endOfDay bool, errs *utils.ValidationErrors) *time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		if endOfDay {
+			// Set to end of day
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return &t
+	}
+
+	errs.Add(field, codeInvalidDate, fmt.Sprintf("%q is not a valid date; use YYYY-MM-DD or RFC3339", value))
+	return nil
+}
+
+func parseIntParam(value, field string, errs *utils.ValidationErrors) *int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		errs.Add(field, codeInvalidInteger, fmt.Sprintf("%q is not an integer", value))
+		return nil
+	}
+	return &n
+}
+
+func parseFloatParam(value, field string, errs *utils.ValidationErrors) *float64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		errs.Add(field, codeInvalidNumber, fmt.Sprintf("%q is not a number", value))
+		return nil
+	}
+	return &f
+}
+
+func parseBoolParam(value, field string, errs *utils.ValidationErrors) *bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		errs.Add(field, codeInvalidBoolean, fmt.Sprintf("%q is not a boolean", value))
+		return nil
+	}
+	return &b
+}
+
+// parseList splits a comma-separated query value, trimming whitespace and
+// dropping empty entries.
+func parseList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func queryFieldError(field string, err error) utils.FieldError {
+	var queryErr *services.QueryError
+	if errors.As(err, &queryErr) {
+		return utils.FieldError{
+			Field:   field,
+			Code:    codeInvalidQuery,
+			Message: fmt.Sprintf("%s (at position %d)", queryErr.Message, queryErr.Position),
+		}
+	}
+	return utils.FieldError{Field: field, Code: codeInvalidQuery, Message: err.Error()}
+}
+
+// serviceFieldError maps errors caused by request parameters to a field
+// error. It returns false for errors that are the server's fault.
+func serviceFieldError(err error) (utils.FieldError, bool) {
+	var queryErr *services.QueryError
+	switch {
+	case errors.As(err, &queryErr):
+		return queryFieldError("q", err), true
+	case errors.Is(err, services.ErrStaleCursor):
+		return utils.FieldError{Field: "cursor", Code: codeStaleCursor, Message: "the dataset was reloaded; restart pagination without a cursor"}, true
+	case errors.Is(err, services.ErrInvalidCursor):
+		return utils.FieldError{Field: "cursor", Code: codeInvalidCursor, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidSort):
+		return utils.FieldError{Field: "sort", Code: codeInvalidSort, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidFacet):
+		return utils.FieldError{Field: "facets", Code: codeInvalidFacet, Message: err.Error()}, true
+	case errors.Is(err, services.ErrRedactedSearch):
+		return utils.FieldError{Code: codeRedacted, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidFilter):
+		return utils.FieldError{Code: codeInvalidFilter, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidAlertRule):
+		return utils.FieldError{Code: codeInvalidRule, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidMetadata):
+		return utils.FieldError{Code: codeInvalidMetadata, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidCron):
+		return utils.FieldError{Field: "cron", Code: codeInvalidCron, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidSchedule):
+		return utils.FieldError{Field: "timezone", Code: codeUnknownValue, Message: err.Error()}, true
+	case errors.Is(err, services.ErrInvalidWorkspace):
+		return utils.FieldError{Field: "data_path", Code: codeInvalidPath, Message: err.Error()}, true
+	}
+	return utils.FieldError{}, false
+}
+
+// respondError writes the error envelope for err: validation errors and other
+// client mistakes become 400s, anything else a 500 with the given message.
+func respondError(c *gin.Context, message string, err error) {
+	var validationErrs utils.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		utils.ErrorResponse(c, http.StatusBadRequest, message, validationErrs...)
+		return
+	}
+
+	if errors.Is(err, services.ErrNotFound) {
+		utils.ErrorResponse(c, http.StatusNotFound, message, utils.FieldError{
+			Code:    codeNotFound,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if fieldErr, ok := serviceFieldError(err); ok {
+		utils.ErrorResponse(c, http.StatusBadRequest, message, fieldErr)
+		return
+	}
+
+	utils.ErrorResponse(c, http.StatusInternalServerError, message, utils.FieldError{
+		Code:    codeInternal,
+		Message: err.Error(),
+	})
+}
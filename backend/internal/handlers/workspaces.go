@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"assembly-dashboard-backend/internal/services"
+	"assembly-dashboard-backend/pkg/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	codeInvalidID   = "invalid_id"
+	codeInvalidPath = "invalid_path"
+	codeExists      = "already_exists"
+)
+
+type WorkspaceHandler struct {
+	service *services.WorkspaceService
+}
+
+func NewWorkspaceHandler(service *services.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{service: service}
+}
+
+// RequireWorkspace only lets callers through who may use the workspace. It
+// runs after Authenticate; other workspaces' routes are reported as not
+// found, so callers cannot tell which workspaces exist.
+func RequireWorkspace(workspace string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !services.InWorkspace(principal(c), workspace) {
+			respondError(c, "Workspace not found", fmt.Errorf("workspace %s: %w", workspace, services.ErrNotFound))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Dispatch hands /api/v1/workspaces/:ws/... requests to the workspace's own
+// routes. It runs after Authenticate, so that unknown workspaces and ones
+// the caller may not use look the same.
+func (h *WorkspaceHandler) Dispatch(c *gin.Context) {
+	id := c.Param("ws")
+	workspace, err := h.service.Get(id)
+	if err == nil && !services.InWorkspace(principal(c), id) {
+		err = fmt.Errorf("workspace %s: %w", id, services.ErrNotFound)
+	}
+	if err != nil {
+		respondError(c, "Workspace not found", err)
+		return
+	}
+
+	workspace.Handler.ServeHTTP(c.Writer, c.Request)
+}
+
+func (h *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	utils.JSONResponse(c, http.StatusOK, "success", h.service.List())
+}
+
+func (h *WorkspaceHandler) GetWorkspace(c *gin.Context) {
+	workspace, err := h.service.Info(c.Param("ws"))
+	if err != nil {
+		respondError(c, "Workspace not found", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "success", workspace)
+}
+
+// CreateWorkspace adds a workspace and loads its data. Its routes are
+// available under /api/v1/workspaces/<id> as soon as it is created.
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	request, ok := bindWorkspaceRequest(c)
+	if !ok {
+		return
+	}
+	if !services.IsWorkspaceID(strings.TrimSpace(request.ID)) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid workspace", utils.FieldError{
+			Field:   "id",
+			Code:    codeInvalidID,
+			Message: "must be 1-63 lower-case letters, digits or dashes, starting with a letter or digit",
+		})
+		return
+	}
+
+	workspace, err := h.service.Create(request)
+	if err != nil {
+		respondWorkspaceError(c, "Failed to create workspace", err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/workspaces/"+workspace.ID)
+	utils.JSONResponse(c, http.StatusCreated, "Workspace created", workspace)
+}
+
+func (h *WorkspaceHandler) UpdateWorkspace(c *gin.Context) {
+	request, ok := bindWorkspaceRequest(c)
+	if !ok {
+		return
+	}
+	if id := strings.TrimSpace(request.ID); id != "" && id != c.Param("ws") {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid workspace", utils.FieldError{
+			Field:   "id",
+			Code:    codeConflict,
+			Message: "a workspace cannot be renamed; change its name instead",
+		})
+		return
+	}
+
+	workspace, err := h.service.Update(c.Param("ws"), request)
+	if err != nil {
+		respondWorkspaceError(c, "Failed to update workspace", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Workspace updated", workspace)
+}
+
+// DeleteWorkspace closes a workspace. Its files stay on disk.
+func (h *WorkspaceHandler) DeleteWorkspace(c *gin.Context) {
+	if err := h.service.Delete(c.Param("ws")); err != nil {
+		respondWorkspaceError(c, "Failed to delete workspace", err)
+		return
+	}
+
+	utils.JSONResponse(c, http.StatusOK, "Workspace deleted", nil)
+}
+
+func bindWorkspaceRequest(c *gin.Context) (models.WorkspaceRequest, bool) {
+	var request models.WorkspaceRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid workspace", utils.FieldError{
+			Code:    codeInvalidJSON,
+			Message: err.Error(),
+		})
+		return request, false
+	}
+
+	var errs utils.ValidationErrors
+	for i, webhook := range request.AlertWebhooks {
+		if !isWebhookURL(webhook) {
+			errs.Add(fmt.Sprintf("alert_webhooks[%d]", i), codeInvalidURL, "must be an absolute http or https URL")
+		}
+	}
+	if len(errs) > 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid workspace", errs...)
+		return request, false
+	}
+	return request, true
+}
+
+func respondWorkspaceError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrWorkspaceExists):
+		utils.ErrorResponse(c, http.StatusConflict, message, utils.FieldError{Field: "id", Code: codeExists, Message: err.Error()})
+	case errors.Is(err, services.ErrDefaultWorkspace):
+		utils.ErrorResponse(c, http.StatusConflict, message, utils.FieldError{Code: codeConflict, Message: err.Error()})
+	default:
+		respondError(c, message, err)
+	}
+}
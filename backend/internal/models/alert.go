@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// Alert rule kinds.
+const (
+	AlertInactiveCompany = "inactive_company"  // Threshold: days without activity
+	AlertNewAtRiskEvent  = "new_at_risk_event" // Threshold: new at-risk events needed
+	AlertDailyDrop       = "daily_drop"        // Threshold: percent drop vs the 4-week average
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+type AlertRule struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Kind            string    `json:"kind"`
+	Threshold       float64   `json:"threshold"`
+	CompanyIDs      []string  `json:"company_ids,omitempty"` // empty means every company
+	CooldownMinutes int       `json:"cooldown_minutes"`
+	Webhooks        []string  `json:"webhooks,omitempty"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type AlertRuleRequest struct {
+	Name            string   `json:"name"`
+	Kind            string   `json:"kind"`
+	Threshold       *float64 `json:"threshold"`
+	CompanyIDs      []string `json:"company_ids"`
+	CooldownMinutes *int     `json:"cooldown_minutes"`
+	Webhooks        []string `json:"webhooks"`
+	Enabled         *bool    `json:"enabled"`
+}
+
+// Alert is the current state of one rule for one company.
+type Alert struct {
+	RuleID         string     `json:"rule_id"`
+	RuleName       string     `json:"rule_name"`
+	CompanyID      string     `json:"company_id"`
+	State          string     `json:"state"`
+	Value          float64    `json:"value"`
+	Message        string     `json:"message"`
+	FiredAt        time.Time  `json:"fired_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	LastNotifiedAt *time.Time `json:"last_notified_at,omitempty"`
+	DeliveryError  string     `json:"delivery_error,omitempty"`
+}
+
+// AlertTransition records an alert changing state. Suppressed is set when a
+// notification was skipped because the rule's cooldown had not elapsed.
+type AlertTransition struct {
+	RuleID     string    `json:"rule_id"`
+	CompanyID  string    `json:"company_id"`
+	State      string    `json:"state"`
+	Value      float64   `json:"value"`
+	Message    string    `json:"message"`
+	Suppressed bool      `json:"suppressed,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// WebhookDelivery is the outcome of sending one notification to one URL.
+type WebhookDelivery struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Annotation is a note explaining activity, e.g. "migration week". It is
+// attached to a company, a date range or both; annotations without a company
+// apply to every company.
+type Annotation struct {
+	ID        string     `json:"id"`
+	CompanyID string     `json:"company_id,omitempty"`
+	StartDate *time.Time `json:"start_date,omitempty"`
+	EndDate   *time.Time `json:"end_date,omitempty"`
+	Text      string     `json:"text"`
+	Author    string     `json:"author,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AnnotationRequest takes dates as strings so they can be given as YYYY-MM-DD
+// as well as RFC3339, like the query string filters.
+type AnnotationRequest struct {
+	CompanyID string `json:"company_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Text      string `json:"text"`
+	Author    string `json:"author"`
+}
+
+// AnnotationQuery selects annotations for a company (plus the global ones)
+// that overlap a date range. Empty fields do not restrict the result.
+type AnnotationQuery struct {
+	CompanyIDs []string
+	From       *time.Time
+	To         *time.Time
+	Scope      []string // when set, company annotations outside it are left out
+}
+
+// CompanyTimeline is the activity of one company over time, with the
+// annotations covering it so charts can render markers.
+type CompanyTimeline struct {
+	Company        Company                      `json:"company"`
+	TotalEvents    int                          `json:"total_events"`
+	TimeSeriesData []TimeSeriesPoint            `json:"time_series_data"`
+	DailyTrends    map[string][]TimeSeriesPoint `json:"daily_trends"`
+	Annotations    []Annotation                 `json:"annotations"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Roles, from least to most privileged. Each role can do everything the
+// ones before it can.
+const (
+	RoleViewer  = "viewer"  // dashboards, search and reports
+	RoleAnalyst = "analyst" // exports, and managing segments, annotations, alerts and digests
+	RoleAdmin   = "admin"   // API keys, data reloads, company metadata and the export audit log
+)
+
+// How a principal authenticated.
+const (
+	AuthAPIKey = "api_key"
+	AuthJWT    = "jwt"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject   string     `json:"subject"` // key name or token subject
+	Role      string     `json:"role"`
+	Method    string     `json:"method"`
+	KeyID     string     `json:"key_id,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// CompanyIDs limits the principal to these companies' data, and
+	// Workspaces to these workspaces; empty means all of them. Company IDs
+	// only come with exactly one workspace, as each workspace has its own.
+	CompanyIDs []string `json:"company_ids,omitempty"`
+	Workspaces []string `json:"workspaces,omitempty"`
+}
+
+// Identity tells principals apart more reliably than Subject, which is only
+// a key's name or a token's subject: "api_key:<key id>" or "jwt:<subject>".
+func (p Principal) Identity() string {
+	if p.Method == AuthAPIKey {
+		return p.Method + ":" + p.KeyID
+	}
+	return p.Method + ":" + p.Subject
+}
+
+// APIKey is a stored API key. Only a hash of the secret is kept; the secret
+// itself is shown once, when the key is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	Prefix     string     `json:"prefix"` // start of the secret, to tell keys apart
+	CompanyIDs []string   `json:"company_ids,omitempty"`
+	Workspaces []string   `json:"workspaces,omitempty"`
+	Hash       string     `json:"hash,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	CompanyIDs []string   `json:"company_ids,omitempty"` // companies the key is limited to
+	Workspaces []string   `json:"workspaces,omitempty"`  // workspaces the key is limited to
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey is returned when a key is created, the only time its secret
+// is available.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Company is a directory entry. Name comes from imported metadata when there
+// is some, otherwise it is inferred from event content.
+type Company struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	NameSource string   `json:"name_source,omitempty"` // "metadata" or "content"
+	Plan       string   `json:"plan,omitempty"`
+	CSMOwner   string   `json:"csm_owner,omitempty"`
+	ARR        *float64 `json:"arr,omitempty"`
+	Region     string   `json:"region,omitempty"`
+}
+
+// CompanyMetadata is one record of an imported company mapping file.
+type CompanyMetadata struct {
+	CompanyID string   `json:"company_id"`
+	Name      string   `json:"name,omitempty"`
+	Plan      string   `json:"plan,omitempty"`
+	CSMOwner  string   `json:"csm_owner,omitempty"`
+	ARR       *float64 `json:"arr,omitempty"`
+	Region    string   `json:"region,omitempty"`
+}
+
+type CompanyImportResult struct {
+	Imported  int `json:"imported"`
+	Companies int `json:"companies"`
+}
+
+// CompanyAggregate holds the per-company figures dynamic segments are
+// evaluated against. Windows such as "last 7 days" end at AsOf, the time of
+// the most recent event in the dataset.
+type CompanyAggregate struct {
+	CompanyID         string    `json:"company_id"`
+	Company           *Company  `json:"company,omitempty"`
+	EventCount        int       `json:"event_count"`
+	EventsLast7Days   int       `json:"events_last_7_days"`
+	EventsPrior7Days  int       `json:"events_prior_7_days"` // the 7 days before that
+	EventsLast30Days  int       `json:"events_last_30_days"`
+	ActionsLast7Days  int       `json:"actions_last_7_days"`
+	AtRiskMetrics     int       `json:"at_risk_metrics"`
+	LastActivity      time.Time `json:"last_activity"`
+	DaysSinceActivity int       `json:"days_since_activity"`
+	HealthScore       int       `json:"health_score"`
+	HealthScoreChange int       `json:"health_score_change"`
+	AsOf              time.Time `json:"as_of"`
+}
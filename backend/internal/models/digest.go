@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// DigestSchedule sends a summary of a set of accounts to recipients on a
+// cron schedule, e.g. "0 8 * * mon" in the CSM's time zone.
+type DigestSchedule struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Cron       string     `json:"cron"`
+	Timezone   string     `json:"timezone"`
+	Recipients []string   `json:"recipients"`
+	CSMOwner   string     `json:"csm_owner,omitempty"`   // only companies owned by this CSM
+	CompanyIDs []string   `json:"company_ids,omitempty"` // only these companies
+	Enabled    bool       `json:"enabled"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	LastOutput string     `json:"last_output,omitempty"` // where the last digest went
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type DigestScheduleRequest struct {
+	Name       string   `json:"name"`
+	Cron       string   `json:"cron"`
+	Timezone   string   `json:"timezone"`
+	Recipients []string `json:"recipients"`
+	CSMOwner   string   `json:"csm_owner"`
+	CompanyIDs []string `json:"company_ids"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// Digest is the content of one digest email.
+type Digest struct {
+	Title       string             `json:"title"`
+	PeriodStart time.Time          `json:"period_start"`
+	PeriodEnd   time.Time          `json:"period_end"`
+	Companies   int                `json:"companies"`
+	ThisWeek    int                `json:"events_this_week"`
+	LastWeek    int                `json:"events_last_week"`
+	Change      *float64           `json:"change_percent,omitempty"` // nil when last week had no events
+	TopMovers   []DigestMover      `json:"top_movers"`
+	AtRisk      []CompanyAggregate `json:"at_risk"`
+	Inactive    []CompanyAggregate `json:"inactive"`
+}
+
+type DigestMover struct {
+	CompanyID string `json:"company_id"`
+	Name      string `json:"name"`
+	ThisWeek  int    `json:"events_this_week"`
+	LastWeek  int    `json:"events_last_week"`
+	Change    int    `json:"change"`
+}
+
+type DigestDelivery struct {
+	Digest Digest `json:"digest"`
+	Output string `json:"output"`
+	DryRun bool   `json:"dry_run"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+const (
+	AuditExport   = "export"   // synchronous download from POST /export
+	AuditJob      = "job"      // background export that has finished
+	AuditDownload = "download" // file of a background export fetched
+)
+
+// ExportAuditEntry records one export of dataset rows: who asked for it,
+// what it selected and what was handed out.
+type ExportAuditEntry struct {
+	ID        string       `json:"id"`
+	Time      time.Time    `json:"time"`
+	Action    string       `json:"action"`
+	Requester string       `json:"requester,omitempty"` // subject of the caller's API key or token
+	KeyID     string       `json:"key_id,omitempty"`    // API key used, if any
+	ClientIP  string       `json:"client_ip,omitempty"`
+	JobID     string       `json:"job_id,omitempty"`
+	Format    string       `json:"format"`
+	Kind      string       `json:"kind,omitempty"` // empty for events
+	Filters   FilterParams `json:"filters"`        // after SegmentID was resolved
+	SegmentID string       `json:"segment_id,omitempty"`
+	Columns   []string     `json:"columns,omitempty"`
+	Rows      int          `json:"rows"`
+	Filename  string       `json:"filename,omitempty"`
+	Redaction string       `json:"redaction,omitempty"` // policy applied to the rows
+	Status    string       `json:"status,omitempty"`    // exports and jobs: completed, failed or cancelled
+	Error     string       `json:"error,omitempty"`
+}
+
+// ExportAuditQuery selects audit entries. Empty fields do not restrict the
+// result.
+type ExportAuditQuery struct {
+	Requester string
+	Action    string
+	Format    string
+	JobID     string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+}
+
+// AuditEntry describes the export a request asks for; the caller fills in
+// the action, requester and outcome.
+func (r ExportRequest) AuditEntry() ExportAuditEntry {
+	return ExportAuditEntry{
+		Format:    r.Format,
+		Kind:      r.Kind,
+		Filters:   r.Filters,
+		SegmentID: r.SegmentID,
+		Columns:   r.Columns,
+	}
+}
+
+// AuditEntry describes the export a job wrote.
+func (j ExportJob) AuditEntry() ExportAuditEntry {
+	entry := j.Request.AuditEntry()
+	entry.JobID = j.ID
+	entry.Rows = j.RowsWritten
+	entry.Filename = j.Filename
+	entry.Redaction = j.Redaction
+	return entry
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportCancelled = "cancelled"
+)
+
+// ExportJob is an export written to disk in the background. Completed files
+// can be downloaded until ExpiresAt, after which they are deleted.
+type ExportJob struct {
+	ID          string        `json:"id"`
+	Status      string        `json:"status"`
+	Request     ExportRequest `json:"request"`
+	RequestedBy string        `json:"requested_by,omitempty"` // subject of the caller who created it
+	Owner       string        `json:"owner,omitempty"`        // identity of that caller, see Principal.Identity
+	ClientIP    string        `json:"client_ip,omitempty"`
+	Redaction   string        `json:"redaction,omitempty"` // policy the rows are redacted with
+	Scope       []string      `json:"scope,omitempty"`     // companies the requester was limited to
+	Filename    string        `json:"filename,omitempty"`
+	ContentType string        `json:"content_type,omitempty"`
+	TotalRows   int           `json:"total_rows"`
+	RowsWritten int           `json:"rows_written"`
+	Progress    float64       `json:"progress"` // 0 to 1
+	Size        int64         `json:"size_bytes,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+}
+
+// Finished reports whether the job will not change any more.
+func (j ExportJob) Finished() bool {
+	return j.Status == ExportCompleted || j.Status == ExportFailed || j.Status == ExportCancelled
+}
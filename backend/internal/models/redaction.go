@@ -0,0 +1,26 @@
+package models
+
+// How a redaction policy treats the user emails in event content.
+const (
+	EmailsVisible = ""     // left as they are
+	EmailsMask    = "mask" // first letter and domain kept: w***@sample.com
+	EmailsHash    = "hash" // salted hash, the same for every event of a user: user-3fa2b1c9d0e4@redacted
+)
+
+// RedactionPolicy describes what is hidden from the people it applies to.
+type RedactionPolicy struct {
+	Name        string `json:"name"`
+	Emails      string `json:"emails,omitempty"`
+	StripURLIDs bool   `json:"strip_url_ids,omitempty"` // /work-orders/2194290 -> /work-orders/:id
+}
+
+// RedactionConfig picks the policy for a request: the one for the caller's
+// role if there is one, else the one for the endpoint, else Default. Policies
+// are referred to by name, either one defined here or a built-in one (none,
+// mask, pseudonymize and strict).
+type RedactionConfig struct {
+	Default   string                     `json:"default,omitempty"`
+	Policies  map[string]RedactionPolicy `json:"policies,omitempty"`
+	Endpoints map[string]string          `json:"endpoints,omitempty"` // search, summary, export or report
+	Roles     map[string]string          `json:"roles,omitempty"`
+}
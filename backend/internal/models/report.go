@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// CompanyReport is an account review of one company over a date range, as
+// rendered to HTML and PDF for quarterly business reviews.
+type CompanyReport struct {
+	Company     Company           `json:"company"`
+	Health      *CompanyAggregate `json:"health,omitempty"` // as of the end of the dataset
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	GeneratedAt time.Time         `json:"generated_at"`
+
+	TotalEvents    int `json:"total_events"`
+	PreviousEvents int `json:"previous_events"` // in the same length of time before From
+	ActiveDays     int `json:"active_days"`
+	ActiveUsers    int `json:"active_users"`
+	FeaturesUsed   int `json:"features_used"`
+
+	DailyActivity []TimeSeriesPoint `json:"daily_activity"` // every day of the range, including quiet ones
+	TopFeatures   []ReportCount     `json:"top_features"`
+	TopUsers      []ReportUser      `json:"top_users"`
+	MetricTrends  []MetricTrend     `json:"metric_trends"`
+	RiskSignals   []RiskSignal      `json:"risk_signals"`
+	Annotations   []Annotation      `json:"annotations"`
+}
+
+type ReportCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type ReportUser struct {
+	Email    string    `json:"email"`
+	Events   int       `json:"events"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// MetricTrend is the recorded values of one numeric metric, oldest first.
+type MetricTrend struct {
+	Name          string        `json:"name"`
+	Points        []MetricPoint `json:"points"`
+	First         float64       `json:"first"`
+	Latest        float64       `json:"latest"`
+	ChangePercent *float64      `json:"change_percent"` // nil when the first value is zero
+}
+
+type MetricPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// RiskSignal is an at-risk metric recorded for the company.
+type RiskSignal struct {
+	Time   time.Time `json:"time"`
+	Signal string    `json:"signal"`
+	Metric string    `json:"metric,omitempty"`
+	Value  string    `json:"value,omitempty"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// SavedSearch is a named, persisted combination of filters that can be used
+// in place of inline filters via segment_id.
+type SavedSearch struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Owner     string       `json:"owner,omitempty"` // identity of the principal that created it
+	Filters   FilterParams `json:"filters"`
+	Query     string       `json:"query,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// SavedSearchRequest creates or updates a saved search. Its owner is the
+// caller who creates it.
+type SavedSearchRequest struct {
+	Name    string       `json:"name"`
+	Filters FilterParams `json:"filters"`
+	Query   string       `json:"query"`
+}
+
+// DynamicSegment groups companies by computed properties rather than by
+// event filters. Membership is re-evaluated every time the data is loaded.
+type DynamicSegment struct {
+	ID             string             `json:"id"`
+	Name           string             `json:"name"`
+	Description    string             `json:"description,omitempty"`
+	Match          string             `json:"match"`
+	Conditions     []SegmentCondition `json:"conditions"`
+	Members        []string           `json:"members"`
+	DatasetVersion string             `json:"dataset_version,omitempty"`
+	EvaluatedAt    time.Time          `json:"evaluated_at"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// SegmentCondition compares one company metric against a value, e.g.
+// {"metric": "events_last_7_days", "op": ">", "value": 50}.
+type SegmentCondition struct {
+	Metric   string  `json:"metric"`
+	Operator string  `json:"op"`
+	Value    float64 `json:"value"`
+}
+
+type DynamicSegmentRequest struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Match       string             `json:"match"`
+	Conditions  []SegmentCondition `json:"conditions"`
+}
+
+const (
+	MembershipEntered = "entered"
+	MembershipExited  = "exited"
+)
+
+type SegmentMembershipChange struct {
+	SegmentID      string    `json:"segment_id"`
+	CompanyID      string    `json:"company_id"`
+	Change         string    `json:"change"`
+	DatasetVersion string    `json:"dataset_version,omitempty"`
+	At             time.Time `json:"at"`
+}
@@ -4,6 +4,13 @@ import (
 	"time"
 )
 
+// Event types emitted by the usage pipeline.
+const (
+	EventTypeAction           = "Action"
+	EventTypeMetric           = "Metric"
+	EventTypeCumulativeMetric = "CumulativeMetric"
+)
+
 type UsageEvent struct {
 	ID                string    `json:"id"`
 	CreatedAt         time.Time `json:"created_at"`
@@ -14,27 +21,124 @@ type UsageEvent struct {
 	UpdatedAt         time.Time `json:"updated_at"`
 	OriginalTimestamp time.Time `json:"original_timestamp"`
 	Value             string    `json:"value"`
+	Score             float64   `json:"score,omitempty"` // search relevance, set on search results only
 }
 
 type FilterParams struct {
 	StartDate  *time.Time `json:"start_date,omitempty"`
 	EndDate    *time.Time `json:"end_date,omitempty"`
+	DateField  string     `json:"date_field,omitempty"` // created_at (default), updated_at or original_timestamp
 	CompanyIDs []string   `json:"company_ids,omitempty"`
 	EventTypes []string   `json:"event_types,omitempty"`
-	SearchText string     `json:"search_text,omitempty"`
-	Limit      int        `json:"limit,omitempty"`
-	Offset     int        `json:"offset,omitempty"`
+
+	ExcludeCompanyIDs []string `json:"exclude_company_ids,omitempty"`
+	CSMOwners         []string `json:"csm_owners,omitempty"` // company directory metadata
+	Plans             []string `json:"plans,omitempty"`
+	Regions           []string `json:"regions,omitempty"`
+	ExcludeEventTypes []string `json:"exclude_event_types,omitempty"`
+	Attributes        []string `json:"attributes,omitempty"`
+	ExcludeAttributes []string `json:"exclude_attributes,omitempty"`
+
+	// Value filters apply to the parsed numeric value ("$1,200.00" -> 1200);
+	// events without a numeric value never match a min/max bound.
+	ValueMin    *float64 `json:"value_min,omitempty"`
+	ValueMax    *float64 `json:"value_max,omitempty"`
+	ValueIsNull *bool    `json:"is_null,omitempty"`
+
+	SearchText string `json:"search_text,omitempty"`
+	Query      string `json:"query,omitempty"` // structured query, see services.ParseQuery
+
+	CaseSensitive bool   `json:"case_sensitive,omitempty"`
+	WholeWord     bool   `json:"whole_word,omitempty"`
+	Limit         int    `json:"limit,omitempty"`
+	Offset        int    `json:"offset,omitempty"`
+	Sort          string `json:"sort,omitempty"`   // e.g. "created_at:desc,company_id:asc"
+	Cursor        string `json:"cursor,omitempty"` // opaque token from FilteredResults.NextCursor
+
+	// Scope is the set of companies the caller may see; nil for callers
+	// who may see every company. It is set from the authenticated principal
+	// and never read from requests, and events outside it are left out of
+	// results, counts and facets alike.
+	Scope []string `json:"-"`
+
+	Facets          []string `json:"facets,omitempty"`            // company_id, type, attribute, date
+	FacetDateBucket string   `json:"facet_date_bucket,omitempty"` // day (default), week or month
+}
+
+// HasConditions reports whether any filter restricts which events match, as
+// opposed to only paging, sorting or faceting them.
+func (f FilterParams) HasConditions() bool {
+	return f.StartDate != nil || f.EndDate != nil ||
+		len(f.CompanyIDs) > 0 || len(f.EventTypes) > 0 ||
+		len(f.ExcludeCompanyIDs) > 0 || len(f.ExcludeEventTypes) > 0 ||
+		len(f.CSMOwners) > 0 || len(f.Plans) > 0 || len(f.Regions) > 0 ||
+		len(f.Attributes) > 0 || len(f.ExcludeAttributes) > 0 ||
+		f.ValueMin != nil || f.ValueMax != nil || f.ValueIsNull != nil ||
+		f.SearchText != "" || f.Query != ""
 }
 
 type FilteredResults struct {
-	Events        []UsageEvent `json:"events"`
-	TotalCount    int          `json:"total_count"`
-	FilteredCount int          `json:"filtered_count"`
+	Events         []UsageEvent `json:"events"`
+	TotalCount     int          `json:"total_count"`
+	FilteredCount  int          `json:"filtered_count"`
+	Sort           string       `json:"sort"`
+	NextCursor     string       `json:"next_cursor,omitempty"`
+	DatasetVersion string       `json:"dataset_version,omitempty"`
+
+	// Facets holds per-value counts for the requested facets. Each facet is
+	// computed with its own filter ignored, so selecting another value in the
+	// panel yields exactly the count shown next to it.
+	Facets map[string][]FacetCount `json:"facets,omitempty"`
+
+	// Matches explains, per returned event ID, which fields matched the
+	// search text and where.
+	Matches map[string][]FieldMatch `json:"matches,omitempty"`
+
+	// Companies holds the directory entry of every company on this page.
+	Companies map[string]Company `json:"companies,omitempty"`
+}
+
+type FieldMatch struct {
+	Field  string       `json:"field"`
+	Ranges []MatchRange `json:"ranges"`
+}
+
+// MatchRange is a half-open [Start, End) character range within a field.
+type MatchRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
 }
 
 type ExportRequest struct {
-	Format  string       `json:"format"` // "csv" or "json"
-	Filters FilterParams `json:"filters"`
+	Format    string       `json:"format"`         // "csv", "json", "ndjson", "xlsx" or "parquet"
+	Kind      string       `json:"kind,omitempty"` // "events" (default), "companies", "timeseries", "trends" or "cohorts"
+	Filters   FilterParams `json:"filters"`
+	SegmentID string       `json:"segment_id,omitempty"` // saved search used in place of Filters
+
+	// IncludeAnnotations adds an Annotations column to CSV exports, wraps
+	// JSON exports as {"events": [...], "annotations": [...]} and adds an
+	// "annotations" field to NDJSON lines.
+	IncludeAnnotations bool `json:"include_annotations,omitempty"`
+
+	// Compress gzips the file itself (a .gz download). Without it, synchronous
+	// downloads are still gzipped in transit when the client accepts it.
+	Compress bool `json:"compress,omitempty"`
+
+	// Columns picks and orders the columns of CSV and XLSX exports, and the
+	// fields of JSON and NDJSON objects. Empty means the standard columns, and
+	// whole events for JSON and NDJSON (which then ignore the options below).
+	Columns         []string          `json:"columns,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`          // column -> header label (or JSON key)
+	TimestampFormat string            `json:"timestamp_format,omitempty"` // rfc3339 (default), rfc3339nano, datetime, date, unix, unix_ms
+	Timezone        string            `json:"timezone,omitempty"`         // IANA zone timestamps are converted to
+	Delimiter       string            `json:"delimiter,omitempty"`        // CSV field separator, "," by default
+	Quote           string            `json:"quote,omitempty"`            // CSV quoting: minimal (default), all or none
+	IncludeHeader   *bool             `json:"include_header,omitempty"`   // CSV header row, true by default
 }
 
 type TimeSeriesPoint struct {
@@ -43,8 +147,17 @@ type TimeSeriesPoint struct {
 	Value string `json:"value,omitempty"`
 }
 
+// Cohort is the companies first seen in a week (starting Monday) and how
+// many of them were active in each week since.
+type Cohort struct {
+	Week      string `json:"week"`
+	Companies int    `json:"companies"`
+	Active    []int  `json:"active"`
+}
+
 type CompanyAnalytics struct {
 	CompanyID    string         `json:"company_id"`
+	Company      *Company       `json:"company,omitempty"`
 	EventCount   int            `json:"event_count"`
 	LastActivity string         `json:"last_activity"`
 	EventTypes   map[string]int `json:"event_types"`
@@ -60,17 +173,32 @@ type DashboardSummary struct {
 	TopCompanies     []CompanyAnalytics           `json:"top_companies"`
 	DailyTrends      map[string][]TimeSeriesPoint `json:"daily_trends"`
 	AvailableFilters AvailableFilters             `json:"available_filters"`
+
+	// Companies holds the directory entry of every company in the summary.
+	Companies map[string]Company `json:"companies,omitempty"`
+
+	// Annotations overlapping the summarized period, for chart markers.
+	Annotations []Annotation `json:"annotations"`
 }
 
 type AvailableFilters struct {
 	Companies  []string `json:"companies"`
 	EventTypes []string `json:"event_types"`
+	CSMOwners  []string `json:"csm_owners,omitempty"`
+	Plans      []string `json:"plans,omitempty"`
+	Regions    []string `json:"regions,omitempty"`
 	DateRange  struct {
 		Min string `json:"min"`
 		Max string `json:"max"`
 	} `json:"date_range"`
 }
 
+type DatasetInfo struct {
+	Version    string    `json:"version"`
+	EventCount int       `json:"event_count"`
+	LoadedAt   time.Time `json:"loaded_at"`
+}
+
 type CSVRecord struct {
 	ID                string
 	CreatedAt         string
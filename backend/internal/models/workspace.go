@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// DefaultWorkspace is the workspace served by the unprefixed /api/v1 routes,
+// reading DATA_PATH and keeping its state directly in STATE_PATH.
+const DefaultWorkspace = "default"
+
+// Workspace is one tenant of the API: a dataset of its own, with its own
+// saved searches, segments, annotations, alerts, digests and exports. Its
+// routes live under /api/v1/workspaces/<id>.
+type Workspace struct {
+	ID            string       `json:"id"`
+	Name          string       `json:"name"`
+	DataPath      string       `json:"data_path"`
+	AlertWebhooks []string     `json:"alert_webhooks,omitempty"` // used by alert rules without their own
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	Dataset       *DatasetInfo `json:"dataset,omitempty"` // the loaded dataset; not stored
+}
+
+// WorkspaceRequest creates or updates a workspace. DataPath is relative to
+// WORKSPACES_DATA_PATH and defaults to the workspace ID. ID can only be set
+// when the workspace is created.
+type WorkspaceRequest struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	DataPath      string   `json:"data_path"`
+	AlertWebhooks []string `json:"alert_webhooks"`
+}
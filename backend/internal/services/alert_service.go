@@ -0,0 +1,691 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidAlertRule = errors.New("invalid alert rule")
+
+const (
+	maxAlertHistory        = 10000
+	defaultAlertCooldown   = 60 // minutes
+	dailyDropBaselineWeeks = 4
+
+	// dailyDropMinBaseline keeps quiet companies, whose daily counts swing
+	// wildly, from firing drop alerts
+	dailyDropMinBaseline = 5
+)
+
+// alertKinds lists the supported rule kinds with their default threshold.
+var alertKinds = map[string]float64{
+	models.AlertInactiveCompany: 7,
+	models.AlertNewAtRiskEvent:  1,
+	models.AlertDailyDrop:       50,
+}
+
+func IsAlertKind(kind string) bool {
+	_, ok := alertKinds[kind]
+	return ok
+}
+
+// AlertKinds returns the supported rule kinds.
+func AlertKinds() []string {
+	kinds := make([]string, 0, len(alertKinds))
+	for kind := range alertKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// alertStore is the persisted state of the alert engine.
+type alertStore struct {
+	Alerts     []models.Alert             `json:"alerts"`
+	History    []models.AlertTransition   `json:"history"`
+	Watermarks map[string]atRiskWatermark `json:"at_risk_watermarks"`
+
+	// LegacyWatermarks holds the newest at-risk event seen per rule, as
+	// stored before watermarks followed the dataset version
+	LegacyWatermarks map[string]time.Time `json:"watermarks,omitempty"`
+}
+
+// atRiskWatermark decides which at-risk events a rule reports as new: those
+// after Since, for as long as dataset Version stays loaded. Once another
+// dataset is loaded, Since moves up to Latest, the newest at-risk event the
+// rule has seen, so an alert fires when new events arrive and resolves with
+// the next load that brings none, however often the rules are evaluated.
+type atRiskWatermark struct {
+	Version string    `json:"version"`
+	Since   time.Time `json:"since"`
+	Latest  time.Time `json:"latest"`
+}
+
+// alertSnapshot holds what rules are evaluated against, computed once per
+// dataset.
+type alertSnapshot struct {
+	version     string
+	aggregates  []models.CompanyAggregate
+	dailyCounts map[string]map[string]int // company -> YYYY-MM-DD -> events
+	atRisk      map[string][]time.Time    // company -> at-risk event times
+}
+
+func newAlertSnapshot(events []models.UsageEvent, version string) *alertSnapshot {
+	snapshot := &alertSnapshot{
+		version:     version,
+		aggregates:  computeCompanyAggregates(events),
+		dailyCounts: make(map[string]map[string]int),
+		atRisk:      make(map[string][]time.Time),
+	}
+
+	for i := range events {
+		event := &events[i]
+		if event.CompanyID == "" {
+			continue
+		}
+		if snapshot.dailyCounts[event.CompanyID] == nil {
+			snapshot.dailyCounts[event.CompanyID] = make(map[string]int)
+		}
+		snapshot.dailyCounts[event.CompanyID][event.CreatedAt.Format("2006-01-02")]++
+		if isAtRiskEvent(event) {
+			snapshot.atRisk[event.CompanyID] = append(snapshot.atRisk[event.CompanyID], event.CreatedAt)
+		}
+	}
+	return snapshot
+}
+
+func (s *alertSnapshot) latestAtRisk() time.Time {
+	var latest time.Time
+	for _, times := range s.atRisk {
+		for _, t := range times {
+			if t.After(latest) {
+				latest = t
+			}
+		}
+	}
+	return latest
+}
+
+// alertCondition is the outcome of a rule for one company.
+type alertCondition struct {
+	companyID string
+	firing    bool
+	value     float64
+	message   string
+}
+
+// AlertService evaluates alert rules whenever data is loaded (and optionally
+// on a schedule), tracks firing/resolved state per rule and company, and
+// notifies webhooks about state changes. Inactivity and daily drops are
+// measured up to the current time, not the newest event in the dataset, so
+// scheduled evaluations pick up companies going quiet between loads.
+type AlertService struct {
+	mu         sync.RWMutex
+	rulesPath  string
+	statePath  string
+	rules      map[string]models.AlertRule
+	alerts     map[string]models.Alert
+	history    []models.AlertTransition
+	watermarks map[string]atRiskWatermark
+	snapshot   *alertSnapshot
+	now        func() time.Time // the clock rules are evaluated against
+
+	directory       *CompanyDirectory
+	notifier        *WebhookNotifier
+	defaultWebhooks []string
+}
+
+func NewAlertService(rulesPath, statePath string, directory *CompanyDirectory, notifier *WebhookNotifier, defaultWebhooks []string) (*AlertService, error) {
+	s := &AlertService{
+		rulesPath:       rulesPath,
+		statePath:       statePath,
+		rules:           make(map[string]models.AlertRule),
+		alerts:          make(map[string]models.Alert),
+		watermarks:      make(map[string]atRiskWatermark),
+		now:             time.Now,
+		directory:       directory,
+		notifier:        notifier,
+		defaultWebhooks: defaultWebhooks,
+	}
+
+	var rules []models.AlertRule
+	if err := loadJSONFile(rulesPath, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		s.rules[rule.ID] = rule
+	}
+
+	var store alertStore
+	if err := loadJSONFile(statePath, &store); err != nil {
+		return nil, err
+	}
+	for _, alert := range store.Alerts {
+		s.alerts[alertKey(alert.RuleID, alert.CompanyID)] = alert
+	}
+	s.history = store.History
+	for ruleID, latest := range store.LegacyWatermarks {
+		s.watermarks[ruleID] = atRiskWatermark{Since: latest, Latest: latest}
+	}
+	for ruleID, watermark := range store.Watermarks {
+		s.watermarks[ruleID] = watermark
+	}
+
+	return s, nil
+}
+
+func alertKey(ruleID, companyID string) string {
+	return ruleID + "/" + companyID
+}
+
+// OnDataLoad evaluates every rule against a freshly loaded dataset. It is
+// registered as a data load hook on the analytics service.
+func (s *AlertService) OnDataLoad(events []models.UsageEvent, version string) error {
+	snapshot := newAlertSnapshot(events, version)
+
+	s.mu.Lock()
+	s.snapshot = snapshot
+	s.mu.Unlock()
+
+	return s.Evaluate()
+}
+
+// Evaluate re-evaluates every enabled rule against the last loaded dataset.
+func (s *AlertService) Evaluate() error {
+	s.mu.Lock()
+	if s.snapshot == nil {
+		s.mu.Unlock()
+		return nil
+	}
+
+	now := s.now().UTC()
+	var notifications []alertNotification
+	for _, rule := range s.sortedRules() {
+		if rule.Enabled {
+			notifications = append(notifications, s.evaluateRule(rule, now)...)
+		}
+	}
+	err := s.save()
+	s.mu.Unlock()
+
+	if len(notifications) > 0 {
+		go s.deliver(notifications)
+	}
+	return err
+}
+
+// RunEvery evaluates the rules every interval until ctx is cancelled.
+func (s *AlertService) RunEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Evaluate(); err != nil {
+				log.Printf("Warning: scheduled alert evaluation failed: %v", err)
+			}
+		}
+	}
+}
+
+type alertNotification struct {
+	alert    models.Alert
+	webhooks []string
+}
+
+// evaluateRule applies the rule to the snapshot and updates alert state. It
+// must be called with the write lock held.
+func (s *AlertService) evaluateRule(rule models.AlertRule, now time.Time) []alertNotification {
+	var notifications []alertNotification
+	seen := make(map[string]bool)
+
+	for _, condition := range s.conditions(rule, now) {
+		key := alertKey(rule.ID, condition.companyID)
+		seen[key] = true
+		alert, exists := s.alerts[key]
+
+		switch {
+		case condition.firing && (!exists || alert.State == models.AlertResolved):
+			alert = models.Alert{
+				RuleID:         rule.ID,
+				RuleName:       rule.Name,
+				CompanyID:      condition.companyID,
+				State:          models.AlertFiring,
+				Value:          condition.value,
+				Message:        condition.message,
+				FiredAt:        now,
+				LastNotifiedAt: alert.LastNotifiedAt,
+			}
+
+			cooldown := time.Duration(rule.CooldownMinutes) * time.Minute
+			suppressed := alert.LastNotifiedAt != nil && now.Sub(*alert.LastNotifiedAt) < cooldown
+			if !suppressed {
+				alert.LastNotifiedAt = &now
+				notifications = append(notifications, alertNotification{alert: alert, webhooks: s.webhooks(rule)})
+			}
+			s.alerts[key] = alert
+			s.recordTransition(alert, suppressed, now)
+
+		case condition.firing:
+			// Still firing; keep the figures current without notifying again
+			alert.RuleName = rule.Name
+			alert.Value = condition.value
+			alert.Message = condition.message
+			s.alerts[key] = alert
+
+		case exists && alert.State == models.AlertFiring:
+			notifications = append(notifications, s.resolve(rule, key, condition.message, now)...)
+		}
+	}
+
+	// Companies that dropped out of scope or out of the dataset resolve too
+	prefix := rule.ID + "/"
+	for key, alert := range s.alerts {
+		if strings.HasPrefix(key, prefix) && !seen[key] && alert.State == models.AlertFiring {
+			notifications = append(notifications, s.resolve(rule, key, "no longer evaluated", now)...)
+		}
+	}
+
+	return notifications
+}
+
+func (s *AlertService) resolve(rule models.AlertRule, key, message string, now time.Time) []alertNotification {
+	alert := s.alerts[key]
+	alert.State = models.AlertResolved
+	alert.Message = message
+	alert.ResolvedAt = &now
+	s.alerts[key] = alert
+	s.recordTransition(alert, false, now)
+
+	// Only announce a resolution when the firing was announced
+	if alert.LastNotifiedAt == nil || alert.LastNotifiedAt.Before(alert.FiredAt) {
+		return nil
+	}
+	return []alertNotification{{alert: alert, webhooks: s.webhooks(rule)}}
+}
+
+func (s *AlertService) recordTransition(alert models.Alert, suppressed bool, now time.Time) {
+	s.history = append(s.history, models.AlertTransition{
+		RuleID:     alert.RuleID,
+		CompanyID:  alert.CompanyID,
+		State:      alert.State,
+		Value:      alert.Value,
+		Message:    alert.Message,
+		Suppressed: suppressed,
+		At:         now,
+	})
+}
+
+// SetDefaultWebhooks replaces the webhooks notified for rules without their
+// own.
+func (s *AlertService) SetDefaultWebhooks(webhooks []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.defaultWebhooks = webhooks
+}
+
+// webhooks must be called with the lock held.
+func (s *AlertService) webhooks(rule models.AlertRule) []string {
+	if len(rule.Webhooks) > 0 {
+		return rule.Webhooks
+	}
+	return s.defaultWebhooks
+}
+
+// conditions evaluates a rule for every company in its scope as of now.
+func (s *AlertService) conditions(rule models.AlertRule, now time.Time) []alertCondition {
+	snapshot := s.snapshot
+	var conditions []alertCondition
+
+	var atRiskSince time.Time
+	if rule.Kind == models.AlertNewAtRiskEvent {
+		atRiskSince = s.advanceWatermark(rule.ID)
+	}
+
+	for i := range snapshot.aggregates {
+		aggregate := &snapshot.aggregates[i]
+		if len(rule.CompanyIDs) > 0 && !containsString(rule.CompanyIDs, aggregate.CompanyID) {
+			continue
+		}
+		name := s.directory.Get(aggregate.CompanyID).Name
+		if name == "" {
+			name = aggregate.CompanyID
+		}
+
+		condition := alertCondition{companyID: aggregate.CompanyID}
+		switch rule.Kind {
+		case models.AlertInactiveCompany:
+			days := int(now.Sub(aggregate.LastActivity) / day)
+			condition.value = float64(days)
+			condition.firing = condition.value > rule.Threshold
+			condition.message = fmt.Sprintf("%s has had no activity for %d days", name, days)
+
+		case models.AlertNewAtRiskEvent:
+			for _, t := range snapshot.atRisk[aggregate.CompanyID] {
+				if t.After(atRiskSince) {
+					condition.value++
+				}
+			}
+			condition.firing = condition.value > 0 && condition.value >= rule.Threshold
+			condition.message = fmt.Sprintf("%s has %g new at-risk events", name, condition.value)
+
+		case models.AlertDailyDrop:
+			count, baseline := dailyDrop(snapshot, aggregate.CompanyID, now)
+			if baseline > 0 {
+				condition.value = (baseline - float64(count)) / baseline * 100
+			}
+			condition.firing = baseline >= dailyDropMinBaseline && condition.value >= rule.Threshold
+			condition.message = fmt.Sprintf("%s had %d events yesterday vs a %.1f average over the same weekday in the previous %d weeks (%.0f%% drop)",
+				name, count, baseline, dailyDropBaselineWeeks, condition.value)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return conditions
+}
+
+// advanceWatermark returns the time after which at-risk events are new for
+// the rule, moving its watermark on when a new dataset has been loaded since
+// the rule was last evaluated. It must be called with the write lock held.
+func (s *AlertService) advanceWatermark(ruleID string) time.Time {
+	watermark := s.watermarks[ruleID]
+	if watermark.Version != s.snapshot.version {
+		watermark.Version = s.snapshot.version
+		watermark.Since = watermark.Latest
+		if latest := s.snapshot.latestAtRisk(); latest.After(watermark.Latest) {
+			watermark.Latest = latest
+		}
+		s.watermarks[ruleID] = watermark
+	}
+	return watermark.Since
+}
+
+// dailyDrop compares the last complete day before now with the average of
+// the same weekday over the previous weeks, so quiet weekends do not read as
+// drops.
+func dailyDrop(snapshot *alertSnapshot, companyID string, now time.Time) (int, float64) {
+	counts := snapshot.dailyCounts[companyID]
+	lastDay := now.Truncate(day).Add(-day)
+
+	total := 0
+	for week := 1; week <= dailyDropBaselineWeeks; week++ {
+		total += counts[lastDay.AddDate(0, 0, -7*week).Format("2006-01-02")]
+	}
+	return counts[lastDay.Format("2006-01-02")], float64(total) / dailyDropBaselineWeeks
+}
+
+func (s *AlertService) deliver(notifications []alertNotification) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	for _, notification := range notifications {
+		if len(notification.webhooks) == 0 {
+			continue
+		}
+
+		payload := alertPayload(notification.alert, s.directory.Get(notification.alert.CompanyID).Name)
+		var failures []string
+		for _, delivery := range s.notifier.Send(ctx, notification.webhooks, payload) {
+			if delivery.Error != "" {
+				failures = append(failures, delivery.URL+": "+delivery.Error)
+			}
+		}
+		if len(failures) > 0 {
+			log.Printf("Warning: alert webhook delivery failed: %s", strings.Join(failures, "; "))
+		}
+
+		s.mu.Lock()
+		key := alertKey(notification.alert.RuleID, notification.alert.CompanyID)
+		if alert, ok := s.alerts[key]; ok {
+			alert.DeliveryError = strings.Join(failures, "; ")
+			s.alerts[key] = alert
+		}
+		s.mu.Unlock()
+	}
+}
+
+// TestRule sends a sample notification for a rule and reports how each
+// webhook responded.
+func (s *AlertService) TestRule(ctx context.Context, id string) ([]models.WebhookDelivery, error) {
+	rule, err := s.GetRule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	webhooks := s.webhooks(rule)
+	s.mu.RUnlock()
+	if len(webhooks) == 0 {
+		return nil, fmt.Errorf("%w: rule %s has no webhooks and no default webhook is configured", ErrInvalidAlertRule, id)
+	}
+
+	alert := models.Alert{
+		RuleID:   rule.ID,
+		RuleName: rule.Name,
+		State:    models.AlertFiring,
+		Message:  "This is a test notification",
+		FiredAt:  time.Now().UTC(),
+	}
+	return s.notifier.Send(ctx, webhooks, alertPayload(alert, "")), nil
+}
+
+// Alerts returns the current alerts, optionally only those in one state,
+// firing first and then most recent first.
+func (s *AlertService) Alerts(state string) []models.Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	alerts := []models.Alert{}
+	for _, alert := range s.alerts {
+		if state == "" || alert.State == state {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].State != alerts[j].State {
+			return alerts[i].State == models.AlertFiring
+		}
+		return alerts[i].FiredAt.After(alerts[j].FiredAt)
+	})
+	return alerts
+}
+
+// History returns state transitions newest first, optionally for one rule,
+// leaving out companies outside scope when it is not nil.
+func (s *AlertService) History(ruleID string, limit int, scope []string) []models.AlertTransition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := []models.AlertTransition{}
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if (ruleID != "" && s.history[i].RuleID != ruleID) ||
+			(scope != nil && !containsString(scope, s.history[i].CompanyID)) {
+			continue
+		}
+		history = append(history, s.history[i])
+		if limit > 0 && len(history) == limit {
+			break
+		}
+	}
+	return history
+}
+
+func (s *AlertService) ListRules() []models.AlertRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedRules()
+}
+
+func (s *AlertService) sortedRules() []models.AlertRule {
+	rules := make([]models.AlertRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].CreatedAt.Before(rules[j].CreatedAt)
+	})
+	return rules
+}
+
+func (s *AlertService) GetRule(id string) (models.AlertRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rule, ok := s.rules[id]
+	if !ok {
+		return models.AlertRule{}, fmt.Errorf("alert rule %s: %w", id, ErrNotFound)
+	}
+	return rule, nil
+}
+
+func (s *AlertService) CreateRule(request models.AlertRuleRequest) (models.AlertRule, error) {
+	now := time.Now().UTC()
+	rule := models.AlertRule{
+		ID:              newID(),
+		Enabled:         true,
+		CooldownMinutes: defaultAlertCooldown,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	applyAlertRuleRequest(&rule, request)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// At-risk rules only report events that arrive after they were created
+	if rule.Kind == models.AlertNewAtRiskEvent && s.snapshot != nil {
+		latest := s.snapshot.latestAtRisk()
+		s.watermarks[rule.ID] = atRiskWatermark{Version: s.snapshot.version, Since: latest, Latest: latest}
+	}
+
+	s.rules[rule.ID] = rule
+	if err := s.saveRules(); err != nil {
+		delete(s.rules, rule.ID)
+		delete(s.watermarks, rule.ID)
+		return models.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+func (s *AlertService) UpdateRule(id string, request models.AlertRuleRequest) (models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.rules[id]
+	if !ok {
+		return models.AlertRule{}, fmt.Errorf("alert rule %s: %w", id, ErrNotFound)
+	}
+
+	rule := previous
+	applyAlertRuleRequest(&rule, request)
+	rule.UpdatedAt = time.Now().UTC()
+
+	// Like new rules, rules turned into at-risk rules start from the events
+	// already loaded
+	watermark, hadWatermark := s.watermarks[id]
+	if rule.Kind == models.AlertNewAtRiskEvent && previous.Kind != rule.Kind && s.snapshot != nil {
+		latest := s.snapshot.latestAtRisk()
+		s.watermarks[id] = atRiskWatermark{Version: s.snapshot.version, Since: latest, Latest: latest}
+	}
+
+	s.rules[id] = rule
+	if err := s.saveRules(); err != nil {
+		s.rules[id] = previous
+		if hadWatermark {
+			s.watermarks[id] = watermark
+		} else {
+			delete(s.watermarks, id)
+		}
+		return models.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+// DeleteRule removes a rule along with its alerts; its history is kept.
+func (s *AlertService) DeleteRule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.rules[id]
+	if !ok {
+		return fmt.Errorf("alert rule %s: %w", id, ErrNotFound)
+	}
+
+	delete(s.rules, id)
+	if err := s.saveRules(); err != nil {
+		s.rules[id] = previous
+		return err
+	}
+
+	prefix := id + "/"
+	for key := range s.alerts {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.alerts, key)
+		}
+	}
+	delete(s.watermarks, id)
+	return s.save()
+}
+
+func applyAlertRuleRequest(rule *models.AlertRule, request models.AlertRuleRequest) {
+	kind := strings.TrimSpace(request.Kind)
+	if kind != rule.Kind {
+		rule.Threshold = alertKinds[kind]
+	}
+	rule.Kind = kind
+	rule.Name = strings.TrimSpace(request.Name)
+	if rule.Name == "" {
+		rule.Name = kind
+	}
+	if request.Threshold != nil {
+		rule.Threshold = *request.Threshold
+	}
+	rule.CompanyIDs = request.CompanyIDs
+	if request.CooldownMinutes != nil {
+		rule.CooldownMinutes = *request.CooldownMinutes
+	}
+	rule.Webhooks = request.Webhooks
+	if request.Enabled != nil {
+		rule.Enabled = *request.Enabled
+	}
+}
+
+// saveRules must be called with the write lock held.
+func (s *AlertService) saveRules() error {
+	return saveJSONFile(s.rulesPath, s.sortedRules())
+}
+
+// save must be called with the write lock held.
+func (s *AlertService) save() error {
+	if len(s.history) > maxAlertHistory {
+		s.history = append([]models.AlertTransition(nil), s.history[len(s.history)-maxAlertHistory:]...)
+	}
+
+	store := alertStore{
+		Alerts:     make([]models.Alert, 0, len(s.alerts)),
+		History:    s.history,
+		Watermarks: s.watermarks,
+	}
+	for _, alert := range s.alerts {
+		store.Alerts = append(store.Alerts, alert)
+	}
+	sort.Slice(store.Alerts, func(i, j int) bool {
+		return alertKey(store.Alerts[i].RuleID, store.Alerts[i].CompanyID) <
+			alertKey(store.Alerts[j].RuleID, store.Alerts[j].CompanyID)
+	})
+
+	return saveJSONFile(s.statePath, store)
+}
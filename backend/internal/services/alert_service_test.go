@@ -0,0 +1,132 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestAlertService(t *testing.T, now *time.Time) *AlertService {
+	t.Helper()
+	dir := t.TempDir()
+	service, err := NewAlertService(filepath.Join(dir, "rules.json"), filepath.Join(dir, "state.json"), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.now = func() time.Time { return *now }
+	return service
+}
+
+func createTestRule(t *testing.T, service *AlertService, kind string, threshold float64) models.AlertRule {
+	t.Helper()
+	rule, err := service.CreateRule(models.AlertRuleRequest{Kind: kind, Threshold: &threshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func alertState(service *AlertService, rule models.AlertRule, companyID string) string {
+	service.mu.RLock()
+	defer service.mu.RUnlock()
+
+	return service.alerts[alertKey(rule.ID, companyID)].State
+}
+
+func activityEvent(companyID string, at time.Time, content string) models.UsageEvent {
+	return models.UsageEvent{ID: companyID + at.Format(time.RFC3339), CompanyID: companyID, CreatedAt: at, Content: content}
+}
+
+func TestInactivityIsMeasuredFromTheClock(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := newTestAlertService(t, &now)
+	rule := createTestRule(t, service, models.AlertInactiveCompany, 7)
+
+	events := []models.UsageEvent{activityEvent("acme", now.AddDate(0, 0, -3), "login")}
+	if err := service.OnDataLoad(events, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if state := alertState(service, rule, "acme"); state != "" {
+		t.Fatalf("3 days after the last event: state %q, want no alert", state)
+	}
+
+	// The data stays the same, but time moves on between scheduled runs
+	now = now.AddDate(0, 0, 6)
+	if err := service.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	if state := alertState(service, rule, "acme"); state != models.AlertFiring {
+		t.Fatalf("9 days after the last event: state %q, want %q", state, models.AlertFiring)
+	}
+}
+
+func TestDailyDropComparesYesterdayWithPreviousWeeks(t *testing.T) {
+	now := time.Date(2025, 6, 10, 9, 0, 0, 0, time.UTC)
+	service := newTestAlertService(t, &now)
+	rule := createTestRule(t, service, models.AlertDailyDrop, 50)
+
+	// Ten events on the same weekday in each of the previous four weeks,
+	// one yesterday
+	yesterday := time.Date(2025, 6, 9, 10, 0, 0, 0, time.UTC)
+	var events []models.UsageEvent
+	for week := 1; week <= dailyDropBaselineWeeks; week++ {
+		for i := 0; i < 10; i++ {
+			events = append(events, activityEvent("acme", yesterday.AddDate(0, 0, -7*week).Add(time.Duration(i)*time.Minute), "login"))
+		}
+	}
+	events = append(events, activityEvent("acme", yesterday, "login"))
+
+	if err := service.OnDataLoad(events, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if state := alertState(service, rule, "acme"); state != models.AlertFiring {
+		t.Fatalf("state %q, want %q", state, models.AlertFiring)
+	}
+}
+
+func TestNewAtRiskAlertsFollowTheDatasetVersion(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := newTestAlertService(t, &now)
+
+	events := []models.UsageEvent{activityEvent("acme", now.AddDate(0, 0, -2), "at risk - Bank Balance Degradation")}
+	if err := service.OnDataLoad(events, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	rule := createTestRule(t, service, models.AlertNewAtRiskEvent, 1)
+
+	// Events loaded before the rule was created are not new
+	if err := service.Evaluate(); err != nil {
+		t.Fatal(err)
+	}
+	if state := alertState(service, rule, "acme"); state != "" {
+		t.Fatalf("before new events: state %q, want no alert", state)
+	}
+
+	events = append(events, activityEvent("acme", now.AddDate(0, 0, -1), "at risk - Bank Balance Degradation"))
+	if err := service.OnDataLoad(events, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if state := alertState(service, rule, "acme"); state != models.AlertFiring {
+		t.Fatalf("after new events: state %q, want %q", state, models.AlertFiring)
+	}
+
+	// Scheduled runs over the same dataset keep the alert firing
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Hour)
+		if err := service.Evaluate(); err != nil {
+			t.Fatal(err)
+		}
+		if state := alertState(service, rule, "acme"); state != models.AlertFiring {
+			t.Fatalf("scheduled run %d: state %q, want %q", i, state, models.AlertFiring)
+		}
+	}
+
+	// The next dataset without new at-risk events resolves it
+	if err := service.OnDataLoad(events, "v3"); err != nil {
+		t.Fatal(err)
+	}
+	if state := alertState(service, rule, "acme"); state != models.AlertResolved {
+		t.Fatalf("after a load without new events: state %q, want %q", state, models.AlertResolved)
+	}
+}
@@ -2,94 +2,350 @@ package services
 
 import (
 	"assembly-dashboard-backend/internal/models"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// DataLoadHook is called with every dataset the service loads, after it has
+// been swapped in. The events must not be modified.
+type DataLoadHook func(events []models.UsageEvent, version string) error
+
 type AnalyticsService struct {
+	mu            sync.RWMutex
+	loadMu        sync.Mutex // serializes loads so hooks see datasets in order
 	csvParser     *CSVParserService
 	filterService *FilterService
 	exportService *ExportService
+	directory     *CompanyDirectory
+	annotations   *AnnotationService
 	events        []models.UsageEvent
 	lastLoad      time.Time
+	version       string
+	eventTypes    []string
+	hooks         []DataLoadHook
 }
 
-func NewAnalyticsService() *AnalyticsService {
+func NewAnalyticsService(directory *CompanyDirectory, annotations *AnnotationService) *AnalyticsService {
 	filterService := NewFilterService()
+	filterService.SetDirectory(directory)
 	return &AnalyticsService{
 		filterService: filterService,
-		exportService: NewExportService(filterService),
+		exportService: NewExportService(filterService, directory),
+		directory:     directory,
+		annotations:   annotations,
 	}
 }
 
+// Initialize loads the CSV files in dataPath. It can be called again to
+// switch to another directory.
 func (s *AnalyticsService) Initialize(dataPath string) error {
+	s.loadMu.Lock()
 	s.csvParser = NewCSVParserService(dataPath)
+	s.loadMu.Unlock()
+	return s.loadData()
+}
+
+// Reload re-reads the CSV files and swaps them in, rebuilding the search
+// index. Requests in flight keep reading the previous dataset until it is done.
+func (s *AnalyticsService) Reload() error {
 	return s.loadData()
 }
 
+// OnDataLoad registers a hook to run after every load. Register hooks before
+// Initialize so they also see the first dataset.
+func (s *AnalyticsService) OnDataLoad(hook DataLoadHook) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	s.hooks = append(s.hooks, hook)
+}
+
 func (s *AnalyticsService) loadData() error {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	if s.csvParser == nil {
+		return fmt.Errorf("analytics service has not been initialized")
+	}
 	events, err := s.csvParser.ParseAllCSVFiles()
 	if err != nil {
 		return fmt.Errorf("failed to load CSV data: %w", err)
 	}
 
+	loadedAt := time.Now()
+	version := strconv.FormatInt(loadedAt.UnixNano(), 36)
+	eventTypes := s.filterService.GetAvailableFilters(events).EventTypes
+	sort.Strings(eventTypes)
+	// Build the index before taking the lock, so requests keep being served
+	// from the previous dataset in the meantime
+	index := NewSearchIndex(events)
+
+	s.mu.Lock()
 	s.events = events
-	s.lastLoad = time.Now()
+	s.lastLoad = loadedAt
+	s.version = version
+	s.eventTypes = eventTypes
+	s.filterService.SetDataset(events, version, index)
+	s.mu.Unlock()
+
 	fmt.Printf("Loaded %d events from CSV files\n", len(events))
 
+	for _, hook := range s.hooks {
+		if err := hook(events, version); err != nil {
+			fmt.Printf("Warning: data load hook failed: %v\n", err)
+		}
+	}
+
 	return nil
 }
 
-func (s *AnalyticsService) GetDashboardSummary() *models.DashboardSummary {
+func (s *AnalyticsService) GetDatasetInfo() models.DatasetInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return models.DatasetInfo{
+		Version:    s.version,
+		EventCount: len(s.events),
+		LoadedAt:   s.lastLoad,
+	}
+}
+
+// EventTypes returns the event types present in the loaded dataset.
+func (s *AnalyticsService) EventTypes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.eventTypes
+}
+
+// GetDashboardSummary computes the dashboard over the events matching
+// filters. Available filters describe every event the caller may see, not
+// just the matching ones, so the panel keeps offering every option.
+func (s *AnalyticsService) GetDashboardSummary(filters models.FilterParams) (*models.DashboardSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if len(s.events) == 0 {
-		return s.getMockSummary()
+		return s.getMockSummary(), nil
+	}
+
+	events, err := s.filterService.FilterEvents(s.events, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := s.events
+	if filters.Scope != nil {
+		visible, err = s.filterService.FilterEvents(s.events, models.FilterParams{Scope: filters.Scope})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	summary := &models.DashboardSummary{
-		TotalEvents:      len(s.events),
-		UniqueCompanies:  s.getUniqueCompanyCount(),
-		EventTypes:       s.getEventTypeBreakdown(),
-		RecentEvents:     s.getRecentEvents(10),
-		TimeRange:        s.getTimeRange(),
-		TimeSeriesData:   s.getTimeSeriesData(),
-		TopCompanies:     s.getTopCompanies(5),
-		DailyTrends:      s.getDailyTrends(),
-		AvailableFilters: s.filterService.GetAvailableFilters(s.events),
-	}
-
-	return summary
+		TotalEvents:      len(events),
+		UniqueCompanies:  s.getUniqueCompanyCount(events),
+		EventTypes:       s.getEventTypeBreakdown(events),
+		RecentEvents:     s.getRecentEvents(events, 10),
+		TimeRange:        s.getTimeRange(events),
+		TimeSeriesData:   s.getTimeSeriesData(events),
+		TopCompanies:     s.getTopCompanies(events, 5),
+		DailyTrends:      s.getDailyTrends(events),
+		AvailableFilters: s.filterService.GetAvailableFilters(visible),
+	}
+
+	// Join directory entries for every company the summary mentions
+	companyIDs := append([]string(nil), summary.AvailableFilters.Companies...)
+	for i := range summary.TopCompanies {
+		company := s.directory.Get(summary.TopCompanies[i].CompanyID)
+		summary.TopCompanies[i].Company = &company
+	}
+	summary.Companies = s.directory.Lookup(companyIDs)
+	summary.Annotations = s.annotations.List(annotationQuery(filters))
+
+	return summary, nil
+}
+
+// GetCompanyTimeline returns the activity of one company over time, narrowed
+// down by filters, together with the annotations covering it.
+func (s *AnalyticsService) GetCompanyTimeline(companyID string, filters models.FilterParams) (*models.CompanyTimeline, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	known := false
+	for i := range s.events {
+		if s.events[i].CompanyID == companyID {
+			known = true
+			break
+		}
+	}
+	// Companies outside the caller's scope are reported as unknown rather
+	// than forbidden, so their IDs cannot be probed
+	if !known || (filters.Scope != nil && !containsString(filters.Scope, companyID)) {
+		return nil, fmt.Errorf("company %s: %w", companyID, ErrNotFound)
+	}
+
+	filters.CompanyIDs = []string{companyID}
+	events, err := s.filterService.FilterEvents(s.events, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CompanyTimeline{
+		Company:        s.directory.Get(companyID),
+		TotalEvents:    len(events),
+		TimeSeriesData: s.getTimeSeriesData(events),
+		DailyTrends:    s.getDailyTrends(events),
+		Annotations:    s.annotations.List(annotationQuery(filters)),
+	}, nil
 }
 
-func (s *AnalyticsService) SearchEvents(filters models.FilterParams) models.FilteredResults {
+// GetCompanyAggregates returns the activity aggregates of every company,
+// joined with its directory entry.
+func (s *AnalyticsService) GetCompanyAggregates() []models.CompanyAggregate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	aggregates := computeCompanyAggregates(s.events)
+	for i := range aggregates {
+		company := s.directory.Get(aggregates[i].CompanyID)
+		aggregates[i].Company = &company
+	}
+	return aggregates
+}
+
+// annotationQuery selects the annotations relevant to a filtered view.
+func annotationQuery(filters models.FilterParams) models.AnnotationQuery {
+	return models.AnnotationQuery{
+		CompanyIDs: filters.CompanyIDs,
+		From:       filters.StartDate,
+		To:         filters.EndDate,
+		Scope:      filters.Scope,
+	}
+}
+
+func (s *AnalyticsService) SearchEvents(filters models.FilterParams) (models.FilteredResults, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if len(s.events) == 0 {
 		return models.FilteredResults{
 			Events:        []models.UsageEvent{},
 			TotalCount:    0,
 			FilteredCount: 0,
-		}
+		}, nil
+	}
+
+	results, err := s.filterService.ApplyFilters(s.events, filters)
+	if err != nil {
+		return results, err
 	}
 
-	return s.filterService.ApplyFilters(s.events, filters)
+	results.Companies = s.directory.LookupEvents(results.Events)
+	return results, nil
+}
+
+// PreparedExport is the filtered snapshot of the dataset an export is
+// written from, so a reload part way through does not change its contents.
+type PreparedExport struct {
+	Request     models.ExportRequest
+	Events      []models.UsageEvent
+	Annotations []models.Annotation
+	Table       *ExportTable // aggregate exports only
+	Filename    string
+	ContentType string
+	Redaction   string // policy applied to Events
+}
+
+// Redact applies a redaction policy to the exported events.
+func (e *PreparedExport) Redact(redaction *Redaction) {
+	e.Events = redaction.Events(e.Events)
+	e.Redaction = redaction.Name()
+}
+
+// AuditEntry describes the export for the audit log: its request, rows and
+// filename.
+func (e *PreparedExport) AuditEntry() models.ExportAuditEntry {
+	entry := e.Request.AuditEntry()
+	entry.Rows = e.Rows()
+	entry.Filename = e.Filename
+	entry.Redaction = e.Redaction
+	return entry
+}
+
+// Rows is the number of rows the export will write.
+func (e *PreparedExport) Rows() int {
+	if e.Table != nil {
+		return len(e.Table.Rows)
+	}
+	return len(e.Events)
 }
 
-func (s *AnalyticsService) ExportData(request models.ExportRequest) ([]byte, string, string, error) {
+func (s *AnalyticsService) PrepareExport(request models.ExportRequest) (*PreparedExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if len(s.events) == 0 {
-		return nil, "", "", fmt.Errorf("no data available for export")
+		return nil, fmt.Errorf("no data available for export")
 	}
 
-	data, contentType, err := s.exportService.ExportData(s.events, request)
+	events, err := s.exportService.FilterEvents(s.events, request)
 	if err != nil {
-		return nil, "", "", err
+		return nil, err
+	}
+
+	export := &PreparedExport{
+		Request:     request,
+		Events:      events,
+		Filename:    s.exportService.GetFilename(request.Kind, request.Format, request.Filters),
+		ContentType: s.exportService.ContentType(request.Format),
+	}
+	if request.Kind != "" && request.Kind != ExportKindEvents {
+		export.Table = s.buildExportTable(request.Kind, events)
+		export.Events = nil
+	} else if request.IncludeAnnotations {
+		export.Annotations = s.annotations.List(annotationQuery(request.Filters))
+	}
+	if request.Compress {
+		export.Filename += ".gz"
+		export.ContentType = "application/gzip"
+	}
+	return export, nil
+}
+
+// WriteExport streams a prepared export to w, gzipping it when the request
+// asks for a compressed file.
+func (s *AnalyticsService) WriteExport(ctx context.Context, w io.Writer, export *PreparedExport, progress ExportProgress) error {
+	if !export.Request.Compress {
+		return s.writeExport(ctx, w, export, progress)
+	}
+
+	gz := gzip.NewWriter(w)
+	if err := s.writeExport(ctx, gz, export, progress); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress export: %w", err)
 	}
+	return nil
+}
 
-	filename := s.exportService.GetFilename(request.Format, request.Filters)
-	return data, contentType, filename, nil
+func (s *AnalyticsService) writeExport(ctx context.Context, w io.Writer, export *PreparedExport, progress ExportProgress) error {
+	if export.Table != nil {
+		return s.exportService.WriteTable(ctx, w, export.Table, export.Request, progress)
+	}
+	return s.exportService.WriteExport(ctx, w, export.Events, export.Request, export.Annotations, progress)
 }
 
-func (s *AnalyticsService) getUniqueCompanyCount() int {
+func (s *AnalyticsService) getUniqueCompanyCount(events []models.UsageEvent) int {
 	companies := make(map[string]bool)
-	for _, event := range s.events {
+	for _, event := range events {
 		if event.CompanyID != "" {
 			companies[event.CompanyID] = true
 		}
@@ -97,9 +353,9 @@ func (s *AnalyticsService) getUniqueCompanyCount() int {
 	return len(companies)
 }
 
-func (s *AnalyticsService) getEventTypeBreakdown() map[string]int {
+func (s *AnalyticsService) getEventTypeBreakdown(events []models.UsageEvent) map[string]int {
 	breakdown := make(map[string]int)
-	for _, event := range s.events {
+	for _, event := range events {
 		if event.Type != "" {
 			breakdown[event.Type]++
 		}
@@ -107,13 +363,13 @@ func (s *AnalyticsService) getEventTypeBreakdown() map[string]int {
 	return breakdown
 }
 
-func (s *AnalyticsService) getRecentEvents(limit int) []models.UsageEvent {
-	if len(s.events) == 0 {
+func (s *AnalyticsService) getRecentEvents(events []models.UsageEvent, limit int) []models.UsageEvent {
+	if len(events) == 0 {
 		return []models.UsageEvent{}
 	}
 
-	sortedEvents := make([]models.UsageEvent, len(s.events))
-	copy(sortedEvents, s.events)
+	sortedEvents := make([]models.UsageEvent, len(events))
+	copy(sortedEvents, events)
 
 	sort.Slice(sortedEvents, func(i, j int) bool {
 		return sortedEvents[i].CreatedAt.After(sortedEvents[j].CreatedAt)
@@ -125,8 +381,8 @@ func (s *AnalyticsService) getRecentEvents(limit int) []models.UsageEvent {
 	return sortedEvents
 }
 
-func (s *AnalyticsService) getTimeRange() map[string]interface{} {
-	if len(s.events) == 0 {
+func (s *AnalyticsService) getTimeRange(events []models.UsageEvent) map[string]interface{} {
+	if len(events) == 0 {
 		now := time.Now()
 		return map[string]interface{}{
 			"start": now.AddDate(0, -1, 0),
@@ -134,10 +390,10 @@ func (s *AnalyticsService) getTimeRange() map[string]interface{} {
 		}
 	}
 
-	minTime := s.events[0].CreatedAt
-	maxTime := s.events[0].CreatedAt
+	minTime := events[0].CreatedAt
+	maxTime := events[0].CreatedAt
 
-	for _, event := range s.events {
+	for _, event := range events {
 		if event.CreatedAt.Before(minTime) {
 			minTime = event.CreatedAt
 		}
@@ -152,14 +408,14 @@ func (s *AnalyticsService) getTimeRange() map[string]interface{} {
 	}
 }
 
-func (s *AnalyticsService) getTimeSeriesData() []models.TimeSeriesPoint {
-	if len(s.events) == 0 {
+func (s *AnalyticsService) getTimeSeriesData(events []models.UsageEvent) []models.TimeSeriesPoint {
+	if len(events) == 0 {
 		return []models.TimeSeriesPoint{}
 	}
 
 	dailyCounts := make(map[string]int)
 
-	for _, event := range s.events {
+	for _, event := range events {
 		date := event.CreatedAt.Format("2006-01-02")
 		dailyCounts[date]++
 	}
@@ -179,14 +435,14 @@ func (s *AnalyticsService) getTimeSeriesData() []models.TimeSeriesPoint {
 	return points
 }
 
-func (s *AnalyticsService) getTopCompanies(limit int) []models.CompanyAnalytics {
-	if len(s.events) == 0 {
+func (s *AnalyticsService) getTopCompanies(events []models.UsageEvent, limit int) []models.CompanyAnalytics {
+	if len(events) == 0 {
 		return []models.CompanyAnalytics{}
 	}
 
 	companyStats := make(map[string]*models.CompanyAnalytics)
 
-	for _, event := range s.events {
+	for _, event := range events {
 		if event.CompanyID == "" {
 			continue
 		}
@@ -225,16 +481,16 @@ func (s *AnalyticsService) getTopCompanies(limit int) []models.CompanyAnalytics
 	return companies
 }
 
-func (s *AnalyticsService) getDailyTrends() map[string][]models.TimeSeriesPoint {
+func (s *AnalyticsService) getDailyTrends(events []models.UsageEvent) map[string][]models.TimeSeriesPoint {
 	trends := make(map[string][]models.TimeSeriesPoint)
 
-	if len(s.events) == 0 {
+	if len(events) == 0 {
 		return trends
 	}
 
 	typeDateCounts := make(map[string]map[string]int)
 
-	for _, event := range s.events {
+	for _, event := range events {
 		eventType := event.Type
 		if eventType == "" {
 			eventType = "Unknown"
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AnnotationService struct {
+	mu          sync.RWMutex
+	path        string
+	annotations map[string]models.Annotation
+}
+
+func NewAnnotationService(path string) (*AnnotationService, error) {
+	s := &AnnotationService{
+		path:        path,
+		annotations: make(map[string]models.Annotation),
+	}
+
+	var stored []models.Annotation
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for _, annotation := range stored {
+		s.annotations[annotation.ID] = annotation
+	}
+
+	return s, nil
+}
+
+// List returns the annotations matching query, ordered by start date with
+// undated annotations first.
+func (s *AnnotationService) List(query models.AnnotationQuery) []models.Annotation {
+	if s == nil {
+		return []models.Annotation{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	annotations := []models.Annotation{}
+	for _, annotation := range s.annotations {
+		if annotationMatches(annotation, query) {
+			annotations = append(annotations, annotation)
+		}
+	}
+
+	sortAnnotations(annotations)
+	return annotations
+}
+
+func annotationMatches(annotation models.Annotation, query models.AnnotationQuery) bool {
+	if annotation.CompanyID != "" && len(query.CompanyIDs) > 0 && !containsString(query.CompanyIDs, annotation.CompanyID) {
+		return false
+	}
+	if annotation.CompanyID != "" && query.Scope != nil && !containsString(query.Scope, annotation.CompanyID) {
+		return false
+	}
+	if query.From != nil && annotation.EndDate != nil && annotation.EndDate.Before(*query.From) {
+		return false
+	}
+	if query.To != nil && annotation.StartDate != nil && annotation.StartDate.After(*query.To) {
+		return false
+	}
+	return true
+}
+
+func sortAnnotations(annotations []models.Annotation) {
+	sort.Slice(annotations, func(i, j int) bool {
+		a, b := annotations[i], annotations[j]
+		switch {
+		case a.StartDate == nil && b.StartDate != nil:
+			return true
+		case a.StartDate != nil && b.StartDate == nil:
+			return false
+		case a.StartDate != nil && !a.StartDate.Equal(*b.StartDate):
+			return a.StartDate.Before(*b.StartDate)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+}
+
+// annotationsCovering returns the annotations that apply to an event of the
+// given company at time t.
+func annotationsCovering(annotations []models.Annotation, companyID string, t time.Time) []models.Annotation {
+	var covering []models.Annotation
+	for _, annotation := range annotations {
+		if annotation.CompanyID != "" && annotation.CompanyID != companyID {
+			continue
+		}
+		if annotation.StartDate != nil && t.Before(*annotation.StartDate) {
+			continue
+		}
+		if annotation.EndDate != nil && t.After(*annotation.EndDate) {
+			continue
+		}
+		covering = append(covering, annotation)
+	}
+	return covering
+}
+
+func (s *AnnotationService) Get(id string) (models.Annotation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	annotation, ok := s.annotations[id]
+	if !ok {
+		return models.Annotation{}, fmt.Errorf("annotation %s: %w", id, ErrNotFound)
+	}
+	return annotation, nil
+}
+
+// Create stores an annotation. Dates are parsed by the caller, which knows
+// whether a date-only end bound should cover the whole day.
+func (s *AnnotationService) Create(request models.AnnotationRequest, startDate, endDate *time.Time) (models.Annotation, error) {
+	annotation := models.Annotation{
+		ID:        newID(),
+		CompanyID: strings.TrimSpace(request.CompanyID),
+		StartDate: startDate,
+		EndDate:   endDate,
+		Text:      strings.TrimSpace(request.Text),
+		Author:    strings.TrimSpace(request.Author),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.annotations[annotation.ID] = annotation
+	if err := s.save(); err != nil {
+		delete(s.annotations, annotation.ID)
+		return models.Annotation{}, err
+	}
+	return annotation, nil
+}
+
+func (s *AnnotationService) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.annotations[id]
+	if !ok {
+		return fmt.Errorf("annotation %s: %w", id, ErrNotFound)
+	}
+
+	delete(s.annotations, id)
+	if err := s.save(); err != nil {
+		s.annotations[id] = previous
+		return err
+	}
+	return nil
+}
+
+// save must be called with the write lock held.
+func (s *AnnotationService) save() error {
+	annotations := make([]models.Annotation, 0, len(s.annotations))
+	for _, annotation := range s.annotations {
+		annotations = append(annotations, annotation)
+	}
+	sort.Slice(annotations, func(i, j int) bool {
+		return annotations[i].CreatedAt.Before(annotations[j].CreatedAt)
+	})
+
+	return saveJSONFile(s.path, annotations)
+}
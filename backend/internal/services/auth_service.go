@@ -0,0 +1,419 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnauthenticated = errors.New("invalid or missing credentials")
+
+const (
+	// apiKeyPrefix starts every API key so they are easy to recognise, for
+	// instance by secret scanners.
+	apiKeyPrefix = "adk_"
+
+	// jwtLeeway allows for clock differences with the token issuer.
+	jwtLeeway = time.Minute
+
+	// keyUseInterval is how often a key's last use is written back, so
+	// authenticating does not save the store on every request.
+	keyUseInterval = time.Hour
+)
+
+var roleRanks = map[string]int{
+	models.RoleViewer:  1,
+	models.RoleAnalyst: 2,
+	models.RoleAdmin:   3,
+}
+
+// IsRole reports whether role is one of viewer, analyst or admin.
+func IsRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// InWorkspace reports whether a principal may use a workspace.
+func InWorkspace(principal models.Principal, workspace string) bool {
+	return len(principal.Workspaces) == 0 || containsString(principal.Workspaces, workspace)
+}
+
+// HasRole reports whether a principal with role may do what required needs.
+func HasRole(role, required string) bool {
+	return IsRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// JWTConfig is how bearer tokens are verified. Tokens are HS256 signed with
+// Secret; Issuer and Audience are checked when set.
+type JWTConfig struct {
+	Secret   []byte
+	Issuer   string
+	Audience string
+}
+
+// AuthService authenticates API keys and JWT bearer tokens. API keys are
+// stored as SHA-256 hashes of their secrets; as the secrets are random, a
+// slow password hash would add nothing.
+type AuthService struct {
+	mu     sync.RWMutex
+	path   string
+	keys   map[string]*models.APIKey
+	byHash map[string]*models.APIKey
+	jwt    JWTConfig
+}
+
+func NewAuthService(path string, jwt JWTConfig) (*AuthService, error) {
+	s := &AuthService{
+		path:   path,
+		keys:   make(map[string]*models.APIKey),
+		byHash: make(map[string]*models.APIKey),
+		jwt:    jwt,
+	}
+
+	var stored []models.APIKey
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for i := range stored {
+		key := &stored[i]
+		s.keys[key.ID] = key
+		s.byHash[key.Hash] = key
+		if key.RevokedAt == nil && !CompanyScopeFits(key.CompanyIDs, key.Workspaces) {
+			log.Printf("Warning: api key %s is limited to companies but not to a single workspace; it will be refused until reissued", key.ID)
+		}
+	}
+
+	return s, nil
+}
+
+// Authenticate resolves a bearer credential, either an API key or a JWT.
+func (s *AuthService) Authenticate(credential string) (models.Principal, error) {
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		return s.authenticateKey(credential)
+	}
+	if strings.Count(credential, ".") == 2 && len(s.jwt.Secret) > 0 {
+		return s.authenticateJWT(credential)
+	}
+	return models.Principal{}, ErrUnauthenticated
+}
+
+func (s *AuthService) authenticateKey(secret string) (models.Principal, error) {
+	hash := hashAPIKey(secret)
+	now := time.Now().UTC()
+
+	s.mu.RLock()
+	key, ok := s.byHash[hash]
+	var principal models.Principal
+	// Keys saved before company scopes were tied to one workspace are
+	// refused rather than let them read the same company IDs everywhere
+	usable := ok && key.RevokedAt == nil && (key.ExpiresAt == nil || now.Before(*key.ExpiresAt)) &&
+		CompanyScopeFits(key.CompanyIDs, key.Workspaces)
+	if usable {
+		principal = models.Principal{
+			Subject:    key.Name,
+			Role:       key.Role,
+			Method:     models.AuthAPIKey,
+			KeyID:      key.ID,
+			ExpiresAt:  key.ExpiresAt,
+			CompanyIDs: key.CompanyIDs,
+			Workspaces: key.Workspaces,
+		}
+	}
+	stale := usable && (key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > keyUseInterval)
+	s.mu.RUnlock()
+
+	if !usable {
+		return models.Principal{}, ErrUnauthenticated
+	}
+	if stale {
+		s.mu.Lock()
+		key.LastUsedAt = &now
+		if err := s.save(); err != nil {
+			log.Printf("Warning: failed to record use of api key %s: %v", key.ID, err)
+		}
+		s.mu.Unlock()
+	}
+	return principal, nil
+}
+
+// jwtClaims are the claims read from a token. Role must be one of the API's
+// roles; exp is required so tokens cannot be valid forever. Workspaces, when
+// present, limits the token to those workspaces. CompanyIDs limits it to
+// those companies and needs exactly one workspace alongside it, as company
+// IDs are only meaningful within a workspace's dataset.
+type jwtClaims struct {
+	Subject    string          `json:"sub"`
+	Role       string          `json:"role"`
+	CompanyIDs *[]string       `json:"company_ids"`
+	Workspaces *[]string       `json:"workspaces"`
+	Issuer     string          `json:"iss"`
+	Audience   json.RawMessage `json:"aud"`
+	ExpiresAt  *float64        `json:"exp"`
+	NotBefore  *float64        `json:"nbf"`
+}
+
+func (s *AuthService) authenticateJWT(token string) (models.Principal, error) {
+	parts := strings.Split(token, ".")
+	invalid := func(reason string) (models.Principal, error) {
+		return models.Principal{}, fmt.Errorf("%w: %s", ErrUnauthenticated, reason)
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return invalid("malformed token header")
+	}
+	// Only HS256 is accepted, whatever the header asks for, so a token
+	// cannot downgrade itself to "none" or another algorithm
+	if header.Algorithm != "HS256" {
+		return invalid("token must be signed with HS256")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return invalid("malformed token signature")
+	}
+	mac := hmac.New(sha256.New, s.jwt.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return invalid("bad token signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return invalid("malformed token claims")
+	}
+	now := time.Now()
+	if claims.ExpiresAt == nil {
+		return invalid("token has no expiry")
+	}
+	expires := time.Unix(int64(*claims.ExpiresAt), 0).UTC()
+	if now.After(expires.Add(jwtLeeway)) {
+		return invalid("token has expired")
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(int64(*claims.NotBefore), 0)) {
+		return invalid("token is not valid yet")
+	}
+	if s.jwt.Issuer != "" && claims.Issuer != s.jwt.Issuer {
+		return invalid("unexpected token issuer")
+	}
+	if s.jwt.Audience != "" && !jwtAudienceIncludes(claims.Audience, s.jwt.Audience) {
+		return invalid("unexpected token audience")
+	}
+	if claims.Subject == "" {
+		return invalid("token has no subject")
+	}
+	if !IsRole(claims.Role) {
+		return invalid("token role must be viewer, analyst or admin")
+	}
+	// An empty list would leave the token unscoped, which is surely not what
+	// the issuer meant, so it is refused like any other bad claim
+	var companyIDs []string
+	if claims.CompanyIDs != nil {
+		if companyIDs = cleanIDs(*claims.CompanyIDs); len(companyIDs) == 0 {
+			return invalid("token company_ids must not be empty")
+		}
+		if claims.Role == models.RoleAdmin {
+			return invalid("admin tokens cannot be limited to companies")
+		}
+	}
+	var workspaces []string
+	if claims.Workspaces != nil {
+		if workspaces = cleanIDs(*claims.Workspaces); len(workspaces) == 0 {
+			return invalid("token workspaces must not be empty")
+		}
+		if claims.Role == models.RoleAdmin {
+			return invalid("admin tokens cannot be limited to workspaces")
+		}
+	}
+	if !CompanyScopeFits(companyIDs, workspaces) {
+		return invalid("token company_ids need exactly one workspace")
+	}
+
+	return models.Principal{
+		Subject:    claims.Subject,
+		Role:       claims.Role,
+		Method:     models.AuthJWT,
+		ExpiresAt:  &expires,
+		CompanyIDs: companyIDs,
+		Workspaces: workspaces,
+	}, nil
+}
+
+// CompanyScopeFits reports whether a company scope can be applied within
+// workspaces. Company IDs come from each workspace's own data, so the same
+// ID may name different companies in two workspaces; a principal limited to
+// companies must therefore be limited to one workspace too. No workspaces
+// means all of them, including any created later.
+func CompanyScopeFits(companyIDs, workspaces []string) bool {
+	return len(companyIDs) == 0 || len(workspaces) == 1
+}
+
+// cleanIDs trims company or workspace IDs and drops blanks and repeats.
+func cleanIDs(ids []string) []string {
+	var cleaned []string
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" && !containsString(cleaned, id) {
+			cleaned = append(cleaned, id)
+		}
+	}
+	return cleaned
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwtAudienceIncludes checks an aud claim, which may be a string or a list.
+func jwtAudienceIncludes(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, item := range list {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ListKeys returns the stored keys, newest first, without their hashes.
+func (s *AuthService) ListKeys() []models.APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, publicKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+func (s *AuthService) GetKey(id string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return models.APIKey{}, fmt.Errorf("api key %s: %w", id, ErrNotFound)
+	}
+	return publicKey(key), nil
+}
+
+// CreateKey stores a new key and returns it with its secret.
+func (s *AuthService) CreateKey(request models.APIKeyRequest, createdBy string) (models.CreatedAPIKey, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return models.CreatedAPIKey{}, fmt.Errorf("failed to generate api key: %w", err)
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(random)
+
+	key := &models.APIKey{
+		ID:         newID(),
+		Name:       strings.TrimSpace(request.Name),
+		Role:       request.Role,
+		Prefix:     secret[:len(apiKeyPrefix)+8],
+		CompanyIDs: cleanIDs(request.CompanyIDs),
+		Workspaces: cleanIDs(request.Workspaces),
+		Hash:       hashAPIKey(secret),
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now().UTC(),
+		ExpiresAt:  request.ExpiresAt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = key
+	s.byHash[key.Hash] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, key.ID)
+		delete(s.byHash, key.Hash)
+		return models.CreatedAPIKey{}, err
+	}
+	return models.CreatedAPIKey{APIKey: publicKey(key), Key: secret}, nil
+}
+
+// RevokeKey stops a key from authenticating. Revoked keys stay listed so
+// past use can still be traced to them.
+func (s *AuthService) RevokeKey(id string) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return models.APIKey{}, fmt.Errorf("api key %s: %w", id, ErrNotFound)
+	}
+	if key.RevokedAt != nil {
+		return publicKey(key), nil
+	}
+
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	if err := s.save(); err != nil {
+		key.RevokedAt = nil
+		return models.APIKey{}, err
+	}
+	return publicKey(key), nil
+}
+
+// HasActiveAdmin reports whether any admin key can still be used, so a
+// fresh install can be bootstrapped with one.
+func (s *AuthService) HasActiveAdmin() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range s.keys {
+		if key.Role == models.RoleAdmin && key.RevokedAt == nil && (key.ExpiresAt == nil || now.Before(*key.ExpiresAt)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func publicKey(key *models.APIKey) models.APIKey {
+	public := *key
+	public.Hash = ""
+	return public
+}
+
+// save must be called with the write lock held.
+func (s *AuthService) save() error {
+	keys := make([]models.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return saveJSONFile(s.path, keys)
+}
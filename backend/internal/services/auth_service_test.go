@@ -0,0 +1,86 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testAuthSecret = "test-secret"
+
+func signTestToken(claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(testAuthSecret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestCompanyScopeNeedsOneWorkspace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	auth, err := NewAuthService(path, JWTConfig{Secret: []byte(testAuthSecret)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := []struct {
+		name       string
+		companyIDs []string
+		workspaces []string
+		accepted   bool
+	}{
+		{"unscoped", nil, nil, true},
+		{"one workspace", nil, []string{"default"}, true},
+		{"companies in one workspace", []string{"A"}, []string{"default"}, true},
+		{"companies in every workspace", []string{"A"}, nil, false},
+		{"companies in two workspaces", []string{"A"}, []string{"default", "other"}, false},
+	}
+	for _, test := range tokens {
+		claims := map[string]interface{}{"sub": "someone", "role": models.RoleAnalyst, "exp": time.Now().Add(time.Hour).Unix()}
+		if test.companyIDs != nil {
+			claims["company_ids"] = test.companyIDs
+		}
+		if test.workspaces != nil {
+			claims["workspaces"] = test.workspaces
+		}
+		_, err := auth.Authenticate(signTestToken(claims))
+		if accepted := err == nil; accepted != test.accepted {
+			t.Errorf("token %s: accepted %v (%v), want %v", test.name, accepted, err, test.accepted)
+		}
+		if err != nil && !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("token %s: got %v, want an authentication error", test.name, err)
+		}
+	}
+
+	// A key saved with a company scope but no single workspace, as keys
+	// could be before, is refused, including after the keys are reloaded
+	scoped, err := auth.CreateKey(models.APIKeyRequest{Name: "a", Role: models.RoleAnalyst, CompanyIDs: []string{"A"}, Workspaces: []string{"default"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := auth.CreateKey(models.APIKeyRequest{Name: "b", Role: models.RoleAnalyst, CompanyIDs: []string{"A"}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewAuthService(path, JWTConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []*AuthService{auth, reloaded} {
+		if principal, err := service.Authenticate(scoped.Key); err != nil || len(principal.Workspaces) != 1 {
+			t.Errorf("key limited to one workspace: got %+v, %v", principal, err)
+		}
+		if _, err := service.Authenticate(legacy.Key); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("key limited to companies in every workspace: got %v, want it refused", err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Health score weights; they add up to 100.
+const (
+	healthRecencyWeight = 40
+	healthTrendWeight   = 30
+	healthRiskWeight    = 30
+
+	// healthChangeWindow is how far back the previous score is taken from.
+	healthChangeWindow = 7 * day
+)
+
+// healthWindow accumulates the inputs of a health score as of one point in time.
+type healthWindow struct {
+	asOf         time.Time
+	seen         bool
+	last7        int
+	prev7        int
+	atRisk30     int
+	lastActivity time.Time
+}
+
+func (w *healthWindow) add(t time.Time, atRisk bool) {
+	if t.After(w.asOf) {
+		return
+	}
+
+	w.seen = true
+	age := w.asOf.Sub(t)
+	switch {
+	case age < 7*day:
+		w.last7++
+	case age < 14*day:
+		w.prev7++
+	}
+	if atRisk && age < 30*day {
+		w.atRisk30++
+	}
+	if t.After(w.lastActivity) {
+		w.lastActivity = t
+	}
+}
+
+// score rates a company from 0 to 100 on how recently it was active, whether
+// its activity this week kept up with the week before, and how many at-risk
+// metrics were recorded for it in the last 30 days.
+func (w *healthWindow) score() int {
+	if !w.seen {
+		return 0
+	}
+
+	recency := 1 - w.asOf.Sub(w.lastActivity).Hours()/(30*24)
+	if recency < 0 {
+		recency = 0
+	}
+
+	var trend float64
+	switch {
+	case w.prev7 > 0:
+		trend = float64(w.last7) / float64(w.prev7)
+		if trend > 1 {
+			trend = 1
+		}
+	case w.last7 > 0:
+		trend = 1
+	}
+
+	risk := 1 / float64(1+w.atRisk30)
+
+	return int(healthRecencyWeight*recency + healthTrendWeight*trend + healthRiskWeight*risk + 0.5)
+}
+
+// isAtRiskEvent reports whether an event records an at-risk metric, e.g.
+// "at risk - Bank Balance Degradation - ..." or "Recording at-risk metric ...".
+func isAtRiskEvent(event *models.UsageEvent) bool {
+	content := strings.ToLower(event.Content)
+	return strings.Contains(content, "at risk") || strings.Contains(content, "at-risk")
+}
+
+// computeCompanyAggregates builds the aggregate of every company in events,
+// ordered by company ID.
+func computeCompanyAggregates(events []models.UsageEvent) []models.CompanyAggregate {
+	var asOf time.Time
+	for i := range events {
+		if events[i].CreatedAt.After(asOf) {
+			asOf = events[i].CreatedAt
+		}
+	}
+
+	type accumulator struct {
+		aggregate models.CompanyAggregate
+		current   healthWindow
+		previous  healthWindow
+	}
+	companies := make(map[string]*accumulator)
+
+	for i := range events {
+		event := &events[i]
+		if event.CompanyID == "" {
+			continue
+		}
+
+		acc, ok := companies[event.CompanyID]
+		if !ok {
+			acc = &accumulator{
+				aggregate: models.CompanyAggregate{CompanyID: event.CompanyID, AsOf: asOf},
+				current:   healthWindow{asOf: asOf},
+				previous:  healthWindow{asOf: asOf.Add(-healthChangeWindow)},
+			}
+			companies[event.CompanyID] = acc
+		}
+
+		aggregate := &acc.aggregate
+		aggregate.EventCount++
+
+		atRisk := isAtRiskEvent(event)
+		age := asOf.Sub(event.CreatedAt)
+		if age < 7*day {
+			aggregate.EventsLast7Days++
+			if event.Type == models.EventTypeAction {
+				aggregate.ActionsLast7Days++
+			}
+		} else if age < 14*day {
+			aggregate.EventsPrior7Days++
+		}
+		if age < 30*day {
+			aggregate.EventsLast30Days++
+			if atRisk {
+				aggregate.AtRiskMetrics++
+			}
+		}
+		if event.CreatedAt.After(aggregate.LastActivity) {
+			aggregate.LastActivity = event.CreatedAt
+		}
+
+		acc.current.add(event.CreatedAt, atRisk)
+		acc.previous.add(event.CreatedAt, atRisk)
+	}
+
+	aggregates := make([]models.CompanyAggregate, 0, len(companies))
+	for _, acc := range companies {
+		aggregate := acc.aggregate
+		aggregate.DaysSinceActivity = int(asOf.Sub(aggregate.LastActivity) / day)
+		aggregate.HealthScore = acc.current.score()
+		// Companies that did not exist a week ago have nothing to compare with
+		if acc.previous.seen {
+			aggregate.HealthScoreChange = aggregate.HealthScore - acc.previous.score()
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].CompanyID < aggregates[j].CompanyID
+	})
+	return aggregates
+}
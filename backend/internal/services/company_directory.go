@@ -0,0 +1,394 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidMetadata = errors.New("invalid company metadata")
+
+const (
+	NameSourceMetadata = "metadata"
+	NameSourceContent  = "content"
+)
+
+// metadataColumns maps accepted CSV header names to CompanyMetadata fields.
+var metadataColumns = map[string]string{
+	"company_id": "company_id",
+	"id":         "company_id",
+	"name":       "name",
+	"company":    "name",
+	"plan":       "plan",
+	"csm_owner":  "csm_owner",
+	"csm":        "csm_owner",
+	"owner":      "csm_owner",
+	"arr":        "arr",
+	"region":     "region",
+}
+
+// CompanyDirectory maps company IDs to display names and account metadata.
+// Imported metadata is persisted; names inferred from event content are
+// recomputed on every data load.
+type CompanyDirectory struct {
+	mu       sync.RWMutex
+	path     string
+	metadata map[string]models.CompanyMetadata
+	inferred map[string]string
+}
+
+func NewCompanyDirectory(path string) (*CompanyDirectory, error) {
+	d := &CompanyDirectory{
+		path:     path,
+		metadata: make(map[string]models.CompanyMetadata),
+		inferred: make(map[string]string),
+	}
+
+	var stored []models.CompanyMetadata
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for _, record := range stored {
+		d.metadata[record.CompanyID] = record
+	}
+
+	return d, nil
+}
+
+// InferNames picks, for every company, the name most often found in its
+// event content. It is registered as a data load hook.
+func (d *CompanyDirectory) InferNames(events []models.UsageEvent, version string) error {
+	counts := make(map[string]map[string]int)
+	for i := range events {
+		name := inferCompanyName(events[i].Content)
+		if name == "" || events[i].CompanyID == "" {
+			continue
+		}
+		if counts[events[i].CompanyID] == nil {
+			counts[events[i].CompanyID] = make(map[string]int)
+		}
+		counts[events[i].CompanyID][name]++
+	}
+
+	inferred := make(map[string]string, len(counts))
+	for companyID, names := range counts {
+		var best string
+		for name, count := range names {
+			if count > names[best] || (count == names[best] && name < best) {
+				best = name
+			}
+		}
+		inferred[companyID] = best
+	}
+
+	d.mu.Lock()
+	d.inferred = inferred
+	d.mu.Unlock()
+	return nil
+}
+
+// inferCompanyName extracts the company from content such as
+// "User active CMMS - Sample Company jane@sample.com /work-orders": the words
+// between the first " - " and the user's email address.
+func inferCompanyName(content string) string {
+	_, rest, ok := strings.Cut(content, " - ")
+	if !ok {
+		return ""
+	}
+
+	var words []string
+	for _, word := range strings.Fields(rest) {
+		if strings.Contains(word, "@") {
+			return strings.Join(words, " ")
+		}
+		if strings.HasPrefix(word, "/") {
+			break
+		}
+		words = append(words, word)
+	}
+	// Without an email address the text is most likely not a company name
+	return ""
+}
+
+// Get returns the directory entry for a company. Unknown companies get an
+// entry with just the ID. Safe to call on a nil directory.
+func (d *CompanyDirectory) Get(companyID string) models.Company {
+	if d == nil {
+		return models.Company{ID: companyID}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.get(companyID)
+}
+
+func (d *CompanyDirectory) get(companyID string) models.Company {
+	company := models.Company{ID: companyID}
+	if name := d.inferred[companyID]; name != "" {
+		company.Name = name
+		company.NameSource = NameSourceContent
+	}
+
+	if record, ok := d.metadata[companyID]; ok {
+		if record.Name != "" {
+			company.Name = record.Name
+			company.NameSource = NameSourceMetadata
+		}
+		company.Plan = record.Plan
+		company.CSMOwner = record.CSMOwner
+		company.ARR = record.ARR
+		company.Region = record.Region
+	}
+	return company
+}
+
+// Lookup returns the directory entries for the given company IDs.
+func (d *CompanyDirectory) Lookup(companyIDs []string) map[string]models.Company {
+	if d == nil || len(companyIDs) == 0 {
+		return nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	companies := make(map[string]models.Company, len(companyIDs))
+	for _, companyID := range companyIDs {
+		if companyID != "" {
+			companies[companyID] = d.get(companyID)
+		}
+	}
+	return companies
+}
+
+// LookupEvents returns the directory entries for the companies of events.
+func (d *CompanyDirectory) LookupEvents(events []models.UsageEvent) map[string]models.Company {
+	companyIDs := make([]string, 0, len(events))
+	for i := range events {
+		companyIDs = append(companyIDs, events[i].CompanyID)
+	}
+	return d.Lookup(companyIDs)
+}
+
+// List returns every company that has metadata or an inferred name.
+func (d *CompanyDirectory) List() []models.Company {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	companies := make([]models.Company, 0, len(d.inferred)+len(d.metadata))
+	for companyID := range d.inferred {
+		companies = append(companies, d.get(companyID))
+	}
+	for companyID := range d.metadata {
+		if _, ok := d.inferred[companyID]; !ok {
+			companies = append(companies, d.get(companyID))
+		}
+	}
+
+	sort.Slice(companies, func(i, j int) bool {
+		return companies[i].ID < companies[j].ID
+	})
+	return companies
+}
+
+// MatchCompanies returns the IDs of companies whose metadata matches every
+// non-empty list (case-insensitively), or nil when all lists are empty.
+func (d *CompanyDirectory) MatchCompanies(csmOwners, plans, regions []string) map[string]bool {
+	if len(csmOwners) == 0 && len(plans) == 0 && len(regions) == 0 {
+		return nil
+	}
+
+	matched := make(map[string]bool)
+	if d == nil {
+		return matched
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for companyID, record := range d.metadata {
+		if matchesAnyFold(csmOwners, record.CSMOwner) &&
+			matchesAnyFold(plans, record.Plan) &&
+			matchesAnyFold(regions, record.Region) {
+			matched[companyID] = true
+		}
+	}
+	return matched
+}
+
+func matchesAnyFold(values []string, target string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataValues returns the distinct CSM owners, plans and regions, for
+// the filter panel.
+func (d *CompanyDirectory) MetadataValues() (csmOwners, plans, regions []string) {
+	if d == nil {
+		return nil, nil, nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	owners, planSet, regionSet := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for _, record := range d.metadata {
+		owners[record.CSMOwner] = true
+		planSet[record.Plan] = true
+		regionSet[record.Region] = true
+	}
+	return sortedKeys(owners), sortedKeys(planSet), sortedKeys(regionSet)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Import stores metadata records. With replace, existing metadata not in
+// records is dropped; otherwise records are merged into it.
+func (d *CompanyDirectory) Import(records []models.CompanyMetadata, replace bool) (models.CompanyImportResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous := d.metadata
+	metadata := make(map[string]models.CompanyMetadata, len(previous)+len(records))
+	if !replace {
+		for companyID, record := range previous {
+			metadata[companyID] = record
+		}
+	}
+	for _, record := range records {
+		metadata[record.CompanyID] = record
+	}
+
+	d.metadata = metadata
+	if err := d.save(); err != nil {
+		d.metadata = previous
+		return models.CompanyImportResult{}, err
+	}
+	return models.CompanyImportResult{Imported: len(records), Companies: len(metadata)}, nil
+}
+
+// save must be called with the write lock held.
+func (d *CompanyDirectory) save() error {
+	records := make([]models.CompanyMetadata, 0, len(d.metadata))
+	for _, record := range d.metadata {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CompanyID < records[j].CompanyID
+	})
+
+	return saveJSONFile(d.path, records)
+}
+
+// ParseCompanyMetadataJSON reads a JSON array of metadata records.
+func ParseCompanyMetadataJSON(r io.Reader) ([]models.CompanyMetadata, error) {
+	var records []models.CompanyMetadata
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+	}
+
+	for i := range records {
+		if err := normalizeMetadata(&records[i]); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %v", ErrInvalidMetadata, i+1, err)
+		}
+	}
+	return records, nil
+}
+
+// ParseCompanyMetadataCSV reads metadata from a CSV file with a header row.
+// Columns are matched by name (company_id, name, plan, csm_owner, arr,
+// region); unknown columns are ignored.
+func ParseCompanyMetadataCSV(r io.Reader) ([]models.CompanyMetadata, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %v", ErrInvalidMetadata, err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := metadataColumns[strings.ReplaceAll(name, " ", "_")]; ok {
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["company_id"]; !ok {
+		return nil, fmt.Errorf("%w: header has no company_id column", ErrInvalidMetadata)
+	}
+
+	column := func(row []string, field string) string {
+		if i, ok := columns[field]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var records []models.CompanyMetadata
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+		}
+
+		record := models.CompanyMetadata{
+			CompanyID: column(row, "company_id"),
+			Name:      column(row, "name"),
+			Plan:      column(row, "plan"),
+			CSMOwner:  column(row, "csm_owner"),
+			Region:    column(row, "region"),
+		}
+		if arr := column(row, "arr"); arr != "" {
+			value, ok := parseNumericValue(arr)
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: arr %q is not a number", ErrInvalidMetadata, line, arr)
+			}
+			record.ARR = &value
+		}
+		if err := normalizeMetadata(&record); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidMetadata, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func normalizeMetadata(record *models.CompanyMetadata) error {
+	record.CompanyID = strings.TrimSpace(record.CompanyID)
+	record.Name = strings.TrimSpace(record.Name)
+	record.Plan = strings.TrimSpace(record.Plan)
+	record.CSMOwner = strings.TrimSpace(record.CSMOwner)
+	record.Region = strings.TrimSpace(record.Region)
+
+	if record.CompanyID == "" {
+		return errors.New("company_id is required")
+	}
+	return nil
+}
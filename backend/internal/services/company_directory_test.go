@@ -0,0 +1,94 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompanyDirectoryMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "company_metadata.json")
+	directory, err := NewCompanyDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ParseCompanyMetadataCSV(strings.NewReader("\ufeffID,Company,Plan,CSM,ARR,Region,Notes\n" +
+		" a , Acme Corp ,Enterprise,Jane Doe,\"$120,000\",EU,ignored\n" +
+		"b,,Starter,john roe,,US,\n" +
+		"c,Globex,enterprise,JANE DOE,,US,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].CompanyID != "a" || records[0].Name != "Acme Corp" || records[0].ARR == nil || *records[0].ARR != 120000 {
+		t.Errorf("first record parsed as %+v", records[0])
+	}
+	if _, err := directory.Import(records, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                     string
+		csmOwners, plans, region []string
+		want                     map[string]bool
+	}{
+		{"no filters", nil, nil, nil, nil},
+		{"case-insensitive plan", nil, []string{"ENTERPRISE"}, nil, map[string]bool{"a": true, "c": true}},
+		{"every list must match", []string{"jane doe"}, nil, []string{"us"}, map[string]bool{"c": true}},
+		{"any value of a list", nil, []string{"starter", "enterprise"}, []string{"EU", "US"}, map[string]bool{"a": true, "b": true, "c": true}},
+		{"no match", nil, []string{"free"}, nil, map[string]bool{}},
+	}
+	for _, test := range tests {
+		if got := directory.MatchCompanies(test.csmOwners, test.plans, test.region); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: matched %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// Names from metadata win over names inferred from content, which fill
+	// in for companies without one
+	directory.InferNames([]models.UsageEvent{
+		{CompanyID: "a", Content: "User active CMMS - Acme jane@acme.com /assets"},
+		{CompanyID: "b", Content: "User active CMMS - Initech Inc bob@initech.com /work-orders"},
+		{CompanyID: "b", Content: "User active CMMS - Initech Inc ann@initech.com /assets"},
+		{CompanyID: "b", Content: "User active CMMS - Initech amy@initech.com /assets"},
+		{CompanyID: "d", Content: "at risk - Bank Balance Degradation - Total Bank Balance Today"},
+	}, "v1")
+	for id, want := range map[string]models.Company{
+		"a": {ID: "a", Name: "Acme Corp", NameSource: NameSourceMetadata},
+		"b": {ID: "b", Name: "Initech Inc", NameSource: NameSourceContent},
+		"d": {ID: "d"},
+	} {
+		got := directory.Get(id)
+		if got.Name != want.Name || got.NameSource != want.NameSource {
+			t.Errorf("company %s: name %q from %q, want %q from %q", id, got.Name, got.NameSource, want.Name, want.NameSource)
+		}
+	}
+
+	// Merging keeps other companies' metadata; replacing drops it, and both
+	// are persisted
+	if _, err := directory.Import([]models.CompanyMetadata{{CompanyID: "d", Plan: "Starter"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewCompanyDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.MatchCompanies(nil, []string{"starter"}, nil); !reflect.DeepEqual(got, map[string]bool{"b": true, "d": true}) {
+		t.Errorf("after merge: starter companies %v", got)
+	}
+	if _, err := reloaded.Import([]models.CompanyMetadata{{CompanyID: "d", Plan: "Starter"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.MatchCompanies(nil, []string{"starter", "enterprise"}, nil); !reflect.DeepEqual(got, map[string]bool{"d": true}) {
+		t.Errorf("after replace: companies %v", got)
+	}
+
+	for _, input := range []string{"name,plan\nAcme,Pro\n", "company_id,arr\na,lots\n", "company_id,plan\n,Pro\n"} {
+		if _, err := ParseCompanyMetadataCSV(strings.NewReader(input)); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%q: got %v, want invalid metadata", input, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// reportDefaultPeriod is the range covered when a report is requested
+	// without a start date: a quarter.
+	reportDefaultPeriod = 90 * day
+
+	reportTopFeatures = 10
+	reportTopUsers    = 10
+	reportMaxSignals  = 25
+)
+
+// CompanyReport builds the account review of a company between from and to.
+// A nil to means the end of the dataset and a nil from the 90 days before it.
+func (s *AnalyticsService) CompanyReport(companyID string, from, to *time.Time) (*models.CompanyReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var asOf time.Time
+	known := false
+	for i := range s.events {
+		known = known || s.events[i].CompanyID == companyID
+		if s.events[i].CreatedAt.After(asOf) {
+			asOf = s.events[i].CreatedAt
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("company %s: %w", companyID, ErrNotFound)
+	}
+
+	report := &models.CompanyReport{
+		Company:     s.directory.Get(companyID),
+		To:          asOf,
+		GeneratedAt: time.Now().UTC(),
+	}
+	if to != nil {
+		report.To = *to
+	}
+	report.From = report.To.Add(-reportDefaultPeriod).UTC().Truncate(day)
+	if from != nil {
+		report.From = *from
+	}
+	previousFrom := report.From.Add(-report.To.Sub(report.From))
+
+	days := make(map[string]int)
+	features := make(map[string]int)
+	users := make(map[string]*models.ReportUser)
+	metrics := make(map[string]*models.MetricTrend)
+	for i := range s.events {
+		event := &s.events[i]
+		if event.CompanyID != companyID {
+			continue
+		}
+
+		if !event.CreatedAt.Before(previousFrom) && event.CreatedAt.Before(report.From) {
+			report.PreviousEvents++
+		}
+		if event.CreatedAt.Before(report.From) || event.CreatedAt.After(report.To) {
+			continue
+		}
+
+		report.TotalEvents++
+		days[event.CreatedAt.UTC().Format("2006-01-02")]++
+
+		if event.Type == models.EventTypeAction {
+			if feature := featureName(contentRoute(event.Content)); feature != "" {
+				features[feature]++
+			}
+			if email := strings.ToLower(contentEmail(event.Content)); email != "" {
+				user := users[email]
+				if user == nil {
+					user = &models.ReportUser{Email: email}
+					users[email] = user
+				}
+				user.Events++
+				if event.CreatedAt.After(user.LastSeen) {
+					user.LastSeen = event.CreatedAt
+				}
+			}
+		} else if value, ok := parseNumericValue(event.Value); ok && event.Attribute != "" {
+			trend := metrics[event.Attribute]
+			if trend == nil {
+				trend = &models.MetricTrend{Name: event.Attribute}
+				metrics[event.Attribute] = trend
+			}
+			trend.Points = append(trend.Points, models.MetricPoint{Time: event.CreatedAt, Value: value})
+		}
+
+		if isAtRiskEvent(event) {
+			report.RiskSignals = append(report.RiskSignals, models.RiskSignal{
+				Time:   event.CreatedAt,
+				Signal: strings.TrimSpace(event.Content),
+				Metric: event.Attribute,
+				Value:  reportValue(event.Value),
+			})
+		}
+	}
+
+	for _, aggregate := range computeCompanyAggregates(s.events) {
+		if aggregate.CompanyID == companyID {
+			aggregate.Company = &report.Company
+			report.Health = &aggregate
+			break
+		}
+	}
+
+	report.ActiveDays = len(days)
+	report.ActiveUsers = len(users)
+	report.FeaturesUsed = len(features)
+	report.DailyActivity = dailyActivity(report.From, report.To, days)
+	report.TopFeatures = topCounts(features, reportTopFeatures)
+	report.TopUsers = topUsers(users, reportTopUsers)
+	report.MetricTrends = metricTrends(metrics)
+
+	sort.Slice(report.RiskSignals, func(i, j int) bool {
+		return report.RiskSignals[i].Time.After(report.RiskSignals[j].Time)
+	})
+	if len(report.RiskSignals) > reportMaxSignals {
+		report.RiskSignals = report.RiskSignals[:reportMaxSignals]
+	}
+	if report.RiskSignals == nil {
+		report.RiskSignals = []models.RiskSignal{}
+	}
+
+	report.Annotations = s.annotations.List(models.AnnotationQuery{
+		CompanyIDs: []string{companyID},
+		From:       &report.From,
+		To:         &report.To,
+	})
+	return report, nil
+}
+
+// featureName reduces a route to the feature it belongs to by dropping
+// record IDs and query strings, e.g. "/work-orders/2194290" -> "/work-orders".
+func featureName(route string) string {
+	route, _, _ = strings.Cut(route, "?")
+	var segments []string
+	for _, segment := range strings.Split(route, "/") {
+		if segment == "" || strings.IndexFunc(segment, unicode.IsDigit) >= 0 {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// reportValue drops the "null" placeholder the source data uses for events
+// without a value.
+func reportValue(value string) string {
+	if strings.EqualFold(value, "null") {
+		return ""
+	}
+	return value
+}
+
+// dailyActivity lists every day from from to to with its event count.
+func dailyActivity(from, to time.Time, counts map[string]int) []models.TimeSeriesPoint {
+	points := []models.TimeSeriesPoint{}
+	for d := from.UTC().Truncate(day); !d.After(to); d = d.Add(day) {
+		date := d.Format("2006-01-02")
+		points = append(points, models.TimeSeriesPoint{Date: date, Count: counts[date]})
+	}
+	return points
+}
+
+// topCounts returns the n largest counts, ties broken by name.
+func topCounts(counts map[string]int, n int) []models.ReportCount {
+	top := make([]models.ReportCount, 0, len(counts))
+	for name, count := range counts {
+		top = append(top, models.ReportCount{Name: name, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+func topUsers(users map[string]*models.ReportUser, n int) []models.ReportUser {
+	top := make([]models.ReportUser, 0, len(users))
+	for _, user := range users {
+		top = append(top, *user)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Events != top[j].Events {
+			return top[i].Events > top[j].Events
+		}
+		return top[i].Email < top[j].Email
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// metricTrends orders each metric's values by time and the metrics by name.
+func metricTrends(metrics map[string]*models.MetricTrend) []models.MetricTrend {
+	trends := make([]models.MetricTrend, 0, len(metrics))
+	for _, trend := range metrics {
+		sort.Slice(trend.Points, func(i, j int) bool {
+			return trend.Points[i].Time.Before(trend.Points[j].Time)
+		})
+		trend.First = trend.Points[0].Value
+		trend.Latest = trend.Points[len(trend.Points)-1].Value
+		if trend.First != 0 {
+			change := (trend.Latest - trend.First) / math.Abs(trend.First) * 100
+			trend.ChangePercent = &change
+		}
+		trends = append(trends, *trend)
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		return trends[i].Name < trends[j].Name
+	})
+	return trends
+}
@@ -0,0 +1,436 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	reportFrom = time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	reportTo   = time.Date(2025, 5, 10, 23, 59, 59, 0, time.UTC)
+)
+
+// newReportTestAnalytics serves the events of c1, Acme Corp, from April to
+// May 11, the end of the data. Between reportFrom and reportTo it has nine:
+// two users on two features, two metrics and two at-risk signals.
+func newReportTestAnalytics(t *testing.T) *AnalyticsService {
+	t.Helper()
+	dir := t.TempDir()
+	directory, err := NewCompanyDirectory(filepath.Join(dir, "company_metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr := 120000.0
+	if _, err := directory.Import([]models.CompanyMetadata{{CompanyID: "c1", Name: "Acme Corp", Plan: "Enterprise", CSMOwner: "Jane Doe", Region: "EU", ARR: &arr}}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	annotations, err := NewAnnotationService(filepath.Join(dir, "annotations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, note := range []struct {
+		company string
+		date    time.Time
+		text    string
+	}{
+		{"c1", time.Date(2025, 5, 5, 0, 0, 0, 0, time.UTC), "Renewal call"},
+		{"c2", time.Date(2025, 5, 5, 0, 0, 0, 0, time.UTC), "Another company"},
+		{"c1", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), "After the report"},
+	} {
+		date := note.date
+		if _, err := annotations.Create(models.AnnotationRequest{CompanyID: note.company, Text: note.text, Author: "Sam"}, &date, &date); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	action := func(id string, createdAt time.Time, content string) models.UsageEvent {
+		return models.UsageEvent{ID: id, CompanyID: "c1", Type: models.EventTypeAction, CreatedAt: createdAt, Content: content, Attribute: "UserActiveCMMS", Value: "null"}
+	}
+	metric := func(id string, createdAt time.Time, content, attribute, value string) models.UsageEvent {
+		return models.UsageEvent{ID: id, CompanyID: "c1", Type: "CumulativeMetric", CreatedAt: createdAt, Content: content, Attribute: attribute, Value: value}
+	}
+
+	analytics := NewAnalyticsService(directory, annotations)
+	analytics.events = []models.UsageEvent{
+		action("old", at(4, 1, 9), "User active CMMS - Acme Corp jane@acme.com /work-orders"),
+		action("previous", at(4, 25, 9), "User active CMMS - Acme Corp jane@acme.com /work-orders"),
+		action("e1", at(5, 2, 9), "User active CMMS - Acme Corp Jane@Acme.com /work-orders/2194290"),
+		action("e2", at(5, 2, 10), "User active CMMS - Acme Corp jane@acme.com /work-orders/17?tab=parts"),
+		metric("e3", at(5, 3, 8), "Total Bank Balance Today", "Balance", "$1,000.00"),
+		action("e4", at(5, 4, 12), "User active CMMS - Acme Corp bob@acme.com /assets/9/meters"),
+		metric("e5", at(5, 5, 8), "Seats in use", "Seats", "0"),
+		metric("e6", at(5, 6, 8), "at risk - Bank Balance Degradation - Total Bank Balance Today", "Balance", "(250)"),
+		metric("e7", at(5, 7, 8), "Seats in use", "Seats", "12"),
+		metric("e8", at(5, 8, 8), "Total Bank Balance Today", "Balance", "$500.00"),
+		action("e9", at(5, 9, 15), " Recording at-risk metric <Churn> "),
+		action("later", at(5, 11, 9), "User active CMMS - Acme Corp bob@acme.com /assets"),
+		{ID: "other", CompanyID: "c2", Type: models.EventTypeAction, CreatedAt: at(5, 5, 9)},
+	}
+	return analytics
+}
+
+func companyReport(t *testing.T) *models.CompanyReport {
+	t.Helper()
+	from, to := reportFrom, reportTo
+	report, err := newReportTestAnalytics(t).CompanyReport("c1", &from, &to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestCompanyReport(t *testing.T) {
+	report := companyReport(t)
+
+	if report.Company.Name != "Acme Corp" || !report.From.Equal(reportFrom) || !report.To.Equal(reportTo) {
+		t.Errorf("company %+v from %s to %s", report.Company, report.From, report.To)
+	}
+	// The previous period is the ten days before May 1
+	if report.TotalEvents != 9 || report.PreviousEvents != 1 || report.ActiveDays != 8 || report.ActiveUsers != 2 || report.FeaturesUsed != 2 {
+		t.Errorf("total %d, previous %d, active days %d, users %d, features %d",
+			report.TotalEvents, report.PreviousEvents, report.ActiveDays, report.ActiveUsers, report.FeaturesUsed)
+	}
+
+	// Every day of the range, including the quiet first and last ones
+	var days []string
+	for _, point := range report.DailyActivity {
+		days = append(days, point.Date+"="+strconv.Itoa(point.Count))
+	}
+	wantDays := "2025-05-01=0 2025-05-02=2 2025-05-03=1 2025-05-04=1 2025-05-05=1 2025-05-06=1 2025-05-07=1 2025-05-08=1 2025-05-09=1 2025-05-10=0"
+	if got := strings.Join(days, " "); got != wantDays {
+		t.Errorf("daily activity:\ngot  %s\nwant %s", got, wantDays)
+	}
+
+	// Features drop record IDs and query strings; emails are case-folded
+	wantFeatures := []models.ReportCount{{Name: "/work-orders", Count: 2}, {Name: "/assets/meters", Count: 1}}
+	if !reflect.DeepEqual(report.TopFeatures, wantFeatures) {
+		t.Errorf("top features %+v, want %+v", report.TopFeatures, wantFeatures)
+	}
+	wantUsers := []models.ReportUser{
+		{Email: "jane@acme.com", Events: 2, LastSeen: time.Date(2025, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{Email: "bob@acme.com", Events: 1, LastSeen: time.Date(2025, 5, 4, 12, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(report.TopUsers, wantUsers) {
+		t.Errorf("top users %+v, want %+v", report.TopUsers, wantUsers)
+	}
+
+	// Metrics by name, values oldest first; a first value of zero has no
+	// percentage change
+	if len(report.MetricTrends) != 2 {
+		t.Fatalf("metric trends %+v", report.MetricTrends)
+	}
+	balance, seats := report.MetricTrends[0], report.MetricTrends[1]
+	var values []float64
+	for _, point := range balance.Points {
+		values = append(values, point.Value)
+	}
+	if balance.Name != "Balance" || !reflect.DeepEqual(values, []float64{1000, -250, 500}) || balance.First != 1000 || balance.Latest != 500 ||
+		balance.ChangePercent == nil || *balance.ChangePercent != -50 {
+		t.Errorf("balance trend %+v", balance)
+	}
+	if seats.Name != "Seats" || seats.First != 0 || seats.Latest != 12 || seats.ChangePercent != nil {
+		t.Errorf("seats trend %+v", seats)
+	}
+
+	// Newest first, without the "null" placeholder value
+	wantSignals := []models.RiskSignal{
+		{Time: time.Date(2025, 5, 9, 15, 0, 0, 0, time.UTC), Signal: "Recording at-risk metric <Churn>", Metric: "UserActiveCMMS"},
+		{Time: time.Date(2025, 5, 6, 8, 0, 0, 0, time.UTC), Signal: "at risk - Bank Balance Degradation - Total Bank Balance Today", Metric: "Balance", Value: "(250)"},
+	}
+	if !reflect.DeepEqual(report.RiskSignals, wantSignals) {
+		t.Errorf("risk signals %+v, want %+v", report.RiskSignals, wantSignals)
+	}
+
+	// Health is as of the end of the data, May 11
+	if health := report.Health; health == nil || health.CompanyID != "c1" || health.EventCount != 12 || health.AtRiskMetrics != 2 ||
+		health.DaysSinceActivity != 0 || health.Company == nil || health.Company.Name != "Acme Corp" {
+		t.Errorf("health %+v", report.Health)
+	}
+
+	if len(report.Annotations) != 1 || report.Annotations[0].Text != "Renewal call" {
+		t.Errorf("annotations %+v", report.Annotations)
+	}
+}
+
+func TestCompanyReportPeriod(t *testing.T) {
+	analytics := newReportTestAnalytics(t)
+
+	// By default the 90 days, from midnight, up to the end of the data
+	report, err := analytics.CompanyReport("c1", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 5, 11, 9, 0, 0, 0, time.UTC); !report.To.Equal(want) {
+		t.Errorf("to %s, want %s", report.To, want)
+	}
+	if want := time.Date(2025, 2, 10, 0, 0, 0, 0, time.UTC); !report.From.Equal(want) {
+		t.Errorf("from %s, want %s", report.From, want)
+	}
+	if report.TotalEvents != 12 || report.PreviousEvents != 0 || len(report.DailyActivity) != 91 {
+		t.Errorf("total %d, previous %d, %d days", report.TotalEvents, report.PreviousEvents, len(report.DailyActivity))
+	}
+
+	// Companies without events have nothing to review
+	if _, err := analytics.CompanyReport("c3", nil, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown company: %v", err)
+	}
+
+	// A quiet company still gets every section, with empty lists
+	report, err = analytics.CompanyReport("c2", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Company.ID != "c2" || report.TotalEvents != 1 || len(report.TopFeatures) != 0 || len(report.TopUsers) != 0 ||
+		len(report.MetricTrends) != 0 || report.RiskSignals == nil || len(report.RiskSignals) != 0 {
+		t.Errorf("quiet company report %+v", report)
+	}
+}
+
+func TestRenderReportHTML(t *testing.T) {
+	data, err := RenderReportHTML(companyReport(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+
+	for _, want := range []string{
+		`<title>Acme Corp account review</title>`,
+		`<div class="muted">Account review, May 1, 2025 &ndash; May 10, 2025 &middot; Enterprise plan · CSM Jane Doe · EU · ARR $120,000</div>`,
+		// Nine events against one in the previous period
+		`<div class="value">9</div><div class="up">800.0% vs previous period</div>`,
+		`<div class="muted">Active days</div><div class="value">8</div>`,
+		// Feature bars are relative to the busiest feature
+		`<tr><td>/work-orders</td><td class="num">2</td><td><div class="bar" style="width: 100%"></div></td></tr>`,
+		`<tr><td>/assets/meters</td><td class="num">1</td><td><div class="bar" style="width: 50%"></div></td></tr>`,
+		`<tr><td>jane@acme.com</td><td class="num">2</td><td class="num">May 2, 2025</td></tr>`,
+		`<td class="num">1,000</td><td class="num">500</td>
+      <td class="num down">-50.0%</td></tr>`,
+		`<td class="num">0</td><td class="num">12</td>
+      <td class="num ">n/a</td></tr>`,
+		`<p>2 at-risk metrics in the last 30 days; last active May 11, 2025 (0 days before the end of the data).</p>`,
+		// Event content is escaped
+		`<tr><td>May 9, 2025</td><td>Recording at-risk metric &lt;Churn&gt;</td><td class="num"></td></tr>`,
+		`<tr><td>May 6, 2025</td><td>at risk - Bank Balance Degradation - Total Bank Balance Today</td><td class="num">(250)</td></tr>`,
+		`<li>May 5, 2025: Renewal call <span class="muted">&ndash; Sam</span></li>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report is missing %s", want)
+		}
+	}
+	if strings.Contains(html, "<Churn>") {
+		t.Error("event content is not escaped")
+	}
+
+	// The activity chart and each trend are inline SVG
+	if n := strings.Count(html, "<svg "); n != 3 {
+		t.Errorf("%d charts, want the activity chart and two trends", n)
+	}
+}
+
+// pdfContents checks a PDF's header, cross-reference table and trailer, and
+// returns the decompressed content stream of each page.
+func pdfContents(t *testing.T, data []byte) []string {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF: %q ... %q", data[:min(len(data), 16)], data[max(0, len(data)-16):])
+	}
+
+	match := regexp.MustCompile(`trailer\n<< /Size (\d+) /Root 1 0 R >>\nstartxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("no trailer: %q", data[max(0, len(data)-80):])
+	}
+	size, _ := strconv.Atoi(string(match[1]))
+	xref, _ := strconv.Atoi(string(match[2]))
+	table := string(data[xref:])
+	if want := fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", size); !strings.HasPrefix(table, want) {
+		t.Fatalf("cross-reference table at %d starts %q, want %q", xref, table[:min(len(table), len(want))], want)
+	}
+	table = strings.TrimPrefix(table, fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", size))
+
+	// Every entry is 20 bytes and points at its object
+	objects := make([]string, size)
+	for i := 1; i < size; i++ {
+		entry := table[(i-1)*20 : i*20]
+		offset, err := strconv.Atoi(entry[:10])
+		if err != nil || entry[10:] != " 00000 n \n" {
+			t.Fatalf("entry %d is %q", i, entry)
+		}
+		header := fmt.Sprintf("%d 0 obj\n", i)
+		if !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Fatalf("object %d is not at offset %d", i, offset)
+		}
+		end := bytes.Index(data[offset:], []byte("\nendobj\n"))
+		objects[i] = string(data[offset+len(header) : offset+end])
+	}
+
+	if objects[1] != "<< /Type /Catalog /Pages 2 0 R >>" {
+		t.Errorf("catalog %s", objects[1])
+	}
+	pages := (size - 5) / 2
+	kids := make([]string, pages)
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	if want := fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages); objects[2] != want {
+		t.Errorf("page tree %s, want %s", objects[2], want)
+	}
+	if !strings.Contains(objects[3], "/BaseFont /Helvetica /Encoding /WinAnsiEncoding") || !strings.Contains(objects[4], "/BaseFont /Helvetica-Bold ") {
+		t.Errorf("fonts %s %s", objects[3], objects[4])
+	}
+
+	contents := make([]string, pages)
+	for i := range contents {
+		page, stream := objects[5+2*i], objects[6+2*i]
+		if want := fmt.Sprintf("/Contents %d 0 R", 6+2*i); !strings.HasPrefix(page, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] ") || !strings.Contains(page, want) {
+			t.Errorf("page %d: %s", i+1, page)
+		}
+		match := regexp.MustCompile(`^<< /Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindStringSubmatch(stream)
+		if match == nil {
+			t.Fatalf("page %d content: %.60q", i+1, stream)
+		}
+		length, _ := strconv.Atoi(match[1])
+		body := stream[len(match[0]):]
+		if len(body) != length+len("\nendstream") || !strings.HasSuffix(body, "\nendstream") {
+			t.Fatalf("page %d stream is %d bytes, /Length %d", i+1, len(body)-len("\nendstream"), length)
+		}
+		r, err := zlib.NewReader(strings.NewReader(body[:length]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("page %d: %v", i+1, err)
+		}
+		contents[i] = string(content)
+	}
+	return contents
+}
+
+var pdfTextOp = regexp.MustCompile(`/F(\d) ([\d.]+) Tf ([\d.-]+) ([\d.-]+) Td \(((?:[^\\)]|\\.)*)\) Tj`)
+
+func TestRenderReportPDF(t *testing.T) {
+	report := companyReport(t)
+	data, err := RenderReportPDF(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := pdfContents(t, data)
+	if len(contents) != 2 {
+		t.Fatalf("%d pages, want 2", len(contents))
+	}
+	content := strings.Join(contents, "")
+
+	// Text is WinAnsi encoded, with en dash 0x96 and middle dot 0xb7, and
+	// parentheses escaped
+	for _, want := range []string{
+		"/F2 20 Tf 48.00 726.00 Td (Acme Corp) Tj",
+		"(Account review, May 1, 2025 \x96 May 10, 2025 \xb7 Enterprise plan \xb7 CSM Jane Doe \xb7 EU \xb7 ARR $120,000) Tj",
+		"(800.0% vs previous) Tj",
+		"(Health score) Tj",
+		"(/work-orders) Tj",
+		"(22.2%) Tj", // of all nine events
+		"(jane@acme.com) Tj",
+		"(May 2, 2025) Tj",
+		"(from 1,000 to 500) Tj",
+		"(-50.0%) Tj",
+		"(from 0 to 12) Tj",
+		"(n/a) Tj",
+		"(2 at-risk metrics in the last 30 days; last active May 11, 2025 \\(0 days before the end of the data\\).) Tj",
+		"(Recording at-risk metric <Churn>) Tj",
+		"(\\(250\\)) Tj",
+		"(May 5, 2025: Renewal call \x96 Sam) Tj",
+		"(Acme Corp \xb7 generated " + reportDate(report.GeneratedAt) + ") Tj",
+		"(Page 1 of 2) Tj",
+		"(Page 2 of 2) Tj",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("page is missing %q", want)
+		}
+	}
+
+	// Sections run top to bottom
+	var headings []string
+	for _, op := range pdfTextOp.FindAllStringSubmatch(content, -1) {
+		if op[1] == "2" && op[2] == "13" {
+			headings = append(headings, op[5])
+		}
+	}
+	if got, want := strings.Join(headings, ", "), "Activity, Top features, Active users, Metric trends, Risk signals, Notes"; got != want {
+		t.Errorf("headings %s, want %s", got, want)
+	}
+}
+
+func TestRenderReportPDFPages(t *testing.T) {
+	// Enough metrics and signals to fill several pages
+	report := &models.CompanyReport{
+		Company:     models.Company{ID: "c9"},
+		From:        reportFrom,
+		To:          reportTo,
+		GeneratedAt: reportTo,
+	}
+	for i := 0; i < 30; i++ {
+		report.MetricTrends = append(report.MetricTrends, models.MetricTrend{
+			Name:   fmt.Sprintf("Metric %02d", i),
+			Points: []models.MetricPoint{{Time: reportFrom, Value: 1}, {Time: reportTo, Value: 2}},
+			First:  1,
+			Latest: 2,
+		})
+	}
+	for i := 0; i < reportMaxSignals; i++ {
+		report.RiskSignals = append(report.RiskSignals, models.RiskSignal{Time: reportTo, Signal: fmt.Sprintf("Signal %02d", i)})
+	}
+	data, err := RenderReportPDF(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := pdfContents(t, data)
+	if len(contents) < 3 {
+		t.Fatalf("%d pages, want at least 3", len(contents))
+	}
+
+	seen := make(map[string]int)
+	for i, content := range contents {
+		if want := fmt.Sprintf("(Page %d of %d) Tj", i+1, len(contents)); !strings.Contains(content, want) {
+			t.Errorf("page %d is missing %s", i+1, want)
+		}
+		signals := false
+		for _, op := range pdfTextOp.FindAllStringSubmatch(content, -1) {
+			text := op[5]
+			seen[text]++
+			signals = signals || strings.HasPrefix(text, "Signal ")
+			// Nothing but the footer is drawn in the bottom margin
+			if y, _ := strconv.ParseFloat(op[4], 64); y < pdfMargin && !strings.HasPrefix(text, "Page ") && text != "c9 \xb7 generated May 10, 2025" {
+				t.Errorf("page %d: %q is drawn at y %g", i+1, text, y)
+			}
+		}
+		// The signal table repeats its header on every page it spans
+		if signals && !strings.Contains(content, "(Signal) Tj") {
+			t.Errorf("page %d has signals without the table header", i+1)
+		}
+	}
+	for i := 0; i < 30; i++ {
+		if name := fmt.Sprintf("Metric %02d", i); seen[name] != 1 {
+			t.Errorf("%s drawn %d times", name, seen[name])
+		}
+	}
+	for i := 0; i < reportMaxSignals; i++ {
+		if name := fmt.Sprintf("Signal %02d", i); seen[name] != 1 {
+			t.Errorf("%s drawn %d times", name, seen[name])
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	valid := []string{"* * * * *", "*/15 9-17 * * 1-5", "0 8 * jun-aug mon,wed", "0 0 1,15 * *", "5/20 * ? * 7", "@weekly", " @Daily "}
+	for _, expr := range valid {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("%q: %v", expr, err)
+		}
+	}
+
+	invalid := []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8",
+		"*/0 * * * *", "5-1 * * * *", "* * * foo *", "a * * * *", "0 0 30 2 *", "0 0 31 4,6,9,11 *"}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); !errors.Is(err, ErrInvalidCron) {
+			t.Errorf("%q: got %v, want an invalid cron error", expr, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		ts, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	// 2025-05-01 is a Thursday
+	tests := []struct {
+		expr, from, want string
+	}{
+		{"*/15 * * * *", "2025-05-01 10:07", "2025-05-01 10:15"},
+		{"*/15 * * * *", "2025-05-01 10:45", "2025-05-01 11:00"},
+		{"*/15 * * * *", "2025-05-01 10:15", "2025-05-01 10:30"},
+		{"0 9 * * 1-5", "2025-05-02 10:00", "2025-05-05 09:00"},
+		{"0 9-17/4 * * *", "2025-05-01 13:30", "2025-05-01 17:00"},
+		// With both day fields restricted, either may match: Friday the 2nd
+		// comes first, then Tuesday the 13th
+		{"0 0 13 * 5", "2025-05-01 00:00", "2025-05-02 00:00"},
+		{"0 0 13 * 5", "2025-05-12 01:00", "2025-05-13 00:00"},
+		// With only one restricted, the other is ignored
+		{"0 0 13 * *", "2025-05-01 00:00", "2025-05-13 00:00"},
+		{"0 0 * * 5", "2025-05-03 00:00", "2025-05-09 00:00"},
+		{"30 6 * * 7", "2025-05-01 00:00", "2025-05-04 06:30"},
+		{"0 8 * jun mon", "2025-05-01 00:00", "2025-06-02 08:00"},
+		{"@monthly", "2025-05-31 12:00", "2025-06-01 00:00"},
+		{"0 0 31 * *", "2025-04-01 00:00", "2025-05-31 00:00"},
+		{"0 0 29 2 *", "2025-03-01 00:00", "2028-02-29 00:00"},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expr)
+		if err != nil {
+			t.Fatalf("%q: %v", test.expr, err)
+		}
+		got := schedule.Next(at(test.from))
+		if want := at(test.want); !got.Equal(want) {
+			t.Errorf("%q after %s: got %s, want %s", test.expr, test.from, got.Format("2006-01-02 15:04 Mon"), want.Format("2006-01-02 15:04 Mon"))
+		}
+		if !schedule.Matches(got) {
+			t.Errorf("%q: does not match %s, which Next returned", test.expr, got)
+		}
+	}
+
+	// Schedules that cannot fire give up after five years
+	impossible := &CronSchedule{minutes: 1, hours: 1, days: 1 << 30, months: 1 << 2, weekdays: 1<<7 - 1}
+	if next := impossible.Next(at("2025-01-01 00:00")); !next.IsZero() {
+		t.Errorf("0 0 30 2 *: got %s, want the zero time", next)
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	schedule, err := ParseCron("*/15 9-17 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"2025-05-01 09:00": true,
+		"2025-05-01 17:45": true,
+		"2025-05-01 09:10": false,
+		"2025-05-01 18:00": false,
+		"2025-05-03 10:00": false, // Saturday
+		"2025-05-05 10:30": true,
+	}
+	for value, want := range tests {
+		ts, _ := time.Parse("2006-01-02 15:04", value)
+		if got := schedule.Matches(ts.Add(42 * time.Second)); got != want {
+			t.Errorf("%s: got %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestSchedulerSkipsRunningJobs(t *testing.T) {
+	scheduler := NewScheduler()
+	every, _ := ParseCron("* * * * *")
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	job := func(ctx context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	scheduler.Set("digest", every, time.UTC, job)
+
+	waitStart := func(want bool) {
+		t.Helper()
+		select {
+		case <-started:
+			if !want {
+				t.Fatal("job started while still running")
+			}
+		case <-time.After(100 * time.Millisecond):
+			if want {
+				t.Fatal("job did not start")
+			}
+		}
+	}
+
+	minute := time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC)
+	scheduler.dispatch(context.Background(), minute)
+	waitStart(true)
+
+	// Neither the next minute nor replacing the job starts it a second time
+	scheduler.dispatch(context.Background(), minute.Add(time.Minute))
+	waitStart(false)
+	scheduler.Set("digest", every, time.UTC, job)
+	scheduler.dispatch(context.Background(), minute.Add(2*time.Minute))
+	waitStart(false)
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		scheduler.mu.Lock()
+		running := scheduler.jobs["digest"].running
+		scheduler.mu.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job still marked as running after it returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	scheduler.dispatch(context.Background(), minute.Add(3*time.Minute))
+	waitStart(true)
+}
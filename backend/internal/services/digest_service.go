@@ -0,0 +1,396 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid digest schedule")
+
+const (
+	digestTopMovers       = 5
+	digestInactiveDays    = 7
+	digestAtRiskHealth    = 50
+	defaultDigestTimezone = "UTC"
+)
+
+// DigestService keeps digest schedules, registers them with the scheduler
+// and renders and mails the digests.
+type DigestService struct {
+	mu        sync.RWMutex
+	path      string
+	schedules map[string]models.DigestSchedule
+
+	analytics *AnalyticsService
+	directory *CompanyDirectory
+	scheduler *Scheduler
+	mailer    Mailer
+	from      string
+	dryRun    bool
+}
+
+func NewDigestService(path string, analytics *AnalyticsService, directory *CompanyDirectory, scheduler *Scheduler, mailer Mailer, from string) (*DigestService, error) {
+	_, dryRun := mailer.(*DryRunMailer)
+	s := &DigestService{
+		path:      path,
+		schedules: make(map[string]models.DigestSchedule),
+		analytics: analytics,
+		directory: directory,
+		scheduler: scheduler,
+		mailer:    mailer,
+		from:      from,
+		dryRun:    dryRun,
+	}
+
+	var stored []models.DigestSchedule
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for _, schedule := range stored {
+		s.schedules[schedule.ID] = schedule
+		if err := s.register(schedule); err != nil {
+			return nil, fmt.Errorf("digest schedule %s: %w", schedule.ID, err)
+		}
+	}
+
+	return s, nil
+}
+
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		name = defaultDigestTimezone
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidSchedule, name)
+	}
+	return location, nil
+}
+
+// register adds the schedule to the scheduler, or removes it when disabled.
+func (s *DigestService) register(schedule models.DigestSchedule) error {
+	if !schedule.Enabled {
+		s.scheduler.Remove(schedule.ID)
+		return nil
+	}
+
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+	location, err := loadTimezone(schedule.Timezone)
+	if err != nil {
+		return err
+	}
+
+	id := schedule.ID
+	s.scheduler.Set(id, cron, location, func(ctx context.Context) error {
+		_, err := s.Send(id)
+		return err
+	})
+	return nil
+}
+
+// withNextRun fills in when an enabled schedule fires next.
+func withNextRun(schedule models.DigestSchedule) models.DigestSchedule {
+	schedule.NextRunAt = nil
+	if !schedule.Enabled {
+		return schedule
+	}
+
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return schedule
+	}
+	location, err := loadTimezone(schedule.Timezone)
+	if err != nil {
+		return schedule
+	}
+	if next := cron.Next(time.Now().In(location)); !next.IsZero() {
+		next = next.UTC()
+		schedule.NextRunAt = &next
+	}
+	return schedule
+}
+
+func (s *DigestService) List() []models.DigestSchedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]models.DigestSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, withNextRun(schedule))
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules
+}
+
+func (s *DigestService) Get(id string) (models.DigestSchedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return models.DigestSchedule{}, fmt.Errorf("digest schedule %s: %w", id, ErrNotFound)
+	}
+	return withNextRun(schedule), nil
+}
+
+func (s *DigestService) Create(request models.DigestScheduleRequest) (models.DigestSchedule, error) {
+	now := time.Now().UTC()
+	schedule := models.DigestSchedule{
+		ID:        newID(),
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	applyDigestRequest(&schedule, request)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.register(schedule); err != nil {
+		return models.DigestSchedule{}, err
+	}
+	s.schedules[schedule.ID] = schedule
+	if err := s.save(); err != nil {
+		delete(s.schedules, schedule.ID)
+		s.scheduler.Remove(schedule.ID)
+		return models.DigestSchedule{}, err
+	}
+	return withNextRun(schedule), nil
+}
+
+func (s *DigestService) Update(id string, request models.DigestScheduleRequest) (models.DigestSchedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.schedules[id]
+	if !ok {
+		return models.DigestSchedule{}, fmt.Errorf("digest schedule %s: %w", id, ErrNotFound)
+	}
+
+	schedule := previous
+	applyDigestRequest(&schedule, request)
+	schedule.UpdatedAt = time.Now().UTC()
+
+	if err := s.register(schedule); err != nil {
+		return models.DigestSchedule{}, err
+	}
+	s.schedules[id] = schedule
+	if err := s.save(); err != nil {
+		s.schedules[id] = previous
+		s.register(previous)
+		return models.DigestSchedule{}, err
+	}
+	return withNextRun(schedule), nil
+}
+
+func (s *DigestService) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.schedules[id]
+	if !ok {
+		return fmt.Errorf("digest schedule %s: %w", id, ErrNotFound)
+	}
+
+	delete(s.schedules, id)
+	if err := s.save(); err != nil {
+		s.schedules[id] = previous
+		return err
+	}
+	s.scheduler.Remove(id)
+	return nil
+}
+
+func applyDigestRequest(schedule *models.DigestSchedule, request models.DigestScheduleRequest) {
+	schedule.Name = strings.TrimSpace(request.Name)
+	schedule.Cron = strings.TrimSpace(request.Cron)
+	schedule.Timezone = strings.TrimSpace(request.Timezone)
+	if schedule.Timezone == "" {
+		schedule.Timezone = defaultDigestTimezone
+	}
+	schedule.Recipients = request.Recipients
+	schedule.CSMOwner = strings.TrimSpace(request.CSMOwner)
+	schedule.CompanyIDs = request.CompanyIDs
+	if request.Enabled != nil {
+		schedule.Enabled = *request.Enabled
+	}
+}
+
+// Build computes the digest for a schedule from the current dataset.
+func (s *DigestService) Build(id string) (models.Digest, error) {
+	schedule, err := s.Get(id)
+	if err != nil {
+		return models.Digest{}, err
+	}
+	return s.build(schedule), nil
+}
+
+func (s *DigestService) build(schedule models.DigestSchedule) models.Digest {
+	var owners []string
+	if schedule.CSMOwner != "" {
+		owners = []string{schedule.CSMOwner}
+	}
+	owned := s.directory.MatchCompanies(owners, nil, nil)
+
+	digest := models.Digest{
+		Title:     "Weekly digest: " + schedule.Name,
+		TopMovers: []models.DigestMover{},
+		AtRisk:    []models.CompanyAggregate{},
+		Inactive:  []models.CompanyAggregate{},
+	}
+
+	for _, aggregate := range s.analytics.GetCompanyAggregates() {
+		if owned != nil && !owned[aggregate.CompanyID] {
+			continue
+		}
+		if len(schedule.CompanyIDs) > 0 && !containsString(schedule.CompanyIDs, aggregate.CompanyID) {
+			continue
+		}
+
+		digest.PeriodEnd = aggregate.AsOf
+		digest.Companies++
+		digest.ThisWeek += aggregate.EventsLast7Days
+		digest.LastWeek += aggregate.EventsPrior7Days
+
+		if change := aggregate.EventsLast7Days - aggregate.EventsPrior7Days; change != 0 {
+			digest.TopMovers = append(digest.TopMovers, models.DigestMover{
+				CompanyID: aggregate.CompanyID,
+				Name:      companyDisplayName(aggregate),
+				ThisWeek:  aggregate.EventsLast7Days,
+				LastWeek:  aggregate.EventsPrior7Days,
+				Change:    change,
+			})
+		}
+		if aggregate.AtRiskMetrics > 0 || aggregate.HealthScore < digestAtRiskHealth {
+			digest.AtRisk = append(digest.AtRisk, aggregate)
+		}
+		if aggregate.DaysSinceActivity >= digestInactiveDays {
+			digest.Inactive = append(digest.Inactive, aggregate)
+		}
+	}
+
+	digest.PeriodStart = digest.PeriodEnd.Add(-7 * day)
+	if digest.LastWeek > 0 {
+		change := float64(digest.ThisWeek-digest.LastWeek) / float64(digest.LastWeek) * 100
+		digest.Change = &change
+	}
+
+	sort.Slice(digest.TopMovers, func(i, j int) bool {
+		a, b := digest.TopMovers[i], digest.TopMovers[j]
+		if abs(a.Change) != abs(b.Change) {
+			return abs(a.Change) > abs(b.Change)
+		}
+		return a.CompanyID < b.CompanyID
+	})
+	if len(digest.TopMovers) > digestTopMovers {
+		digest.TopMovers = digest.TopMovers[:digestTopMovers]
+	}
+	sort.Slice(digest.AtRisk, func(i, j int) bool {
+		return digest.AtRisk[i].HealthScore < digest.AtRisk[j].HealthScore
+	})
+	sort.Slice(digest.Inactive, func(i, j int) bool {
+		return digest.Inactive[i].DaysSinceActivity > digest.Inactive[j].DaysSinceActivity
+	})
+
+	return digest
+}
+
+// RenderDigest returns the plain text and HTML bodies of a digest.
+func RenderDigest(digest models.Digest) (string, string, error) {
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, digest); err != nil {
+		return "", "", fmt.Errorf("failed to render digest text: %w", err)
+	}
+	if err := digestHTMLTemplate.Execute(&html, digest); err != nil {
+		return "", "", fmt.Errorf("failed to render digest HTML: %w", err)
+	}
+	return text.String(), html.String(), nil
+}
+
+// Send builds, renders and mails the digest for a schedule, recording the
+// outcome on the schedule.
+func (s *DigestService) Send(id string) (models.DigestDelivery, error) {
+	schedule, err := s.Get(id)
+	if err != nil {
+		return models.DigestDelivery{}, err
+	}
+
+	digest := s.build(schedule)
+	output, sendErr := s.send(schedule, digest)
+
+	s.mu.Lock()
+	if current, ok := s.schedules[id]; ok {
+		now := time.Now().UTC()
+		current.LastRunAt = &now
+		current.LastOutput = output
+		current.LastError = ""
+		if sendErr != nil {
+			current.LastError = sendErr.Error()
+		}
+		s.schedules[id] = current
+		if err := s.save(); err != nil && sendErr == nil {
+			sendErr = err
+		}
+	}
+	s.mu.Unlock()
+
+	if sendErr != nil {
+		return models.DigestDelivery{}, sendErr
+	}
+	return models.DigestDelivery{Digest: digest, Output: output, DryRun: s.dryRun}, nil
+}
+
+func (s *DigestService) send(schedule models.DigestSchedule, digest models.Digest) (string, error) {
+	text, html, err := RenderDigest(digest)
+	if err != nil {
+		return "", err
+	}
+
+	return s.mailer.Send(EmailMessage{
+		From:    s.from,
+		To:      schedule.Recipients,
+		Subject: fmt.Sprintf("%s (%s)", digest.Title, digest.PeriodEnd.Format("Jan 2")),
+		Text:    text,
+		HTML:    html,
+	})
+}
+
+// save must be called with the write lock held.
+func (s *DigestService) save() error {
+	schedules := make([]models.DigestSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedule.NextRunAt = nil
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+
+	return saveJSONFile(s.path, schedules)
+}
+
+func companyDisplayName(aggregate models.CompanyAggregate) string {
+	if aggregate.Company != nil && aggregate.Company.Name != "" {
+		return aggregate.Company.Name
+	}
+	return aggregate.CompanyID
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// digestFuncs are shared by the text and HTML digest templates.
+var digestFuncs = map[string]interface{}{
+	"date":        func(t interface{ Format(string) string }) string { return t.Format("Jan 2, 2006") },
+	"signed":      formatSigned,
+	"percent":     formatPercent,
+	"companyName": companyDisplayName,
+	"pad":         func(s string, n int) string { return s + strings.Repeat(" ", max(0, n-len(s))) },
+}
+
+func formatSigned(n int) string {
+	if n > 0 {
+		return "+" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+func formatPercent(p *float64) string {
+	if p == nil {
+		return "n/a"
+	}
+	return strconv.FormatFloat(*p, 'f', 1, 64) + "%"
+}
+
+var digestTextTemplate = texttemplate.Must(texttemplate.New("digest.txt").Funcs(digestFuncs).Parse(`{{.Title}}
+{{date .PeriodStart}} - {{date .PeriodEnd}}
+
+TOTALS
+  Companies:          {{.Companies}}
+  Events this week:   {{.ThisWeek}}
+  Events last week:   {{.LastWeek}}
+  Change:             {{percent .Change}}
+
+TOP MOVERS
+{{- range .TopMovers}}
+  {{pad .Name 30}} {{.ThisWeek}} events ({{signed .Change}} vs last week)
+{{- else}}
+  No change in activity.
+{{- end}}
+
+AT-RISK COMPANIES
+{{- range .AtRisk}}
+  {{pad (companyName .) 30}} health {{.HealthScore}}, {{.AtRiskMetrics}} at-risk metrics in the last 30 days
+{{- else}}
+  None.
+{{- end}}
+
+INACTIVE ACCOUNTS
+{{- range .Inactive}}
+  {{pad (companyName .) 30}} no activity for {{.DaysSinceActivity}} days
+{{- else}}
+  None.
+{{- end}}
+`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(digestFuncs).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; color: #1f2933; max-width: 640px;">
+  <h2 style="margin-bottom: 4px;">{{.Title}}</h2>
+  <div style="color: #616e7c;">{{date .PeriodStart}} &ndash; {{date .PeriodEnd}}</div>
+
+  <table style="margin: 16px 0; border-collapse: collapse;">
+    <tr><td style="padding: 2px 16px 2px 0;">Companies</td><td><strong>{{.Companies}}</strong></td></tr>
+    <tr><td style="padding: 2px 16px 2px 0;">Events this week</td><td><strong>{{.ThisWeek}}</strong></td></tr>
+    <tr><td style="padding: 2px 16px 2px 0;">Events last week</td><td>{{.LastWeek}}</td></tr>
+    <tr><td style="padding: 2px 16px 2px 0;">Change</td><td>{{percent .Change}}</td></tr>
+  </table>
+
+  <h3>Top movers</h3>
+  {{- if .TopMovers}}
+  <table style="border-collapse: collapse; width: 100%;">
+    <tr style="text-align: left; color: #616e7c;"><th>Company</th><th>This week</th><th>Last week</th><th>Change</th></tr>
+    {{- range .TopMovers}}
+    <tr><td>{{.Name}}</td><td>{{.ThisWeek}}</td><td>{{.LastWeek}}</td>
+      <td style="color: {{if lt .Change 0}}#d00000{{else}}#2eb886{{end}};">{{signed .Change}}</td></tr>
+    {{- end}}
+  </table>
+  {{- else}}
+  <p>No change in activity.</p>
+  {{- end}}
+
+  <h3>At-risk companies</h3>
+  {{- if .AtRisk}}
+  <ul>
+    {{- range .AtRisk}}
+    <li><strong>{{companyName .}}</strong> &ndash; health {{.HealthScore}}, {{.AtRiskMetrics}} at-risk metrics in the last 30 days</li>
+    {{- end}}
+  </ul>
+  {{- else}}
+  <p>None.</p>
+  {{- end}}
+
+  <h3>Inactive accounts</h3>
+  {{- if .Inactive}}
+  <ul>
+    {{- range .Inactive}}
+    <li><strong>{{companyName .}}</strong> &ndash; no activity for {{.DaysSinceActivity}} days</li>
+    {{- end}}
+  </ul>
+  {{- else}}
+  <p>None.</p>
+  {{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSegmentHistory bounds the membership history kept on disk; the oldest
+// changes are dropped first.
+const maxSegmentHistory = 10000
+
+const (
+	SegmentMatchAll = "all"
+	SegmentMatchAny = "any"
+)
+
+// segmentMetrics are the company properties a segment condition can test.
+var segmentMetrics = map[string]func(*models.CompanyAggregate) float64{
+	"event_count":         func(a *models.CompanyAggregate) float64 { return float64(a.EventCount) },
+	"events_last_7_days":  func(a *models.CompanyAggregate) float64 { return float64(a.EventsLast7Days) },
+	"events_last_30_days": func(a *models.CompanyAggregate) float64 { return float64(a.EventsLast30Days) },
+	"actions_last_7_days": func(a *models.CompanyAggregate) float64 { return float64(a.ActionsLast7Days) },
+	"at_risk_metrics":     func(a *models.CompanyAggregate) float64 { return float64(a.AtRiskMetrics) },
+	"days_since_activity": func(a *models.CompanyAggregate) float64 { return float64(a.DaysSinceActivity) },
+	"health_score":        func(a *models.CompanyAggregate) float64 { return float64(a.HealthScore) },
+	"health_score_change": func(a *models.CompanyAggregate) float64 { return float64(a.HealthScoreChange) },
+}
+
+var segmentOperators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"=":  func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// SegmentMetrics returns the metric names conditions may use.
+func SegmentMetrics() []string {
+	names := make([]string, 0, len(segmentMetrics))
+	for name := range segmentMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func IsSegmentMetric(name string) bool {
+	_, ok := segmentMetrics[name]
+	return ok
+}
+
+func IsSegmentOperator(op string) bool {
+	_, ok := segmentOperators[op]
+	return ok
+}
+
+// DynamicSegmentService keeps company aggregates for the loaded dataset and
+// the membership of every dynamic segment, recording each company that enters
+// or leaves a segment.
+type DynamicSegmentService struct {
+	mu          sync.RWMutex
+	path        string
+	historyPath string
+	segments    map[string]models.DynamicSegment
+	history     []models.SegmentMembershipChange
+	aggregates  []models.CompanyAggregate
+	version     string
+	directory   *CompanyDirectory
+}
+
+func NewDynamicSegmentService(path, historyPath string, directory *CompanyDirectory) (*DynamicSegmentService, error) {
+	s := &DynamicSegmentService{
+		path:        path,
+		historyPath: historyPath,
+		segments:    make(map[string]models.DynamicSegment),
+		directory:   directory,
+	}
+
+	var stored []models.DynamicSegment
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for _, segment := range stored {
+		s.segments[segment.ID] = segment
+	}
+
+	if err := loadJSONFile(historyPath, &s.history); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Evaluate recomputes company aggregates and re-evaluates every segment. It
+// is registered as a data load hook on the analytics service.
+func (s *DynamicSegmentService) Evaluate(events []models.UsageEvent, version string) error {
+	aggregates := computeCompanyAggregates(events)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.aggregates = aggregates
+	s.version = version
+
+	now := time.Now().UTC()
+	for id, segment := range s.segments {
+		s.segments[id] = s.evaluateSegment(segment, now)
+	}
+
+	return s.save()
+}
+
+// Companies returns the aggregate of every company, ordered by company ID and
+// joined with its directory entry.
+func (s *DynamicSegmentService) Companies() []models.CompanyAggregate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	aggregates := make([]models.CompanyAggregate, len(s.aggregates))
+	for i, aggregate := range s.aggregates {
+		aggregates[i] = s.withCompany(aggregate)
+	}
+	return aggregates
+}
+
+// Company returns the aggregate of one company.
+func (s *DynamicSegmentService) Company(companyID string) (models.CompanyAggregate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := sort.Search(len(s.aggregates), func(i int) bool {
+		return s.aggregates[i].CompanyID >= companyID
+	})
+	if i == len(s.aggregates) || s.aggregates[i].CompanyID != companyID {
+		return models.CompanyAggregate{}, fmt.Errorf("company %s: %w", companyID, ErrNotFound)
+	}
+	return s.withCompany(s.aggregates[i]), nil
+}
+
+func (s *DynamicSegmentService) withCompany(aggregate models.CompanyAggregate) models.CompanyAggregate {
+	company := s.directory.Get(aggregate.CompanyID)
+	aggregate.Company = &company
+	return aggregate
+}
+
+func (s *DynamicSegmentService) List() []models.DynamicSegment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segments := make([]models.DynamicSegment, 0, len(s.segments))
+	for _, segment := range s.segments {
+		segments = append(segments, segment)
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Name != segments[j].Name {
+			return segments[i].Name < segments[j].Name
+		}
+		return segments[i].ID < segments[j].ID
+	})
+	return segments
+}
+
+func (s *DynamicSegmentService) Get(id string) (models.DynamicSegment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segment, ok := s.segments[id]
+	if !ok {
+		return models.DynamicSegment{}, fmt.Errorf("dynamic segment %s: %w", id, ErrNotFound)
+	}
+	return segment, nil
+}
+
+// Members returns the aggregates of the companies currently in a segment,
+// leaving out those outside scope when it is not nil.
+func (s *DynamicSegmentService) Members(id string, scope []string) ([]models.CompanyAggregate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segment, ok := s.segments[id]
+	if !ok {
+		return nil, fmt.Errorf("dynamic segment %s: %w", id, ErrNotFound)
+	}
+
+	members := make(map[string]bool, len(segment.Members))
+	for _, companyID := range segment.Members {
+		members[companyID] = true
+	}
+
+	aggregates := make([]models.CompanyAggregate, 0, len(segment.Members))
+	for _, aggregate := range s.aggregates {
+		if members[aggregate.CompanyID] && (scope == nil || containsString(scope, aggregate.CompanyID)) {
+			aggregates = append(aggregates, s.withCompany(aggregate))
+		}
+	}
+	return aggregates, nil
+}
+
+// History returns a segment's membership changes, newest first, leaving out
+// companies outside scope when it is not nil.
+func (s *DynamicSegmentService) History(id string, limit int, scope []string) ([]models.SegmentMembershipChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.segments[id]; !ok {
+		return nil, fmt.Errorf("dynamic segment %s: %w", id, ErrNotFound)
+	}
+
+	changes := []models.SegmentMembershipChange{}
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].SegmentID != id || (scope != nil && !containsString(scope, s.history[i].CompanyID)) {
+			continue
+		}
+		changes = append(changes, s.history[i])
+		if limit > 0 && len(changes) == limit {
+			break
+		}
+	}
+	return changes, nil
+}
+
+func (s *DynamicSegmentService) Create(request models.DynamicSegmentRequest) (models.DynamicSegment, error) {
+	now := time.Now().UTC()
+	segment := models.DynamicSegment{
+		ID:        newID(),
+		Members:   []string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	applySegmentRequest(&segment, request)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previousHistory := s.history
+	segment = s.evaluateSegment(segment, now)
+	s.segments[segment.ID] = segment
+	if err := s.save(); err != nil {
+		delete(s.segments, segment.ID)
+		s.history = previousHistory
+		return models.DynamicSegment{}, err
+	}
+	return segment, nil
+}
+
+func (s *DynamicSegmentService) Update(id string, request models.DynamicSegmentRequest) (models.DynamicSegment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.segments[id]
+	if !ok {
+		return models.DynamicSegment{}, fmt.Errorf("dynamic segment %s: %w", id, ErrNotFound)
+	}
+
+	now := time.Now().UTC()
+	segment := previous
+	applySegmentRequest(&segment, request)
+	segment.UpdatedAt = now
+
+	previousHistory := s.history
+	segment = s.evaluateSegment(segment, now)
+	s.segments[id] = segment
+	if err := s.save(); err != nil {
+		s.segments[id] = previous
+		s.history = previousHistory
+		return models.DynamicSegment{}, err
+	}
+	return segment, nil
+}
+
+// Delete removes a segment together with its membership history.
+func (s *DynamicSegmentService) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.segments[id]
+	if !ok {
+		return fmt.Errorf("dynamic segment %s: %w", id, ErrNotFound)
+	}
+
+	previousHistory := s.history
+	history := make([]models.SegmentMembershipChange, 0, len(s.history))
+	for _, change := range s.history {
+		if change.SegmentID != id {
+			history = append(history, change)
+		}
+	}
+
+	delete(s.segments, id)
+	s.history = history
+	if err := s.save(); err != nil {
+		s.segments[id] = previous
+		s.history = previousHistory
+		return err
+	}
+	return nil
+}
+
+func applySegmentRequest(segment *models.DynamicSegment, request models.DynamicSegmentRequest) {
+	segment.Name = strings.TrimSpace(request.Name)
+	segment.Description = strings.TrimSpace(request.Description)
+	segment.Match = strings.ToLower(strings.TrimSpace(request.Match))
+	if segment.Match == "" {
+		segment.Match = SegmentMatchAll
+	}
+	segment.Conditions = request.Conditions
+}
+
+// evaluateSegment recomputes a segment's members and appends the companies
+// that entered or exited it to the history. It must be called with the write
+// lock held.
+func (s *DynamicSegmentService) evaluateSegment(segment models.DynamicSegment, now time.Time) models.DynamicSegment {
+	if s.version == "" {
+		// No data loaded yet; keep the last known membership
+		return segment
+	}
+
+	previous := make(map[string]bool, len(segment.Members))
+	for _, companyID := range segment.Members {
+		previous[companyID] = true
+	}
+
+	members := []string{}
+	for i := range s.aggregates {
+		aggregate := &s.aggregates[i]
+		if !segmentMatches(segment, aggregate) {
+			continue
+		}
+
+		members = append(members, aggregate.CompanyID)
+		if previous[aggregate.CompanyID] {
+			delete(previous, aggregate.CompanyID)
+		} else {
+			s.recordChange(segment.ID, aggregate.CompanyID, models.MembershipEntered, now)
+		}
+	}
+
+	exited := make([]string, 0, len(previous))
+	for companyID := range previous {
+		exited = append(exited, companyID)
+	}
+	sort.Strings(exited)
+	for _, companyID := range exited {
+		s.recordChange(segment.ID, companyID, models.MembershipExited, now)
+	}
+
+	segment.Members = members
+	segment.DatasetVersion = s.version
+	segment.EvaluatedAt = now
+	return segment
+}
+
+func (s *DynamicSegmentService) recordChange(segmentID, companyID, change string, now time.Time) {
+	s.history = append(s.history, models.SegmentMembershipChange{
+		SegmentID:      segmentID,
+		CompanyID:      companyID,
+		Change:         change,
+		DatasetVersion: s.version,
+		At:             now,
+	})
+}
+
+func segmentMatches(segment models.DynamicSegment, aggregate *models.CompanyAggregate) bool {
+	if len(segment.Conditions) == 0 {
+		return false
+	}
+
+	for _, condition := range segment.Conditions {
+		metric, ok := segmentMetrics[condition.Metric]
+		if !ok {
+			return false
+		}
+		compare, ok := segmentOperators[condition.Operator]
+		if !ok {
+			return false
+		}
+
+		matched := compare(metric(aggregate), condition.Value)
+		if segment.Match == SegmentMatchAny && matched {
+			return true
+		}
+		if segment.Match != SegmentMatchAny && !matched {
+			return false
+		}
+	}
+	return segment.Match != SegmentMatchAny
+}
+
+// save must be called with the write lock held.
+func (s *DynamicSegmentService) save() error {
+	if len(s.history) > maxSegmentHistory {
+		s.history = append([]models.SegmentMembershipChange(nil), s.history[len(s.history)-maxSegmentHistory:]...)
+	}
+
+	segments := make([]models.DynamicSegment, 0, len(s.segments))
+	for _, segment := range s.segments {
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].CreatedAt.Before(segments[j].CreatedAt)
+	})
+
+	if err := saveJSONFile(s.path, segments); err != nil {
+		return err
+	}
+	return saveJSONFile(s.historyPath, s.history)
+}
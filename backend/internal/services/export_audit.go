@@ -0,0 +1,215 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ExportAuditLog is the record of every export, one JSON entry per line in
+// an append-only file. Entries are only ever removed by Prune once they are
+// older than the retention period.
+type ExportAuditLog struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+}
+
+func NewExportAuditLog(path string, retention time.Duration) (*ExportAuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	// A crash part way through a write can leave the last line unterminated;
+	// end it so the next entry starts on a line of its own.
+	last, err := lastByte(path)
+	if err != nil {
+		return nil, err
+	}
+	if last != 0 && last != '\n' {
+		if err := appendFile(path, []byte{'\n'}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ExportAuditLog{path: path, retention: retention}, nil
+}
+
+// Record appends an entry, filling in its ID and time. The entry is synced
+// to disk before Record returns, so callers can refuse an export that could
+// not be recorded.
+func (l *ExportAuditLog) Record(entry models.ExportAuditEntry) error {
+	entry.ID = newID()
+	entry.Time = time.Now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return appendFile(l.path, line)
+}
+
+// appendFile writes data to the end of path and syncs it to disk.
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// lastByte returns the final byte of path, or 0 when it is empty or missing.
+func lastByte(path string) (byte, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return 0, err
+	}
+	b := make([]byte, 1)
+	if _, err := file.ReadAt(b, info.Size()-1); err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return b[0], nil
+}
+
+// Query returns the matching entries, newest first.
+func (l *ExportAuditLog) Query(query models.ExportAuditQuery) ([]models.ExportAuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []models.ExportAuditEntry{}
+	err := l.scan(func(entry models.ExportAuditEntry, _ []byte) {
+		if matchesAuditQuery(entry, query) {
+			entries = append(entries, entry)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The file is in the order entries were written
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+	return entries, nil
+}
+
+func matchesAuditQuery(entry models.ExportAuditEntry, query models.ExportAuditQuery) bool {
+	switch {
+	case query.Requester != "" && entry.Requester != query.Requester:
+		return false
+	case query.Action != "" && entry.Action != query.Action:
+		return false
+	case query.Format != "" && entry.Format != query.Format:
+		return false
+	case query.JobID != "" && entry.JobID != query.JobID:
+		return false
+	case query.From != nil && entry.Time.Before(*query.From):
+		return false
+	case query.To != nil && entry.Time.After(*query.To):
+		return false
+	}
+	return true
+}
+
+// Prune drops entries older than the retention period by rewriting the file
+// without them.
+func (l *ExportAuditLog) Prune(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-l.retention)
+	var kept bytes.Buffer
+	removed := 0
+	err := l.scan(func(entry models.ExportAuditEntry, line []byte) {
+		if entry.Time.Before(cutoff) {
+			removed++
+			return
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	})
+	if err != nil || removed == 0 {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %w", l.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(kept.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", l.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", l.path, err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", l.path, err)
+	}
+
+	log.Printf("Removed %d export audit entries older than %s", removed, l.retention)
+	return nil
+}
+
+// scan calls fn for each entry in the file. It must be called with the lock
+// held. Lines that do not decode, such as one cut short by a crash, are
+// skipped.
+func (l *ExportAuditLog) scan(fn func(entry models.ExportAuditEntry, line []byte)) error {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", l.path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var entry models.ExportAuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Warning: skipping unreadable line %d of %s: %v", n, l.path, err)
+			continue
+		}
+		fn(entry, scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", l.path, err)
+	}
+	return nil
+}
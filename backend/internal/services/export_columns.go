@@ -0,0 +1,328 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Export column kinds decide how a value is written: text as is, times in
+// the requested format (or as date cells in XLSX) and numbers unquoted.
+const (
+	columnText = iota
+	columnTime
+	columnNumber
+)
+
+// exportRecord is one event along with the data joined onto it.
+type exportRecord struct {
+	event       *models.UsageEvent
+	companyName string
+	annotations []string
+}
+
+type exportColumn struct {
+	key        string
+	header     string
+	kind       int
+	dictionary bool // few distinct values; dictionary encoded in Parquet
+	text       func(r *exportRecord) string
+	time       func(r *exportRecord) time.Time
+	number     func(r *exportRecord) (float64, bool)
+}
+
+// exportColumns lists every column an export can contain, in the order they
+// are documented.
+var exportColumns = []exportColumn{
+	{key: "id", header: "ID", text: func(r *exportRecord) string { return r.event.ID }},
+	{key: "created_at", header: "Created At", kind: columnTime, time: func(r *exportRecord) time.Time { return r.event.CreatedAt }},
+	{key: "company_id", header: "Company ID", dictionary: true, text: func(r *exportRecord) string { return r.event.CompanyID }},
+	{key: "company_name", header: "Company Name", dictionary: true, text: func(r *exportRecord) string { return r.companyName }},
+	{key: "type", header: "Type", dictionary: true, text: func(r *exportRecord) string { return r.event.Type }},
+	{key: "content", header: "Content", text: func(r *exportRecord) string { return r.event.Content }},
+	{key: "attribute", header: "Attribute", dictionary: true, text: func(r *exportRecord) string { return r.event.Attribute }},
+	{key: "updated_at", header: "Updated At", kind: columnTime, time: func(r *exportRecord) time.Time { return r.event.UpdatedAt }},
+	{key: "original_timestamp", header: "Original Timestamp", kind: columnTime, time: func(r *exportRecord) time.Time { return r.event.OriginalTimestamp }},
+	{key: "value", header: "Value", text: func(r *exportRecord) string { return r.event.Value }},
+	{key: "value_number", header: "Value (Number)", kind: columnNumber, number: func(r *exportRecord) (float64, bool) { return parseNumericValue(r.event.Value) }},
+	{key: "user_email", header: "User Email", text: func(r *exportRecord) string { return contentEmail(r.event.Content) }},
+	{key: "route", header: "Route", dictionary: true, text: func(r *exportRecord) string { return contentRoute(r.event.Content) }},
+	{key: "annotations", header: "Annotations", text: func(r *exportRecord) string { return strings.Join(r.annotations, " | ") }},
+}
+
+// defaultExportColumns are written when a request does not pick columns.
+var defaultExportColumns = []string{
+	"id", "created_at", "company_id", "company_name", "type", "content",
+	"attribute", "updated_at", "original_timestamp", "value",
+}
+
+var exportTimestampLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"datetime":    "2006-01-02 15:04:05",
+	"date":        "2006-01-02",
+	"unix":        "",
+	"unix_ms":     "",
+}
+
+const (
+	QuoteMinimal = "minimal"
+	QuoteAll     = "all"
+	QuoteNone    = "none"
+)
+
+func ExportColumns() []string {
+	keys := make([]string, len(exportColumns))
+	for i, column := range exportColumns {
+		keys[i] = column.key
+	}
+	return keys
+}
+
+func IsExportColumn(key string) bool {
+	_, ok := findExportColumn(key)
+	return ok
+}
+
+func ExportTimestampFormats() []string {
+	return []string{"rfc3339", "rfc3339nano", "datetime", "date", "unix", "unix_ms"}
+}
+
+func IsExportTimestampFormat(format string) bool {
+	_, ok := exportTimestampLayouts[format]
+	return ok
+}
+
+func findExportColumn(key string) (exportColumn, bool) {
+	for _, column := range exportColumns {
+		if column.key == key {
+			return column, true
+		}
+	}
+	return exportColumn{}, false
+}
+
+// exportLayout is the column and formatting choices of a request, resolved
+// once per export.
+type exportLayout struct {
+	columns       []exportColumn
+	headers       []string
+	custom        bool // columns were picked by the request
+	annotations   bool // the annotations column is included
+	timeFormat    string
+	location      *time.Location // nil keeps each timestamp's own zone
+	includeHeader bool
+	delimiter     rune
+	quote         string
+}
+
+// newExportLayout resolves a validated request. The annotations column is
+// added when annotations are requested without listing it, unless
+// withAnnotations is false (JSON exports carry them separately).
+func newExportLayout(request models.ExportRequest, withAnnotations bool) *exportLayout {
+	layout := &exportLayout{
+		custom:        len(request.Columns) > 0,
+		timeFormat:    strings.ToLower(request.TimestampFormat),
+		includeHeader: request.IncludeHeader == nil || *request.IncludeHeader,
+		delimiter:     ',',
+		quote:         strings.ToLower(request.Quote),
+	}
+	if layout.timeFormat == "" {
+		layout.timeFormat = "rfc3339"
+	}
+	if layout.quote == "" {
+		layout.quote = QuoteMinimal
+	}
+	if request.Timezone != "" {
+		layout.location, _ = time.LoadLocation(request.Timezone)
+	}
+	if request.Delimiter != "" {
+		layout.delimiter, _ = utf8.DecodeRuneInString(request.Delimiter)
+	}
+
+	keys := request.Columns
+	if len(keys) == 0 {
+		keys = defaultExportColumns
+	}
+	for _, key := range keys {
+		if column, ok := findExportColumn(key); ok {
+			layout.columns = append(layout.columns, column)
+			layout.annotations = layout.annotations || key == "annotations"
+		}
+	}
+	if request.IncludeAnnotations && withAnnotations && !layout.annotations {
+		column, _ := findExportColumn("annotations")
+		layout.columns = append(layout.columns, column)
+		layout.annotations = true
+	}
+
+	layout.headers = make([]string, len(layout.columns))
+	for i, column := range layout.columns {
+		layout.headers[i] = column.header
+		if label, ok := request.Headers[column.key]; ok {
+			layout.headers[i] = label
+		}
+	}
+
+	return layout
+}
+
+func (l *exportLayout) localTime(t time.Time) time.Time {
+	if l.location != nil {
+		return t.In(l.location)
+	}
+	return t
+}
+
+// text formats a column for delimited output. Missing numbers and zero
+// times are written as empty fields.
+func (l *exportLayout) text(column exportColumn, record *exportRecord) string {
+	switch column.kind {
+	case columnTime:
+		t := column.time(record)
+		if t.IsZero() {
+			return ""
+		}
+		switch l.timeFormat {
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10)
+		case "unix_ms":
+			return strconv.FormatInt(t.UnixMilli(), 10)
+		}
+		return l.localTime(t).Format(exportTimestampLayouts[l.timeFormat])
+	case columnNumber:
+		if n, ok := column.number(record); ok {
+			return strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		return ""
+	}
+	return column.text(record)
+}
+
+// value is the JSON value of a column: numbers for numeric columns and unix
+// timestamps, null when missing.
+func (l *exportLayout) value(column exportColumn, record *exportRecord) interface{} {
+	switch column.kind {
+	case columnTime:
+		if t := column.time(record); t.IsZero() {
+			return nil
+		} else if l.timeFormat == "unix" {
+			return t.Unix()
+		} else if l.timeFormat == "unix_ms" {
+			return t.UnixMilli()
+		}
+	case columnNumber:
+		if n, ok := column.number(record); ok {
+			return n
+		}
+		return nil
+	default:
+		if column.key == "annotations" {
+			if record.annotations == nil {
+				return []string{}
+			}
+			return record.annotations
+		}
+	}
+	return l.text(column, record)
+}
+
+func (l *exportLayout) xlsxCell(column exportColumn, record *exportRecord) xlsxCell {
+	switch column.kind {
+	case columnTime:
+		t := column.time(record)
+		if t.IsZero() {
+			return xlsxCell{}
+		}
+		// Excel has no time zones; write the wall clock time in the
+		// requested zone
+		local := l.localTime(t)
+		wall := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+		return xlsxTime(wall, xlsxStyleDateTime)
+	case columnNumber:
+		if n, ok := column.number(record); ok {
+			return xlsxNumber(n)
+		}
+		return xlsxCell{}
+	}
+	if column.key == "value" {
+		return xlsxValue(record.event.Value)
+	}
+	return xlsxString(column.text(record))
+}
+
+// contentEmail returns the user's email address from content such as
+// "User active CMMS - Sample Company jane@sample.com /work-orders".
+func contentEmail(content string) string {
+	for _, word := range strings.Fields(content) {
+		if strings.Contains(word, "@") && !strings.HasPrefix(word, "/") {
+			return word
+		}
+	}
+	return ""
+}
+
+// contentRoute returns the path the user visited, e.g. "/work-orders".
+func contentRoute(content string) string {
+	for _, word := range strings.Fields(content) {
+		if strings.HasPrefix(word, "/") {
+			return word
+		}
+	}
+	return ""
+}
+
+// delimitedWriter writes CSV-style records with a configurable delimiter
+// and quoting. Minimal quoting matches encoding/csv.
+type delimitedWriter struct {
+	w         *bufio.Writer
+	delimiter rune
+	quote     string
+}
+
+func newDelimitedWriter(w io.Writer, layout *exportLayout) *delimitedWriter {
+	return &delimitedWriter{w: bufio.NewWriter(w), delimiter: layout.delimiter, quote: layout.quote}
+}
+
+func (d *delimitedWriter) Write(fields []string) error {
+	for i, field := range fields {
+		if i > 0 {
+			d.w.WriteRune(d.delimiter)
+		}
+		if !d.needsQuotes(field) {
+			d.w.WriteString(field)
+			continue
+		}
+		d.w.WriteByte('"')
+		d.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		d.w.WriteByte('"')
+	}
+	_, err := d.w.WriteString("\n")
+	return err
+}
+
+func (d *delimitedWriter) needsQuotes(field string) bool {
+	switch d.quote {
+	case QuoteAll:
+		return true
+	case QuoteNone:
+		return false
+	}
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsRune(field, d.delimiter) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
+
+func (d *delimitedWriter) Flush() error {
+	return d.w.Flush()
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// columnTestEvents are two events at 2025-05-01 12:00 and 2025-05-02 15:00
+// UTC, one from a named company.
+var columnTestEvents = []models.UsageEvent{
+	{ID: "e1", CreatedAt: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC), CompanyID: "c1", Type: "Action",
+		Content: "User active CMMS - Acme Corp jane@acme.com /work-orders/17", Attribute: "UserActiveCMMS", Value: "null"},
+	{ID: "e2", CreatedAt: time.Date(2025, 5, 2, 15, 0, 0, 0, time.UTC), CompanyID: "c2", Type: "CumulativeMetric",
+		Content: "Total Bank Balance Today", Attribute: "Balance", Value: "$1,234.50"},
+}
+
+func writeColumnExport(t *testing.T, request models.ExportRequest) []byte {
+	t.Helper()
+	directory, err := NewCompanyDirectory(filepath.Join(t.TempDir(), "company_metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := directory.Import([]models.CompanyMetadata{{CompanyID: "c2", Name: "Globex; Inc"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewExportService(NewFilterService(), directory).WriteExport(context.Background(), &buf, columnTestEvents, request, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportColumnSelection(t *testing.T) {
+	noHeader := false
+	tests := []struct {
+		name    string
+		request models.ExportRequest
+		want    string
+	}{
+		{
+			name:    "default columns",
+			request: models.ExportRequest{Format: "csv"},
+			want: "ID,Created At,Company ID,Company Name,Type,Content,Attribute,Updated At,Original Timestamp,Value\n" +
+				"e1,2025-05-01T12:00:00Z,c1,,Action,User active CMMS - Acme Corp jane@acme.com /work-orders/17,UserActiveCMMS,,,null\n" +
+				"e2,2025-05-02T15:00:00Z,c2,Globex; Inc,CumulativeMetric,Total Bank Balance Today,Balance,,,\"$1,234.50\"\n",
+		},
+		{
+			// New York is four hours behind UTC in May; fields holding the
+			// delimiter are quoted, and derived columns come from the
+			// content and value
+			name: "picked columns, labels, zone and delimiter",
+			request: models.ExportRequest{
+				Format:          "csv",
+				Columns:         []string{"id", "created_at", "company_name", "value_number", "user_email", "route"},
+				Headers:         map[string]string{"id": "Event", "value_number": "Amount"},
+				TimestampFormat: "datetime",
+				Timezone:        "America/New_York",
+				Delimiter:       ";",
+			},
+			want: "Event;Created At;Company Name;Amount;User Email;Route\n" +
+				"e1;2025-05-01 08:00:00;;;jane@acme.com;/work-orders/17\n" +
+				"e2;2025-05-02 11:00:00;\"Globex; Inc\";1234.5;;\n",
+		},
+		{
+			name: "no header, everything quoted, unix seconds",
+			request: models.ExportRequest{
+				Format:          "csv",
+				Columns:         []string{"created_at", "id"},
+				TimestampFormat: "unix",
+				Quote:           QuoteAll,
+				IncludeHeader:   &noHeader,
+			},
+			want: "\"1746100800\",\"e1\"\n\"1746198000\",\"e2\"\n",
+		},
+		{
+			name: "no quoting",
+			request: models.ExportRequest{
+				Format:  "csv",
+				Columns: []string{"company_name", "value"},
+				Quote:   QuoteNone,
+			},
+			want: "Company Name,Value\n,null\nGlobex; Inc,$1,234.50\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got := string(writeColumnExport(t, test.request)); got != test.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExportColumnsInJSON(t *testing.T) {
+	// Picked columns become objects keyed in column order by their labels,
+	// with numbers and unix times as JSON numbers and missing values null
+	request := models.ExportRequest{
+		Format:          "json",
+		Columns:         []string{"id", "created_at", "value_number", "company_name"},
+		Headers:         map[string]string{"id": "event", "created_at": "ts"},
+		TimestampFormat: "unix_ms",
+	}
+	want := `[{"event":"e1","ts":1746100800000,"value_number":null,"company_name":""},` +
+		`{"event":"e2","ts":1746198000000,"value_number":1234.5,"company_name":"Globex; Inc"}]`
+
+	var got bytes.Buffer
+	if err := json.Compact(&got, writeColumnExport(t, request)); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want {
+		t.Errorf("got  %s\nwant %s", got.String(), want)
+	}
+
+	// NDJSON takes the same columns, one object per line
+	request.Format = "ndjson"
+	wantLines := `{"event":"e1","ts":1746100800000,"value_number":null,"company_name":""}` + "\n" +
+		`{"event":"e2","ts":1746198000000,"value_number":1234.5,"company_name":"Globex; Inc"}` + "\n"
+	if got := string(writeColumnExport(t, request)); got != wantLines {
+		t.Errorf("ndjson:\ngot  %s\nwant %s", got, wantLines)
+	}
+}
+
+func TestExportColumnsInXLSX(t *testing.T) {
+	// Excel has no zones, so times are the wall clock in the requested
+	// zone: 21:00 and midnight in Tokyo
+	request := models.ExportRequest{
+		Format:   "xlsx",
+		Columns:  []string{"created_at", "value_number", "route"},
+		Headers:  map[string]string{"created_at": "When"},
+		Timezone: "Asia/Tokyo",
+	}
+	parts := xlsxParts(t, writeColumnExport(t, request))
+
+	want := `<row r="1">` + inlineCell("A1", "1", "When") + inlineCell("B1", "1", "Value (Number)") + inlineCell("C1", "1", "Route") + `</row>` +
+		`<row r="2"><c r="A2" s="2"><v>45778.875</v></c>` + inlineCell("C2", "", "/work-orders/17") + `</row>` +
+		`<row r="3"><c r="A3" s="2"><v>45780</v></c><c r="B3"><v>1234.5</v></c></row>`
+	if got := sheetRows(t, parts["xl/worksheets/sheet1.xml"]); got != want {
+		t.Errorf("events sheet rows:\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,404 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrExportNotReady  = errors.New("export is not ready for download")
+	ErrExportFinished  = errors.New("export has already finished")
+	ErrExportQueueFull = errors.New("too many exports are queued")
+)
+
+const maxQueuedExports = 100
+
+// ExportJobService runs exports in background workers, writing each one to a
+// file in dir. Job metadata is kept in dir/jobs.json so finished exports can
+// still be downloaded after a restart.
+type ExportJobService struct {
+	mu        sync.RWMutex
+	dir       string
+	ttl       time.Duration
+	jobs      map[string]*models.ExportJob
+	cancels   map[string]context.CancelFunc
+	queue     chan string
+	analytics *AnalyticsService
+	audit     *ExportAuditLog
+	redactor  *Redactor
+}
+
+func NewExportJobService(dir string, ttl time.Duration, analytics *AnalyticsService, audit *ExportAuditLog, redactor *Redactor) (*ExportJobService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory %s: %w", dir, err)
+	}
+
+	s := &ExportJobService{
+		dir:       dir,
+		ttl:       ttl,
+		jobs:      make(map[string]*models.ExportJob),
+		cancels:   make(map[string]context.CancelFunc),
+		queue:     make(chan string, maxQueuedExports),
+		analytics: analytics,
+		audit:     audit,
+		redactor:  redactor,
+	}
+
+	var stored []models.ExportJob
+	if err := loadJSONFile(s.indexPath(), &stored); err != nil {
+		return nil, err
+	}
+	for i := range stored {
+		job := stored[i]
+		// Jobs that were in flight when the server stopped cannot be resumed
+		if !job.Finished() {
+			os.Remove(s.partialPath(job))
+			s.finish(&job, models.ExportFailed, errors.New("interrupted by a server restart"))
+		}
+		s.jobs[job.ID] = &job
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Run starts the given number of workers and blocks until ctx is cancelled.
+func (s *ExportJobService) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-s.queue:
+					s.run(ctx, id)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *ExportJobService) List() []models.ExportJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]models.ExportJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+func (s *ExportJobService) Get(id string) (models.ExportJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return models.ExportJob{}, fmt.Errorf("export %s: %w", id, ErrNotFound)
+	}
+	return *job, nil
+}
+
+// Create queues an export. The filters are resolved against the dataset when
+// a worker picks the job up; the redaction policy is the one in force for
+// the requester now.
+func (s *ExportJobService) Create(request models.ExportRequest, requester models.Principal, clientIP, redaction string) (models.ExportJob, error) {
+	now := time.Now().UTC()
+	job := &models.ExportJob{
+		ID:          newID(),
+		Status:      models.ExportQueued,
+		Request:     request,
+		RequestedBy: requester.Subject,
+		Owner:       requester.Identity(),
+		ClientIP:    clientIP,
+		Redaction:   redaction,
+		Scope:       request.Filters.Scope,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job
+	if err := s.save(); err != nil {
+		delete(s.jobs, job.ID)
+		return models.ExportJob{}, err
+	}
+
+	select {
+	case s.queue <- job.ID:
+	default:
+		delete(s.jobs, job.ID)
+		s.save()
+		return models.ExportJob{}, ErrExportQueueFull
+	}
+
+	return *job, nil
+}
+
+// Cancel stops a queued or running export.
+func (s *ExportJobService) Cancel(id string) (models.ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return models.ExportJob{}, fmt.Errorf("export %s: %w", id, ErrNotFound)
+	}
+	if job.Finished() {
+		return *job, ErrExportFinished
+	}
+
+	if cancel, ok := s.cancels[id]; ok {
+		// The worker records the cancellation once it has stopped writing
+		cancel()
+		return *job, nil
+	}
+
+	s.finish(job, models.ExportCancelled, nil)
+	return *job, s.save()
+}
+
+// Delete cancels the export if it is still in progress and removes it and
+// its file.
+func (s *ExportJobService) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("export %s: %w", id, ErrNotFound)
+	}
+	if cancel, ok := s.cancels[id]; ok {
+		cancel()
+	}
+
+	s.remove(job)
+	return s.save()
+}
+
+// File returns the path of a completed export's file.
+func (s *ExportJobService) File(id string) (models.ExportJob, string, error) {
+	job, err := s.Get(id)
+	if err != nil {
+		return job, "", err
+	}
+	if job.Status != models.ExportCompleted {
+		return job, "", fmt.Errorf("%w: export is %s", ErrExportNotReady, job.Status)
+	}
+	return job, s.filePath(job), nil
+}
+
+// Cleanup deletes finished exports whose expiry has passed.
+func (s *ExportJobService) Cleanup(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for _, job := range s.jobs {
+		if job.Finished() && now.After(job.ExpiresAt) {
+			s.remove(job)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+
+	log.Printf("Removed %d expired exports", removed)
+	return s.save()
+}
+
+func (s *ExportJobService) run(ctx context.Context, id string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != models.ExportQueued {
+		// Cancelled or deleted while queued
+		s.mu.Unlock()
+		return
+	}
+	started := time.Now().UTC()
+	job.Status = models.ExportRunning
+	job.StartedAt = &started
+	s.cancels[id] = cancel
+	s.save()
+	request, redaction := job.Request, job.Redaction
+	// The scope is not part of the request's JSON, so it is kept on the job
+	// and put back here, including for jobs saved before a restart
+	request.Filters.Scope = job.Scope
+	s.mu.Unlock()
+
+	size, err := s.write(ctx, id, request, redaction)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cancels, id)
+	job, ok = s.jobs[id]
+	if !ok {
+		// Deleted while running
+		os.Remove(s.filePath(models.ExportJob{ID: id, Request: request}))
+		return
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		s.finish(job, models.ExportCancelled, nil)
+	case err != nil:
+		s.finish(job, models.ExportFailed, err)
+	default:
+		job.Size = size
+		job.RowsWritten = job.TotalRows
+		job.Progress = 1
+		s.finish(job, models.ExportCompleted, nil)
+	}
+	if err := s.save(); err != nil {
+		log.Printf("Warning: failed to save export jobs: %v", err)
+	}
+
+	entry := job.AuditEntry()
+	entry.Action = models.AuditJob
+	entry.Requester = job.RequestedBy
+	entry.ClientIP = job.ClientIP
+	entry.Status = job.Status
+	entry.Error = job.Error
+	if err := s.audit.Record(entry); err != nil {
+		log.Printf("Warning: failed to record export %s in the audit log: %v", id, err)
+	}
+}
+
+// write renders the export to a temporary file and moves it into place once
+// it is complete.
+func (s *ExportJobService) write(ctx context.Context, id string, request models.ExportRequest, redaction string) (int64, error) {
+	// A policy removed from the configuration since the job was queued
+	// fails the job rather than exporting unredacted rows
+	policy, err := s.redactor.Named(redaction)
+	if err != nil {
+		return 0, err
+	}
+	export, err := s.analytics.PrepareExport(request)
+	if err != nil {
+		return 0, err
+	}
+	export.Redact(policy)
+
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		return 0, context.Canceled
+	}
+	job.Filename = export.Filename
+	job.ContentType = export.ContentType
+	job.TotalRows = export.Rows()
+	path, partial := s.filePath(*job), s.partialPath(*job)
+	s.mu.Unlock()
+
+	file, err := os.Create(partial)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create export file: %w", err)
+	}
+	counter := &countingWriter{w: file}
+
+	err = s.analytics.WriteExport(ctx, counter, export, func(rows int) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if job, ok := s.jobs[id]; ok {
+			job.RowsWritten = rows
+			if job.TotalRows > 0 {
+				job.Progress = float64(rows) / float64(job.TotalRows)
+			}
+		}
+	})
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write export file: %w", closeErr)
+	}
+	if err == nil {
+		err = os.Rename(partial, path)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return 0, err
+	}
+
+	return counter.n, nil
+}
+
+// finish must be called with the write lock held.
+func (s *ExportJobService) finish(job *models.ExportJob, status string, err error) {
+	now := time.Now().UTC()
+	job.Status = status
+	job.CompletedAt = &now
+	job.ExpiresAt = now.Add(s.ttl)
+	job.Error = ""
+	if err != nil {
+		job.Error = err.Error()
+	}
+}
+
+// remove must be called with the write lock held.
+func (s *ExportJobService) remove(job *models.ExportJob) {
+	os.Remove(s.filePath(*job))
+	delete(s.jobs, job.ID)
+}
+
+// save must be called with the write lock held.
+func (s *ExportJobService) save() error {
+	jobs := make([]models.ExportJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	return saveJSONFile(s.indexPath(), jobs)
+}
+
+func (s *ExportJobService) indexPath() string {
+	return filepath.Join(s.dir, "jobs.json")
+}
+
+func (s *ExportJobService) filePath(job models.ExportJob) string {
+	return filepath.Join(s.dir, job.ID+"."+strings.ToLower(job.Request.Format))
+}
+
+func (s *ExportJobService) partialPath(job models.ExportJob) string {
+	return s.filePath(job) + ".part"
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testRequester = models.Principal{Subject: "reports", Role: models.RoleAnalyst, Method: models.AuthAPIKey, KeyID: "k1"}
+
+// newTestExportJobs returns an export job service over count generated
+// events, keeping its files in dir. Workers are not started.
+func newTestExportJobs(t *testing.T, dir string, count int, ttl time.Duration) *ExportJobService {
+	t.Helper()
+	analytics := NewAnalyticsService(nil, nil)
+	analytics.events = generateEvents(1, count)
+	analytics.filterService.SetDataset(analytics.events, "test", nil)
+
+	audit, err := NewExportAuditLog(filepath.Join(dir, "audit.log"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor, err := NewRedactor("", "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := NewExportJobService(filepath.Join(dir, "exports"), ttl, analytics, audit, redactor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+// startExportWorkers runs one worker until the test ends.
+func startExportWorkers(t *testing.T, jobs *ExportJobService) {
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.Run(ctx, 1)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		stop()
+		<-done
+	})
+}
+
+func waitForJob(t *testing.T, jobs *ExportJobService, id string, done func(models.ExportJob) bool) models.ExportJob {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, err := jobs.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("export %s still %s", id, job.Status)
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+func finished(job models.ExportJob) bool { return job.Finished() }
+
+func createTestExport(t *testing.T, jobs *ExportJobService) models.ExportJob {
+	t.Helper()
+	job, err := jobs.Create(models.ExportRequest{Format: "csv"}, testRequester, "127.0.0.1", RedactionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestExportJobQueueFull(t *testing.T) {
+	dir := t.TempDir()
+	jobs := newTestExportJobs(t, dir, 10, time.Hour)
+
+	for i := 0; i < maxQueuedExports; i++ {
+		createTestExport(t, jobs)
+	}
+	_, err := jobs.Create(models.ExportRequest{Format: "csv"}, testRequester, "", RedactionNone)
+	if !errors.Is(err, ErrExportQueueFull) {
+		t.Fatalf("got %v, want the queue to be full", err)
+	}
+
+	// The refused job is neither listed nor saved
+	if n := len(jobs.List()); n != maxQueuedExports {
+		t.Errorf("%d jobs listed, want %d", n, maxQueuedExports)
+	}
+	var stored []models.ExportJob
+	if err := loadJSONFile(jobs.indexPath(), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != maxQueuedExports {
+		t.Errorf("%d jobs saved, want %d", len(stored), maxQueuedExports)
+	}
+}
+
+func TestExportJobsFailWhenInterruptedByARestart(t *testing.T) {
+	dir := t.TempDir()
+	jobs := newTestExportJobs(t, dir, 10, time.Hour)
+	startExportWorkers(t, jobs)
+	completed := waitForJob(t, jobs, createTestExport(t, jobs).ID, finished)
+
+	// A queued job, and a running one with half a file written
+	stopped := newTestExportJobs(t, dir, 10, time.Hour)
+	queued := createTestExport(t, stopped)
+	running := createTestExport(t, stopped)
+	stopped.mu.Lock()
+	stopped.jobs[running.ID].Status = models.ExportRunning
+	stopped.save()
+	stopped.mu.Unlock()
+	partial := stopped.partialPath(running)
+	if err := os.WriteFile(partial, []byte("id,created_at\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := newTestExportJobs(t, dir, 10, time.Hour)
+	for _, id := range []string{queued.ID, running.ID} {
+		job, err := restarted.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != models.ExportFailed || job.Error != "interrupted by a server restart" || job.CompletedAt == nil {
+			t.Errorf("interrupted job: %s %q", job.Status, job.Error)
+		}
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("partial file was kept: %v", err)
+	}
+	if _, path, err := restarted.File(completed.ID); err != nil {
+		t.Errorf("completed job after restart: %v", err)
+	} else if _, err := os.Stat(path); err != nil {
+		t.Errorf("completed job's file: %v", err)
+	}
+}
+
+func TestExportJobCancel(t *testing.T) {
+	jobs := newTestExportJobs(t, t.TempDir(), 100000, time.Hour)
+
+	// A queued job is cancelled on the spot, and workers skip it
+	queued := createTestExport(t, jobs)
+	job, err := jobs.Cancel(queued.ID)
+	if err != nil || job.Status != models.ExportCancelled {
+		t.Fatalf("cancel queued: %s, %v", job.Status, err)
+	}
+	startExportWorkers(t, jobs)
+
+	// A running job is cancelled by its worker once it stops writing
+	running := createTestExport(t, jobs)
+	waitForJob(t, jobs, running.ID, func(job models.ExportJob) bool { return job.Status != models.ExportQueued })
+	job, err = jobs.Cancel(running.ID)
+	if err != nil || job.Status != models.ExportRunning {
+		t.Fatalf("cancel running: %s, %v", job.Status, err)
+	}
+	job = waitForJob(t, jobs, running.ID, finished)
+	if job.Status != models.ExportCancelled || job.Error != "" {
+		t.Errorf("cancelled while running: %s %q", job.Status, job.Error)
+	}
+	if _, err := os.Stat(jobs.partialPath(job)); !os.IsNotExist(err) {
+		t.Errorf("partial file was kept: %v", err)
+	}
+	if _, _, err := jobs.File(running.ID); !errors.Is(err, ErrExportNotReady) {
+		t.Errorf("download of a cancelled export: %v", err)
+	}
+
+	if job, _ := jobs.Get(queued.ID); job.Status != models.ExportCancelled {
+		t.Errorf("cancelled queued job was run: %s", job.Status)
+	}
+	if _, err := jobs.Cancel(running.ID); !errors.Is(err, ErrExportFinished) {
+		t.Errorf("second cancel: got %v, want finished", err)
+	}
+}
+
+func TestExportJobExpiry(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	jobs := newTestExportJobs(t, t.TempDir(), 10, ttl)
+	startExportWorkers(t, jobs)
+
+	job := waitForJob(t, jobs, createTestExport(t, jobs).ID, finished)
+	_, path, err := jobs.File(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Expiry counts from when the export finished
+	if want := job.CompletedAt.Add(ttl); !job.ExpiresAt.Equal(want) {
+		t.Errorf("expires at %s, want %s", job.ExpiresAt, want)
+	}
+
+	if err := jobs.Cleanup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Get(job.ID); err != nil {
+		t.Errorf("export removed before it expired: %v", err)
+	}
+
+	time.Sleep(time.Until(job.ExpiresAt) + 10*time.Millisecond)
+	if err := jobs.Cleanup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Get(job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired export: got %v, want not found", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired export's file was kept: %v", err)
+	}
+}
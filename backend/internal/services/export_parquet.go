@@ -0,0 +1,643 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// parquetRowGroupRows is how many rows are buffered before a row group is
+// written, bounding memory for large exports.
+const parquetRowGroupRows = 50000
+
+// parquetMaxDictionary is the most distinct values a dictionary column
+// chunk may have before it falls back to plain encoding.
+const parquetMaxDictionary = 1 << 16
+
+// Parquet physical types, page types, encodings and codec
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetDataPage       = 0
+	parquetDictionaryPage = 2
+
+	parquetPlain         = 0
+	parquetRLE           = 3
+	parquetRLEDictionary = 8
+
+	parquetGzip = 2
+)
+
+// Logical types of Parquet columns
+const (
+	parquetNoLogical = iota
+	parquetString
+	parquetTimestamp
+	parquetDate
+)
+
+// parquetColumn is an optional, flat column. Values of the current row
+// group are buffered until it is written.
+type parquetColumn struct {
+	name       string
+	physical   int32
+	logical    int
+	utc        bool // timestamps are instants rather than wall clock times
+	dictionary bool
+
+	defs    []int32 // 1 for a value, 0 for null
+	strings []string
+	ints    []int64
+	doubles []float64
+
+	chunks []parquetChunk
+}
+
+type parquetChunk struct {
+	offset           int64
+	dataPageOffset   int64
+	dictionaryOffset int64 // 0 without a dictionary page
+	values           int
+	nulls            int
+	uncompressed     int64
+	compressed       int64
+	encodings        []int32
+	min, max         []byte
+}
+
+func (c *parquetColumn) appendNull() {
+	c.defs = append(c.defs, 0)
+}
+
+func (c *parquetColumn) appendString(v string) {
+	if v == "" {
+		c.appendNull()
+		return
+	}
+	c.defs = append(c.defs, 1)
+	c.strings = append(c.strings, v)
+}
+
+func (c *parquetColumn) appendInt(v int64) {
+	c.defs = append(c.defs, 1)
+	c.ints = append(c.ints, v)
+}
+
+func (c *parquetColumn) appendDouble(v float64) {
+	c.defs = append(c.defs, 1)
+	c.doubles = append(c.doubles, v)
+}
+
+func (c *parquetColumn) reset() {
+	c.defs, c.strings, c.ints, c.doubles = c.defs[:0], c.strings[:0], c.ints[:0], c.doubles[:0]
+}
+
+// parquetWriter streams a Parquet file: row groups are written as they fill
+// and the footer describing them on close. Pages are gzip compressed.
+type parquetWriter struct {
+	w       *bufio.Writer
+	offset  int64
+	columns []*parquetColumn
+	rows    int // rows buffered in the current row group
+	groups  []int
+	gz      *gzip.Writer
+	page    bytes.Buffer
+}
+
+func newParquetWriter(w io.Writer, columns []*parquetColumn) (*parquetWriter, error) {
+	pw := &parquetWriter{w: bufio.NewWriter(w), columns: columns}
+	pw.gz = gzip.NewWriter(&pw.page)
+	if err := pw.write([]byte("PAR1")); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *parquetWriter) write(data []byte) error {
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	return err
+}
+
+// endRow finishes a row once a value was appended to every column.
+func (pw *parquetWriter) endRow() error {
+	pw.rows++
+	if pw.rows < parquetRowGroupRows {
+		return nil
+	}
+	return pw.flushRowGroup()
+}
+
+func (pw *parquetWriter) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	for _, column := range pw.columns {
+		if err := pw.writeChunk(column); err != nil {
+			return err
+		}
+		column.reset()
+	}
+	pw.groups = append(pw.groups, pw.rows)
+	pw.rows = 0
+	return pw.w.Flush()
+}
+
+func (pw *parquetWriter) writeChunk(column *parquetColumn) error {
+	chunk := parquetChunk{offset: pw.offset, values: len(column.defs)}
+	for _, def := range column.defs {
+		if def == 0 {
+			chunk.nulls++
+		}
+	}
+	chunk.min, chunk.max = column.stats()
+
+	defs := binary.LittleEndian.AppendUint32(nil, 0)
+	defs = appendHybrid(defs, column.defs, 1)
+	binary.LittleEndian.PutUint32(defs, uint32(len(defs)-4))
+
+	dictionary, indices := column.dictionaryEncode()
+	if dictionary != nil {
+		var page []byte
+		for _, v := range dictionary {
+			page = appendPlainByteArray(page, v)
+		}
+		chunk.dictionaryOffset = pw.offset
+		if err := pw.writePage(&chunk, parquetDictionaryPage, len(dictionary), parquetPlain, page); err != nil {
+			return err
+		}
+
+		width := bitWidth(len(dictionary) - 1)
+		page = append(defs, byte(width))
+		page = appendHybrid(page, indices, width)
+		chunk.dataPageOffset = pw.offset
+		if err := pw.writePage(&chunk, parquetDataPage, len(column.defs), parquetRLEDictionary, page); err != nil {
+			return err
+		}
+		chunk.encodings = []int32{parquetPlain, parquetRLE, parquetRLEDictionary}
+	} else {
+		page := defs
+		switch column.physical {
+		case parquetByteArray:
+			for _, v := range column.strings {
+				page = appendPlainByteArray(page, v)
+			}
+		case parquetInt32:
+			for _, v := range column.ints {
+				page = appendPlainInt32(page, int32(v))
+			}
+		case parquetInt64:
+			for _, v := range column.ints {
+				page = appendPlainInt64(page, v)
+			}
+		case parquetDouble:
+			for _, v := range column.doubles {
+				page = appendPlainDouble(page, v)
+			}
+		}
+		chunk.dataPageOffset = pw.offset
+		if err := pw.writePage(&chunk, parquetDataPage, len(column.defs), parquetPlain, page); err != nil {
+			return err
+		}
+		chunk.encodings = []int32{parquetPlain, parquetRLE}
+	}
+
+	column.chunks = append(column.chunks, chunk)
+	return nil
+}
+
+func (pw *parquetWriter) writePage(chunk *parquetChunk, pageType int32, values int, encoding int32, data []byte) error {
+	pw.page.Reset()
+	pw.gz.Reset(&pw.page)
+	if _, err := pw.gz.Write(data); err != nil {
+		return err
+	}
+	if err := pw.gz.Close(); err != nil {
+		return err
+	}
+
+	var header thriftEncoder
+	header.beginStruct()
+	header.i32(1, pageType)
+	header.i32(2, int32(len(data)))
+	header.i32(3, int32(pw.page.Len()))
+	if pageType == parquetDictionaryPage {
+		header.structField(7)
+		header.i32(1, int32(values))
+		header.i32(2, encoding)
+		header.endStruct()
+	} else {
+		header.structField(5)
+		header.i32(1, int32(values))
+		header.i32(2, encoding)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+	}
+	header.endStruct()
+
+	chunk.uncompressed += int64(len(header.buf) + len(data))
+	chunk.compressed += int64(len(header.buf) + pw.page.Len())
+	if err := pw.write(header.buf); err != nil {
+		return err
+	}
+	return pw.write(pw.page.Bytes())
+}
+
+// dictionaryEncode returns the distinct values of a dictionary column in
+// order of first use and each value's index, or nil when the column is not
+// dictionary encoded or has too many distinct values.
+func (c *parquetColumn) dictionaryEncode() ([]string, []int32) {
+	if !c.dictionary || c.physical != parquetByteArray {
+		return nil, nil
+	}
+	positions := make(map[string]int32)
+	var dictionary []string
+	indices := make([]int32, len(c.strings))
+	for i, v := range c.strings {
+		index, ok := positions[v]
+		if !ok {
+			if len(dictionary) == parquetMaxDictionary {
+				return nil, nil
+			}
+			index = int32(len(dictionary))
+			positions[v] = index
+			dictionary = append(dictionary, v)
+		}
+		indices[i] = index
+	}
+	if len(dictionary) == 0 {
+		return nil, nil
+	}
+	return dictionary, indices
+}
+
+// stats returns the plain-encoded minimum and maximum of the row group's
+// values. Free text columns are skipped to keep the footer small.
+func (c *parquetColumn) stats() (minValue, maxValue []byte) {
+	switch c.physical {
+	case parquetByteArray:
+		if !c.dictionary || len(c.strings) == 0 {
+			return nil, nil
+		}
+		lo, hi := c.strings[0], c.strings[0]
+		for _, v := range c.strings {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		return []byte(lo), []byte(hi)
+	case parquetInt32, parquetInt64:
+		if len(c.ints) == 0 {
+			return nil, nil
+		}
+		lo, hi := c.ints[0], c.ints[0]
+		for _, v := range c.ints {
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if c.physical == parquetInt32 {
+			return appendPlainInt32(nil, int32(lo)), appendPlainInt32(nil, int32(hi))
+		}
+		return appendPlainInt64(nil, lo), appendPlainInt64(nil, hi)
+	case parquetDouble:
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, v := range c.doubles {
+			if !math.IsNaN(v) {
+				lo, hi = math.Min(lo, v), math.Max(hi, v)
+			}
+		}
+		if lo > hi {
+			return nil, nil
+		}
+		return appendPlainDouble(nil, lo), appendPlainDouble(nil, hi)
+	}
+	return nil, nil
+}
+
+// close writes the last row group and the footer.
+func (pw *parquetWriter) close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+
+	var meta thriftEncoder
+	meta.beginStruct()
+	meta.i32(1, 1)
+
+	meta.list(2, thriftStruct, len(pw.columns)+1)
+	meta.beginStruct()
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(pw.columns)))
+	meta.endStruct()
+	for _, column := range pw.columns {
+		column.writeSchema(&meta)
+	}
+
+	var rows int64
+	for _, n := range pw.groups {
+		rows += int64(n)
+	}
+	meta.i64(3, rows)
+
+	meta.list(4, thriftStruct, len(pw.groups))
+	for g, n := range pw.groups {
+		var size int64
+		for _, column := range pw.columns {
+			size += column.chunks[g].uncompressed
+		}
+		meta.beginStruct()
+		meta.list(1, thriftStruct, len(pw.columns))
+		for _, column := range pw.columns {
+			column.writeChunkMeta(&meta, column.chunks[g])
+		}
+		meta.i64(2, size)
+		meta.i64(3, int64(n))
+		meta.endStruct()
+	}
+
+	meta.string(6, "assembly-dashboard-backend")
+
+	// Min and max statistics use each type's natural order
+	meta.list(7, thriftStruct, len(pw.columns))
+	for range pw.columns {
+		meta.beginStruct()
+		meta.emptyStruct(1)
+		meta.endStruct()
+	}
+	meta.endStruct()
+
+	if err := pw.write(meta.buf); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.buf)))); err != nil {
+		return err
+	}
+	if err := pw.write([]byte("PAR1")); err != nil {
+		return err
+	}
+	return pw.w.Flush()
+}
+
+func (c *parquetColumn) writeSchema(e *thriftEncoder) {
+	e.beginStruct()
+	e.i32(1, c.physical)
+	e.i32(3, 1) // optional
+	e.string(4, c.name)
+	switch c.logical {
+	case parquetString:
+		e.i32(6, 0) // UTF8
+		e.structField(10)
+		e.emptyStruct(1)
+		e.endStruct()
+	case parquetDate:
+		e.i32(6, 6) // DATE
+		e.structField(10)
+		e.emptyStruct(6)
+		e.endStruct()
+	case parquetTimestamp:
+		if c.utc {
+			e.i32(6, 10) // TIMESTAMP_MICROS
+		}
+		e.structField(10)
+		e.structField(8)
+		e.bool(1, c.utc)
+		e.structField(2)
+		e.emptyStruct(2) // microseconds
+		e.endStruct()
+		e.endStruct()
+		e.endStruct()
+	}
+	e.endStruct()
+}
+
+func (c *parquetColumn) writeChunkMeta(e *thriftEncoder, chunk parquetChunk) {
+	e.beginStruct()
+	e.i64(2, chunk.offset)
+	e.structField(3)
+	e.i32(1, c.physical)
+	e.listI32(2, chunk.encodings)
+	e.listString(3, []string{c.name})
+	e.i32(4, parquetGzip)
+	e.i64(5, int64(chunk.values))
+	e.i64(6, chunk.uncompressed)
+	e.i64(7, chunk.compressed)
+	e.i64(9, chunk.dataPageOffset)
+	if chunk.dictionaryOffset > 0 {
+		e.i64(11, chunk.dictionaryOffset)
+	}
+	e.structField(12)
+	e.i64(3, int64(chunk.nulls))
+	if chunk.min != nil {
+		e.binary(5, chunk.max)
+		e.binary(6, chunk.min)
+	}
+	e.endStruct()
+	e.endStruct()
+	e.endStruct()
+}
+
+// parquetMicros is a timestamp in microseconds, as wall clock time in the
+// layout's time zone when one was requested.
+func (l *exportLayout) parquetMicros(t time.Time) int64 {
+	if l.location == nil {
+		return t.UnixMicro()
+	}
+	local := t.In(l.location)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC).UnixMicro()
+}
+
+// parquetDays is a DATE value: the days from 1970-01-01 to the calendar day
+// of t, negative for earlier days.
+func parquetDays(t time.Time) int64 {
+	seconds := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix()
+	days := seconds / 86400
+	if seconds%86400 < 0 {
+		days--
+	}
+	return days
+}
+
+func (l *exportLayout) parquetTimestampColumn(name string) *parquetColumn {
+	return &parquetColumn{name: name, physical: parquetInt64, logical: parquetTimestamp, utc: l.location == nil}
+}
+
+// parquetLayout is the layout of a Parquet event export. Without picked
+// columns the parsed value is added to the standard ones.
+func parquetLayout(request models.ExportRequest) *exportLayout {
+	layout := newExportLayout(request, true)
+	if !layout.custom {
+		column, _ := findExportColumn("value_number")
+		layout.columns = append(layout.columns, column)
+		layout.headers = append(layout.headers, column.header)
+	}
+	return layout
+}
+
+// parquetColumnNames are the schema names of a Parquet event export's
+// columns: each column's header label if the request gives one, otherwise
+// its key.
+func parquetColumnNames(layout *exportLayout, request models.ExportRequest) ([]string, error) {
+	names := make([]string, len(layout.columns))
+	seen := make(map[string]string)
+	for i, column := range layout.columns {
+		names[i] = column.key
+		if label, ok := request.Headers[column.key]; ok {
+			names[i] = label
+		}
+		if other, ok := seen[names[i]]; ok {
+			return nil, fmt.Errorf("%w: columns %q and %q would both be named %q", ErrInvalidFilter, other, column.key, names[i])
+		}
+		seen[names[i]] = column.key
+	}
+	return names, nil
+}
+
+// CheckParquetColumns rejects Parquet event exports whose header labels give
+// two columns the same name, which readers cannot tell apart. Other exports
+// always pass.
+func CheckParquetColumns(request models.ExportRequest) error {
+	if !strings.EqualFold(request.Format, "parquet") || (request.Kind != "" && request.Kind != ExportKindEvents) {
+		return nil
+	}
+	_, err := parquetColumnNames(parquetLayout(request), request)
+	return err
+}
+
+// writeParquet writes events with a typed schema: text columns as strings
+// (empty ones as nulls), timestamps as microsecond timestamps and numbers as
+// doubles.
+func (s *ExportService) writeParquet(ctx context.Context, w io.Writer, events []models.UsageEvent, request models.ExportRequest, annotations []models.Annotation, progress ExportProgress) error {
+	layout := parquetLayout(request)
+	names, err := parquetColumnNames(layout, request)
+	if err != nil {
+		return err
+	}
+
+	columns := make([]*parquetColumn, len(layout.columns))
+	for i, column := range layout.columns {
+		name := names[i]
+		switch column.kind {
+		case columnTime:
+			columns[i] = layout.parquetTimestampColumn(name)
+		case columnNumber:
+			columns[i] = &parquetColumn{name: name, physical: parquetDouble}
+		default:
+			columns[i] = &parquetColumn{name: name, physical: parquetByteArray, logical: parquetString, dictionary: column.dictionary}
+		}
+	}
+
+	writer, err := newParquetWriter(w, columns)
+	if err != nil {
+		return fmt.Errorf("failed to write Parquet: %w", err)
+	}
+
+	record := s.recordSource(events, layout, annotations)
+	for i := range events {
+		if i%exportCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			progress(i)
+		}
+
+		r := record(&events[i])
+		for j, column := range layout.columns {
+			switch column.kind {
+			case columnTime:
+				if t := column.time(r); t.IsZero() {
+					columns[j].appendNull()
+				} else {
+					columns[j].appendInt(layout.parquetMicros(t))
+				}
+			case columnNumber:
+				if n, ok := column.number(r); ok {
+					columns[j].appendDouble(n)
+				} else {
+					columns[j].appendNull()
+				}
+			default:
+				columns[j].appendString(column.text(r))
+			}
+		}
+		if err := writer.endRow(); err != nil {
+			return fmt.Errorf("failed to write Parquet: %w", err)
+		}
+	}
+
+	if err := writer.close(); err != nil {
+		return fmt.Errorf("failed to write Parquet: %w", err)
+	}
+	progress(len(events))
+	return nil
+}
+
+// writeTableParquet writes an aggregate export. Number columns holding only
+// whole numbers are written as 64-bit integers, others as doubles.
+func writeTableParquet(w io.Writer, table *ExportTable, layout *exportLayout) error {
+	columns := make([]*parquetColumn, len(table.columns))
+	for i, column := range table.columns {
+		switch column.kind {
+		case columnTime:
+			columns[i] = layout.parquetTimestampColumn(column.key)
+		case columnDate:
+			columns[i] = &parquetColumn{name: column.key, physical: parquetInt32, logical: parquetDate}
+		case columnNumber:
+			columns[i] = &parquetColumn{name: column.key, physical: parquetInt64}
+			for _, row := range table.Rows {
+				if _, ok := row[i].(float64); ok {
+					columns[i].physical = parquetDouble
+					break
+				}
+			}
+		default:
+			columns[i] = &parquetColumn{name: column.key, physical: parquetByteArray, logical: parquetString}
+		}
+	}
+
+	writer, err := newParquetWriter(w, columns)
+	if err != nil {
+		return fmt.Errorf("failed to write Parquet: %w", err)
+	}
+	for _, row := range table.Rows {
+		for i, value := range row {
+			column := columns[i]
+			switch v := value.(type) {
+			case nil:
+				column.appendNull()
+			case string:
+				column.appendString(v)
+			case int:
+				if column.physical == parquetDouble {
+					column.appendDouble(float64(v))
+				} else {
+					column.appendInt(int64(v))
+				}
+			case float64:
+				column.appendDouble(v)
+			case time.Time:
+				if column.logical == parquetDate {
+					column.appendInt(parquetDays(v))
+				} else {
+					column.appendInt(layout.parquetMicros(v))
+				}
+			}
+		}
+		if err := writer.endRow(); err != nil {
+			return fmt.Errorf("failed to write Parquet: %w", err)
+		}
+	}
+
+	if err := writer.close(); err != nil {
+		return fmt.Errorf("failed to write Parquet: %w", err)
+	}
+	return nil
+}
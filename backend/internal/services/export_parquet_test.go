@@ -0,0 +1,605 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// parquetFile is a Parquet file decoded by the test reader below, which
+// follows the format specification rather than the writer's code and is
+// checked against a file Apache Arrow wrote.
+type parquetFile struct {
+	meta    decodedStruct
+	schema  []decodedStruct // leaf columns
+	columns map[string][]interface{}
+	widths  map[string][]int // bit widths of dictionary indices, per page
+}
+
+// readParquetFile checks the file layout and footer, then decodes every
+// page of every column chunk. Values are strings, int64s or float64s, nil
+// for nulls.
+func readParquetFile(t *testing.T, data []byte) *parquetFile {
+	t.Helper()
+
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("missing PAR1 magic")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLength
+	if footerStart < 4 {
+		t.Fatalf("footer length %d does not fit a %d byte file", footerLength, len(data))
+	}
+	decoder := thriftDecoder{data: data[footerStart : len(data)-8]}
+	meta, err := decoder.readStruct()
+	if err != nil {
+		t.Fatalf("footer: %v", err)
+	}
+	if decoder.pos != footerLength {
+		t.Fatalf("footer: decoded %d of %d bytes", decoder.pos, footerLength)
+	}
+
+	file := &parquetFile{meta: meta, columns: make(map[string][]interface{}), widths: make(map[string][]int)}
+	schema := meta.list(2)
+	if len(schema) == 0 || schema[0].(decodedStruct).int(5) != int64(len(schema)-1) {
+		t.Fatalf("schema root does not list its %d columns", len(schema)-1)
+	}
+	for _, element := range schema[1:] {
+		file.schema = append(file.schema, element.(decodedStruct))
+	}
+
+	var rows int64
+	for g, group := range meta.list(4) {
+		group := group.(decodedStruct)
+		chunks := group.list(1)
+		if len(chunks) != len(file.schema) {
+			t.Fatalf("row group %d has %d column chunks for %d columns", g, len(chunks), len(file.schema))
+		}
+		for c, chunk := range chunks {
+			column := file.schema[c]
+			values, widths := readParquetChunk(t, data[:footerStart], column, chunk.(decodedStruct))
+			if int64(len(values)) != group.int(3) {
+				t.Fatalf("row group %d, column %s: %d values for %d rows", g, column.str(4), len(values), group.int(3))
+			}
+			file.columns[column.str(4)] = append(file.columns[column.str(4)], values...)
+			file.widths[column.str(4)] = append(file.widths[column.str(4)], widths...)
+		}
+		rows += group.int(3)
+	}
+	if rows != meta.int(3) {
+		t.Fatalf("row groups hold %d rows, footer says %d", rows, meta.int(3))
+	}
+	return file
+}
+
+func readParquetChunk(t *testing.T, data []byte, column, chunk decodedStruct) ([]interface{}, []int) {
+	t.Helper()
+	name := column.str(4)
+	meta := chunk.sub(3)
+	if meta.int(1) != column.int(1) {
+		t.Fatalf("%s: chunk type %d, schema type %d", name, meta.int(1), column.int(1))
+	}
+	if path := meta.list(3); len(path) != 1 || string(path[0].([]byte)) != name {
+		t.Fatalf("%s: chunk path %q", name, path)
+	}
+	if meta.int(4) != parquetGzip {
+		t.Fatalf("%s: codec %d", name, meta.int(4))
+	}
+
+	start := meta.int(9)
+	if offset, ok := meta[11]; ok {
+		start = offset.(int64)
+		if start >= meta.int(9) {
+			t.Fatalf("%s: dictionary page at %d is not before the data page at %d", name, start, meta.int(9))
+		}
+	}
+
+	var dictionary, values []interface{}
+	var widths []int
+	var nulls int64
+	pos := int(start)
+	for int64(len(values)) < meta.int(5) {
+		decoder := thriftDecoder{data: data[pos:]}
+		header, err := decoder.readStruct()
+		if err != nil {
+			t.Fatalf("%s: page header at %d: %v", name, pos, err)
+		}
+		pos += decoder.pos
+
+		compressed := int(header.int(3))
+		reader, err := gzip.NewReader(bytes.NewReader(data[pos : pos+compressed]))
+		if err != nil {
+			t.Fatalf("%s: page at %d: %v", name, pos, err)
+		}
+		page, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%s: page at %d: %v", name, pos, err)
+		}
+		pos += compressed
+		if len(page) != int(header.int(2)) {
+			t.Fatalf("%s: page of %d bytes, header says %d", name, len(page), header.int(2))
+		}
+
+		switch header.int(1) {
+		case parquetDictionaryPage:
+			if dictionary != nil || len(values) > 0 {
+				t.Fatalf("%s: unexpected dictionary page", name)
+			}
+			dictionary = readPlainValues(t, name, page, column.int(1), int(header.sub(7).int(1)))
+
+		case parquetDataPage:
+			pageHeader := header.sub(5)
+			count := int(pageHeader.int(1))
+			if pageHeader.int(3) != parquetRLE {
+				t.Fatalf("%s: definition level encoding %d", name, pageHeader.int(3))
+			}
+			defLength := int(binary.LittleEndian.Uint32(page))
+			defs, n, err := decodeHybrid(page[4:4+defLength], 1, count)
+			if err != nil || n != defLength {
+				t.Fatalf("%s: definition levels: %v (%d of %d bytes)", name, err, n, defLength)
+			}
+			present := 0
+			for _, def := range defs {
+				present += int(def)
+			}
+
+			var decoded []interface{}
+			rest := page[4+defLength:]
+			switch pageHeader.int(2) {
+			case parquetPlain:
+				decoded = readPlainValues(t, name, rest, column.int(1), present)
+			case parquetRLEDictionary:
+				if dictionary == nil {
+					t.Fatalf("%s: dictionary encoded page without a dictionary", name)
+				}
+				indices, _, err := decodeHybrid(rest[1:], int(rest[0]), present)
+				if err != nil {
+					t.Fatalf("%s: dictionary indices: %v", name, err)
+				}
+				widths = append(widths, int(rest[0]))
+				for _, index := range indices {
+					decoded = append(decoded, dictionary[index])
+				}
+			default:
+				t.Fatalf("%s: encoding %d", name, pageHeader.int(2))
+			}
+
+			for _, def := range defs {
+				if def == 0 {
+					values = append(values, nil)
+					nulls++
+				} else {
+					values = append(values, decoded[0])
+					decoded = decoded[1:]
+				}
+			}
+
+		default:
+			t.Fatalf("%s: page type %d", name, header.int(1))
+		}
+	}
+
+	if compressed := int64(pos) - start; compressed != meta.int(7) {
+		t.Errorf("%s: pages take %d bytes, chunk says %d", name, compressed, meta.int(7))
+	}
+	if stats := meta.sub(12); stats.int(3) != nulls {
+		t.Errorf("%s: %d nulls, statistics say %d", name, nulls, stats.int(3))
+	}
+	return values, widths
+}
+
+func readPlainValues(t *testing.T, name string, data []byte, physical int64, count int) []interface{} {
+	t.Helper()
+	values := make([]interface{}, 0, count)
+	for i := 0; i < count; i++ {
+		switch physical {
+		case parquetByteArray:
+			n := int(binary.LittleEndian.Uint32(data))
+			values = append(values, string(data[4:4+n]))
+			data = data[4+n:]
+		case parquetInt32:
+			values = append(values, int64(int32(binary.LittleEndian.Uint32(data))))
+			data = data[4:]
+		case parquetInt64:
+			values = append(values, int64(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case parquetDouble:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		default:
+			t.Fatalf("%s: physical type %d", name, physical)
+		}
+	}
+	if len(data) != 0 {
+		t.Fatalf("%s: %d bytes left after %d values", name, len(data), count)
+	}
+	return values
+}
+
+// expectedParquetColumns is what the standard event columns should hold.
+func expectedParquetColumns(events []models.UsageEvent) map[string][]interface{} {
+	text := func(v string) interface{} {
+		if v == "" {
+			return nil
+		}
+		return v
+	}
+	micros := func(t time.Time) interface{} {
+		if t.IsZero() {
+			return nil
+		}
+		return t.UnixMicro()
+	}
+
+	columns := make(map[string][]interface{})
+	for i := range events {
+		event := &events[i]
+		row := map[string]interface{}{
+			"id":                 text(event.ID),
+			"created_at":         micros(event.CreatedAt),
+			"company_id":         text(event.CompanyID),
+			"company_name":       nil,
+			"type":               text(event.Type),
+			"content":            text(event.Content),
+			"attribute":          text(event.Attribute),
+			"updated_at":         micros(event.UpdatedAt),
+			"original_timestamp": micros(event.OriginalTimestamp),
+			"value":              text(event.Value),
+			"value_number":       nil,
+		}
+		if n, ok := parseNumericValue(event.Value); ok {
+			row["value_number"] = n
+		}
+		for key, value := range row {
+			columns[key] = append(columns[key], value)
+		}
+	}
+	return columns
+}
+
+func writeTestParquet(t *testing.T, events []models.UsageEvent) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	service := NewExportService(NewFilterService(), nil)
+	if err := service.WriteExport(context.Background(), &buf, events, models.ExportRequest{Format: "parquet"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func checkParquetEvents(t *testing.T, file *parquetFile, events []models.UsageEvent) {
+	t.Helper()
+	want := expectedParquetColumns(events)
+	if len(file.columns) != len(want) {
+		t.Errorf("file has columns %d, want %d", len(file.columns), len(want))
+	}
+	for name, values := range want {
+		got := file.columns[name]
+		if len(got) != len(values) {
+			t.Errorf("%s: %d values, want %d", name, len(got), len(values))
+			continue
+		}
+		for i := range values {
+			if !reflect.DeepEqual(got[i], values[i]) {
+				t.Errorf("%s row %d: got %#v, want %#v", name, i, got[i], values[i])
+				break
+			}
+		}
+	}
+}
+
+func TestParquetEventsRoundTrip(t *testing.T) {
+	// Enough events for three row groups, the last one partial
+	events := generateEvents(7, 2*parquetRowGroupRows+1234)
+	file := readParquetFile(t, writeTestParquet(t, events))
+
+	if groups := file.meta.list(4); len(groups) != 3 || groups[2].(decodedStruct).int(3) != 1234 {
+		t.Errorf("got %d row groups", len(groups))
+	}
+	checkParquetEvents(t, file, events)
+
+	// Physical and converted type of each column, -1 for no converted type
+	const utf8, timestampMicros, none = 0, 10, -1
+	want := map[string][2]int64{
+		"id": {parquetByteArray, utf8}, "created_at": {parquetInt64, timestampMicros},
+		"company_id": {parquetByteArray, utf8}, "company_name": {parquetByteArray, utf8},
+		"type": {parquetByteArray, utf8}, "content": {parquetByteArray, utf8},
+		"attribute": {parquetByteArray, utf8}, "updated_at": {parquetInt64, timestampMicros},
+		"original_timestamp": {parquetInt64, timestampMicros}, "value": {parquetByteArray, utf8},
+		"value_number": {parquetDouble, none},
+	}
+	for _, column := range file.schema {
+		name := column.str(4)
+		if column.int(3) != 1 {
+			t.Errorf("%s is not optional", name)
+		}
+		converted := int64(none)
+		if _, ok := column[6]; ok {
+			converted = column.int(6)
+		}
+		if got := [2]int64{column.int(1), converted}; got != want[name] {
+			t.Errorf("%s: physical and converted type %v, want %v", name, got, want[name])
+		}
+	}
+}
+
+func TestParquetStatistics(t *testing.T) {
+	events := generateEvents(3, 500)
+	data := writeTestParquet(t, events)
+	file := readParquetFile(t, data)
+
+	group := file.meta.list(4)[0].(decodedStruct)
+	for c, chunk := range group.list(1) {
+		column := file.schema[c]
+		stats := chunk.(decodedStruct).sub(3).sub(12)
+		maxValue, hasMax := stats[5].([]byte)
+		minValue, hasMin := stats[6].([]byte)
+		if !hasMax || !hasMin {
+			continue
+		}
+
+		var lo, hi interface{}
+		for _, v := range file.columns[column.str(4)] {
+			if v == nil {
+				continue
+			}
+			if lo == nil || less(v, lo) {
+				lo = v
+			}
+			if hi == nil || less(hi, v) {
+				hi = v
+			}
+		}
+		gotMin := readPlainStat(t, column, minValue)
+		gotMax := readPlainStat(t, column, maxValue)
+		if gotMin != lo || gotMax != hi {
+			t.Errorf("%s: statistics [%v, %v], values [%v, %v]", column.str(4), gotMin, gotMax, lo, hi)
+		}
+	}
+}
+
+func less(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		return a < b.(string)
+	case int64:
+		return a < b.(int64)
+	case float64:
+		return a < b.(float64)
+	}
+	return false
+}
+
+func readPlainStat(t *testing.T, column decodedStruct, value []byte) interface{} {
+	t.Helper()
+	if column.int(1) == parquetByteArray {
+		return string(value)
+	}
+	return readPlainValues(t, column.str(4), value, column.int(1), 1)[0]
+}
+
+func TestParquetTableDates(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("time zone database unavailable")
+	}
+
+	table := &ExportTable{Name: "Series"}
+	table.addColumn("date", "Date", columnDate)
+	table.addColumn("count", "Count", columnNumber)
+	dates := []struct {
+		date time.Time
+		days int64
+	}{
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(1970, 1, 2, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), -1},
+		{time.Date(1969, 12, 31, 18, 0, 0, 0, time.UTC), -1},
+		{time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), -25508},
+		{time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), 20209},
+		// The calendar day in the value's own zone, as in CSV exports
+		{time.Date(2025, 5, 1, 0, 0, 0, 0, tokyo), 20209},
+	}
+	for i, d := range dates {
+		table.Rows = append(table.Rows, []interface{}{d.date, i})
+	}
+	table.Rows = append(table.Rows, []interface{}{nil, nil})
+
+	var buf bytes.Buffer
+	if err := writeTableParquet(&buf, table, newExportLayout(models.ExportRequest{}, false)); err != nil {
+		t.Fatal(err)
+	}
+	file := readParquetFile(t, buf.Bytes())
+
+	if date := file.schema[0]; date.int(1) != parquetInt32 || date.int(6) != 6 {
+		t.Errorf("date column has physical type %d and converted type %d, want INT32 DATE", date.int(1), date.int(6))
+	}
+	for i, d := range dates {
+		if got := file.columns["date"][i]; got != d.days {
+			t.Errorf("%s: got day %v, want %d", d.date.Format(time.RFC3339), got, d.days)
+		}
+		if got := file.columns["count"][i]; got != int64(i) {
+			t.Errorf("row %d: count %v", i, got)
+		}
+	}
+	if last := len(dates); file.columns["date"][last] != nil || file.columns["count"][last] != nil {
+		t.Errorf("nulls read back as %v, %v", file.columns["date"][last], file.columns["count"][last])
+	}
+}
+
+// fixtureEvents are the rows of testdata/arrow_events.parquet. They cover
+// nulls, numbers with currency signs and separators, negative values,
+// non-ASCII text and dictionary columns with one value and several.
+func fixtureEvents() []models.UsageEvent {
+	base := time.Date(2025, 5, 1, 9, 30, 0, 0, time.UTC)
+	rows := []struct{ company, eventType, content, attribute, value string }{
+		{"0196217a-30d6-77e9-be9e-75b799fb4297", "Action", "User active CMMS - Sample Company wes.cherveny@sample.com /work-orders/12345", "UserActiveCMMS", "null"},
+		{"0196217a-30d6-77e9-be9e-75b799fb4297", "CumulativeMetric", "at risk - Bank Balance Degradation - Total Bank Balance Today", "Total Bank Balance Today", "$100,187.00"},
+		{"0196217a-30d6-77e9-be9e-75b799fb4297", "CumulativeMetric", "Max Trailing 60-Day Settled Card Spend", "Max Trailing 60-Day Settled Card Spend", "(250.5)"},
+		{"0196217a-30d6-77e9-be9e-75b799fb4297", "Action", "Usuário ativo – Zürich café ☕", "UserActiveCMMS", ""},
+		{"", "Action", "", "", "42"},
+	}
+
+	events := make([]models.UsageEvent, len(rows))
+	for i, row := range rows {
+		createdAt := base.Add(time.Duration(i) * 90 * time.Minute)
+		events[i] = models.UsageEvent{
+			ID:                fmt.Sprintf("evt-%02d", i),
+			CreatedAt:         createdAt,
+			CompanyID:         row.company,
+			Type:              row.eventType,
+			Content:           row.content,
+			Attribute:         row.attribute,
+			Value:             row.value,
+			UpdatedAt:         createdAt.Add(time.Minute),
+			OriginalTimestamp: createdAt,
+		}
+	}
+	events[4].OriginalTimestamp = time.Time{}
+	return events
+}
+
+// readArrowFixture reads testdata/arrow_events.parquet, which Apache Arrow
+// wrote from fixtureEvents; testdata/parquetgen regenerates it. Reading it
+// back shows the test reader decodes Parquet as a real implementation
+// writes it, not just as the export writer does.
+func readArrowFixture(t *testing.T) *parquetFile {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "arrow_events.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := readParquetFile(t, data)
+	checkParquetEvents(t, fixture, fixtureEvents())
+	return fixture
+}
+
+func TestParquetReaderReadsArrow(t *testing.T) {
+	fixture := readArrowFixture(t)
+	if !bytes.HasPrefix([]byte(fixture.meta.str(6)), []byte("parquet-go version")) {
+		t.Errorf("fixture was created by %q", fixture.meta.str(6))
+	}
+	// Arrow spends a bit on the indices of a single dictionary value
+	for name, want := range map[string][]int{"company_id": {1}, "type": {1}, "attribute": {2}} {
+		if got := fixture.widths[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Arrow wrote dictionary indices %d bits wide, decoded %v", name, want, got)
+		}
+	}
+}
+
+func TestParquetMatchesArrow(t *testing.T) {
+	fixture := readArrowFixture(t)
+	file := readParquetFile(t, writeTestParquet(t, fixtureEvents()))
+
+	// Same columns with the same types: physical type, repetition, name,
+	// converted type and logical type
+	if len(file.schema) != len(fixture.schema) {
+		t.Fatalf("%d columns, Arrow wrote %d", len(file.schema), len(fixture.schema))
+	}
+	for i, column := range file.schema {
+		want := fixture.schema[i]
+		for _, field := range []int16{1, 3, 4, 6, 10} {
+			if !reflect.DeepEqual(column[field], want[field]) {
+				t.Errorf("%s: schema field %d is %v, Arrow wrote %v", want.str(4), field, column[field], want[field])
+			}
+		}
+	}
+	if !reflect.DeepEqual(file.columns, fixture.columns) {
+		t.Errorf("values differ from Arrow's:\ngot  %v\nwant %v", file.columns, fixture.columns)
+	}
+
+	// The writer needs no bits at all for them, which the format allows
+	if got := file.widths["company_id"]; !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("company_id dictionary indices %v bits wide, want 0", got)
+	}
+}
+
+// TestParquetSingleDictionaryValue covers a dictionary column with one
+// distinct value over long runs and nulls. Arrow reads such files as well:
+// write one out and run go run . check FILE in testdata/parquetgen.
+func TestParquetSingleDictionaryValue(t *testing.T) {
+	events := generateEvents(5, 1000)
+	for i := range events {
+		events[i].Type = "Action"
+		if i%7 == 0 {
+			events[i].Type = ""
+		}
+	}
+
+	var buf bytes.Buffer
+	service := NewExportService(NewFilterService(), nil)
+	request := models.ExportRequest{Format: "parquet", Columns: []string{"id", "type"}}
+	if err := service.WriteExport(context.Background(), &buf, events, request, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	file := readParquetFile(t, buf.Bytes())
+
+	if got := file.widths["type"]; !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("type dictionary indices %v bits wide, want 0", got)
+	}
+	for i, got := range file.columns["type"] {
+		var want interface{} = "Action"
+		if i%7 == 0 {
+			want = nil
+		}
+		if got != want {
+			t.Fatalf("row %d: type %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestParquetDuplicateColumnNames(t *testing.T) {
+	var buf bytes.Buffer
+	service := NewExportService(NewFilterService(), nil)
+	events := fixtureEvents()
+
+	duplicates := []models.ExportRequest{
+		{Format: "parquet", Headers: map[string]string{"id": "value"}},
+		{Format: "parquet", Headers: map[string]string{"id": "Event", "type": "Event"}},
+		{Format: "parquet", Headers: map[string]string{"value_number": "value"}},
+		{Format: "parquet", Columns: []string{"id", "type"}, Headers: map[string]string{"type": "id"}},
+		{Format: "parquet", IncludeAnnotations: true, Headers: map[string]string{"annotations": "content"}},
+	}
+	for _, request := range duplicates {
+		if err := CheckParquetColumns(request); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("headers %v: got %v, want an invalid filter error", request.Headers, err)
+		}
+		buf.Reset()
+		if err := service.WriteExport(context.Background(), &buf, events, request, nil, nil); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("writing with headers %v: got %v, want an invalid filter error", request.Headers, err)
+		}
+	}
+
+	// Swapped names are distinct, and other formats key by label only
+	// where they must
+	allowed := []models.ExportRequest{
+		{Format: "parquet", Headers: map[string]string{"id": "value", "value": "id"}},
+		{Format: "parquet", Columns: []string{"id"}, Headers: map[string]string{"type": "id"}},
+		{Format: "csv", Headers: map[string]string{"id": "value"}},
+		{Format: "parquet", Kind: ExportKindCompanies},
+	}
+	for _, request := range allowed {
+		if err := CheckParquetColumns(request); err != nil {
+			t.Errorf("%s with headers %v: %v", request.Format, request.Headers, err)
+		}
+	}
+	buf.Reset()
+	if err := service.WriteExport(context.Background(), &buf, events, allowed[0], nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	file := readParquetFile(t, buf.Bytes())
+	if file.schema[0].str(4) != "value" || file.columns["value"][0] != "evt-00" || file.columns["id"][0] != "null" {
+		t.Errorf("swapped names read back as %v and %v", file.columns["value"][0], file.columns["id"][0])
+	}
+}
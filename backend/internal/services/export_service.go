@@ -2,86 +2,308 @@ package services
 
 import (
 	"assembly-dashboard-backend/internal/models"
-	"encoding/csv"
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 )
 
+// exportCheckInterval is how many rows are written between progress reports
+// and cancellation checks. Buffered output is flushed to the underlying
+// writer before each report, so streamed responses arrive in chunks.
+const exportCheckInterval = 1000
+
+// ExportProgress is called while an export is written with the number of
+// rows written so far.
+type ExportProgress func(rows int)
+
 type ExportService struct {
 	filterService *FilterService
+	directory     *CompanyDirectory
 }
 
-func NewExportService(filterService *FilterService) *ExportService {
+func NewExportService(filterService *FilterService, directory *CompanyDirectory) *ExportService {
 	return &ExportService{
 		filterService: filterService,
+		directory:     directory,
 	}
 }
 
-func (s *ExportService) ExportData(events []models.UsageEvent, request models.ExportRequest) ([]byte, string, error) {
-	// Apply filters
-	filtered := s.filterService.ApplyFilters(events, request.Filters)
+// FilterEvents applies the request's filters, ignoring pagination.
+func (s *ExportService) FilterEvents(events []models.UsageEvent, request models.ExportRequest) ([]models.UsageEvent, error) {
+	filters := request.Filters
+	filters.Limit, filters.Offset, filters.Cursor = 0, 0, ""
+
+	filtered, err := s.filterService.ApplyFilters(events, filters)
+	if err != nil {
+		return nil, err
+	}
+	return filtered.Events, nil
+}
+
+// WriteExport streams already filtered events to w in the requested format.
+// annotations is only used when the request asks for them. progress may be
+// nil; ctx is checked between batches of rows so long exports can be
+// cancelled.
+func (s *ExportService) WriteExport(ctx context.Context, w io.Writer, events []models.UsageEvent, request models.ExportRequest, annotations []models.Annotation, progress ExportProgress) error {
+	if progress == nil {
+		progress = func(int) {}
+	}
 
 	switch strings.ToLower(request.Format) {
 	case "csv":
-		return s.exportCSV(filtered.Events)
+		return s.writeCSV(ctx, w, events, request, annotations, progress)
 	case "json":
-		return s.exportJSON(filtered.Events)
+		return s.writeJSON(ctx, w, events, request, annotations, progress)
+	case "ndjson":
+		return s.writeNDJSON(ctx, w, events, request, annotations, progress)
+	case "xlsx":
+		return s.writeXLSX(ctx, w, events, request, annotations, progress)
+	case "parquet":
+		return s.writeParquet(ctx, w, events, request, annotations, progress)
 	default:
-		return nil, "", fmt.Errorf("unsupported export format: %s", request.Format)
+		return fmt.Errorf("unsupported export format: %s", request.Format)
 	}
 }
 
-func (s *ExportService) exportCSV(events []models.UsageEvent) ([]byte, string, error) {
-	var output strings.Builder
-	writer := csv.NewWriter(&output)
+func (s *ExportService) ContentType(format string) string {
+	switch strings.ToLower(format) {
+	case "csv":
+		return "text/csv"
+	case "json":
+		return "application/json"
+	case "ndjson":
+		return "application/x-ndjson"
+	case "xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case "parquet":
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
 
-	// Write header
-	header := []string{
-		"ID", "Created At", "Company ID", "Type", "Content",
-		"Attribute", "Updated At", "Original Timestamp", "Value",
+// recordSource joins company names, and annotations when the layout needs
+// them, onto events.
+func (s *ExportService) recordSource(events []models.UsageEvent, layout *exportLayout, annotations []models.Annotation) func(event *models.UsageEvent) *exportRecord {
+	companies := s.directory.LookupEvents(events)
+	return func(event *models.UsageEvent) *exportRecord {
+		record := &exportRecord{event: event, companyName: companies[event.CompanyID].Name}
+		if layout.annotations {
+			for _, annotation := range annotationsCovering(annotations, event.CompanyID, event.CreatedAt) {
+				record.annotations = append(record.annotations, annotation.Text)
+			}
+		}
+		return record
 	}
-	if err := writer.Write(header); err != nil {
-		return nil, "", fmt.Errorf("failed to write CSV header: %w", err)
+}
+
+func (s *ExportService) writeCSV(ctx context.Context, w io.Writer, events []models.UsageEvent, request models.ExportRequest, annotations []models.Annotation, progress ExportProgress) error {
+	layout := newExportLayout(request, true)
+	writer := newDelimitedWriter(w, layout)
+
+	if layout.includeHeader {
+		if err := writer.Write(layout.headers); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
 	}
 
 	// Write data rows
-	for _, event := range events {
-		row := []string{
-			event.ID,
-			event.CreatedAt.Format(time.RFC3339),
-			event.CompanyID,
-			event.Type,
-			event.Content,
-			event.Attribute,
-			event.UpdatedAt.Format(time.RFC3339),
-			event.OriginalTimestamp.Format(time.RFC3339),
-			event.Value,
+	record := s.recordSource(events, layout, annotations)
+	row := make([]string, len(layout.columns))
+	for i := range events {
+		if i%exportCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := writer.Flush(); err != nil {
+				return fmt.Errorf("failed to write CSV: %w", err)
+			}
+			progress(i)
+		}
+
+		r := record(&events[i])
+		for j, column := range layout.columns {
+			row[j] = layout.text(column, r)
 		}
 		if err := writer.Write(row); err != nil {
-			return nil, "", fmt.Errorf("failed to write CSV row: %w", err)
+			return fmt.Errorf("failed to write CSV row: %w", err)
 		}
 	}
 
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return nil, "", fmt.Errorf("failed to flush CSV writer: %w", err)
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush CSV writer: %w", err)
 	}
+	progress(len(events))
 
-	return []byte(output.String()), "text/csv", nil
+	return nil
 }
 
-func (s *ExportService) exportJSON(events []models.UsageEvent) ([]byte, string, error) {
-	data, err := json.MarshalIndent(events, "", "  ")
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to marshal JSON: %w", err)
+// exportObject is a row of picked columns, marshalled with its keys in
+// column order.
+type exportObject struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o exportObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// jsonRows returns a function producing the JSON value for each event: the
+// event itself, or an object of the picked columns keyed by their custom
+// header (or column name) when the request chose columns.
+func (s *ExportService) jsonRows(events []models.UsageEvent, request models.ExportRequest, annotations []models.Annotation, withAnnotations bool) func(event *models.UsageEvent) interface{} {
+	layout := newExportLayout(request, withAnnotations)
+	if !layout.custom {
+		if withAnnotations && request.IncludeAnnotations {
+			record := s.recordSource(events, layout, annotations)
+			return func(event *models.UsageEvent) interface{} {
+				return ndjsonEvent{UsageEvent: *event, Annotations: record(event).annotations}
+			}
+		}
+		return func(event *models.UsageEvent) interface{} { return event }
+	}
+
+	keys := make([]string, len(layout.columns))
+	for i, column := range layout.columns {
+		keys[i] = column.key
+		if label, ok := request.Headers[column.key]; ok {
+			keys[i] = label
+		}
+	}
+
+	record := s.recordSource(events, layout, annotations)
+	return func(event *models.UsageEvent) interface{} {
+		r := record(event)
+		object := exportObject{keys: keys, values: make([]interface{}, len(layout.columns))}
+		for i, column := range layout.columns {
+			object.values[i] = layout.value(column, r)
+		}
+		return object
+	}
+}
+
+// writeJSON writes an indented array one event at a time rather than
+// marshalling the whole export at once.
+func (s *ExportService) writeJSON(ctx context.Context, w io.Writer, events []models.UsageEvent, request models.ExportRequest, annotations []models.Annotation, progress ExportProgress) error {
+	buffered := bufio.NewWriter(w)
+	row := s.jsonRows(events, request, annotations, false)
+
+	indent := "  "
+	if request.IncludeAnnotations {
+		indent = "    "
+		buffered.WriteString("{\n  \"events\": ")
+	}
+
+	buffered.WriteString("[")
+	for i := range events {
+		if i%exportCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := buffered.Flush(); err != nil {
+				return fmt.Errorf("failed to write JSON: %w", err)
+			}
+			progress(i)
+		}
+
+		data, err := json.MarshalIndent(row(&events[i]), indent, "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		if i > 0 {
+			buffered.WriteString(",")
+		}
+		buffered.WriteString("\n" + indent)
+		buffered.Write(data)
+	}
+	if len(events) > 0 {
+		buffered.WriteString("\n" + indent[2:])
+	}
+	buffered.WriteString("]")
+
+	if request.IncludeAnnotations {
+		if annotations == nil {
+			annotations = []models.Annotation{}
+		}
+		data, err := json.MarshalIndent(annotations, "  ", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		buffered.WriteString(",\n  \"annotations\": ")
+		buffered.Write(data)
+		buffered.WriteString("\n}")
 	}
 
-	return data, "application/json", nil
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	progress(len(events))
+
+	return nil
+}
+
+// ndjsonEvent is one line of an NDJSON export; annotations covering the
+// event are inlined when requested.
+type ndjsonEvent struct {
+	models.UsageEvent
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// writeNDJSON writes one compact JSON object per line.
+func (s *ExportService) writeNDJSON(ctx context.Context, w io.Writer, events []models.UsageEvent, request models.ExportRequest, annotations []models.Annotation, progress ExportProgress) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	row := s.jsonRows(events, request, annotations, true)
+
+	for i := range events {
+		if i%exportCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := buffered.Flush(); err != nil {
+				return fmt.Errorf("failed to write NDJSON: %w", err)
+			}
+			progress(i)
+		}
+
+		if err := encoder.Encode(row(&events[i])); err != nil {
+			return fmt.Errorf("failed to write NDJSON: %w", err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write NDJSON: %w", err)
+	}
+	progress(len(events))
+
+	return nil
 }
 
-func (s *ExportService) GetFilename(format string, filters models.FilterParams) string {
+func (s *ExportService) GetFilename(kind, format string, filters models.FilterParams) string {
 	timestamp := time.Now().Format("20060102_150405")
 
 	var filterSuffix string
@@ -92,5 +314,10 @@ func (s *ExportService) GetFilename(format string, filters models.FilterParams)
 		filterSuffix += "_filtered"
 	}
 
-	return fmt.Sprintf("assembly_analytics_%s%s.%s", timestamp, filterSuffix, format)
+	var kindSuffix string
+	if kind != "" && kind != ExportKindEvents {
+		kindSuffix = "_" + kind
+	}
+
+	return fmt.Sprintf("assembly_analytics%s_%s%s.%s", kindSuffix, timestamp, filterSuffix, format)
 }
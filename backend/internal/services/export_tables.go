@@ -0,0 +1,478 @@
+package services
+
+import (
+	"archive/zip"
+	"assembly-dashboard-backend/internal/models"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportKindEvents     = "events"
+	ExportKindCompanies  = "companies"
+	ExportKindTimeseries = "timeseries"
+	ExportKindTrends     = "trends"
+	ExportKindCohorts    = "cohorts"
+)
+
+func ExportKinds() []string {
+	return []string{ExportKindEvents, ExportKindCompanies, ExportKindTimeseries, ExportKindTrends, ExportKindCohorts}
+}
+
+func IsExportKind(kind string) bool {
+	for _, k := range ExportKinds() {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// columnDate values are days, written as YYYY-MM-DD (or date cells in XLSX)
+// whatever the timestamp format.
+const columnDate = columnNumber + 1
+
+type tableColumn struct {
+	key    string
+	header string
+	kind   int
+}
+
+// ExportTable is an aggregate export: a header and rows of string, int,
+// float64 or time.Time values (nil for missing ones).
+type ExportTable struct {
+	Name    string
+	columns []tableColumn
+	Rows    [][]interface{}
+}
+
+func (t *ExportTable) addColumn(key, header string, kind int) {
+	t.columns = append(t.columns, tableColumn{key: key, header: header, kind: kind})
+}
+
+// buildExportTable computes the aggregate for a non-event export kind over
+// the filtered events, using the same computations as the dashboard.
+func (s *AnalyticsService) buildExportTable(kind string, events []models.UsageEvent) *ExportTable {
+	switch kind {
+	case ExportKindCompanies:
+		return s.companiesTable(events)
+	case ExportKindTimeseries:
+		return s.timeseriesTable(events)
+	case ExportKindTrends:
+		return s.trendsTable(events)
+	case ExportKindCohorts:
+		return cohortsTable(computeCohorts(events))
+	}
+	return nil
+}
+
+func (s *AnalyticsService) companiesTable(events []models.UsageEvent) *ExportTable {
+	companies := s.getTopCompanies(events, len(events))
+	sort.SliceStable(companies, func(i, j int) bool {
+		if companies[i].EventCount != companies[j].EventCount {
+			return companies[i].EventCount > companies[j].EventCount
+		}
+		return companies[i].CompanyID < companies[j].CompanyID
+	})
+	eventTypes := make([]string, 0)
+	for eventType := range s.getEventTypeBreakdown(events) {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	table := &ExportTable{Name: "Companies"}
+	table.addColumn("company_id", "Company ID", columnText)
+	table.addColumn("company_name", "Company Name", columnText)
+	table.addColumn("plan", "Plan", columnText)
+	table.addColumn("csm_owner", "CSM Owner", columnText)
+	table.addColumn("region", "Region", columnText)
+	table.addColumn("arr", "ARR", columnNumber)
+	table.addColumn("event_count", "Events", columnNumber)
+	table.addColumn("last_activity", "Last Activity", columnTime)
+	for _, eventType := range eventTypes {
+		table.addColumn(eventType, eventType, columnNumber)
+	}
+
+	for _, company := range companies {
+		entry := s.directory.Get(company.CompanyID)
+		var arr interface{}
+		if entry.ARR != nil {
+			arr = *entry.ARR
+		}
+		var lastActivity interface{}
+		if t, err := time.Parse(time.RFC3339, company.LastActivity); err == nil {
+			lastActivity = t
+		}
+
+		row := []interface{}{
+			company.CompanyID, entry.Name, entry.Plan, entry.CSMOwner, entry.Region,
+			arr, company.EventCount, lastActivity,
+		}
+		for _, eventType := range eventTypes {
+			row = append(row, company.EventTypes[eventType])
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+func (s *AnalyticsService) timeseriesTable(events []models.UsageEvent) *ExportTable {
+	table := &ExportTable{Name: "Daily"}
+	table.addColumn("date", "Date", columnDate)
+	table.addColumn("count", "Events", columnNumber)
+
+	for _, point := range s.getTimeSeriesData(events) {
+		table.Rows = append(table.Rows, []interface{}{exportDay(point.Date), point.Count})
+	}
+	return table
+}
+
+// trendsTable pivots the per-type daily trends into one row per day and
+// one column per event type.
+func (s *AnalyticsService) trendsTable(events []models.UsageEvent) *ExportTable {
+	trends := s.getDailyTrends(events)
+	eventTypes := make([]string, 0, len(trends))
+	for eventType := range trends {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	table := &ExportTable{Name: "Trends"}
+	table.addColumn("date", "Date", columnDate)
+	for _, eventType := range eventTypes {
+		table.addColumn(eventType, eventType, columnNumber)
+	}
+	table.addColumn("total", "Total", columnNumber)
+
+	counts := make(map[string]map[string]int)
+	for eventType, points := range trends {
+		for _, point := range points {
+			if counts[point.Date] == nil {
+				counts[point.Date] = make(map[string]int)
+			}
+			counts[point.Date][eventType] = point.Count
+		}
+	}
+	dates := make([]string, 0, len(counts))
+	for date := range counts {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	for _, date := range dates {
+		row := []interface{}{exportDay(date)}
+		total := 0
+		for _, eventType := range eventTypes {
+			row = append(row, counts[date][eventType])
+			total += counts[date][eventType]
+		}
+		table.Rows = append(table.Rows, append(row, total))
+	}
+	return table
+}
+
+// cohortsTable has one row per cohort and one column per week since the
+// cohort's first week, holding how many of its companies were active.
+func cohortsTable(cohorts []models.Cohort) *ExportTable {
+	weeks := 0
+	for _, cohort := range cohorts {
+		if len(cohort.Active) > weeks {
+			weeks = len(cohort.Active)
+		}
+	}
+
+	table := &ExportTable{Name: "Cohorts"}
+	table.addColumn("cohort", "Cohort (Week Of)", columnDate)
+	table.addColumn("companies", "Companies", columnNumber)
+	for week := 0; week < weeks; week++ {
+		table.addColumn("week_"+strconv.Itoa(week), "Week "+strconv.Itoa(week), columnNumber)
+	}
+
+	for _, cohort := range cohorts {
+		row := []interface{}{exportDay(cohort.Week), cohort.Companies}
+		for week := 0; week < weeks; week++ {
+			if week < len(cohort.Active) {
+				row = append(row, cohort.Active[week])
+			} else {
+				row = append(row, nil)
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// computeCohorts groups companies by the week (starting Monday) of their
+// first event and counts, for every following week up to the last event,
+// how many of them had any activity.
+func computeCohorts(events []models.UsageEvent) []models.Cohort {
+	weekOf := func(t time.Time) time.Time {
+		day := t.UTC().Truncate(24 * time.Hour)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+
+	first := make(map[string]time.Time)
+	active := make(map[string]map[time.Time]bool)
+	var lastWeek time.Time
+	for i := range events {
+		event := &events[i]
+		if event.CompanyID == "" {
+			continue
+		}
+		week := weekOf(event.CreatedAt)
+		if f, ok := first[event.CompanyID]; !ok || week.Before(f) {
+			first[event.CompanyID] = week
+		}
+		if active[event.CompanyID] == nil {
+			active[event.CompanyID] = make(map[time.Time]bool)
+		}
+		active[event.CompanyID][week] = true
+		if week.After(lastWeek) {
+			lastWeek = week
+		}
+	}
+
+	byWeek := make(map[time.Time]*models.Cohort)
+	for companyID, week := range first {
+		cohort := byWeek[week]
+		if cohort == nil {
+			weeks := int(lastWeek.Sub(week)/(7*24*time.Hour)) + 1
+			cohort = &models.Cohort{Week: week.Format("2006-01-02"), Active: make([]int, weeks)}
+			byWeek[week] = cohort
+		}
+		cohort.Companies++
+		for offset := range cohort.Active {
+			if active[companyID][week.AddDate(0, 0, 7*offset)] {
+				cohort.Active[offset]++
+			}
+		}
+	}
+
+	cohorts := make([]models.Cohort, 0, len(byWeek))
+	for _, cohort := range byWeek {
+		cohorts = append(cohorts, *cohort)
+	}
+	sort.Slice(cohorts, func(i, j int) bool {
+		return cohorts[i].Week < cohorts[j].Week
+	})
+	return cohorts
+}
+
+// exportDay parses a YYYY-MM-DD date for a columnDate value.
+func exportDay(date string) interface{} {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t
+}
+
+// WriteTable writes an aggregate export in the requested format. The
+// formatting options of event exports (timestamps, delimiter, quoting and
+// the header row) apply here too.
+func (s *ExportService) WriteTable(ctx context.Context, w io.Writer, table *ExportTable, request models.ExportRequest, progress ExportProgress) error {
+	if progress == nil {
+		progress = func(int) {}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	layout := newExportLayout(request, false)
+	var err error
+	switch strings.ToLower(request.Format) {
+	case "csv":
+		err = writeTableCSV(w, table, layout)
+	case "json", "ndjson":
+		err = writeTableJSON(w, table, layout, strings.ToLower(request.Format) == "ndjson")
+	case "xlsx":
+		err = writeTableXLSX(w, table, layout)
+	case "parquet":
+		err = writeTableParquet(w, table, layout)
+	default:
+		err = fmt.Errorf("unsupported export format: %s", request.Format)
+	}
+	if err != nil {
+		return err
+	}
+
+	progress(len(table.Rows))
+	return nil
+}
+
+func (l *exportLayout) tableText(column tableColumn, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if column.kind == columnDate {
+			return v.Format("2006-01-02")
+		}
+		return l.text(exportColumn{kind: columnTime, time: func(*exportRecord) time.Time { return v }}, nil)
+	}
+	return fmt.Sprint(value)
+}
+
+func (l *exportLayout) tableValue(column tableColumn, value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		if column.kind == columnDate {
+			return t.Format("2006-01-02")
+		}
+		return l.value(exportColumn{kind: columnTime, time: func(*exportRecord) time.Time { return t }}, nil)
+	}
+	return value
+}
+
+func (l *exportLayout) tableCell(column tableColumn, value interface{}) xlsxCell {
+	switch v := value.(type) {
+	case nil:
+		return xlsxCell{}
+	case int:
+		return xlsxNumber(float64(v))
+	case float64:
+		return xlsxNumber(v)
+	case time.Time:
+		if column.kind == columnDate {
+			return xlsxTime(v, xlsxStyleDate)
+		}
+		return l.xlsxCell(exportColumn{kind: columnTime, time: func(*exportRecord) time.Time { return v }}, nil)
+	}
+	return xlsxString(l.tableText(column, value))
+}
+
+func writeTableCSV(w io.Writer, table *ExportTable, layout *exportLayout) error {
+	writer := newDelimitedWriter(w, layout)
+
+	if layout.includeHeader {
+		header := make([]string, len(table.columns))
+		for i, column := range table.columns {
+			header[i] = column.header
+		}
+		if err := writer.Write(header); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
+
+	fields := make([]string, len(table.columns))
+	for _, row := range table.Rows {
+		for i, column := range table.columns {
+			fields[i] = layout.tableText(column, row[i])
+		}
+		if err := writer.Write(fields); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush CSV writer: %w", err)
+	}
+	return nil
+}
+
+// writeTableJSON writes rows as objects keyed by column, either as an
+// indented array or one object per line.
+func writeTableJSON(w io.Writer, table *ExportTable, layout *exportLayout, lines bool) error {
+	buffered := bufio.NewWriter(w)
+
+	keys := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		keys[i] = column.key
+	}
+
+	if !lines {
+		buffered.WriteString("[")
+	}
+	for r, row := range table.Rows {
+		object := exportObject{keys: keys, values: make([]interface{}, len(row))}
+		for i, column := range table.columns {
+			object.values[i] = layout.tableValue(column, row[i])
+		}
+
+		var data []byte
+		var err error
+		if lines {
+			data, err = json.Marshal(object)
+		} else {
+			data, err = json.MarshalIndent(object, "  ", "  ")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+
+		switch {
+		case lines:
+			buffered.Write(data)
+			buffered.WriteString("\n")
+		case r > 0:
+			buffered.WriteString(",\n  ")
+			buffered.Write(data)
+		default:
+			buffered.WriteString("\n  ")
+			buffered.Write(data)
+		}
+	}
+	if !lines {
+		if len(table.Rows) > 0 {
+			buffered.WriteString("\n")
+		}
+		buffered.WriteString("]")
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	return nil
+}
+
+func writeTableXLSX(w io.Writer, table *ExportTable, layout *exportLayout) error {
+	zw := zip.NewWriter(w)
+
+	header := make([]string, len(table.columns))
+	widths := make([]float64, len(table.columns))
+	for i, column := range table.columns {
+		header[i] = column.header
+		widths[i] = float64(len(column.header) + 4)
+		if widths[i] < 12 {
+			widths[i] = 12
+		}
+		if column.key == "company_id" {
+			widths[i] = 38
+		}
+	}
+
+	sheet, err := newXLSXSheet(zw, 1, table.Name, header, widths)
+	if err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	cells := make([]xlsxCell, len(table.columns))
+	for _, row := range table.Rows {
+		for i, column := range table.columns {
+			cells[i] = layout.tableCell(column, row[i])
+		}
+		sheet.writeRow(cells)
+	}
+	if err := sheet.close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+
+	if err := writeXLSXWorkbook(zw, []*xlsxSheet{sheet}); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	return nil
+}
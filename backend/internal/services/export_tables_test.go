@@ -0,0 +1,135 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTableTestAnalytics serves five events over two weeks: c1 is active in
+// both, starting Monday 2025-05-05, and c2 only in the second.
+func newTableTestAnalytics(t *testing.T) *AnalyticsService {
+	t.Helper()
+	directory, err := NewCompanyDirectory(filepath.Join(t.TempDir(), "company_metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr := 120000.0
+	if _, err := directory.Import([]models.CompanyMetadata{{CompanyID: "c1", Name: "Acme Corp", Plan: "Enterprise", CSMOwner: "Jane Doe", Region: "EU", ARR: &arr}}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(day, hour int) time.Time { return time.Date(2025, 5, day, hour, 0, 0, 0, time.UTC) }
+	analytics := NewAnalyticsService(directory, nil)
+	analytics.events = []models.UsageEvent{
+		{ID: "a1", CompanyID: "c1", Type: "Action", CreatedAt: at(5, 9)},
+		{ID: "a2", CompanyID: "c1", Type: "CumulativeMetric", CreatedAt: at(5, 10)},
+		{ID: "a3", CompanyID: "c1", Type: "Action", CreatedAt: at(13, 8)},
+		{ID: "b1", CompanyID: "c2", Type: "Action", CreatedAt: at(13, 12)},
+		{ID: "x1", Type: "Action", CreatedAt: at(13, 13)},
+	}
+	analytics.filterService.SetDataset(analytics.events, "test", nil)
+	return analytics
+}
+
+func writeTableExport(t *testing.T, analytics *AnalyticsService, request models.ExportRequest) string {
+	t.Helper()
+	export, err := analytics.PrepareExport(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.Table == nil || export.Events != nil {
+		t.Fatalf("%s export was not prepared as a table", request.Kind)
+	}
+	var buf bytes.Buffer
+	if err := analytics.WriteExport(context.Background(), &buf, export, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestExportTablesAsCSV(t *testing.T) {
+	analytics := newTableTestAnalytics(t)
+
+	tests := []struct {
+		name    string
+		request models.ExportRequest
+		want    string
+	}{
+		{
+			// Busiest first, with a column per event type; events without a
+			// company are not a company
+			name:    "companies",
+			request: models.ExportRequest{Kind: ExportKindCompanies, Format: "csv"},
+			want: "Company ID,Company Name,Plan,CSM Owner,Region,ARR,Events,Last Activity,Action,CumulativeMetric\n" +
+				"c1,Acme Corp,Enterprise,Jane Doe,EU,120000,3,2025-05-13T08:00:00Z,2,1\n" +
+				"c2,,,,,,1,2025-05-13T12:00:00Z,1,0\n",
+		},
+		{
+			name:    "time series of the filtered events",
+			request: models.ExportRequest{Kind: ExportKindTimeseries, Format: "csv", Filters: models.FilterParams{EventTypes: []string{"Action"}}},
+			want:    "Date,Events\n2025-05-05,1\n2025-05-13,3\n",
+		},
+		{
+			// Days without a type's events count zero; dates ignore the
+			// timestamp format
+			name:    "trends",
+			request: models.ExportRequest{Kind: ExportKindTrends, Format: "csv", TimestampFormat: "unix", Delimiter: "\t"},
+			want:    "Date\tAction\tCumulativeMetric\tTotal\n2025-05-05\t1\t1\t2\n2025-05-13\t3\t0\t3\n",
+		},
+		{
+			// The later cohort has no second week yet
+			name:    "cohorts",
+			request: models.ExportRequest{Kind: ExportKindCohorts, Format: "csv"},
+			want:    "Cohort (Week Of),Companies,Week 0,Week 1\n2025-05-05,1,1,1\n2025-05-12,1,1,\n",
+		},
+	}
+	for _, test := range tests {
+		if got := writeTableExport(t, analytics, test.request); got != test.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExportTablesAsJSON(t *testing.T) {
+	analytics := newTableTestAnalytics(t)
+
+	// Rows are objects keyed by column in column order, missing values null
+	var got bytes.Buffer
+	if err := json.Compact(&got, []byte(writeTableExport(t, analytics, models.ExportRequest{Kind: ExportKindCohorts, Format: "json"}))); err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"cohort":"2025-05-05","companies":1,"week_0":1,"week_1":1},{"cohort":"2025-05-12","companies":1,"week_0":1,"week_1":null}]`
+	if got.String() != want {
+		t.Errorf("cohorts:\ngot  %s\nwant %s", got.String(), want)
+	}
+
+	// Times follow the timestamp format
+	lines := writeTableExport(t, analytics, models.ExportRequest{Kind: ExportKindCompanies, Format: "ndjson", TimestampFormat: "unix"})
+	wantLines := `{"company_id":"c1","company_name":"Acme Corp","plan":"Enterprise","csm_owner":"Jane Doe","region":"EU","arr":120000,"event_count":3,"last_activity":1747123200,"Action":2,"CumulativeMetric":1}` + "\n" +
+		`{"company_id":"c2","company_name":"","plan":"","csm_owner":"","region":"","arr":null,"event_count":1,"last_activity":1747137600,"Action":1,"CumulativeMetric":0}` + "\n"
+	if lines != wantLines {
+		t.Errorf("companies:\ngot\n%s\nwant\n%s", lines, wantLines)
+	}
+}
+
+func TestExportTablesAsXLSX(t *testing.T) {
+	analytics := newTableTestAnalytics(t)
+	parts := xlsxParts(t, []byte(writeTableExport(t, analytics, models.ExportRequest{Kind: ExportKindTrends, Format: "xlsx"})))
+
+	if want := `<sheets><sheet name="Trends" sheetId="1" r:id="rId1"/></sheets>`; !strings.Contains(parts["xl/workbook.xml"], want) {
+		t.Errorf("workbook sheets:\n%s", parts["xl/workbook.xml"])
+	}
+	// 2025-05-05 is serial 45782, in the date style
+	want := `<row r="1">` + inlineCell("A1", "1", "Date") + inlineCell("B1", "1", "Action") + inlineCell("C1", "1", "CumulativeMetric") + inlineCell("D1", "1", "Total") + `</row>` +
+		`<row r="2"><c r="A2" s="3"><v>45782</v></c><c r="B2"><v>1</v></c><c r="C2"><v>1</v></c><c r="D2"><v>2</v></c></row>` +
+		`<row r="3"><c r="A3" s="3"><v>45790</v></c><c r="B3"><v>3</v></c><c r="C3"><v>0</v></c><c r="D3"><v>3</v></c></row>`
+	if got := sheetRows(t, parts["xl/worksheets/sheet1.xml"]); got != want {
+		t.Errorf("trends rows:\ngot  %s\nwant %s", got, want)
+	}
+}
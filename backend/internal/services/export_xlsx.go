@@ -0,0 +1,395 @@
+package services
+
+import (
+	"archive/zip"
+	"assembly-dashboard-backend/internal/models"
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The workbook is written by hand as SpreadsheetML: a zip of XML parts with
+// inline strings, so the events sheet can be streamed row by row without
+// building a shared string table first.
+
+// Indexes into cellXfs in xlsxStyles.
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDateTime
+	xlsxStyleDate
+)
+
+// Excel truncates longer cell values on open, and warns about it. The limit
+// counts UTF-16 code units.
+const xlsxMaxCellLength = 32767
+
+// xlsxColumnWidths are the events sheet column widths, in characters.
+var xlsxColumnWidths = map[string]float64{
+	"id": 38, "created_at": 20, "company_id": 38, "company_name": 24,
+	"type": 18, "content": 60, "attribute": 24, "updated_at": 20,
+	"original_timestamp": 20, "value": 14, "value_number": 14,
+	"user_email": 30, "route": 30, "annotations": 40,
+}
+
+// excelEpoch is day zero of Excel's 1900 date system, adjusted for its
+// 1900 leap year bug so serials match for every date after February 1900.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+%s</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+type xlsxCell struct {
+	text    string
+	number  float64
+	numeric bool
+	style   int
+}
+
+func xlsxString(s string) xlsxCell { return xlsxCell{text: s} }
+
+// xlsxNumber is a numeric cell; SpreadsheetML has no infinities or NaN, so
+// those are written as text.
+func xlsxNumber(n float64) xlsxCell {
+	if math.IsInf(n, 0) || math.IsNaN(n) {
+		return xlsxString(strconv.FormatFloat(n, 'g', -1, 64))
+	}
+	return xlsxCell{number: n, numeric: true}
+}
+
+// xlsxTime is a date-time cell, or an empty cell for the zero time.
+func xlsxTime(t time.Time, style int) xlsxCell {
+	if t.IsZero() {
+		return xlsxCell{}
+	}
+	serial := float64(t.UTC().Sub(excelEpoch)) / float64(24*time.Hour)
+	return xlsxCell{number: serial, numeric: true, style: style}
+}
+
+// xlsxValue stores numeric event values as numbers so they can be summed.
+func xlsxValue(value string) xlsxCell {
+	if n, ok := parseNumericValue(value); ok {
+		return xlsxNumber(n)
+	}
+	return xlsxString(value)
+}
+
+// xlsxSheet writes one worksheet part. Every sheet starts with a frozen,
+// bold header row and gets an auto-filter over all of its rows.
+type xlsxSheet struct {
+	name    string
+	w       *bufio.Writer
+	columns int
+	rows    int
+}
+
+func newXLSXSheet(zw *zip.Writer, index int, name string, header []string, widths []float64) (*xlsxSheet, error) {
+	part, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", index))
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := &xlsxSheet{name: name, w: bufio.NewWriter(part), columns: len(header)}
+	sheet.w.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sheet.w.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	sheet.w.WriteString(`<cols>`)
+	for i, width := range widths {
+		fmt.Fprintf(sheet.w, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+	}
+	sheet.w.WriteString(`</cols><sheetData>`)
+
+	cells := make([]xlsxCell, len(header))
+	for i, title := range header {
+		cells[i] = xlsxCell{text: title, style: xlsxStyleHeader}
+	}
+	sheet.writeRow(cells)
+	return sheet, nil
+}
+
+func (s *xlsxSheet) writeRow(cells []xlsxCell) {
+	s.rows++
+	fmt.Fprintf(s.w, `<row r="%d">`, s.rows)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(s.rows)
+		switch {
+		case cell.numeric:
+			fmt.Fprintf(s.w, `<c r="%s"`, ref)
+			if cell.style != xlsxStyleDefault {
+				fmt.Fprintf(s.w, ` s="%d"`, cell.style)
+			}
+			fmt.Fprintf(s.w, `><v>%s</v></c>`, strconv.FormatFloat(cell.number, 'g', -1, 64))
+		case cell.text != "":
+			text := xlsxTruncate(cell.text)
+			fmt.Fprintf(s.w, `<c r="%s" t="inlineStr"`, ref)
+			if cell.style != xlsxStyleDefault {
+				fmt.Fprintf(s.w, ` s="%d"`, cell.style)
+			}
+			s.w.WriteString(`><is><t xml:space="preserve">`)
+			xml.EscapeText(s.w, []byte(text))
+			s.w.WriteString(`</t></is></c>`)
+		}
+	}
+	s.w.WriteString(`</row>`)
+}
+
+// xlsxTruncate cuts text to Excel's cell limit without splitting a
+// character; characters outside the Basic Multilingual Plane count twice.
+func xlsxTruncate(text string) string {
+	if len(text) <= xlsxMaxCellLength {
+		return text
+	}
+	units := 0
+	for i, r := range text {
+		n := 1
+		if r > 0xffff {
+			n = 2
+		}
+		if units+n > xlsxMaxCellLength {
+			return text[:i]
+		}
+		units += n
+	}
+	return text
+}
+
+func (s *xlsxSheet) close() error {
+	fmt.Fprintf(s.w, `</sheetData><autoFilter ref="%s"/></worksheet>`, s.filterRange())
+	return s.w.Flush()
+}
+
+func (s *xlsxSheet) filterRange() string {
+	return fmt.Sprintf("A1:%s%d", xlsxColumn(s.columns-1), s.rows)
+}
+
+// xlsxColumn converts a zero-based column index to its letters (0 is A,
+// 26 is AA).
+func xlsxColumn(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// writeXLSX writes the events sheet followed by per-company, per-type and
+// daily summary sheets computed over the same events.
+func (s *ExportService) writeXLSX(ctx context.Context, w io.Writer, events []models.UsageEvent, request models.ExportRequest, annotations []models.Annotation, progress ExportProgress) error {
+	zw := zip.NewWriter(w)
+	var sheets []*xlsxSheet
+
+	layout := newExportLayout(request, true)
+	widths := make([]float64, len(layout.columns))
+	for i, column := range layout.columns {
+		widths[i] = xlsxColumnWidths[column.key]
+	}
+	eventSheet, err := newXLSXSheet(zw, 1, "Events", layout.headers, widths)
+	if err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	sheets = append(sheets, eventSheet)
+
+	type companyTotals struct {
+		count       int
+		first, last time.Time
+	}
+	companyCounts := make(map[string]*companyTotals)
+	typeCounts := make(map[string]int)
+	dailyCounts := make(map[time.Time]int)
+
+	companies := s.directory.LookupEvents(events)
+	record := s.recordSource(events, layout, annotations)
+	row := make([]xlsxCell, len(layout.columns))
+	for i := range events {
+		event := &events[i]
+		if i%exportCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := eventSheet.w.Flush(); err != nil {
+				return fmt.Errorf("failed to write XLSX: %w", err)
+			}
+			progress(i)
+		}
+
+		r := record(event)
+		for j, column := range layout.columns {
+			row[j] = layout.xlsxCell(column, r)
+		}
+		eventSheet.writeRow(row)
+
+		totals := companyCounts[event.CompanyID]
+		if totals == nil {
+			totals = &companyTotals{first: event.CreatedAt, last: event.CreatedAt}
+			companyCounts[event.CompanyID] = totals
+		}
+		totals.count++
+		if event.CreatedAt.Before(totals.first) {
+			totals.first = event.CreatedAt
+		}
+		if event.CreatedAt.After(totals.last) {
+			totals.last = event.CreatedAt
+		}
+		typeCounts[event.Type]++
+		dailyCounts[event.CreatedAt.UTC().Truncate(24*time.Hour)]++
+	}
+	if err := eventSheet.close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+
+	// Companies, busiest first
+	companySheet, err := newXLSXSheet(zw, 2, "Companies", []string{"Company ID", "Company Name", "Events", "First Event", "Last Event"}, []float64{38, 24, 10, 20, 20})
+	if err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	companyIDs := make([]string, 0, len(companyCounts))
+	for id := range companyCounts {
+		companyIDs = append(companyIDs, id)
+	}
+	sort.Slice(companyIDs, func(i, j int) bool {
+		a, b := companyCounts[companyIDs[i]], companyCounts[companyIDs[j]]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return companyIDs[i] < companyIDs[j]
+	})
+	for _, id := range companyIDs {
+		totals := companyCounts[id]
+		companySheet.writeRow([]xlsxCell{
+			xlsxString(id),
+			xlsxString(companies[id].Name),
+			xlsxNumber(float64(totals.count)),
+			xlsxTime(totals.first, xlsxStyleDateTime),
+			xlsxTime(totals.last, xlsxStyleDateTime),
+		})
+	}
+	if err := companySheet.close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	sheets = append(sheets, companySheet)
+
+	// Event types, most common first
+	typeSheet, err := newXLSXSheet(zw, 3, "Event Types", []string{"Type", "Events"}, []float64{24, 10})
+	if err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	types := make([]string, 0, len(typeCounts))
+	for eventType := range typeCounts {
+		types = append(types, eventType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if typeCounts[types[i]] != typeCounts[types[j]] {
+			return typeCounts[types[i]] > typeCounts[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for _, eventType := range types {
+		typeSheet.writeRow([]xlsxCell{xlsxString(eventType), xlsxNumber(float64(typeCounts[eventType]))})
+	}
+	if err := typeSheet.close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	sheets = append(sheets, typeSheet)
+
+	// Daily series in date order
+	dailySheet, err := newXLSXSheet(zw, 4, "Daily", []string{"Date", "Events"}, []float64{12, 10})
+	if err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	days := make([]time.Time, 0, len(dailyCounts))
+	for date := range dailyCounts {
+		days = append(days, date)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+	for _, date := range days {
+		dailySheet.writeRow([]xlsxCell{xlsxTime(date, xlsxStyleDate), xlsxNumber(float64(dailyCounts[date]))})
+	}
+	if err := dailySheet.close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	sheets = append(sheets, dailySheet)
+
+	if err := writeXLSXWorkbook(zw, sheets); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+	progress(len(events))
+
+	return nil
+}
+
+// writeXLSXWorkbook writes the package parts that list the sheets.
+func writeXLSXWorkbook(zw *zip.Writer, sheets []*xlsxSheet) error {
+	var overrides, workbookSheets, definedNames, rels strings.Builder
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", n)
+		fmt.Fprintf(&workbookSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, sheet.name, n, n)
+		// Excel expects the hidden filter database name alongside each auto-filter
+		absolute := "$A$1:$" + xlsxColumn(sheet.columns-1) + "$" + strconv.Itoa(sheet.rows)
+		fmt.Fprintf(&definedNames, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">'%s'!%s</definedName>`, i, sheet.name, absolute)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", n, n)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(sheets)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, overrides.String())},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>` + workbookSheets.String() + `</sheets>
+<definedNames>` + definedNames.String() + `</definedNames>
+</workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+` + rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
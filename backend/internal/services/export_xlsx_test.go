@@ -0,0 +1,255 @@
+package services
+
+import (
+	"archive/zip"
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// xlsxParts unzips a workbook into its parts, keyed by name.
+func xlsxParts(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		parts[file.Name] = string(content)
+	}
+	return parts
+}
+
+// sheetRows is the content of a worksheet's sheetData element.
+func sheetRows(t *testing.T, sheet string) string {
+	t.Helper()
+	start := strings.Index(sheet, "<sheetData>")
+	end := strings.Index(sheet, "</sheetData>")
+	if start < 0 || end < start {
+		t.Fatalf("worksheet has no sheetData: %s", sheet)
+	}
+	return sheet[start+len("<sheetData>") : end]
+}
+
+// inlineCell is how a text cell is expected to look in a sheet.
+func inlineCell(ref, style, text string) string {
+	if style != "" {
+		style = ` s="` + style + `"`
+	}
+	return `<c r="` + ref + `" t="inlineStr"` + style + `><is><t xml:space="preserve">` + text + `</t></is></c>`
+}
+
+func exportXLSX(t *testing.T, events []models.UsageEvent) map[string]string {
+	t.Helper()
+	var buf bytes.Buffer
+	service := NewExportService(NewFilterService(), nil)
+	if err := service.WriteExport(context.Background(), &buf, events, models.ExportRequest{Format: "xlsx"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return xlsxParts(t, buf.Bytes())
+}
+
+var xlsxTestEvents = []models.UsageEvent{
+	{ID: "e1", CreatedAt: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC), CompanyID: "c1", Type: "Action",
+		Content: `<b>"Tom & Jerry"</b>` + "\x07\t", Attribute: "UserActiveCMMS",
+		UpdatedAt: time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC), Value: "12.5%"},
+	{ID: "e2", CreatedAt: time.Date(2025, 5, 3, 0, 0, 0, 0, time.UTC), CompanyID: "c2", Type: "CumulativeMetric",
+		Attribute: "Balance", Value: "null"},
+}
+
+func TestXLSXEventsSheet(t *testing.T) {
+	parts := exportXLSX(t, xlsxTestEvents)
+	sheet, ok := parts["xl/worksheets/sheet1.xml"]
+	if !ok {
+		t.Fatal("missing the events sheet")
+	}
+
+	var header strings.Builder
+	for i, title := range []string{"ID", "Created At", "Company ID", "Company Name", "Type", "Content", "Attribute", "Updated At", "Original Timestamp", "Value"} {
+		header.WriteString(inlineCell(string(rune('A'+i))+"1", "1", title))
+	}
+	// 2025-05-01 12:00 UTC is serial 45778.5. Markup is escaped, the bell,
+	// which XML cannot hold, is replaced and the tab kept as a reference;
+	// numeric values are numbers and empty fields have no cell.
+	want := `<row r="1">` + header.String() + `</row>` +
+		`<row r="2">` + inlineCell("A2", "", "e1") + `<c r="B2" s="2"><v>45778.5</v></c>` + inlineCell("C2", "", "c1") +
+		inlineCell("E2", "", "Action") + inlineCell("F2", "", "&lt;b&gt;&#34;Tom &amp; Jerry&#34;&lt;/b&gt;\uFFFD&#x9;") +
+		inlineCell("G2", "", "UserActiveCMMS") + `<c r="H2" s="2"><v>45778.5</v></c><c r="J2"><v>12.5</v></c></row>` +
+		`<row r="3">` + inlineCell("A3", "", "e2") + `<c r="B3" s="2"><v>45780</v></c>` + inlineCell("C3", "", "c2") +
+		inlineCell("E3", "", "CumulativeMetric") + inlineCell("G3", "", "Balance") + inlineCell("J3", "", "null") + `</row>`
+	if got := sheetRows(t, sheet); got != want {
+		t.Errorf("events sheet rows:\ngot  %s\nwant %s", got, want)
+	}
+	if !strings.Contains(sheet, `<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`) {
+		t.Error("header row is not frozen")
+	}
+	if !strings.HasSuffix(sheet, `</sheetData><autoFilter ref="A1:J3"/></worksheet>`) {
+		t.Error("auto-filter does not cover the header and both events")
+	}
+
+	// Daily counts are keyed by whole-day serials in the date style
+	wantDaily := `<row r="1">` + inlineCell("A1", "1", "Date") + inlineCell("B1", "1", "Events") + `</row>` +
+		`<row r="2"><c r="A2" s="3"><v>45778</v></c><c r="B2"><v>1</v></c></row>` +
+		`<row r="3"><c r="A3" s="3"><v>45780</v></c><c r="B3"><v>1</v></c></row>`
+	if got := sheetRows(t, parts["xl/worksheets/sheet4.xml"]); got != wantDaily {
+		t.Errorf("daily sheet rows:\ngot  %s\nwant %s", got, wantDaily)
+	}
+}
+
+func TestXLSXWorkbookParts(t *testing.T) {
+	parts := exportXLSX(t, xlsxTestEvents)
+
+	// Text is written inline, so there is no shared string table
+	if _, ok := parts["xl/sharedStrings.xml"]; ok {
+		t.Error("workbook has a shared strings part")
+	}
+	if types := parts["[Content_Types].xml"]; strings.Contains(types, "sharedStrings") {
+		t.Error("content types list a shared strings part")
+	}
+	for n := 1; n <= 4; n++ {
+		name := "/xl/worksheets/sheet" + string(rune('0'+n)) + ".xml"
+		if !strings.Contains(parts["[Content_Types].xml"], `<Override PartName="`+name+`" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`) {
+			t.Errorf("content types do not list %s", name)
+		}
+	}
+
+	if want := `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>`; !strings.Contains(parts["_rels/.rels"], want) {
+		t.Error("package does not point at the workbook")
+	}
+	workbook := parts["xl/workbook.xml"]
+	wantSheets := `<sheets><sheet name="Events" sheetId="1" r:id="rId1"/><sheet name="Companies" sheetId="2" r:id="rId2"/>` +
+		`<sheet name="Event Types" sheetId="3" r:id="rId3"/><sheet name="Daily" sheetId="4" r:id="rId4"/></sheets>`
+	if !strings.Contains(workbook, wantSheets) {
+		t.Errorf("workbook sheets:\n%s", workbook)
+	}
+	if want := `<definedName name="_xlnm._FilterDatabase" localSheetId="0" hidden="1">'Events'!$A$1:$J$3</definedName>`; !strings.Contains(workbook, want) {
+		t.Error("events auto-filter has no filter database name")
+	}
+	rels := parts["xl/_rels/workbook.xml.rels"]
+	for _, want := range []string{
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>`,
+		`<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet4.xml"/>`,
+		`<Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`,
+	} {
+		if !strings.Contains(rels, want) {
+			t.Errorf("workbook relationships lack %s", want)
+		}
+	}
+
+	// Cells styled 2 and 3 show as date-times and dates
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs struct {
+			Count int `xml:"count,attr"`
+			Xfs   []struct {
+				NumFmtID int `xml:"numFmtId,attr"`
+				FontID   int `xml:"fontId,attr"`
+			} `xml:"xf"`
+		} `xml:"cellXfs"`
+		Fonts []struct {
+			Bold *struct{} `xml:"b"`
+		} `xml:"fonts>font"`
+	}
+	if err := xml.Unmarshal([]byte(parts["xl/styles.xml"]), &styles); err != nil {
+		t.Fatal(err)
+	}
+	formats := make(map[int]string)
+	for _, f := range styles.NumFmts {
+		formats[f.ID] = f.Code
+	}
+	xfs := styles.CellXfs.Xfs
+	if len(xfs) != 4 || styles.CellXfs.Count != 4 {
+		t.Fatalf("%d cell styles, count %d, want 4", len(xfs), styles.CellXfs.Count)
+	}
+	if code := formats[xfs[2].NumFmtID]; code != "yyyy-mm-dd hh:mm:ss" {
+		t.Errorf("style 2 formats as %q", code)
+	}
+	if code := formats[xfs[3].NumFmtID]; code != "yyyy-mm-dd" {
+		t.Errorf("style 3 formats as %q", code)
+	}
+	if font := xfs[1].FontID; font >= len(styles.Fonts) || styles.Fonts[font].Bold == nil {
+		t.Error("header style 1 is not bold")
+	}
+	if xfs[0].NumFmtID != 0 || xfs[0].FontID != 0 {
+		t.Error("default style is not General")
+	}
+
+	for name, part := range parts {
+		decoder := xml.NewDecoder(strings.NewReader(part))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s is not well-formed: %v", name, err)
+				break
+			}
+		}
+	}
+}
+
+func TestXLSXCellTruncation(t *testing.T) {
+	long := strings.Repeat("é", xlsxMaxCellLength+10)
+	astral := strings.Repeat("a", xlsxMaxCellLength-1) + "😀"
+	sheet := exportXLSX(t, []models.UsageEvent{{ID: "long", Content: long}, {ID: "astral", Content: astral}})["xl/worksheets/sheet1.xml"]
+
+	// Excel counts UTF-16 units: é is one, but the emoji takes two and no
+	// longer fits
+	if want := inlineCell("F2", "", strings.Repeat("é", xlsxMaxCellLength)); !strings.Contains(sheet, want) {
+		t.Error("long text was not cut to the cell limit")
+	}
+	if want := inlineCell("F3", "", astral[:xlsxMaxCellLength-1]); !strings.Contains(sheet, want) {
+		t.Error("text ending in an emoji was not cut before it")
+	}
+}
+
+func TestXLSXTableDates(t *testing.T) {
+	table := &ExportTable{Name: "Series"}
+	table.addColumn("date", "Date", columnDate)
+	table.addColumn("count", "Count", columnNumber)
+	for i, day := range []time.Time{
+		time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		table.Rows = append(table.Rows, []interface{}{day, i})
+	}
+	table.Rows = append(table.Rows, []interface{}{nil, nil})
+
+	var buf bytes.Buffer
+	if err := writeTableXLSX(&buf, table, newExportLayout(models.ExportRequest{}, false)); err != nil {
+		t.Fatal(err)
+	}
+	parts := xlsxParts(t, buf.Bytes())
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheets><sheet name="Series" sheetId="1" r:id="rId1"/></sheets>`) {
+		t.Errorf("workbook sheets:\n%s", parts["xl/workbook.xml"])
+	}
+
+	// Serials as Excel shows them: 61 is 1900-03-01, past the leap day Excel
+	// wrongly gives 1900, 25569 is 1970-01-01; missing values have no cells
+	want := `<row r="1">` + inlineCell("A1", "1", "Date") + inlineCell("B1", "1", "Count") + `</row>` +
+		`<row r="2"><c r="A2" s="3"><v>61</v></c><c r="B2"><v>0</v></c></row>` +
+		`<row r="3"><c r="A3" s="3"><v>25569</v></c><c r="B3"><v>1</v></c></row>` +
+		`<row r="4"><c r="A4" s="3"><v>45778</v></c><c r="B4"><v>2</v></c></row>` +
+		`<row r="5"></row>`
+	if got := sheetRows(t, parts["xl/worksheets/sheet1.xml"]); got != want {
+		t.Errorf("table rows:\ngot  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidFacet = errors.New("invalid facet parameter")
+
+// filterDimension identifies one independent part of FilterParams. Facets
+// are computed with their own dimension ignored so the panel can show how
+// many hits each alternative value would have.
+type filterDimension uint8
+
+const (
+	dimensionDate filterDimension = 1 << iota
+	dimensionCompany
+	dimensionType
+	dimensionAttribute
+	dimensionValue
+	dimensionText
+)
+
+const (
+	FacetCompany   = "company_id"
+	FacetType      = "type"
+	FacetAttribute = "attribute"
+	FacetDate      = "date"
+)
+
+var facetAliases = map[string]string{
+	"company_id": FacetCompany,
+	"company":    FacetCompany,
+	"type":       FacetType,
+	"event_type": FacetType,
+	"attribute":  FacetAttribute,
+	"date":       FacetDate,
+	"created_at": FacetDate,
+}
+
+// facetDimensions maps each facet to the filter dimension it ignores.
+var facetDimensions = map[string]filterDimension{
+	FacetCompany:   dimensionCompany,
+	FacetType:      dimensionType,
+	FacetAttribute: dimensionAttribute,
+	FacetDate:      dimensionDate,
+}
+
+var dateBucketLayouts = map[string]string{
+	"day":   "2006-01-02",
+	"week":  "2006-01-02",
+	"month": "2006-01",
+}
+
+// NormalizeFacets resolves facet aliases, dropping duplicates. Unknown names
+// are reported as an error.
+func NormalizeFacets(names []string) ([]string, error) {
+	var facets []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		facet, ok := facetAliases[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown facet %q", ErrInvalidFacet, name)
+		}
+		if !seen[facet] {
+			seen[facet] = true
+			facets = append(facets, facet)
+		}
+	}
+	return facets, nil
+}
+
+// ValidateFacets checks facet names and the date bucket without building a
+// counter, for request validation.
+func ValidateFacets(names []string, bucket string) error {
+	if _, err := NormalizeFacets(names); err != nil {
+		return err
+	}
+	if bucket != "" {
+		if _, ok := dateBucketLayouts[strings.ToLower(bucket)]; !ok {
+			return fmt.Errorf("%w: unknown date bucket %q (use day, week or month)", ErrInvalidFacet, bucket)
+		}
+	}
+	return nil
+}
+
+type facetCounter struct {
+	facets    []string
+	bucket    string
+	dateField string
+	counts    map[string]map[string]int
+}
+
+// newFacetCounter returns nil when no facets were requested, which lets
+// callers skip the bookkeeping entirely.
+func newFacetCounter(filters models.FilterParams) *facetCounter {
+	facets, _ := NormalizeFacets(filters.Facets)
+	if len(facets) == 0 {
+		return nil
+	}
+
+	bucket := strings.ToLower(filters.FacetDateBucket)
+	if bucket == "" {
+		bucket = "day"
+	}
+
+	counter := &facetCounter{
+		facets:    facets,
+		bucket:    bucket,
+		dateField: filters.DateField,
+		counts:    make(map[string]map[string]int, len(facets)),
+	}
+	for _, facet := range facets {
+		counter.counts[facet] = make(map[string]int)
+	}
+	return counter
+}
+
+// add counts an event towards every facet whose own dimension is the only
+// one (if any) that the event failed.
+func (c *facetCounter) add(event *models.UsageEvent, failed filterDimension) {
+	if c == nil {
+		return
+	}
+
+	for _, facet := range c.facets {
+		if failed&^facetDimensions[facet] != 0 {
+			continue
+		}
+
+		var value string
+		switch facet {
+		case FacetCompany:
+			value = event.CompanyID
+		case FacetType:
+			value = event.Type
+		case FacetAttribute:
+			value = event.Attribute
+		case FacetDate:
+			value = c.dateBucket(eventTime(event, c.dateField))
+		}
+		if value == "" {
+			continue
+		}
+		c.counts[facet][value]++
+	}
+}
+
+func (c *facetCounter) dateBucket(t time.Time) string {
+	if c.bucket == "week" {
+		// Weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		t = t.AddDate(0, 0, -offset)
+	}
+	return t.Format(dateBucketLayouts[c.bucket])
+}
+
+func (c *facetCounter) results() map[string][]models.FacetCount {
+	if c == nil {
+		return nil
+	}
+
+	results := make(map[string][]models.FacetCount, len(c.facets))
+	for _, facet := range c.facets {
+		counts := make([]models.FacetCount, 0, len(c.counts[facet]))
+		for value, count := range c.counts[facet] {
+			counts = append(counts, models.FacetCount{Value: value, Count: count})
+		}
+
+		if facet == FacetDate {
+			sort.Slice(counts, func(i, j int) bool {
+				return counts[i].Value < counts[j].Value
+			})
+		} else {
+			sort.Slice(counts, func(i, j int) bool {
+				if counts[i].Count != counts[j].Count {
+					return counts[i].Count > counts[j].Count
+				}
+				return counts[i].Value < counts[j].Value
+			})
+		}
+
+		results[facet] = counts
+	}
+	return results
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func facetMap(counts []models.FacetCount) map[string]int {
+	m := make(map[string]int, len(counts))
+	for _, count := range counts {
+		m[count.Value] = count.Count
+	}
+	return m
+}
+
+// TestFacetsIgnoreTheirOwnDimension counts facets by hand, each ignoring its
+// own filter, and checks both the index path (with search text) and the scan
+// path (without an index) against them. Company facets ignore the company
+// directory filters too, as those select companies.
+func TestFacetsIgnoreTheirOwnDimension(t *testing.T) {
+	events := generateEvents(7, 3000)
+
+	directory, err := NewCompanyDirectory(filepath.Join(t.TempDir(), "companies.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	companyIDs := sortedKeys(func() map[string]bool {
+		ids := make(map[string]bool)
+		for i := range events {
+			ids[events[i].CompanyID] = true
+		}
+		return ids
+	}())
+	plans := make(map[string]string)
+	var records []models.CompanyMetadata
+	for i, id := range companyIDs {
+		plans[id] = []string{"Pro", "Basic"}[i%2]
+		records = append(records, models.CompanyMetadata{CompanyID: id, Plan: plans[id], Region: "EU"})
+	}
+	if _, err := directory.Import(records, true); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := NewFilterService()
+	scan.SetDirectory(directory)
+	indexed := indexedFilterService(events)
+	indexed.SetDirectory(directory)
+
+	start := time.Date(2025, 5, 10, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	excluded := companyIDs[0]
+
+	for _, search := range []string{"", "gmail", "bank balance"} {
+		filters := models.FilterParams{
+			StartDate:         &start,
+			EndDate:           &end,
+			Plans:             []string{"pro"},
+			ExcludeCompanyIDs: []string{excluded},
+			EventTypes:        []string{"Action"},
+			SearchText:        search,
+			Facets:            []string{FacetCompany, FacetType, FacetAttribute, FacetDate},
+		}
+
+		// Text matches come from a scan without facets, the reference the
+		// index is checked against elsewhere
+		textMatches := make(map[string]bool)
+		matched, err := scan.FilterEvents(events, models.FilterParams{SearchText: search})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range matched {
+			textMatches[matched[i].ID] = true
+		}
+
+		want := map[string]map[string]int{FacetCompany: {}, FacetType: {}, FacetAttribute: {}, FacetDate: {}}
+		for i := range events {
+			event := &events[i]
+			var failed filterDimension
+			if event.CreatedAt.Before(start) || event.CreatedAt.After(end) {
+				failed |= dimensionDate
+			}
+			if plans[event.CompanyID] != "Pro" || event.CompanyID == excluded {
+				failed |= dimensionCompany
+			}
+			if event.Type != "Action" {
+				failed |= dimensionType
+			}
+			if !textMatches[event.ID] {
+				failed |= dimensionText
+			}
+			if failed&^dimensionCompany == 0 {
+				want[FacetCompany][event.CompanyID]++
+			}
+			if failed&^dimensionType == 0 {
+				want[FacetType][event.Type]++
+			}
+			if failed == 0 {
+				want[FacetAttribute][event.Attribute]++
+			}
+			if failed&^dimensionDate == 0 {
+				want[FacetDate][event.CreatedAt.Format("2006-01-02")]++
+			}
+		}
+
+		for name, service := range map[string]*FilterService{"scan": scan, "index": indexed} {
+			results, err := service.ApplyFilters(events, filters)
+			if err != nil {
+				t.Fatalf("%s %q: %v", name, search, err)
+			}
+			for facet, counts := range want {
+				if got := facetMap(results.Facets[facet]); !reflect.DeepEqual(got, counts) {
+					t.Errorf("%s %q: %s facet\ngot:  %v\nwant: %v", name, search, facet, got, counts)
+				}
+			}
+		}
+	}
+}
@@ -2,27 +2,71 @@ package services
 
 import (
 	"assembly-dashboard-backend/internal/models"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
 
-type FilterService struct{}
+var ErrInvalidFilter = errors.New("invalid filter parameter")
+
+type FilterService struct {
+	datasetVersion string
+	indexedEvents  []models.UsageEvent
+	index          *SearchIndex
+	directory      *CompanyDirectory // resolves csm_owners, plans and regions; may be nil
+}
 
 func NewFilterService() *FilterService {
 	return &FilterService{}
 }
 
-func (s *FilterService) ApplyFilters(events []models.UsageEvent, filters models.FilterParams) models.FilteredResults {
-	filtered := make([]models.UsageEvent, 0, len(events))
+// SetDirectory sets the company directory used for metadata filters.
+func (s *FilterService) SetDirectory(directory *CompanyDirectory) {
+	s.directory = directory
+}
 
-	for _, event := range events {
-		if s.matchesFilters(event, filters) {
-			filtered = append(filtered, event)
-		}
+// SetDataset swaps in freshly loaded events along with their search index,
+// built beforehand with NewSearchIndex so that searches are not held up while
+// it is built. The version is recorded so that cursors issued for an older
+// load are rejected instead of skipping rows.
+func (s *FilterService) SetDataset(events []models.UsageEvent, version string, index *SearchIndex) {
+	s.datasetVersion = version
+	s.indexedEvents = events
+	s.index = index
+}
+
+func (s *FilterService) ApplyFilters(events []models.UsageEvent, filters models.FilterParams) (models.FilteredResults, error) {
+	sortSpec := filters.Sort
+	if sortSpec == "" && filters.SearchText != "" {
+		sortSpec = relevanceSort
 	}
 
-	// Apply pagination
+	sortKeys, err := parseSort(sortSpec)
+	if err != nil {
+		return models.FilteredResults{}, err
+	}
+
+	compiled, err := s.compileFilters(filters)
+	if err != nil {
+		return models.FilteredResults{}, err
+	}
+
+	filtered, facets := s.collect(events, compiled)
+	sortEvents(filtered, sortKeys)
+
+	// Apply pagination, resuming after the cursor position when one is given
 	start := filters.Offset
+	if filters.Cursor != "" {
+		position, err := decodeCursor(filters.Cursor, sortKeys, s.datasetVersion)
+		if err != nil {
+			return models.FilteredResults{}, err
+		}
+		start = sort.Search(len(filtered), func(i int) bool {
+			return compareEvents(&filtered[i], &position, sortKeys) > 0
+		})
+	}
 	if start > len(filtered) {
 		start = len(filtered)
 	}
@@ -39,67 +83,280 @@ func (s *FilterService) ApplyFilters(events []models.UsageEvent, filters models.
 		paginatedEvents = []models.UsageEvent{}
 	}
 
-	return models.FilteredResults{
-		Events:        paginatedEvents,
-		TotalCount:    len(events),
-		FilteredCount: len(filtered),
+	results := models.FilteredResults{
+		Events:         paginatedEvents,
+		TotalCount:     compiled.visible(events),
+		FilteredCount:  len(filtered),
+		Sort:           formatSort(sortKeys),
+		DatasetVersion: s.datasetVersion,
+		Facets:         facets.results(),
+	}
+
+	if end < len(filtered) && len(paginatedEvents) > 0 {
+		results.NextCursor = encodeCursor(paginatedEvents[len(paginatedEvents)-1], sortKeys, s.datasetVersion)
+	}
+
+	// Explain why each returned event matched the search text
+	if compiled.matcher != nil && len(paginatedEvents) > 0 {
+		results.Matches = make(map[string][]models.FieldMatch, len(paginatedEvents))
+		for i := range paginatedEvents {
+			if matches := compiled.matcher.fieldMatches(&paginatedEvents[i]); len(matches) > 0 {
+				results.Matches[paginatedEvents[i].ID] = matches
+			}
+		}
 	}
+
+	return results, nil
 }
 
-func (s *FilterService) matchesFilters(event models.UsageEvent, filters models.FilterParams) bool {
-	// Date range filter
-	if filters.StartDate != nil && event.CreatedAt.Before(*filters.StartDate) {
-		return false
+// FilterEvents returns every event matching the filters, ignoring pagination
+// and sorting. Unfiltered, unscoped requests get the events slice back
+// unchanged.
+func (s *FilterService) FilterEvents(events []models.UsageEvent, filters models.FilterParams) ([]models.UsageEvent, error) {
+	compiled, err := s.compileFilters(filters)
+	if err != nil {
+		return nil, err
 	}
-	if filters.EndDate != nil && event.CreatedAt.After(*filters.EndDate) {
-		return false
+
+	if !filters.HasConditions() && filters.Scope == nil {
+		return events, nil
 	}
 
-	// Company filter
-	if len(filters.CompanyIDs) > 0 {
-		found := false
-		for _, companyID := range filters.CompanyIDs {
-			if event.CompanyID == companyID {
-				found = true
-				break
+	filtered, _ := s.collect(events, compiled)
+	return filtered, nil
+}
+
+// compiledFilters holds FilterParams together with the matchers derived from
+// them, so queries and search text are parsed once per request.
+type compiledFilters struct {
+	models.FilterParams
+	query   *Query
+	matcher *textMatcher
+
+	// companies is the set of companies matching the metadata filters, or
+	// nil when there are none
+	companies map[string]bool
+
+	// scope is the set of companies the caller may see, or nil when they may
+	// see all of them
+	scope map[string]bool
+}
+
+// inScope reports whether the caller may see the event at all.
+func (f *compiledFilters) inScope(event *models.UsageEvent) bool {
+	return f.scope == nil || f.scope[event.CompanyID]
+}
+
+// visible counts the events the caller may see.
+func (f *compiledFilters) visible(events []models.UsageEvent) int {
+	if f.scope == nil {
+		return len(events)
+	}
+	count := 0
+	for i := range events {
+		if f.scope[events[i].CompanyID] {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *FilterService) compileFilters(filters models.FilterParams) (*compiledFilters, error) {
+	if err := ValidateFacets(filters.Facets, filters.FacetDateBucket); err != nil {
+		return nil, err
+	}
+
+	switch filters.DateField {
+	case "", "created_at", "updated_at", "original_timestamp":
+	default:
+		return nil, fmt.Errorf("%w: unknown date field %q", ErrInvalidFilter, filters.DateField)
+	}
+	if filters.ValueMin != nil && filters.ValueMax != nil && *filters.ValueMin > *filters.ValueMax {
+		return nil, fmt.Errorf("%w: value_min must not be greater than value_max", ErrInvalidFilter)
+	}
+
+	compiled := &compiledFilters{
+		FilterParams: filters,
+		matcher:      newTextMatcher(filters),
+		companies:    s.directory.MatchCompanies(filters.CSMOwners, filters.Plans, filters.Regions),
+	}
+	if filters.Scope != nil {
+		compiled.scope = make(map[string]bool, len(filters.Scope))
+		for _, id := range filters.Scope {
+			compiled.scope[id] = true
+		}
+	}
+
+	if strings.TrimSpace(filters.Query) != "" {
+		query, err := ParseQuery(filters.Query)
+		if err != nil {
+			return nil, err
+		}
+		compiled.query = query
+	}
+
+	return compiled, nil
+}
+
+// collect returns copies of the events matching the filters, along with the
+// requested facet counts. Text searches over the loaded dataset are answered
+// from the inverted index and the resulting events carry their relevance score.
+// Events outside the caller's scope are skipped before anything is counted,
+// so they show up in neither the results nor the facets.
+func (s *FilterService) collect(events []models.UsageEvent, filters *compiledFilters) ([]models.UsageEvent, *facetCounter) {
+	facets := newFacetCounter(filters.FilterParams)
+
+	if filters.matcher != nil && len(filters.matcher.words) > 0 && s.isIndexed(events) {
+		hits := s.index.Search(filters.SearchText, filters.WholeWord)
+
+		// The index lookup is case-insensitive and finds every word anywhere
+		// in the event, so case-sensitive searches and phrases still need to
+		// look at the text of each hit
+		remaining := *filters
+		if !filters.CaseSensitive && len(filters.matcher.words) == 1 {
+			remaining.matcher = nil
+		}
+
+		filtered := make([]models.UsageEvent, 0, len(hits))
+		for _, hit := range hits {
+			if !filters.inScope(&events[hit.Doc]) {
+				continue
 			}
+			failed := s.failedFilters(&events[hit.Doc], &remaining, facets == nil)
+			facets.add(&events[hit.Doc], failed)
+			if failed == 0 {
+				event := events[hit.Doc]
+				event.Score = hit.Score
+				filtered = append(filtered, event)
+			}
+		}
+		return filtered, facets
+	}
+
+	filtered := make([]models.UsageEvent, 0, len(events))
+	for i := range events {
+		if !filters.inScope(&events[i]) {
+			continue
 		}
-		if !found {
-			return false
+		failed := s.failedFilters(&events[i], filters, facets == nil)
+		facets.add(&events[i], failed)
+		if failed == 0 {
+			filtered = append(filtered, events[i])
 		}
 	}
+	return filtered, facets
+}
 
-	// Event type filter
-	if len(filters.EventTypes) > 0 {
-		found := false
-		for _, eventType := range filters.EventTypes {
-			if event.Type == eventType {
-				found = true
-				break
+// isIndexed reports whether events is the slice the search index was built
+// from, as opposed to some other subset handed in by a caller.
+func (s *FilterService) isIndexed(events []models.UsageEvent) bool {
+	return s.index != nil &&
+		len(events) > 0 &&
+		len(events) == len(s.indexedEvents) &&
+		&events[0] == &s.indexedEvents[0]
+}
+
+// failedFilters returns the set of filter dimensions the event does not
+// satisfy. With stopEarly it returns as soon as one dimension fails; facet
+// counting needs the complete set to tell which filter excluded the event.
+func (s *FilterService) failedFilters(event *models.UsageEvent, filters *compiledFilters, stopEarly bool) filterDimension {
+	var failed filterDimension
+
+	// Date range filter
+	if filters.StartDate != nil || filters.EndDate != nil {
+		timestamp := eventTime(event, filters.DateField)
+		if (filters.StartDate != nil && timestamp.Before(*filters.StartDate)) ||
+			(filters.EndDate != nil && timestamp.After(*filters.EndDate)) {
+			failed |= dimensionDate
+			if stopEarly {
+				return failed
 			}
 		}
-		if !found {
-			return false
+	}
+
+	// Company filter
+	if (len(filters.CompanyIDs) > 0 && !containsString(filters.CompanyIDs, event.CompanyID)) ||
+		containsString(filters.ExcludeCompanyIDs, event.CompanyID) ||
+		(filters.companies != nil && !filters.companies[event.CompanyID]) {
+		failed |= dimensionCompany
+		if stopEarly {
+			return failed
+		}
+	}
+
+	// Event type filter
+	if (len(filters.EventTypes) > 0 && !containsString(filters.EventTypes, event.Type)) ||
+		containsString(filters.ExcludeEventTypes, event.Type) {
+		failed |= dimensionType
+		if stopEarly {
+			return failed
+		}
+	}
+
+	// Attribute filter
+	if (len(filters.Attributes) > 0 && !containsString(filters.Attributes, event.Attribute)) ||
+		containsString(filters.ExcludeAttributes, event.Attribute) {
+		failed |= dimensionAttribute
+		if stopEarly {
+			return failed
+		}
+	}
+
+	// Value filter
+	if !matchesValueFilters(event.Value, &filters.FilterParams) {
+		failed |= dimensionValue
+		if stopEarly {
+			return failed
 		}
 	}
 
 	// Text search filter
-	if filters.SearchText != "" {
-		searchText := strings.ToLower(filters.SearchText)
-		searchableContent := strings.ToLower(
-			event.Content + " " +
-				event.Attribute + " " +
-				event.Value + " " +
-				event.CompanyID,
-		)
-		if !strings.Contains(searchableContent, searchText) {
-			return false
+	if filters.matcher != nil && !filters.matcher.matchEvent(event) {
+		failed |= dimensionText
+		if stopEarly {
+			return failed
 		}
 	}
 
+	// Structured query filter
+	if filters.query != nil && !filters.query.Match(event) {
+		failed |= dimensionText
+	}
+
+	return failed
+}
+
+func matchesValueFilters(value string, filters *models.FilterParams) bool {
+	if filters.ValueIsNull != nil && isNullValue(value) != *filters.ValueIsNull {
+		return false
+	}
+
+	if filters.ValueMin == nil && filters.ValueMax == nil {
+		return true
+	}
+
+	number, ok := parseNumericValue(value)
+	if !ok {
+		return false
+	}
+	if filters.ValueMin != nil && number < *filters.ValueMin {
+		return false
+	}
+	if filters.ValueMax != nil && number > *filters.ValueMax {
+		return false
+	}
 	return true
 }
 
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *FilterService) GetAvailableFilters(events []models.UsageEvent) models.AvailableFilters {
 	companies := make(map[string]bool)
 	eventTypes := make(map[string]bool)
@@ -145,6 +402,7 @@ func (s *FilterService) GetAvailableFilters(events []models.UsageEvent) models.A
 		Companies:  companyList,
 		EventTypes: eventTypeList,
 	}
+	filters.CSMOwners, filters.Plans, filters.Regions = s.directory.MetadataValues()
 
 	if !minDate.IsZero() && !maxDate.IsZero() {
 		filters.DateRange.Min = minDate.Format("2006-01-02")
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// searchableFields lists the event fields covered by the search box, in the
+// order match metadata is reported.
+var searchableFields = []string{"content", "attribute", "value", "company_id"}
+
+type byteRange struct {
+	start, end int
+}
+
+// textMatcher decides whether an event matches the search text and where.
+// Searches made of words follow the index semantics, read as a phrase: the
+// words must match consecutive tokens of one field, in order, with the last
+// word allowed to be the start of its token. "wes.cherveny@sample.com" thus
+// only matches that address, whatever separates the words. Punctuation-only
+// searches are matched as a plain substring.
+type textMatcher struct {
+	text          string
+	words         []string
+	caseSensitive bool
+	wholeWord     bool
+}
+
+func newTextMatcher(filters models.FilterParams) *textMatcher {
+	if filters.SearchText == "" {
+		return nil
+	}
+
+	m := &textMatcher{
+		text:          filters.SearchText,
+		caseSensitive: filters.CaseSensitive,
+		wholeWord:     filters.WholeWord,
+	}
+	if isSearchable(filters.SearchText) {
+		scanWords(filters.SearchText, func(word string, _ int) {
+			m.words = append(m.words, word)
+		})
+	}
+	return m
+}
+
+// matchEvent reports whether the search phrase (or the whole search text)
+// occurs in at least one searchable field.
+func (m *textMatcher) matchEvent(event *models.UsageEvent) bool {
+	for _, field := range searchableFields {
+		if len(m.ranges(eventField(event, field), true)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldMatches returns the match metadata for an event, with offsets counted
+// in characters rather than bytes so clients can slice the strings directly.
+func (m *textMatcher) fieldMatches(event *models.UsageEvent) []models.FieldMatch {
+	var matches []models.FieldMatch
+
+	for _, field := range searchableFields {
+		value := eventField(event, field)
+
+		ranges := m.ranges(value, false)
+		if len(ranges) == 0 {
+			continue
+		}
+
+		match := models.FieldMatch{Field: field, Ranges: make([]models.MatchRange, len(ranges))}
+		for i, r := range ranges {
+			match.Ranges[i] = models.MatchRange{
+				Start: utf8.RuneCountInString(value[:r.start]),
+				End:   utf8.RuneCountInString(value[:r.end]),
+			}
+		}
+		matches = append(matches, match)
+	}
+
+	return matches
+}
+
+func (m *textMatcher) ranges(text string, firstOnly bool) []byteRange {
+	switch len(m.words) {
+	case 0:
+		return m.substringRanges(text, firstOnly)
+	case 1:
+		return m.wordRanges(text, m.words[0], firstOnly)
+	default:
+		return m.phraseRanges(text, firstOnly)
+	}
+}
+
+// wordRanges finds tokens of text that start with word (or equal it in
+// whole-word mode) and returns the matched part of each token.
+func (m *textMatcher) wordRanges(text, word string, firstOnly bool) []byteRange {
+	var ranges []byteRange
+	scanWords(text, func(token string, offset int) {
+		if firstOnly && len(ranges) > 0 {
+			return
+		}
+		if n, ok := m.matchToken(token, word, true); ok {
+			ranges = append(ranges, byteRange{start: offset, end: offset + n})
+		}
+	})
+	return ranges
+}
+
+// phraseRanges finds runs of consecutive tokens of text matching the search
+// words in order and returns each run, from the first token to the matched
+// part of the last.
+func (m *textMatcher) phraseRanges(text string, firstOnly bool) []byteRange {
+	type token struct {
+		text   string
+		offset int
+	}
+	var tokens []token
+	scanWords(text, func(word string, offset int) {
+		tokens = append(tokens, token{text: word, offset: offset})
+	})
+
+	var ranges []byteRange
+	for i := 0; i+len(m.words) <= len(tokens); i++ {
+		end := -1
+		for j, word := range m.words {
+			n, ok := m.matchToken(tokens[i+j].text, word, j == len(m.words)-1)
+			if !ok {
+				end = -1
+				break
+			}
+			end = tokens[i+j].offset + n
+		}
+		if end < 0 {
+			continue
+		}
+		ranges = append(ranges, byteRange{start: tokens[i].offset, end: end})
+		if firstOnly {
+			break
+		}
+		i += len(m.words) - 1
+	}
+	return ranges
+}
+
+// matchToken reports whether token matches word and how many bytes of token
+// matched. Only the last word of a search may match the start of a token;
+// the others, and every word in whole-word mode, must match a whole token.
+func (m *textMatcher) matchToken(token, word string, last bool) (int, bool) {
+	if !last || m.wholeWord {
+		if m.caseSensitive {
+			return len(token), token == word
+		}
+		return len(token), strings.EqualFold(token, word)
+	}
+	if m.caseSensitive {
+		return len(word), strings.HasPrefix(token, word)
+	}
+	return prefixFold(token, word)
+}
+
+// prefixFold reports whether s starts with prefix under simple case folding
+// and returns the length in bytes of that start of s. Runes are compared one
+// at a time, as their folded forms can differ in byte length.
+func prefixFold(s, prefix string) (int, bool) {
+	n := 0
+	for _, want := range prefix {
+		if n >= len(s) {
+			return 0, false
+		}
+		got, size := utf8.DecodeRuneInString(s[n:])
+		if got != want && !equalFoldRune(got, want) {
+			return 0, false
+		}
+		n += size
+	}
+	return n, true
+}
+
+func equalFoldRune(a, b rune) bool {
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// substringRanges finds non-overlapping occurrences of the full search text.
+func (m *textMatcher) substringRanges(text string, firstOnly bool) []byteRange {
+	haystack, needle := text, m.text
+	if !m.caseSensitive {
+		haystack, needle = strings.ToLower(text), strings.ToLower(m.text)
+	}
+	if needle == "" || len(haystack) != len(text) {
+		// Lowercasing changed byte lengths; fall back to a case-sensitive
+		// search so offsets stay valid for the original text.
+		haystack, needle = text, m.text
+	}
+
+	var ranges []byteRange
+	for from := 0; from <= len(haystack)-len(needle); {
+		i := strings.Index(haystack[from:], needle)
+		if i < 0 {
+			break
+		}
+		start, end := from+i, from+i+len(needle)
+		if !m.wholeWord || isWordBoundary(text, start, end) {
+			ranges = append(ranges, byteRange{start: start, end: end})
+			if firstOnly {
+				break
+			}
+			from = end
+		} else {
+			from = start + 1
+		}
+	}
+	return ranges
+}
+
+func isWordBoundary(text string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(text[:start])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		r, _ := utf8.DecodeRuneInString(text[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// scanWords is tokenize without lowercasing, so callers can apply their own
+// case rules.
+func scanWords(text string, emit func(word string, offset int)) {
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			emit(text[start:i], start)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		emit(text[start:], start)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestSearchPhrases(t *testing.T) {
+	events := []models.UsageEvent{
+		{ID: "address", CompanyID: "c1", Type: "Action", Attribute: "UserActiveCMMS", Value: "null",
+			Content: "User active CMMS - Sample Company wes.cherveny@sample.com /work-orders/17"},
+		{ID: "scattered", CompanyID: "c1", Type: "Action", Attribute: "UserActiveCMMS", Value: "null",
+			Content: "User active CMMS - Sample Company wes.kinney@sample.com /com/cherveny"},
+		{ID: "across-fields", CompanyID: "sample", Type: "Action", Attribute: "wes", Value: "null",
+			Content: "cherveny com"},
+		{ID: "path", CompanyID: "c2", Type: "Action", Attribute: "UserActiveCMMS", Value: "null",
+			Content: "User active CMMS - Globex andrew.crook@gmail.com /purchase-orders/3"},
+		{ID: "folding", CompanyID: "c3", Type: "Action", Attribute: "UserActiveCMMS", Value: "null",
+			Content: "User active CMMS - \u212Aelvin Corp kelvin@kelvin.com /assets"},
+	}
+	scan := NewFilterService()
+	indexed := indexedFilterService(events)
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"wes.cherveny@sample.com", []string{"address"}},
+		{"cherveny@sample", []string{"address"}},
+		{"wes cherveny", []string{"address"}},
+		{"/work-orders/17", []string{"address"}},
+		{"/purchase-orders", []string{"path"}},
+		{"orders/3", []string{"path"}},
+		{"sample.co", []string{"address", "scattered"}},
+		{"kel", []string{"folding"}},
+		{"Kelvin Corp", []string{"folding"}},
+		{"kelvin@kel", []string{"folding"}},
+		{"cherveny wes", []string{}},
+		{"sample.com/cherveny", []string{}},
+	}
+
+	for _, test := range tests {
+		for name, service := range map[string]*FilterService{"scan": scan, "index": indexed} {
+			matched, err := service.FilterEvents(events, models.FilterParams{SearchText: test.search})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := eventIDs(matched); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s %q: matched %v, want %v", name, test.search, got, test.want)
+			}
+		}
+	}
+}
+
+func TestSearchHighlights(t *testing.T) {
+	event := &models.UsageEvent{Content: "Kelvin Corp: wes.cherveny@sample.com and wes cherveny"}
+
+	tests := []struct {
+		search string
+		want   []models.MatchRange
+	}{
+		// The Kelvin sign is three bytes but folds to a one-byte "k"
+		{"kel", []models.MatchRange{{Start: 0, End: 3}}},
+		{"corp", []models.MatchRange{{Start: 7, End: 11}}},
+		{"wes cherv", []models.MatchRange{{Start: 13, End: 22}, {Start: 41, End: 50}}},
+		{"wes.cherveny@sample.com", []models.MatchRange{{Start: 13, End: 36}}},
+	}
+
+	for _, test := range tests {
+		matches := newTextMatcher(models.FilterParams{SearchText: test.search}).fieldMatches(event)
+		if len(matches) != 1 || matches[0].Field != "content" || !reflect.DeepEqual(matches[0].Ranges, test.want) {
+			t.Errorf("%q: got %+v, want content ranges %v", test.search, matches, test.want)
+		}
+	}
+}
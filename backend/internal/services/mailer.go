@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EmailMessage is a multipart/alternative email with a plain text and an
+// HTML body.
+type EmailMessage struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	Date    time.Time
+}
+
+// Bytes renders the message in RFC 5322 format.
+func (m EmailMessage) Bytes() []byte {
+	boundary := "digest-" + randomHex(12)
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@assembly-analytics>\r\n", randomHex(16))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", m.Text},
+		{"text/html", m.HTML},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&b)
+		qp.Write([]byte(strings.ReplaceAll(part.body, "\n", "\r\n")))
+		qp.Close()
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+
+	return b.Bytes()
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Mailer delivers rendered emails.
+type Mailer interface {
+	Send(message EmailMessage) (string, error)
+}
+
+// SMTPMailer sends mail through an SMTP server, authenticating when a
+// username is configured. net/smtp upgrades to TLS when the server offers
+// STARTTLS.
+type SMTPMailer struct {
+	Addr     string // host:port
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(message EmailMessage) (string, error) {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return "", fmt.Errorf("invalid SMTP address %q: %w", m.Addr, err)
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	if err := smtp.SendMail(m.Addr, auth, message.From, message.To, message.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to send email via %s: %w", m.Addr, err)
+	}
+	return "smtp://" + m.Addr, nil
+}
+
+// DryRunMailer writes each email to a .eml file in Dir instead of sending it.
+type DryRunMailer struct {
+	Dir string
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (m *DryRunMailer) Send(message EmailMessage) (string, error) {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create outbox %s: %w", m.Dir, err)
+	}
+
+	subject := strings.Trim(unsafeFilenameChars.ReplaceAllString(message.Subject, "_"), "_")
+	if len(subject) > 60 {
+		subject = subject[:60]
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000"), subject)
+	path := filepath.Join(m.Dir, name)
+
+	if err := os.WriteFile(path, message.Bytes(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return "file://" + path, nil
+}
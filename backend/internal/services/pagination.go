@@ -0,0 +1,276 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSort   = "created_at:desc"
+	relevanceSort = "relevance:desc,created_at:desc"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort parameter")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrStaleCursor   = errors.New("cursor refers to a previous version of the dataset")
+)
+
+var sortableFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"company_id": true,
+	"type":       true,
+	"value":      true,
+	"relevance":  true,
+}
+
+type sortKey struct {
+	Field      string
+	Descending bool
+}
+
+// cursorToken is the payload behind the opaque cursor handed to clients. It
+// records the sort keys of the last event on a page so the next page can
+// resume right after it, and is only valid for the dataset it was issued on.
+type cursorToken struct {
+	Version   string  `json:"v"`
+	Sort      string  `json:"s"`
+	ID        string  `json:"id"`
+	CreatedAt string  `json:"ca,omitempty"`
+	UpdatedAt string  `json:"ua,omitempty"`
+	CompanyID string  `json:"c,omitempty"`
+	Type      string  `json:"t,omitempty"`
+	Value     string  `json:"val,omitempty"`
+	Score     float64 `json:"sc,omitempty"`
+}
+
+// parseSort accepts "created_at:desc,company_id" or "-created_at,company_id".
+func parseSort(raw string) ([]sortKey, error) {
+	if strings.TrimSpace(raw) == "" {
+		raw = defaultSort
+	}
+
+	var keys []sortKey
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key := sortKey{Field: part}
+		if strings.HasPrefix(part, "-") {
+			key = sortKey{Field: part[1:], Descending: true}
+		} else if field, direction, found := strings.Cut(part, ":"); found {
+			key.Field = field
+			switch strings.ToLower(direction) {
+			case "asc":
+			case "desc":
+				key.Descending = true
+			default:
+				return nil, fmt.Errorf("%w: unknown direction %q for %s", ErrInvalidSort, direction, field)
+			}
+		}
+
+		key.Field = strings.ToLower(strings.TrimSpace(key.Field))
+		if !sortableFields[key.Field] {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, key.Field)
+		}
+		if seen[key.Field] {
+			return nil, fmt.Errorf("%w: %s listed more than once", ErrInvalidSort, key.Field)
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return parseSort(defaultSort)
+	}
+	return keys, nil
+}
+
+func ValidateSort(raw string) error {
+	_, err := parseSort(raw)
+	return err
+}
+
+func formatSort(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "asc"
+		if key.Descending {
+			direction = "desc"
+		}
+		parts[i] = key.Field + ":" + direction
+	}
+	return strings.Join(parts, ",")
+}
+
+// compareEvents orders two events by the given keys, falling back to the
+// event ID so that the ordering is total and pages never overlap.
+func compareEvents(a, b *models.UsageEvent, keys []sortKey) int {
+	for _, key := range keys {
+		var cmp int
+		switch key.Field {
+		case "created_at":
+			cmp = compareTimes(a.CreatedAt, b.CreatedAt)
+		case "updated_at":
+			cmp = compareTimes(a.UpdatedAt, b.UpdatedAt)
+		case "company_id":
+			cmp = strings.Compare(a.CompanyID, b.CompanyID)
+		case "type":
+			cmp = strings.Compare(a.Type, b.Type)
+		case "value":
+			cmp = compareValues(a.Value, b.Value)
+		case "relevance":
+			cmp = compareScores(a.Score, b.Score)
+		}
+
+		if cmp != 0 {
+			if key.Descending {
+				return -cmp
+			}
+			return cmp
+		}
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+func compareScores(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareValues sorts numeric values numerically, then other text, then
+// empty/null values last.
+func compareValues(a, b string) int {
+	aNum, aOK := parseNumericValue(a)
+	bNum, bOK := parseNumericValue(b)
+
+	switch {
+	case aOK && bOK:
+		switch {
+		case aNum < bNum:
+			return -1
+		case aNum > bNum:
+			return 1
+		default:
+			return 0
+		}
+	case aOK:
+		return -1
+	case bOK:
+		return 1
+	}
+
+	aEmpty := isNullValue(a)
+	bEmpty := isNullValue(b)
+	switch {
+	case aEmpty && bEmpty:
+		return 0
+	case aEmpty:
+		return 1
+	case bEmpty:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+func sortEvents(events []models.UsageEvent, keys []sortKey) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return compareEvents(&events[i], &events[j], keys) < 0
+	})
+}
+
+func encodeCursor(event models.UsageEvent, keys []sortKey, version string) string {
+	token := cursorToken{
+		Version: version,
+		Sort:    formatSort(keys),
+		ID:      event.ID,
+	}
+
+	for _, key := range keys {
+		switch key.Field {
+		case "created_at":
+			token.CreatedAt = event.CreatedAt.Format(time.RFC3339Nano)
+		case "updated_at":
+			token.UpdatedAt = event.UpdatedAt.Format(time.RFC3339Nano)
+		case "company_id":
+			token.CompanyID = event.CompanyID
+		case "type":
+			token.Type = event.Type
+		case "value":
+			token.Value = event.Value
+		case "relevance":
+			token.Score = event.Score
+		}
+	}
+
+	payload, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// decodeCursor validates a cursor against the current dataset version and sort
+// order and returns the position it points at as a synthetic event.
+func decodeCursor(raw string, keys []sortKey, version string) (models.UsageEvent, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return models.UsageEvent{}, ErrInvalidCursor
+	}
+
+	var token cursorToken
+	if err := json.Unmarshal(payload, &token); err != nil {
+		return models.UsageEvent{}, ErrInvalidCursor
+	}
+
+	if token.Version != version {
+		return models.UsageEvent{}, ErrStaleCursor
+	}
+	if token.Sort != formatSort(keys) {
+		return models.UsageEvent{}, fmt.Errorf("%w: cursor was issued for sort %q", ErrInvalidCursor, token.Sort)
+	}
+
+	position := models.UsageEvent{
+		ID:        token.ID,
+		CompanyID: token.CompanyID,
+		Type:      token.Type,
+		Value:     token.Value,
+		Score:     token.Score,
+	}
+	if token.CreatedAt != "" {
+		if position.CreatedAt, err = time.Parse(time.RFC3339Nano, token.CreatedAt); err != nil {
+			return models.UsageEvent{}, ErrInvalidCursor
+		}
+	}
+	if token.UpdatedAt != "" {
+		if position.UpdatedAt, err = time.Parse(time.RFC3339Nano, token.UpdatedAt); err != nil {
+			return models.UsageEvent{}, ErrInvalidCursor
+		}
+	}
+
+	return position, nil
+}
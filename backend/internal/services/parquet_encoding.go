@@ -0,0 +1,193 @@
+package services
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Thrift compact protocol field types, as used by the Parquet footer and
+// page headers.
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftEncoder writes thrift structs in the compact protocol. Structs are
+// opened with beginStruct (or a struct field/list element) and closed with
+// endStruct; field ids must increase within a struct.
+type thriftEncoder struct {
+	buf  []byte
+	last []int16 // previous field id of each open struct
+}
+
+func (e *thriftEncoder) beginStruct() {
+	e.last = append(e.last, 0)
+}
+
+func (e *thriftEncoder) endStruct() {
+	e.buf = append(e.buf, 0)
+	e.last = e.last[:len(e.last)-1]
+}
+
+func (e *thriftEncoder) fieldHeader(id int16, fieldType byte) {
+	top := len(e.last) - 1
+	if delta := id - e.last[top]; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|fieldType)
+	} else {
+		e.buf = append(e.buf, fieldType)
+		e.buf = binary.AppendVarint(e.buf, int64(id))
+	}
+	e.last[top] = id
+}
+
+func (e *thriftEncoder) i32(id int16, v int32) {
+	e.fieldHeader(id, thriftI32)
+	e.buf = binary.AppendVarint(e.buf, int64(v))
+}
+
+func (e *thriftEncoder) i64(id int16, v int64) {
+	e.fieldHeader(id, thriftI64)
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *thriftEncoder) bool(id int16, v bool) {
+	if v {
+		e.fieldHeader(id, thriftTrue)
+	} else {
+		e.fieldHeader(id, thriftFalse)
+	}
+}
+
+func (e *thriftEncoder) binary(id int16, v []byte) {
+	e.fieldHeader(id, thriftBinary)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *thriftEncoder) string(id int16, v string) {
+	e.binary(id, []byte(v))
+}
+
+// structField opens a struct-valued field; close it with endStruct.
+func (e *thriftEncoder) structField(id int16) {
+	e.fieldHeader(id, thriftStruct)
+	e.beginStruct()
+}
+
+// emptyStruct writes a struct field with no fields, as Parquet uses for
+// the members of its logical type unions.
+func (e *thriftEncoder) emptyStruct(id int16) {
+	e.structField(id)
+	e.endStruct()
+}
+
+// list opens a list field; its elements follow, structs each opened with
+// beginStruct.
+func (e *thriftEncoder) list(id int16, elemType byte, size int) {
+	e.fieldHeader(id, thriftList)
+	if size < 15 {
+		e.buf = append(e.buf, byte(size)<<4|elemType)
+	} else {
+		e.buf = append(e.buf, 0xf0|elemType)
+		e.buf = binary.AppendUvarint(e.buf, uint64(size))
+	}
+}
+
+func (e *thriftEncoder) listI32(id int16, values []int32) {
+	e.list(id, thriftI32, len(values))
+	for _, v := range values {
+		e.buf = binary.AppendVarint(e.buf, int64(v))
+	}
+}
+
+func (e *thriftEncoder) listString(id int16, values []string) {
+	e.list(id, thriftBinary, len(values))
+	for _, v := range values {
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+		e.buf = append(e.buf, v...)
+	}
+}
+
+// appendHybrid encodes values with Parquet's RLE/bit-packing hybrid: runs
+// of eight or more equal values as RLE runs, everything else bit-packed in
+// groups of eight.
+func appendHybrid(dst []byte, values []int32, bitWidth int) []byte {
+	byteWidth := (bitWidth + 7) / 8
+	runLength := func(i int) int {
+		j := i + 1
+		for j < len(values) && values[j] == values[i] {
+			j++
+		}
+		return j - i
+	}
+
+	for i := 0; i < len(values); {
+		if n := runLength(i); n >= 8 || bitWidth == 0 {
+			dst = binary.AppendUvarint(dst, uint64(n)<<1)
+			for b := 0; b < byteWidth; b++ {
+				dst = append(dst, byte(values[i]>>(8*b)))
+			}
+			i += n
+			continue
+		}
+
+		// Take groups of eight until a long run starts on a group boundary
+		start, groups := i, 0
+		for i < len(values) && (groups == 0 || runLength(i) < 8) {
+			i += 8
+			groups++
+		}
+		end := min(i, len(values))
+		i = end
+
+		dst = binary.AppendUvarint(dst, uint64(groups)<<1|1)
+		var acc uint64
+		bits := 0
+		for k := 0; k < groups*8; k++ {
+			var v int32
+			if start+k < end {
+				v = values[start+k]
+			}
+			acc |= uint64(uint32(v)) << bits
+			bits += bitWidth
+			for bits >= 8 {
+				dst = append(dst, byte(acc))
+				acc >>= 8
+				bits -= 8
+			}
+		}
+	}
+	return dst
+}
+
+// bitWidth is the number of bits needed for values up to max.
+func bitWidth(max int) int {
+	width := 0
+	for max > 0 {
+		width++
+		max >>= 1
+	}
+	return width
+}
+
+func appendPlainInt32(dst []byte, v int32) []byte {
+	return binary.LittleEndian.AppendUint32(dst, uint32(v))
+}
+
+func appendPlainInt64(dst []byte, v int64) []byte {
+	return binary.LittleEndian.AppendUint64(dst, uint64(v))
+}
+
+func appendPlainDouble(dst []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+}
+
+func appendPlainByteArray(dst []byte, v string) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v)))
+	return append(dst, v...)
+}
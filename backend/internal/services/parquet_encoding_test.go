@@ -0,0 +1,303 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// decodedStruct is a thrift struct: field id to value. Values are
+// bool, int64 (for every integer type), []byte, []interface{} or
+// decodedStruct.
+type decodedStruct map[int16]interface{}
+
+func (s decodedStruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s decodedStruct) str(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s decodedStruct) sub(id int16) decodedStruct {
+	v, _ := s[id].(decodedStruct)
+	return v
+}
+
+func (s decodedStruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+// thriftDecoder reads the thrift compact protocol independently of
+// thriftEncoder, so that tests do not share the writer's mistakes.
+type thriftDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *thriftDecoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("unexpected end of data at %d", d.pos)
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *thriftDecoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("bad varint at %d", d.pos)
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *thriftDecoder) varint() (int64, error) {
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("bad zigzag varint at %d", d.pos)
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *thriftDecoder) readStruct() (decodedStruct, error) {
+	s := make(decodedStruct)
+	var last int16
+	for {
+		header, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return s, nil
+		}
+
+		fieldType := header & 0x0f
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			v, err := d.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		if id <= last {
+			return nil, fmt.Errorf("field id %d after %d", id, last)
+		}
+		last = id
+
+		switch fieldType {
+		case 1, 2: // booleans live in the field header
+			s[id] = fieldType == 1
+		default:
+			v, err := d.readValue(fieldType)
+			if err != nil {
+				return nil, fmt.Errorf("field %d: %w", id, err)
+			}
+			s[id] = v
+		}
+	}
+}
+
+func (d *thriftDecoder) readValue(valueType byte) (interface{}, error) {
+	switch valueType {
+	case 1, 2: // booleans in lists take a byte
+		b, err := d.byte()
+		return b == 1, err
+	case 3:
+		b, err := d.byte()
+		return int64(int8(b)), err
+	case 4, 5, 6:
+		return d.varint()
+	case 7:
+		if d.pos+8 > len(d.data) {
+			return nil, fmt.Errorf("unexpected end of double at %d", d.pos)
+		}
+		v := int64(binary.LittleEndian.Uint64(d.data[d.pos:]))
+		d.pos += 8
+		return v, nil
+	case 8:
+		n, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if d.pos+int(n) > len(d.data) {
+			return nil, fmt.Errorf("binary of %d bytes runs past the end at %d", n, d.pos)
+		}
+		v := d.data[d.pos : d.pos+int(n)]
+		d.pos += int(n)
+		return v, nil
+	case 9:
+		header, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = d.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		list := make([]interface{}, 0, size)
+		for i := uint64(0); i < size; i++ {
+			v, err := d.readValue(header & 0x0f)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case 12:
+		return d.readStruct()
+	}
+	return nil, fmt.Errorf("unsupported thrift type %d at %d", valueType, d.pos)
+}
+
+// decodeHybrid reads count values of the RLE/bit-packing hybrid encoding and
+// returns them with the number of bytes consumed.
+func decodeHybrid(data []byte, bitWidth, count int) ([]int32, int, error) {
+	byteWidth := (bitWidth + 7) / 8
+	values := make([]int32, 0, count)
+	pos := 0
+	for len(values) < count {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, 0, fmt.Errorf("bad run header at %d", pos)
+		}
+		pos += n
+
+		if header&1 == 0 {
+			run := int(header >> 1)
+			if run == 0 || pos+byteWidth > len(data) {
+				return nil, 0, fmt.Errorf("bad RLE run at %d", pos)
+			}
+			var v int32
+			for b := 0; b < byteWidth; b++ {
+				v |= int32(data[pos+b]) << (8 * b)
+			}
+			pos += byteWidth
+			for i := 0; i < run; i++ {
+				values = append(values, v)
+			}
+			continue
+		}
+
+		groups := int(header >> 1)
+		size := groups * bitWidth
+		if groups == 0 || pos+size > len(data) {
+			return nil, 0, fmt.Errorf("bad bit-packed run at %d", pos)
+		}
+		packed := data[pos : pos+size]
+		pos += size
+		for k := 0; k < groups*8 && len(values) < count; k++ {
+			var v int32
+			for bit := 0; bit < bitWidth; bit++ {
+				at := k*bitWidth + bit
+				if packed[at/8]&(1<<(at%8)) != 0 {
+					v |= 1 << bit
+				}
+			}
+			values = append(values, v)
+		}
+	}
+	if len(values) != count {
+		return nil, 0, fmt.Errorf("decoded %d values, want %d", len(values), count)
+	}
+	return values, pos, nil
+}
+
+func TestAppendHybridRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sequences := map[string][]int32{
+		"empty":      {},
+		"one":        {1},
+		"run":        {3, 3, 3, 3, 3, 3, 3, 3, 3, 3},
+		"short runs": {1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 0},
+		"mixed":      {0, 1, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 1, 0, 0},
+	}
+	random := make([]int32, 1000)
+	for i := range random {
+		if rng.Intn(3) == 0 {
+			random[i] = random[max(i-1, 0)]
+		} else {
+			random[i] = rng.Int31n(5000)
+		}
+	}
+	sequences["random"] = random
+
+	for name, values := range sequences {
+		width := 0
+		for _, v := range values {
+			width = max(width, bitWidth(int(v)))
+		}
+		for _, w := range []int{width, width + 3, 17} {
+			if len(values) > 0 && w == 0 {
+				continue
+			}
+			encoded := appendHybrid(nil, values, w)
+			decoded, n, err := decodeHybrid(encoded, w, len(values))
+			if err != nil {
+				t.Fatalf("%s at width %d: %v", name, w, err)
+			}
+			if n != len(encoded) {
+				t.Errorf("%s at width %d: decoded %d of %d bytes", name, w, n, len(encoded))
+			}
+			if !reflect.DeepEqual(decoded, values) {
+				t.Errorf("%s at width %d: got %v, want %v", name, w, decoded, values)
+			}
+		}
+	}
+
+	// The indices of a single dictionary value are zero bits wide
+	zeros := make([]int32, 20)
+	decoded, _, err := decodeHybrid(appendHybrid(nil, zeros, 0), 0, len(zeros))
+	if err != nil || !reflect.DeepEqual(decoded, zeros) {
+		t.Errorf("width 0: got %v, %v", decoded, err)
+	}
+}
+
+func TestThriftEncoderRoundTrip(t *testing.T) {
+	var e thriftEncoder
+	e.beginStruct()
+	e.i32(1, -7)
+	e.i64(2, 1<<40)
+	e.bool(3, true)
+	e.bool(4, false)
+	e.string(5, "name")
+	e.structField(20) // a jump of more than 15 ids uses the long header
+	e.i32(1, 42)
+	e.endStruct()
+	e.listI32(21, []int32{0, 3, 8})
+	strings := make([]string, 20) // 15 or more elements use the long list header
+	for i := range strings {
+		strings[i] = fmt.Sprint(i)
+	}
+	e.listString(22, strings)
+	e.endStruct()
+
+	d := thriftDecoder{data: e.buf}
+	s, err := d.readStruct()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.pos != len(e.buf) {
+		t.Errorf("decoded %d of %d bytes", d.pos, len(e.buf))
+	}
+
+	if s.int(1) != -7 || s.int(2) != 1<<40 || s[3] != true || s[4] != false || s.str(5) != "name" || s.sub(20).int(1) != 42 {
+		t.Errorf("decoded %v", s)
+	}
+	if list := s.list(21); len(list) != 3 || list[2] != int64(8) {
+		t.Errorf("i32 list decoded as %v", list)
+	}
+	if list := s.list(22); len(list) != 20 || string(list[19].([]byte)) != "19" {
+		t.Errorf("string list decoded as %v", list)
+	}
+}
@@ -0,0 +1,726 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a parsed event search expression such as
+//
+//	attribute:UserActiveCMMS AND content:"/work-orders" NOT company:X
+//	created_at:[2025-05-01 TO 2025-05-15] (type:Action OR value:>1000)
+//
+// Bare terms search content, attribute, value and company ID as substrings;
+// field terms are matched against a single field.
+type Query struct {
+	raw  string
+	root queryNode
+}
+
+// QueryError describes a query that could not be parsed. Position is the
+// zero-based byte offset in the input where the problem was found.
+type QueryError struct {
+	Position int    `json:"position"`
+	Message  string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query parse error at position %d: %s", e.Position, e.Message)
+}
+
+// Queries are parsed recursively, so their length and nesting are bounded to
+// keep a hostile query from exhausting the stack.
+const (
+	maxQueryLength = 4096
+	maxQueryDepth  = 32
+)
+
+var queryFields = map[string]string{
+	"id":                 "id",
+	"company":            "company_id",
+	"company_id":         "company_id",
+	"type":               "type",
+	"attribute":          "attribute",
+	"content":            "content",
+	"value":              "value",
+	"created_at":         "created_at",
+	"created":            "created_at",
+	"updated_at":         "updated_at",
+	"updated":            "updated_at",
+	"original_timestamp": "original_timestamp",
+}
+
+func ParseQuery(input string) (*Query, error) {
+	if len(input) > maxQueryLength {
+		return nil, &QueryError{Position: maxQueryLength, Message: fmt.Sprintf("query is longer than %d characters", maxQueryLength)}
+	}
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, input: input}
+	if p.peek().kind == tokenEOF {
+		return nil, &QueryError{Position: 0, Message: "query is empty"}
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &QueryError{Position: tok.pos, Message: fmt.Sprintf("unexpected %s", tok.describe())}
+	}
+
+	return &Query{raw: input, root: root}, nil
+}
+
+func (q *Query) Match(event *models.UsageEvent) bool {
+	return q.root.match(event)
+}
+
+func (q *Query) String() string {
+	return q.raw
+}
+
+// MatchesContent reports whether any part of the query looks at event
+// content: a term without a field, which searches content among others, or a
+// term or range on the content field.
+func (q *Query) MatchesContent() bool {
+	return matchesContent(q.root)
+}
+
+func matchesContent(node queryNode) bool {
+	switch n := node.(type) {
+	case *andNode:
+		return matchesContent(n.left) || matchesContent(n.right)
+	case *orNode:
+		return matchesContent(n.left) || matchesContent(n.right)
+	case *notNode:
+		return matchesContent(n.operand)
+	case *termNode:
+		return n.field == "" || n.field == "content"
+	case *rangeNode:
+		return n.field == "content"
+	}
+	return false
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenPhrase
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenLBrace
+	tokenRBrace
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t queryToken) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenPhrase:
+		return fmt.Sprintf("phrase %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+func lexQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(input)
+	offsets := make([]int, len(runes)+1)
+	for i, pos := 0, 0; i < len(runes); i++ {
+		offsets[i] = pos
+		pos += len(string(runes[i]))
+		offsets[i+1] = pos
+	}
+
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, text: "(", pos: offsets[i]})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, text: ")", pos: offsets[i]})
+			i++
+		case r == '[':
+			tokens = append(tokens, queryToken{kind: tokenLBracket, text: "[", pos: offsets[i]})
+			i++
+		case r == ']':
+			tokens = append(tokens, queryToken{kind: tokenRBracket, text: "]", pos: offsets[i]})
+			i++
+		case r == '{':
+			tokens = append(tokens, queryToken{kind: tokenLBrace, text: "{", pos: offsets[i]})
+			i++
+		case r == '}':
+			tokens = append(tokens, queryToken{kind: tokenRBrace, text: "}", pos: offsets[i]})
+			i++
+		case r == '"':
+			start := i
+			i++
+			var phrase strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					phrase.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				phrase.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &QueryError{Position: offsets[start], Message: "unterminated quoted phrase"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, text: phrase.String(), pos: offsets[start]})
+		case r == '-' && (i == 0 || isQueryBoundary(runes[i-1])) && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			// A leading minus negates the following clause, e.g. -type:Metric
+			tokens = append(tokens, queryToken{kind: tokenNot, text: "-", pos: offsets[i]})
+			i++
+		default:
+			start := i
+			var word strings.Builder
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("()[]{}\"", runes[i]) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					word.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				word.WriteRune(runes[i])
+				i++
+			}
+			text := word.String()
+			kind := tokenWord
+			switch text {
+			case "AND", "&&":
+				kind = tokenAnd
+			case "OR", "||":
+				kind = tokenOr
+			case "NOT", "!":
+				kind = tokenNot
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: text, pos: offsets[start]})
+		}
+	}
+
+	tokens = append(tokens, queryToken{kind: tokenEOF, pos: len(input)})
+	return tokens, nil
+}
+
+func isQueryBoundary(r rune) bool {
+	return unicode.IsSpace(r) || r == '('
+}
+
+// Parser
+//
+//	or      := and ("OR" and)*
+//	and     := unary (["AND"] unary)*
+//	unary   := "NOT" unary | primary
+//	primary := "(" or ")" | field ":" value | term | phrase
+//	value   := term | phrase | range | "(" or ")"
+//	range   := ("[" | "{") bound "TO" bound ("]" | "}")
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	input  string
+	field  string // field applied to bare terms inside field:( ... ) groups
+	depth  int    // groups and NOTs currently open
+}
+
+// enter opens a nested group or NOT at pos; the caller must call p.depth--
+// once it is parsed.
+func (p *queryParser) enter(pos int) error {
+	if p.depth++; p.depth > maxQueryDepth {
+		return &QueryError{Position: pos, Message: fmt.Sprintf("query is nested more than %d levels deep", maxQueryDepth)}
+	}
+	return nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenWord, tokenPhrase, tokenLParen, tokenNot:
+			// Adjacent clauses are implicitly ANDed
+		default:
+			return left, nil
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if tok := p.peek(); tok.kind == tokenNot {
+		p.next()
+		if err := p.enter(tok.pos); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenLParen:
+		if err := p.enter(tok.pos); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &QueryError{Position: closing.pos, Message: fmt.Sprintf("expected ')' to close group opened at position %d, found %s", tok.pos, closing.describe())}
+		}
+		return node, nil
+	case tokenPhrase:
+		return newTermNode(p.field, tok.text, true), nil
+	case tokenWord:
+		if name, rest, found := strings.Cut(tok.text, ":"); found && name != "" {
+			field, known := queryFields[strings.ToLower(name)]
+			if !known {
+				return nil, &QueryError{Position: tok.pos, Message: fmt.Sprintf("unknown field %q", name)}
+			}
+			if p.field != "" {
+				return nil, &QueryError{Position: tok.pos, Message: "field expressions cannot be nested inside a field group"}
+			}
+			return p.parseFieldValue(field, rest, tok.pos+len(name)+1)
+		}
+		return newTermNode(p.field, tok.text, false), nil
+	default:
+		return nil, &QueryError{Position: tok.pos, Message: fmt.Sprintf("expected a search term, found %s", tok.describe())}
+	}
+}
+
+// parseFieldValue parses what follows "field:". inline holds any text that was
+// attached to the colon in the same word, e.g. "/work-orders" or ">100".
+func (p *queryParser) parseFieldValue(field, inline string, pos int) (queryNode, error) {
+	if inline != "" {
+		for _, op := range []string{">=", "<=", ">", "<"} {
+			if strings.HasPrefix(inline, op) && len(inline) > len(op) {
+				return newComparisonNode(field, op, inline[len(op):], pos)
+			}
+		}
+		return newTermNode(field, inline, false), nil
+	}
+
+	tok := p.next()
+	switch tok.kind {
+	case tokenPhrase:
+		return newTermNode(field, tok.text, true), nil
+	case tokenLBracket, tokenLBrace:
+		return p.parseRange(field, tok)
+	case tokenLParen:
+		if err := p.enter(tok.pos); err != nil {
+			return nil, err
+		}
+		p.field = field
+		node, err := p.parseOr()
+		p.field = ""
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &QueryError{Position: closing.pos, Message: fmt.Sprintf("expected ')' to close group opened at position %d, found %s", tok.pos, closing.describe())}
+		}
+		return node, nil
+	default:
+		return nil, &QueryError{Position: tok.pos, Message: fmt.Sprintf("expected a value for field %s, found %s", field, tok.describe())}
+	}
+}
+
+func (p *queryParser) parseRange(field string, open queryToken) (queryNode, error) {
+	lower := p.next()
+	if lower.kind != tokenWord && lower.kind != tokenPhrase {
+		return nil, &QueryError{Position: lower.pos, Message: fmt.Sprintf("expected range lower bound, found %s", lower.describe())}
+	}
+	if to := p.next(); to.kind != tokenWord || to.text != "TO" {
+		return nil, &QueryError{Position: to.pos, Message: fmt.Sprintf("expected TO in range, found %s", to.describe())}
+	}
+	upper := p.next()
+	if upper.kind != tokenWord && upper.kind != tokenPhrase {
+		return nil, &QueryError{Position: upper.pos, Message: fmt.Sprintf("expected range upper bound, found %s", upper.describe())}
+	}
+	closing := p.next()
+	if closing.kind != tokenRBracket && closing.kind != tokenRBrace {
+		return nil, &QueryError{Position: closing.pos, Message: fmt.Sprintf("expected ']' or '}' to close range, found %s", closing.describe())}
+	}
+
+	node := &rangeNode{
+		field:         field,
+		includeLower:  open.kind == tokenLBracket,
+		includeUpper:  closing.kind == tokenRBracket,
+		hasLower:      lower.text != "*",
+		hasUpper:      upper.text != "*",
+		lowerText:     lower.text,
+		upperText:     upper.text,
+		lowerPosition: lower.pos,
+		upperPosition: upper.pos,
+	}
+	if err := node.compile(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// AST
+
+type queryNode interface {
+	match(event *models.UsageEvent) bool
+}
+
+type andNode struct{ left, right queryNode }
+
+func (n *andNode) match(event *models.UsageEvent) bool {
+	return n.left.match(event) && n.right.match(event)
+}
+
+type orNode struct{ left, right queryNode }
+
+func (n *orNode) match(event *models.UsageEvent) bool {
+	return n.left.match(event) || n.right.match(event)
+}
+
+type notNode struct{ operand queryNode }
+
+func (n *notNode) match(event *models.UsageEvent) bool {
+	return !n.operand.match(event)
+}
+
+// termNode matches a word or phrase. Without a field it matches as a
+// case-insensitive substring of content, attribute, value or company ID.
+// With a field, content is matched as a substring and the other fields
+// exactly, both case-insensitively. Terms containing * or ? are matched as wildcards against
+// the whole field value.
+type termNode struct {
+	field   string
+	text    string
+	lower   string
+	pattern *regexp.Regexp
+}
+
+func newTermNode(field, text string, phrase bool) *termNode {
+	node := &termNode{field: field, text: text, lower: strings.ToLower(text)}
+	if !phrase && strings.ContainsAny(text, "*?") {
+		node.pattern = wildcardPattern(text, field == "")
+	}
+	return node
+}
+
+func wildcardPattern(text string, unanchored bool) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("(?is)")
+	if !unanchored {
+		expr.WriteString("^")
+	}
+	for _, r := range text {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if !unanchored {
+		expr.WriteString("$")
+	}
+	return regexp.MustCompile(expr.String())
+}
+
+func (n *termNode) match(event *models.UsageEvent) bool {
+	if n.field == "" {
+		for _, value := range []string{event.Content, event.Attribute, event.Value, event.CompanyID} {
+			if n.pattern != nil {
+				if n.pattern.MatchString(value) {
+					return true
+				}
+			} else if strings.Contains(strings.ToLower(value), n.lower) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch n.field {
+	case "created_at", "updated_at", "original_timestamp":
+		// A bare date matches the whole day, a full timestamp matches exactly
+		value := eventTime(event, n.field)
+		if day, err := time.Parse("2006-01-02", n.text); err == nil {
+			return !value.Before(day) && value.Before(day.AddDate(0, 0, 1))
+		}
+		if ts, err := time.Parse(time.RFC3339, n.text); err == nil {
+			return value.Equal(ts)
+		}
+		return false
+	}
+
+	value := eventField(event, n.field)
+	if n.pattern != nil {
+		return n.pattern.MatchString(value)
+	}
+	if n.field == "content" {
+		return strings.Contains(strings.ToLower(value), n.lower)
+	}
+	if n.field == "value" {
+		if queryNumber, ok := parseNumericValue(n.text); ok {
+			if eventNumber, ok := parseNumericValue(value); ok {
+				return eventNumber == queryNumber
+			}
+		}
+	}
+	return strings.EqualFold(value, n.text)
+}
+
+// rangeNode matches timestamps, numeric values or strings between two bounds.
+// A date-only bound stands for the whole day: inclusive bounds take the day in
+// and exclusive ones leave it out. So [2025-05-01 TO 2025-05-15] includes
+// events at any time on the 15th, >2025-05-01 starts on the 2nd and
+// <2025-05-15 ends before the 15th.
+type rangeNode struct {
+	field        string
+	includeLower bool
+	includeUpper bool
+	hasLower     bool
+	hasUpper     bool
+	lowerText    string
+	upperText    string
+
+	lowerTime, upperTime     time.Time
+	lowerNumber, upperNumber float64
+
+	lowerPosition, upperPosition int
+}
+
+func newComparisonNode(field, op, bound string, pos int) (queryNode, error) {
+	node := &rangeNode{field: field, lowerPosition: pos + len(op), upperPosition: pos + len(op)}
+	switch op {
+	case ">", ">=":
+		node.hasLower, node.lowerText, node.includeLower = true, bound, op == ">="
+	case "<", "<=":
+		node.hasUpper, node.upperText, node.includeUpper = true, bound, op == "<="
+	}
+	if err := node.compile(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (n *rangeNode) compile() error {
+	switch n.field {
+	case "created_at", "updated_at", "original_timestamp":
+		// Date-only bounds become the start of the first day inside the range
+		// (lower) or of the first day past it (upper), both compared as >= and <
+		if n.hasLower {
+			t, dateOnly, err := parseQueryTime(n.lowerText)
+			if err != nil {
+				return &QueryError{Position: n.lowerPosition, Message: err.Error()}
+			}
+			if dateOnly && !n.includeLower {
+				t, n.includeLower = t.AddDate(0, 0, 1), true
+			}
+			n.lowerTime = t
+		}
+		if n.hasUpper {
+			t, dateOnly, err := parseQueryTime(n.upperText)
+			if err != nil {
+				return &QueryError{Position: n.upperPosition, Message: err.Error()}
+			}
+			if dateOnly && n.includeUpper {
+				t, n.includeUpper = t.AddDate(0, 0, 1), false
+			}
+			n.upperTime = t
+		}
+	case "value":
+		if n.hasLower {
+			number, ok := parseNumericValue(n.lowerText)
+			if !ok {
+				return &QueryError{Position: n.lowerPosition, Message: fmt.Sprintf("%q is not a number", n.lowerText)}
+			}
+			n.lowerNumber = number
+		}
+		if n.hasUpper {
+			number, ok := parseNumericValue(n.upperText)
+			if !ok {
+				return &QueryError{Position: n.upperPosition, Message: fmt.Sprintf("%q is not a number", n.upperText)}
+			}
+			n.upperNumber = number
+		}
+	}
+	return nil
+}
+
+func parseQueryTime(text string) (time.Time, bool, error) {
+	if day, err := time.Parse("2006-01-02", text); err == nil {
+		return day, true, nil
+	}
+	if ts, err := time.Parse(time.RFC3339, text); err == nil {
+		return ts, false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not a date (use YYYY-MM-DD or RFC3339)", text)
+}
+
+func (n *rangeNode) match(event *models.UsageEvent) bool {
+	switch n.field {
+	case "created_at", "updated_at", "original_timestamp":
+		value := eventTime(event, n.field)
+		if n.hasLower {
+			if n.includeLower && value.Before(n.lowerTime) {
+				return false
+			}
+			if !n.includeLower && !value.After(n.lowerTime) {
+				return false
+			}
+		}
+		if n.hasUpper {
+			if n.includeUpper && value.After(n.upperTime) {
+				return false
+			}
+			if !n.includeUpper && !value.Before(n.upperTime) {
+				return false
+			}
+		}
+		return true
+	case "value":
+		number, ok := parseNumericValue(event.Value)
+		if !ok {
+			return false
+		}
+		if n.hasLower && (number < n.lowerNumber || (!n.includeLower && number == n.lowerNumber)) {
+			return false
+		}
+		if n.hasUpper && (number > n.upperNumber || (!n.includeUpper && number == n.upperNumber)) {
+			return false
+		}
+		return true
+	default:
+		value := eventField(event, n.field)
+		if n.hasLower {
+			cmp := strings.Compare(value, n.lowerText)
+			if cmp < 0 || (cmp == 0 && !n.includeLower) {
+				return false
+			}
+		}
+		if n.hasUpper {
+			cmp := strings.Compare(value, n.upperText)
+			if cmp > 0 || (cmp == 0 && !n.includeUpper) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func eventField(event *models.UsageEvent, field string) string {
+	switch field {
+	case "id":
+		return event.ID
+	case "company_id":
+		return event.CompanyID
+	case "type":
+		return event.Type
+	case "attribute":
+		return event.Attribute
+	case "content":
+		return event.Content
+	case "value":
+		return event.Value
+	case "created_at", "updated_at", "original_timestamp":
+		return eventTime(event, field).Format(time.RFC3339)
+	default:
+		return ""
+	}
+}
+
+func eventTime(event *models.UsageEvent, field string) time.Time {
+	switch field {
+	case "updated_at":
+		return event.UpdatedAt
+	case "original_timestamp":
+		return event.OriginalTimestamp
+	default:
+		return event.CreatedAt
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateOnlyRangeBoundsCoverWholeDays(t *testing.T) {
+	at := func(value string) *models.UsageEvent {
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &models.UsageEvent{CreatedAt: ts}
+	}
+	lastOfApril := at("2025-04-30T23:59:59Z")
+	startOfFirst := at("2025-05-01T00:00:00Z")
+	noonOfFirst := at("2025-05-01T12:00:00Z")
+	startOfSecond := at("2025-05-02T00:00:00Z")
+	lateOnFifteenth := at("2025-05-15T23:59:59Z")
+	startOfSixteenth := at("2025-05-16T00:00:00Z")
+
+	tests := []struct {
+		query string
+		event *models.UsageEvent
+		want  bool
+	}{
+		{"created_at:>=2025-05-01", lastOfApril, false},
+		{"created_at:>=2025-05-01", startOfFirst, true},
+		{"created_at:>2025-05-01", noonOfFirst, false},
+		{"created_at:>2025-05-01", startOfSecond, true},
+		{"created_at:<=2025-05-15", lateOnFifteenth, true},
+		{"created_at:<=2025-05-15", startOfSixteenth, false},
+		{"created_at:<2025-05-02", noonOfFirst, true},
+		{"created_at:<2025-05-02", startOfSecond, false},
+		{"created_at:[2025-05-01 TO 2025-05-15]", startOfFirst, true},
+		{"created_at:[2025-05-01 TO 2025-05-15]", lateOnFifteenth, true},
+		{"created_at:[2025-05-01 TO 2025-05-15]", startOfSixteenth, false},
+		{"created_at:{2025-05-01 TO 2025-05-15}", noonOfFirst, false},
+		{"created_at:{2025-05-01 TO 2025-05-15}", startOfSecond, true},
+		{"created_at:{2025-05-01 TO 2025-05-15}", lateOnFifteenth, false},
+		{"created_at:2025-05-01", noonOfFirst, true},
+		{"created_at:2025-05-01", startOfSecond, false},
+		// Full timestamps are compared exactly
+		{"created_at:>2025-05-01T00:00:00Z", noonOfFirst, true},
+		{"created_at:<=2025-05-15T23:59:59Z", lateOnFifteenth, true},
+	}
+
+	for _, tt := range tests {
+		query, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+		}
+		if got := query.Match(tt.event); got != tt.want {
+			t.Errorf("%s on %s = %v, want %v", tt.query, tt.event.CreatedAt.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "type:Action" + strings.Repeat(")", depth)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		message string
+	}{
+		{"deepest group allowed", nested(maxQueryDepth), ""},
+		{"group too deep", nested(maxQueryDepth + 1), "nested more than"},
+		{"field group too deep", strings.Repeat("(", maxQueryDepth) + "content:(a)" + strings.Repeat(")", maxQueryDepth), "nested more than"},
+		{"NOT chain too deep", strings.Repeat("NOT ", maxQueryDepth+1) + "a", "nested more than"},
+		{"longest query allowed", "content:" + strings.Repeat("a", maxQueryLength-len("content:")), ""},
+		{"query too long", "content:" + strings.Repeat("a", maxQueryLength), "longer than"},
+		{"stack overflow attempt", nested(2000000), "longer than"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseQuery(test.query)
+		if test.message == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || !strings.Contains(queryErr.Message, test.message) {
+			t.Errorf("%s: got %v, want a query error containing %q", test.name, err, test.message)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ErrRedactedSearch is returned for filters that would match event content
+// the caller's redaction policy hides.
+var ErrRedactedSearch = errors.New("content is redacted")
+
+// Endpoints a redaction policy can be assigned to.
+const (
+	RedactSearch  = "search"
+	RedactSummary = "summary"
+	RedactExport  = "export"
+	RedactReport  = "report"
+)
+
+// RedactionNone is the policy that leaves everything visible.
+const RedactionNone = "none"
+
+var builtinRedactionPolicies = map[string]models.RedactionPolicy{
+	RedactionNone:  {Name: RedactionNone},
+	"mask":         {Name: "mask", Emails: models.EmailsMask},
+	"pseudonymize": {Name: "pseudonymize", Emails: models.EmailsHash},
+	"strict":       {Name: "strict", Emails: models.EmailsHash, StripURLIDs: true},
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+`)
+	routePattern = regexp.MustCompile(`(?:^|\s)/\S*`)
+)
+
+// Redactor decides which redaction policy applies to a request. Redaction
+// hides identities in what is returned, and callers it applies to cannot
+// search the content it rewrites (see Redaction.CheckFilters).
+type Redactor struct {
+	config   models.RedactionConfig
+	policies map[string]models.RedactionPolicy
+	salt     []byte
+}
+
+// NewRedactor loads the policy configuration from path; a missing file
+// leaves everything visible. Hashing emails needs a salt, so that the
+// pseudonyms cannot be reversed by hashing known addresses.
+func NewRedactor(path, salt string) (*Redactor, error) {
+	r := &Redactor{policies: make(map[string]models.RedactionPolicy), salt: []byte(salt)}
+	if err := loadJSONFile(path, &r.config); err != nil {
+		return nil, err
+	}
+
+	for name, policy := range builtinRedactionPolicies {
+		r.policies[name] = policy
+	}
+	for name, policy := range r.config.Policies {
+		if _, ok := builtinRedactionPolicies[name]; ok {
+			return nil, fmt.Errorf("redaction policy %q: cannot redefine a built-in policy", name)
+		}
+		switch policy.Emails {
+		case models.EmailsVisible, models.EmailsMask, models.EmailsHash:
+		default:
+			return nil, fmt.Errorf("redaction policy %q: emails must be mask, hash or empty", name)
+		}
+		policy.Name = name
+		r.policies[name] = policy
+	}
+
+	if r.config.Default == "" {
+		r.config.Default = RedactionNone
+	}
+	if err := r.check("default", r.config.Default); err != nil {
+		return nil, err
+	}
+	for endpoint, name := range r.config.Endpoints {
+		switch endpoint {
+		case RedactSearch, RedactSummary, RedactExport, RedactReport:
+		default:
+			return nil, fmt.Errorf("redaction endpoint %q: must be search, summary, export or report", endpoint)
+		}
+		if err := r.check("endpoint "+endpoint, name); err != nil {
+			return nil, err
+		}
+	}
+	for role, name := range r.config.Roles {
+		if err := r.check("role "+role, name); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// check verifies that a policy in use exists and can be applied.
+func (r *Redactor) check(use, name string) error {
+	policy, ok := r.policies[name]
+	if !ok {
+		return fmt.Errorf("redaction %s: unknown policy %q", use, name)
+	}
+	if policy.Emails == models.EmailsHash && len(r.salt) == 0 {
+		return fmt.Errorf("redaction %s: policy %q hashes emails, which needs a salt", use, name)
+	}
+	return nil
+}
+
+// Config returns the configuration in force, with the built-in policies
+// listed alongside the configured ones.
+func (r *Redactor) Config() models.RedactionConfig {
+	config := r.config
+	config.Policies = make(map[string]models.RedactionPolicy, len(r.policies))
+	for name, policy := range r.policies {
+		config.Policies[name] = policy
+	}
+	return config
+}
+
+// For returns the redaction for a request to endpoint by a caller with the
+// given role (empty when the caller has none).
+func (r *Redactor) For(endpoint, role string) *Redaction {
+	name, ok := r.config.Roles[role]
+	if role == "" || !ok {
+		if name, ok = r.config.Endpoints[endpoint]; !ok {
+			name = r.config.Default
+		}
+	}
+	return &Redaction{policy: r.policies[name], salt: r.salt}
+}
+
+// Named returns the redaction of a policy chosen earlier, such as the one an
+// export job was created with.
+func (r *Redactor) Named(name string) (*Redaction, error) {
+	if name == "" {
+		name = RedactionNone
+	}
+	if err := r.check("policy", name); err != nil {
+		return nil, err
+	}
+	return &Redaction{policy: r.policies[name], salt: r.salt}, nil
+}
+
+// Redaction applies one policy. A nil Redaction leaves everything as it is.
+type Redaction struct {
+	policy models.RedactionPolicy
+	salt   []byte
+}
+
+// Name is the policy name, or "none".
+func (r *Redaction) Name() string {
+	if r == nil || r.policy.Name == "" {
+		return RedactionNone
+	}
+	return r.policy.Name
+}
+
+// Active reports whether the policy hides anything.
+func (r *Redaction) Active() bool {
+	return r != nil && (r.policy.Emails != models.EmailsVisible || r.policy.StripURLIDs)
+}
+
+// CheckFilters refuses filters that match event content while the policy
+// rewrites it. Searches run over the original content, so the counts and
+// facets of a search for an address would tell whether it occurs even with
+// every result redacted. Filters on the other fields are left alone.
+func (r *Redaction) CheckFilters(filters models.FilterParams) error {
+	if !r.Active() {
+		return nil
+	}
+	if strings.TrimSpace(filters.SearchText) != "" {
+		return fmt.Errorf("%w: free-text search is not available under redaction policy %q", ErrRedactedSearch, r.Name())
+	}
+	if strings.TrimSpace(filters.Query) == "" {
+		return nil
+	}
+	query, err := ParseQuery(filters.Query)
+	if err != nil {
+		return err
+	}
+	if query.MatchesContent() {
+		return fmt.Errorf("%w: query terms on content, or without a field, are not available under redaction policy %q", ErrRedactedSearch, r.Name())
+	}
+	return nil
+}
+
+// Text redacts the emails and URL IDs in free text such as event content.
+func (r *Redaction) Text(text string) string {
+	if !r.Active() {
+		return text
+	}
+	if r.policy.Emails != models.EmailsVisible {
+		text = emailPattern.ReplaceAllStringFunc(text, r.Email)
+	}
+	if r.policy.StripURLIDs {
+		text = routePattern.ReplaceAllStringFunc(text, stripURLIDs)
+	}
+	return text
+}
+
+// Email redacts a single address.
+func (r *Redaction) Email(email string) string {
+	if r == nil || email == "" {
+		return email
+	}
+	switch r.policy.Emails {
+	case models.EmailsMask:
+		local, domain, ok := strings.Cut(email, "@")
+		if !ok {
+			return "***"
+		}
+		if local != "" {
+			local = local[:1]
+		}
+		return local + "***@" + domain
+	case models.EmailsHash:
+		mac := hmac.New(sha256.New, r.salt)
+		mac.Write([]byte(strings.ToLower(email)))
+		return "user-" + hex.EncodeToString(mac.Sum(nil))[:12] + "@redacted"
+	}
+	return email
+}
+
+// stripURLIDs replaces the path segments of a route that contain digits,
+// and drops its query string: " /work-orders/2194290?tab=1" ->
+// " /work-orders/:id".
+func stripURLIDs(route string) string {
+	route, _, _ = strings.Cut(route, "?")
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.IndexFunc(segment, unicode.IsDigit) >= 0 {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Events returns the events with their content redacted, copying them so
+// the dataset itself is left alone.
+func (r *Redaction) Events(events []models.UsageEvent) []models.UsageEvent {
+	if !r.Active() {
+		return events
+	}
+	redacted := make([]models.UsageEvent, len(events))
+	for i, event := range events {
+		event.Content = r.Text(event.Content)
+		redacted[i] = event
+	}
+	return redacted
+}
+
+// Results redacts a page of search results. Match ranges in content that
+// was rewritten no longer line up, so they are dropped.
+func (r *Redaction) Results(results *models.FilteredResults) {
+	if !r.Active() {
+		return
+	}
+	original := results.Events
+	results.Events = r.Events(original)
+	for i, event := range results.Events {
+		matches, ok := results.Matches[event.ID]
+		if !ok || event.Content == original[i].Content {
+			continue
+		}
+		var kept []models.FieldMatch
+		for _, match := range matches {
+			if match.Field != "content" {
+				kept = append(kept, match)
+			}
+		}
+		if len(kept) == 0 {
+			delete(results.Matches, event.ID)
+		} else {
+			results.Matches[event.ID] = kept
+		}
+	}
+}
+
+func (r *Redaction) Summary(summary *models.DashboardSummary) {
+	summary.RecentEvents = r.Events(summary.RecentEvents)
+}
+
+func (r *Redaction) Report(report *models.CompanyReport) {
+	if !r.Active() {
+		return
+	}
+	for i := range report.TopUsers {
+		report.TopUsers[i].Email = r.Email(report.TopUsers[i].Email)
+	}
+	for i := range report.RiskSignals {
+		report.RiskSignals[i].Signal = r.Text(report.RiskSignals[i].Signal)
+	}
+}
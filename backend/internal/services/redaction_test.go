@@ -0,0 +1,50 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"errors"
+	"testing"
+)
+
+func TestRedactionCheckFilters(t *testing.T) {
+	redactor, err := NewRedactor("", "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		filters models.FilterParams
+		refused bool
+	}{
+		{"no search", models.FilterParams{EventTypes: []string{"Action"}}, false},
+		{"search text", models.FilterParams{SearchText: "wes.cherveny@sample.com"}, true},
+		{"term without a field", models.FilterParams{Query: "type:Action AND cherveny"}, true},
+		{"content term", models.FilterParams{Query: `content:"@sample.com"`}, true},
+		{"content term under NOT", models.FilterParams{Query: "NOT content:wes*"}, true},
+		{"content group", models.FilterParams{Query: "content:(wes OR maddie)"}, true},
+		{"content range", models.FilterParams{Query: "content:[a TO b]"}, true},
+		{"other fields", models.FilterParams{Query: "type:Action AND attribute:UserActiveCMMS AND value:>100 AND created_at:>=2025-05-01"}, false},
+	}
+
+	for _, test := range tests {
+		for _, policy := range []string{"mask", "pseudonymize", "strict", RedactionNone} {
+			redaction, err := redactor.Named(policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = redaction.CheckFilters(test.filters)
+			want := test.refused && policy != RedactionNone
+			if got := errors.Is(err, ErrRedactedSearch); got != want {
+				t.Errorf("%s under %s: refused %v (%v), want %v", test.name, policy, got, err, want)
+			}
+		}
+	}
+
+	// Syntax errors are reported as such rather than as redaction errors
+	redaction, _ := redactor.Named("mask")
+	var queryErr *QueryError
+	if err := redaction.CheckFilters(models.FilterParams{Query: "type:("}); !errors.As(err, &queryErr) {
+		t.Errorf("bad query: got %v, want a query error", err)
+	}
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report charts are laid out once as a list of shapes, then drawn as SVG for
+// the HTML report or as PDF drawing operators. Coordinates have their origin
+// at the top left, as in SVG.
+const (
+	shapeRect = iota
+	shapeLine
+	shapeText
+)
+
+const (
+	chartBarColor  = "#3e7bfa"
+	chartLineColor = "#2eb886"
+	chartGridColor = "#e4e7eb"
+	chartTextColor = "#616e7c"
+
+	// chartMaxBars is the most days shown as separate bars; longer ranges
+	// are shown by week.
+	chartMaxBars = 120
+)
+
+type chartShape struct {
+	kind   int
+	x, y   float64
+	w, h   float64      // rectangles
+	points [][2]float64 // polylines
+	text   string
+	anchor string // start, middle or end
+	size   float64
+	color  string
+	stroke float64
+}
+
+type chart struct {
+	width, height float64
+	shapes        []chartShape
+}
+
+func (c *chart) rect(x, y, w, h float64, color string) {
+	c.shapes = append(c.shapes, chartShape{kind: shapeRect, x: x, y: y, w: w, h: h, color: color})
+}
+
+func (c *chart) line(points [][2]float64, color string, stroke float64) {
+	c.shapes = append(c.shapes, chartShape{kind: shapeLine, points: points, color: color, stroke: stroke})
+}
+
+func (c *chart) label(x, y float64, text, anchor string, size float64) {
+	c.shapes = append(c.shapes, chartShape{kind: shapeText, x: x, y: y, text: text, anchor: anchor, size: size, color: chartTextColor})
+}
+
+// activityChart is a bar chart of events per day, or per week when the
+// range has too many days for legible bars.
+func activityChart(points []models.TimeSeriesPoint, width, height float64) *chart {
+	c := &chart{width: width, height: height}
+	if len(points) == 0 {
+		return c
+	}
+
+	if len(points) > chartMaxBars {
+		var weeks []models.TimeSeriesPoint
+		for i, point := range points {
+			if i%7 == 0 {
+				weeks = append(weeks, models.TimeSeriesPoint{Date: point.Date})
+			}
+			weeks[len(weeks)-1].Count += point.Count
+		}
+		points = weeks
+	}
+
+	const left, right, top, bottom = 36.0, 8.0, 8.0, 18.0
+	plotWidth, plotHeight := width-left-right, height-top-bottom
+
+	maxCount := 0
+	for _, point := range points {
+		maxCount = max(maxCount, point.Count)
+	}
+	scale := niceCeiling(float64(maxCount))
+
+	for _, fraction := range []float64{0, 0.5, 1} {
+		y := top + plotHeight*(1-fraction)
+		c.line([][2]float64{{left, y}, {left + plotWidth, y}}, chartGridColor, 0.5)
+		c.label(left-4, y+3, compactNumber(scale*fraction), "end", 8)
+	}
+
+	slot := plotWidth / float64(len(points))
+	gap := math.Min(slot*0.2, 2)
+	for i, point := range points {
+		if point.Count == 0 {
+			continue
+		}
+		h := plotHeight * float64(point.Count) / scale
+		c.rect(left+float64(i)*slot+gap/2, top+plotHeight-h, slot-gap, h, chartBarColor)
+	}
+
+	labelled := make(map[int]bool)
+	for _, i := range []int{0, len(points) / 2, len(points) - 1} {
+		if labelled[i] {
+			continue
+		}
+		labelled[i] = true
+		anchor := "middle"
+		switch i {
+		case 0:
+			anchor = "start"
+		case len(points) - 1:
+			anchor = "end"
+		}
+		x := left + float64(i)*slot
+		if anchor == "middle" {
+			x += slot / 2
+		} else if anchor == "end" {
+			x += slot
+		}
+		c.label(x, height-4, shortDate(points[i].Date), anchor, 8)
+	}
+	return c
+}
+
+// trendChart is a line chart of a metric's values over time.
+func trendChart(points []models.MetricPoint, width, height float64) *chart {
+	c := &chart{width: width, height: height}
+	if len(points) == 0 {
+		return c
+	}
+
+	const left, right, top, bottom = 44.0, 6.0, 6.0, 6.0
+	plotWidth, plotHeight := width-left-right, height-top-bottom
+
+	low, high := points[0].Value, points[0].Value
+	for _, point := range points {
+		low, high = math.Min(low, point.Value), math.Max(high, point.Value)
+	}
+	if low == high {
+		low, high = low-1, high+1
+	}
+	start, end := points[0].Time, points[len(points)-1].Time
+
+	x := func(t time.Time) float64 {
+		if !end.After(start) {
+			return left + plotWidth/2
+		}
+		return left + plotWidth*float64(t.Sub(start))/float64(end.Sub(start))
+	}
+	y := func(v float64) float64 {
+		return top + plotHeight*(1-(v-low)/(high-low))
+	}
+
+	c.line([][2]float64{{left, top}, {left + plotWidth, top}}, chartGridColor, 0.5)
+	c.line([][2]float64{{left, top + plotHeight}, {left + plotWidth, top + plotHeight}}, chartGridColor, 0.5)
+	c.label(left-4, top+3, compactNumber(high), "end", 7)
+	c.label(left-4, top+plotHeight+2, compactNumber(low), "end", 7)
+
+	line := make([][2]float64, len(points))
+	for i, point := range points {
+		line[i] = [2]float64{x(point.Time), y(point.Value)}
+	}
+	if len(line) > 1 {
+		c.line(line, chartLineColor, 1.5)
+	}
+	last := line[len(line)-1]
+	c.rect(last[0]-2, last[1]-2, 4, 4, chartLineColor)
+	return c
+}
+
+// niceCeiling rounds n up to 1, 2 or 5 times a power of ten.
+func niceCeiling(n float64) float64 {
+	if n <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(n)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if n <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// compactNumber formats axis values: 950, 1.2K, 3.4M.
+func compactNumber(n float64) string {
+	switch size := math.Abs(n); {
+	case size >= 1e9:
+		return trimNumber(n/1e9) + "B"
+	case size >= 1e6:
+		return trimNumber(n/1e6) + "M"
+	case size >= 1e3:
+		return trimNumber(n/1e3) + "K"
+	}
+	return trimNumber(n)
+}
+
+func trimNumber(n float64) string {
+	return strconv.FormatFloat(math.Round(n*10)/10, 'f', -1, 64)
+}
+
+func shortDate(date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format("Jan 2")
+}
+
+// svg draws the chart as an inline SVG element.
+func (c *chart) svg() htmltemplate.HTML {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g" font-family="Helvetica, Arial, sans-serif">`, c.width, c.height, c.width, c.height)
+	for _, shape := range c.shapes {
+		switch shape.kind {
+		case shapeRect:
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`, shape.x, shape.y, shape.w, shape.h, shape.color)
+		case shapeLine:
+			points := make([]string, len(shape.points))
+			for i, p := range shape.points {
+				points[i] = fmt.Sprintf("%.1f,%.1f", p[0], p[1])
+			}
+			fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%g"/>`, strings.Join(points, " "), shape.color, shape.stroke)
+		case shapeText:
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" font-size="%g" fill="%s" text-anchor="%s">%s</text>`, shape.x, shape.y, shape.size, shape.color, shape.anchor, htmltemplate.HTMLEscapeString(shape.text))
+		}
+	}
+	b.WriteString(`</svg>`)
+	return htmltemplate.HTML(b.String())
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The PDF report is drawn with the standard Helvetica fonts, which every
+// viewer provides, so nothing needs embedding. Layout works top-down in
+// points like the charts; pdfPage flips y when writing operators.
+const (
+	pdfPageWidth  = 612.0 // US Letter
+	pdfPageHeight = 792.0
+	pdfMargin     = 48.0
+	pdfContent    = pdfPageWidth - 2*pdfMargin
+
+	pdfTextColor  = "#1f2933"
+	pdfMutedColor = "#616e7c"
+	pdfRuleColor  = "#e4e7eb"
+	pdfUpColor    = "#2eb886"
+	pdfDownColor  = "#d00000"
+)
+
+// Helvetica and Helvetica-Bold advance widths of the printable ASCII
+// characters, in thousandths of the font size.
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+)
+
+// winAnsi maps the characters outside Latin-1 that WinAnsiEncoding has.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// pdfEncode converts text to WinAnsiEncoding, replacing what it cannot
+// represent with "?".
+func pdfEncode(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch b, ok := winAnsi[r]; {
+		case ok:
+			encoded = append(encoded, b)
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			encoded = append(encoded, byte(r))
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+func textWidth(text string, size float64, bold bool) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+	total := 0
+	for _, b := range pdfEncode(text) {
+		switch {
+		case b >= 0x20 && b < 0x7f:
+			total += widths[b-0x20]
+		case b == 0x85, b == 0x97: // ellipsis and em dash
+			total += 1000
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// fitText shortens text with an ellipsis until it fits width.
+func fitText(text string, width, size float64, bold bool) string {
+	if textWidth(text, size, bold) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && textWidth(string(runes)+"…", size, bold) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func pdfColor(hex string) string {
+	var r, g, b int
+	fmt.Sscanf(strings.TrimPrefix(hex, "#"), "%02x%02x%02x", &r, &g, &b)
+	return fmt.Sprintf("%.3f %.3f %.3f", float64(r)/255, float64(g)/255, float64(b)/255)
+}
+
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+func (p *pdfPage) text(x, y float64, text string, size float64, bold bool, color, anchor string) {
+	switch anchor {
+	case "middle":
+		x -= textWidth(text, size, bold) / 2
+	case "end":
+		x -= textWidth(text, size, bold)
+	}
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(string(pdfEncode(text)))
+	fmt.Fprintf(&p.content, "BT %s rg /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", pdfColor(color), font, size, x, pdfPageHeight-y, escaped)
+}
+
+func (p *pdfPage) rect(x, y, w, h float64, color string) {
+	fmt.Fprintf(&p.content, "%s rg %.2f %.2f %.2f %.2f re f\n", pdfColor(color), x, pdfPageHeight-y-h, w, h)
+}
+
+func (p *pdfPage) strokeRect(x, y, w, h float64, color string) {
+	fmt.Fprintf(&p.content, "%s RG 0.75 w %.2f %.2f %.2f %.2f re S\n", pdfColor(color), x, pdfPageHeight-y-h, w, h)
+}
+
+func (p *pdfPage) line(points [][2]float64, color string, width float64) {
+	fmt.Fprintf(&p.content, "%s RG %g w", pdfColor(color), width)
+	for i, point := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&p.content, " %.2f %.2f %s", point[0], pdfPageHeight-point[1], op)
+	}
+	p.content.WriteString(" S\n")
+}
+
+// drawChart draws a chart with its top left corner at x, y.
+func (p *pdfPage) drawChart(c *chart, x, y float64) {
+	for _, shape := range c.shapes {
+		switch shape.kind {
+		case shapeRect:
+			p.rect(x+shape.x, y+shape.y, shape.w, shape.h, shape.color)
+		case shapeLine:
+			points := make([][2]float64, len(shape.points))
+			for i, point := range shape.points {
+				points[i] = [2]float64{x + point[0], y + point[1]}
+			}
+			p.line(points, shape.color, shape.stroke)
+		case shapeText:
+			p.text(x+shape.x, y+shape.y, shape.text, shape.size, false, shape.color, shape.anchor)
+		}
+	}
+}
+
+// pdfDocument lays out pages top to bottom, starting a new page when the
+// next block does not fit.
+type pdfDocument struct {
+	pages []*pdfPage
+	page  *pdfPage
+	y     float64
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.page = &pdfPage{}
+	d.pages = append(d.pages, d.page)
+	d.y = pdfMargin
+}
+
+// ensure starts a new page unless height fits below the cursor.
+func (d *pdfDocument) ensure(height float64) {
+	if d.y+height > pdfPageHeight-pdfMargin {
+		d.newPage()
+	}
+}
+
+func (d *pdfDocument) heading(text string) {
+	d.ensure(60)
+	d.y += 22
+	d.page.text(pdfMargin, d.y, text, 13, true, pdfTextColor, "start")
+	d.y += 6
+	d.page.line([][2]float64{{pdfMargin, d.y}, {pdfMargin + pdfContent, d.y}}, pdfRuleColor, 0.75)
+	d.y += 14
+}
+
+func (d *pdfDocument) paragraph(text string, color string) {
+	d.ensure(14)
+	d.page.text(pdfMargin, d.y, fitText(text, pdfContent, 9, false), 9, false, color, "start")
+	d.y += 14
+}
+
+type pdfColumn struct {
+	title string
+	width float64
+	align string // start or end
+}
+
+// table draws rows of cells, repeating the header on every page it spans.
+func (d *pdfDocument) table(columns []pdfColumn, rows [][]string) {
+	const rowHeight = 15.0
+	header := func() {
+		x := pdfMargin
+		for _, column := range columns {
+			d.page.text(cellX(x, column), d.y, column.title, 8, false, pdfMutedColor, column.align)
+			x += column.width
+		}
+		d.y += 5
+	}
+
+	d.ensure(2 * rowHeight)
+	header()
+	for _, row := range rows {
+		if d.y+rowHeight > pdfPageHeight-pdfMargin {
+			d.newPage()
+			header()
+		}
+		d.page.line([][2]float64{{pdfMargin, d.y}, {pdfMargin + pdfContent, d.y}}, "#f0f2f4", 0.5)
+		d.y += rowHeight - 4
+		x := pdfMargin
+		for i, column := range columns {
+			d.page.text(cellX(x, column), d.y, fitText(row[i], column.width-8, 9, false), 9, false, pdfTextColor, column.align)
+			x += column.width
+		}
+		d.y += 4
+	}
+	d.y += 4
+}
+
+func cellX(x float64, column pdfColumn) float64 {
+	if column.align == "end" {
+		return x + column.width - 8
+	}
+	return x
+}
+
+// bytes writes the document with a page number footer on every page.
+func (d *pdfDocument) bytes(footer string) ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are the catalog, page tree and fonts; each page is then a
+	// page object followed by its content stream
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		page.text(pdfMargin, pdfPageHeight-pdfMargin/2, footer, 8, false, pdfMutedColor, "start")
+		page.text(pdfPageWidth-pdfMargin, pdfPageHeight-pdfMargin/2, fmt.Sprintf("Page %d of %d", i+1, len(d.pages)), 8, false, pdfMutedColor, "end")
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(page.content.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// RenderReportPDF renders a company report as a PDF with the same sections
+// as the HTML report.
+func RenderReportPDF(report *models.CompanyReport) ([]byte, error) {
+	d := newPDFDocument()
+	p := d.page
+	date := reportDate
+
+	p.text(pdfMargin, d.y+18, reportTitle(report), 20, true, pdfTextColor, "start")
+	d.y += 36
+	subtitle := "Account review, " + date(report.From) + " – " + date(report.To)
+	if details := reportSubtitle(report); details != "" {
+		subtitle += " · " + details
+	}
+	p.text(pdfMargin, d.y, fitText(subtitle, pdfContent, 10, false), 10, false, pdfMutedColor, "start")
+	d.y += 16
+
+	// Key figures
+	type kpi struct{ label, value, note, color string }
+	kpis := []kpi{
+		{label: "Events", value: formatCount(report.TotalEvents)},
+		{label: "Active days", value: strconv.Itoa(report.ActiveDays)},
+		{label: "Active users", value: strconv.Itoa(report.ActiveUsers)},
+		{label: "Features used", value: strconv.Itoa(report.FeaturesUsed)},
+	}
+	if change := periodChange(report); change != nil {
+		kpis[0].note, kpis[0].color = formatPercent(change)+" vs previous", pdfUpColor
+		if *change < 0 {
+			kpis[0].color = pdfDownColor
+		}
+	}
+	if report.Health != nil {
+		health := kpi{label: "Health score", value: strconv.Itoa(report.Health.HealthScore), note: formatSigned(report.Health.HealthScoreChange) + " this week", color: pdfUpColor}
+		if report.Health.HealthScoreChange < 0 {
+			health.color = pdfDownColor
+		}
+		kpis = append(kpis, health)
+	}
+	const gap = 8.0
+	boxWidth := (pdfContent - gap*float64(len(kpis)-1)) / float64(len(kpis))
+	for i, k := range kpis {
+		x := pdfMargin + float64(i)*(boxWidth+gap)
+		p.strokeRect(x, d.y, boxWidth, 52, pdfRuleColor)
+		p.text(x+8, d.y+14, k.label, 8, false, pdfMutedColor, "start")
+		p.text(x+8, d.y+33, k.value, 16, true, pdfTextColor, "start")
+		if k.note != "" {
+			p.text(x+8, d.y+45, fitText(k.note, boxWidth-12, 7, false), 7, false, k.color, "start")
+		}
+	}
+	d.y += 52
+
+	d.heading("Activity")
+	activity := activityChart(report.DailyActivity, pdfContent, 150)
+	d.ensure(activity.height)
+	d.page.drawChart(activity, pdfMargin, d.y)
+	d.y += activity.height
+
+	d.heading("Top features")
+	if len(report.TopFeatures) == 0 {
+		d.paragraph("No feature usage recorded.", pdfMutedColor)
+	} else {
+		rows := make([][]string, len(report.TopFeatures))
+		for i, feature := range report.TopFeatures {
+			rows[i] = []string{feature.Name, formatCount(feature.Count), formatShare(feature.Count, report.TotalEvents) + "%"}
+		}
+		d.table([]pdfColumn{{"Feature", 336, "start"}, {"Events", 90, "end"}, {"Share of events", 90, "end"}}, rows)
+	}
+
+	d.heading("Active users")
+	if len(report.TopUsers) == 0 {
+		d.paragraph("No user activity recorded.", pdfMutedColor)
+	} else {
+		rows := make([][]string, len(report.TopUsers))
+		for i, user := range report.TopUsers {
+			rows[i] = []string{user.Email, formatCount(user.Events), date(user.LastSeen)}
+		}
+		d.table([]pdfColumn{{"User", 336, "start"}, {"Events", 90, "end"}, {"Last seen", 90, "end"}}, rows)
+	}
+
+	d.heading("Metric trends")
+	if len(report.MetricTrends) == 0 {
+		d.paragraph("No metrics recorded.", pdfMutedColor)
+	}
+	for _, trend := range report.MetricTrends {
+		const rowHeight = 44.0
+		d.ensure(rowHeight)
+		color := pdfTextColor
+		if trend.ChangePercent != nil {
+			color = pdfUpColor
+			if *trend.ChangePercent < 0 {
+				color = pdfDownColor
+			}
+		}
+		d.page.text(pdfMargin, d.y+16, fitText(trend.Name, 180, 9, false), 9, false, pdfTextColor, "start")
+		d.page.text(pdfMargin, d.y+28, "from "+formatMetric(trend.First)+" to "+formatMetric(trend.Latest), 8, false, pdfMutedColor, "start")
+		d.page.drawChart(trendChart(trend.Points, 240, 40), pdfMargin+196, d.y)
+		d.page.text(pdfMargin+pdfContent, d.y+22, formatPercent(trend.ChangePercent), 10, true, color, "end")
+		d.y += rowHeight
+	}
+
+	d.heading("Risk signals")
+	if report.Health != nil {
+		d.paragraph(fmt.Sprintf("%d at-risk metrics in the last 30 days; last active %s (%d days before the end of the data).",
+			report.Health.AtRiskMetrics, date(report.Health.LastActivity), report.Health.DaysSinceActivity), pdfTextColor)
+	}
+	if len(report.RiskSignals) == 0 {
+		d.paragraph("No at-risk signals in this period.", pdfMutedColor)
+	} else {
+		rows := make([][]string, len(report.RiskSignals))
+		for i, signal := range report.RiskSignals {
+			rows[i] = []string{date(signal.Time), signal.Signal, signal.Value}
+		}
+		d.table([]pdfColumn{{"Date", 80, "start"}, {"Signal", 356, "start"}, {"Value", 80, "end"}}, rows)
+	}
+
+	if len(report.Annotations) > 0 {
+		d.heading("Notes")
+		for _, annotation := range report.Annotations {
+			text := annotation.Text
+			if annotation.StartDate != nil {
+				text = date(*annotation.StartDate) + ": " + text
+			}
+			if annotation.Author != "" {
+				text += " – " + annotation.Author
+			}
+			d.paragraph(text, pdfTextColor)
+		}
+	}
+
+	return d.bytes(reportTitle(report) + " · generated " + date(report.GeneratedAt))
+}
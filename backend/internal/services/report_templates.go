@@ -0,0 +1,237 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	htmltemplate "html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportFuncs are shared by the HTML report template and the PDF layout.
+var reportFuncs = map[string]interface{}{
+	"date":     reportDate,
+	"count":    formatCount,
+	"metric":   formatMetric,
+	"percent":  formatPercent,
+	"signed":   formatSigned,
+	"change":   periodChange,
+	"negative": func(p *float64) bool { return p != nil && *p < 0 },
+	"subtitle": reportSubtitle,
+	"activity": func(report *models.CompanyReport) htmltemplate.HTML {
+		return activityChart(report.DailyActivity, 700, 180).svg()
+	},
+	"trend": func(trend models.MetricTrend) htmltemplate.HTML {
+		return trendChart(trend.Points, 220, 44).svg()
+	},
+	"share": formatShare,
+}
+
+func reportDate(t time.Time) string {
+	return t.Format("Jan 2, 2006")
+}
+
+// formatShare is count as a percentage of total, to one decimal.
+func formatShare(count, total int) string {
+	if total == 0 {
+		return "0"
+	}
+	return strconv.FormatFloat(math.Round(float64(count)/float64(total)*1000)/10, 'f', -1, 64)
+}
+
+// formatCount writes a count with thousands separators.
+func formatCount(n int) string {
+	if n < 0 {
+		return "-" + groupDigits(strconv.Itoa(-n))
+	}
+	return groupDigits(strconv.Itoa(n))
+}
+
+// formatMetric writes a metric value with thousands separators and at most
+// two decimals.
+func formatMetric(v float64) string {
+	whole, fraction, _ := strings.Cut(strconv.FormatFloat(math.Abs(v), 'f', 2, 64), ".")
+	text := groupDigits(whole)
+	if fraction = strings.TrimRight(fraction, "0"); fraction != "" {
+		text += "." + fraction
+	}
+	if v < 0 && text != "0" {
+		return "-" + text
+	}
+	return text
+}
+
+func groupDigits(digits string) string {
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
+
+// periodChange is the change in events against the previous period of the
+// same length, in percent; nil when there were none before.
+func periodChange(report *models.CompanyReport) *float64 {
+	if report.PreviousEvents == 0 {
+		return nil
+	}
+	change := float64(report.TotalEvents-report.PreviousEvents) / float64(report.PreviousEvents) * 100
+	return &change
+}
+
+func reportTitle(report *models.CompanyReport) string {
+	if report.Company.Name != "" {
+		return report.Company.Name
+	}
+	return report.Company.ID
+}
+
+// reportSubtitle lists the directory details known for the company.
+func reportSubtitle(report *models.CompanyReport) string {
+	var details []string
+	if report.Company.Plan != "" {
+		details = append(details, report.Company.Plan+" plan")
+	}
+	if report.Company.CSMOwner != "" {
+		details = append(details, "CSM "+report.Company.CSMOwner)
+	}
+	if report.Company.Region != "" {
+		details = append(details, report.Company.Region)
+	}
+	if report.Company.ARR != nil {
+		details = append(details, "ARR $"+formatMetric(*report.Company.ARR))
+	}
+	return strings.Join(details, " · ")
+}
+
+// RenderReportHTML renders a company report as a single HTML page with its
+// styles and charts inline, so it can be saved or mailed as is.
+func RenderReportHTML(report *models.CompanyReport) ([]byte, error) {
+	var b bytes.Buffer
+	data := struct {
+		*models.CompanyReport
+		Title string
+	}{report, reportTitle(report)}
+	if err := reportHTMLTemplate.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+var reportHTMLTemplate = htmltemplate.Must(htmltemplate.New("report.html").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} account review</title>
+<style>
+  body { font-family: -apple-system, Segoe UI, Helvetica, Arial, sans-serif; color: #1f2933; max-width: 760px; margin: 32px auto; padding: 0 16px; }
+  h1 { margin: 0 0 4px; }
+  h2 { font-size: 18px; margin: 32px 0 8px; border-bottom: 1px solid #e4e7eb; padding-bottom: 4px; }
+  .muted { color: #616e7c; }
+  .kpis { display: flex; flex-wrap: wrap; gap: 12px; margin-top: 24px; }
+  .kpi { flex: 1 1 140px; border: 1px solid #e4e7eb; border-radius: 6px; padding: 10px 12px; }
+  .kpi .value { font-size: 22px; font-weight: 600; }
+  .up { color: #2eb886; } .down { color: #d00000; }
+  table { border-collapse: collapse; width: 100%; font-size: 14px; }
+  th { text-align: left; color: #616e7c; font-weight: normal; padding: 4px 8px 4px 0; }
+  td { padding: 4px 8px 4px 0; border-top: 1px solid #f0f2f4; vertical-align: middle; }
+  .num { text-align: right; }
+  .columns { display: flex; gap: 24px; } .columns > div { flex: 1; }
+  .bar { background: #3e7bfa; height: 6px; border-radius: 3px; }
+  @media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+  <h1>{{.Title}}</h1>
+  <div class="muted">Account review, {{date .From}} &ndash; {{date .To}}{{with subtitle .CompanyReport}} &middot; {{.}}{{end}}</div>
+
+  <div class="kpis">
+    <div class="kpi"><div class="muted">Events</div><div class="value">{{count .TotalEvents}}</div>
+      {{- with change .CompanyReport}}<div class="{{if negative .}}down{{else}}up{{end}}">{{percent .}} vs previous period</div>{{end}}</div>
+    <div class="kpi"><div class="muted">Active days</div><div class="value">{{.ActiveDays}}</div></div>
+    <div class="kpi"><div class="muted">Active users</div><div class="value">{{.ActiveUsers}}</div></div>
+    <div class="kpi"><div class="muted">Features used</div><div class="value">{{.FeaturesUsed}}</div></div>
+    {{- with .Health}}
+    <div class="kpi"><div class="muted">Health score</div><div class="value">{{.HealthScore}}</div>
+      <div class="{{if lt .HealthScoreChange 0}}down{{else}}up{{end}}">{{signed .HealthScoreChange}} this week</div></div>
+    {{- end}}
+  </div>
+
+  <h2>Activity</h2>
+  {{activity .CompanyReport}}
+
+  <div class="columns">
+    <div>
+      <h2>Top features</h2>
+      {{- if .TopFeatures}}
+      <table>
+        <tr><th>Feature</th><th class="num">Events</th><th style="width: 30%"></th></tr>
+        {{- range .TopFeatures}}
+        <tr><td>{{.Name}}</td><td class="num">{{count .Count}}</td><td><div class="bar" style="width: {{share .Count (index $.TopFeatures 0).Count}}%"></div></td></tr>
+        {{- end}}
+      </table>
+      {{- else}}
+      <p class="muted">No feature usage recorded.</p>
+      {{- end}}
+    </div>
+    <div>
+      <h2>Active users</h2>
+      {{- if .TopUsers}}
+      <table>
+        <tr><th>User</th><th class="num">Events</th><th class="num">Last seen</th></tr>
+        {{- range .TopUsers}}
+        <tr><td>{{.Email}}</td><td class="num">{{count .Events}}</td><td class="num">{{date .LastSeen}}</td></tr>
+        {{- end}}
+      </table>
+      {{- else}}
+      <p class="muted">No user activity recorded.</p>
+      {{- end}}
+    </div>
+  </div>
+
+  <h2>Metric trends</h2>
+  {{- if .MetricTrends}}
+  <table>
+    <tr><th>Metric</th><th></th><th class="num">First</th><th class="num">Latest</th><th class="num">Change</th></tr>
+    {{- range .MetricTrends}}
+    <tr><td>{{.Name}}</td><td>{{trend .}}</td><td class="num">{{metric .First}}</td><td class="num">{{metric .Latest}}</td>
+      <td class="num {{if negative .ChangePercent}}down{{else if .ChangePercent}}up{{end}}">{{percent .ChangePercent}}</td></tr>
+    {{- end}}
+  </table>
+  {{- else}}
+  <p class="muted">No metrics recorded.</p>
+  {{- end}}
+
+  <h2>Risk signals</h2>
+  {{- with .Health}}
+  <p>{{.AtRiskMetrics}} at-risk metrics in the last 30 days; last active {{date .LastActivity}} ({{.DaysSinceActivity}} days before the end of the data).</p>
+  {{- end}}
+  {{- if .RiskSignals}}
+  <table>
+    <tr><th>Date</th><th>Signal</th><th class="num">Value</th></tr>
+    {{- range .RiskSignals}}
+    <tr><td>{{date .Time}}</td><td>{{.Signal}}</td><td class="num">{{.Value}}</td></tr>
+    {{- end}}
+  </table>
+  {{- else}}
+  <p class="muted">No at-risk signals in this period.</p>
+  {{- end}}
+
+  {{- if .Annotations}}
+  <h2>Notes</h2>
+  <ul>
+    {{- range .Annotations}}
+    <li>{{with .StartDate}}{{date .}}: {{end}}{{.Text}}{{with .Author}} <span class="muted">&ndash; {{.}}</span>{{end}}</li>
+    {{- end}}
+  </ul>
+  {{- end}}
+
+  <p class="muted" style="margin-top: 32px; font-size: 12px;">Generated {{date .GeneratedAt}}</p>
+</body>
+</html>
+`))
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SavedSearchService struct {
+	mu       sync.RWMutex
+	path     string
+	searches map[string]models.SavedSearch
+}
+
+func NewSavedSearchService(path string) (*SavedSearchService, error) {
+	s := &SavedSearchService{
+		path:     path,
+		searches: make(map[string]models.SavedSearch),
+	}
+
+	var stored []models.SavedSearch
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for _, search := range stored {
+		s.searches[search.ID] = search
+	}
+
+	return s, nil
+}
+
+// List returns saved searches ordered by name.
+func (s *SavedSearchService) List() []models.SavedSearch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	searches := make([]models.SavedSearch, 0, len(s.searches))
+	for _, search := range s.searches {
+		searches = append(searches, search)
+	}
+
+	sort.Slice(searches, func(i, j int) bool {
+		if searches[i].Name != searches[j].Name {
+			return searches[i].Name < searches[j].Name
+		}
+		return searches[i].ID < searches[j].ID
+	})
+	return searches
+}
+
+func (s *SavedSearchService) Get(id string) (models.SavedSearch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search, ok := s.searches[id]
+	if !ok {
+		return models.SavedSearch{}, fmt.Errorf("saved search %s: %w", id, ErrNotFound)
+	}
+	return search, nil
+}
+
+// Create saves a search for owner, the identity of the principal saving it.
+func (s *SavedSearchService) Create(request models.SavedSearchRequest, owner string) (models.SavedSearch, error) {
+	now := time.Now().UTC()
+	search := models.SavedSearch{
+		ID:        newID(),
+		Name:      strings.TrimSpace(request.Name),
+		Owner:     owner,
+		Filters:   storedFilters(request.Filters),
+		Query:     strings.TrimSpace(request.Query),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.searches[search.ID] = search
+	if err := s.save(); err != nil {
+		delete(s.searches, search.ID)
+		return models.SavedSearch{}, err
+	}
+	return search, nil
+}
+
+// Update replaces a saved search's name and filters; its owner stays.
+func (s *SavedSearchService) Update(id string, request models.SavedSearchRequest) (models.SavedSearch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.searches[id]
+	if !ok {
+		return models.SavedSearch{}, fmt.Errorf("saved search %s: %w", id, ErrNotFound)
+	}
+
+	search := previous
+	search.Name = strings.TrimSpace(request.Name)
+	search.Filters = storedFilters(request.Filters)
+	search.Query = strings.TrimSpace(request.Query)
+	search.UpdatedAt = time.Now().UTC()
+
+	s.searches[id] = search
+	if err := s.save(); err != nil {
+		s.searches[id] = previous
+		return models.SavedSearch{}, err
+	}
+	return search, nil
+}
+
+func (s *SavedSearchService) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.searches[id]
+	if !ok {
+		return fmt.Errorf("saved search %s: %w", id, ErrNotFound)
+	}
+
+	delete(s.searches, id)
+	if err := s.save(); err != nil {
+		s.searches[id] = previous
+		return err
+	}
+	return nil
+}
+
+// ResolveFilters turns a saved search into the filters for a request. The
+// saved search supplies what to match; paging, sorting and facets still come
+// from the request.
+func (s *SavedSearchService) ResolveFilters(id string, request models.FilterParams) (models.FilterParams, error) {
+	search, err := s.Get(id)
+	if err != nil {
+		return models.FilterParams{}, err
+	}
+
+	filters := search.Filters
+	switch {
+	case search.Query != "" && filters.Query != "":
+		filters.Query = "(" + filters.Query + ") AND (" + search.Query + ")"
+	case search.Query != "":
+		filters.Query = search.Query
+	}
+
+	filters.Limit = request.Limit
+	filters.Offset = request.Offset
+	if request.Sort != "" {
+		filters.Sort = request.Sort
+	}
+	filters.Cursor = request.Cursor
+	filters.Facets = request.Facets
+	filters.FacetDateBucket = request.FacetDateBucket
+
+	return filters, nil
+}
+
+// storedFilters drops the per-request parts of FilterParams before saving.
+func storedFilters(filters models.FilterParams) models.FilterParams {
+	filters.Limit = 0
+	filters.Offset = 0
+	filters.Cursor = ""
+	filters.Facets = nil
+	filters.FacetDateBucket = ""
+	return filters
+}
+
+// save must be called with the write lock held.
+func (s *SavedSearchService) save() error {
+	searches := make([]models.SavedSearch, 0, len(s.searches))
+	for _, search := range s.searches {
+		searches = append(searches, search)
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		return searches[i].CreatedAt.Before(searches[j].CreatedAt)
+	})
+
+	return saveJSONFile(s.path, searches)
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSavedSearchesPersistAndResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "saved_searches.json")
+	service, err := NewSavedSearchService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := service.Create(models.SavedSearchRequest{
+		Name: "  Big balances ",
+		Filters: models.FilterParams{
+			EventTypes:      []string{"CumulativeMetric"},
+			Query:           "value:>1000",
+			Limit:           10,
+			Offset:          20,
+			Cursor:          "abc",
+			Facets:          []string{"type"},
+			FacetDateBucket: "week",
+		},
+		Query: " attribute:Balance ",
+	}, "api_key:k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != "Big balances" || saved.Query != "attribute:Balance" {
+		t.Errorf("name and query were not trimmed: %q, %q", saved.Name, saved.Query)
+	}
+	if f := saved.Filters; f.Limit != 0 || f.Offset != 0 || f.Cursor != "" || f.Facets != nil || f.FacetDateBucket != "" {
+		t.Errorf("per-request filters were saved: %+v", f)
+	}
+
+	// Searches survive a restart
+	reloaded, err := NewSavedSearchService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reloaded.Get(saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Filters, saved.Filters) || got.Name != saved.Name || got.Owner != "api_key:k1" {
+		t.Errorf("reloaded search %+v, want %+v", got, saved)
+	}
+
+	// The saved search decides what matches, the request how it is paged
+	filters, err := reloaded.ResolveFilters(saved.ID, models.FilterParams{
+		EventTypes: []string{"Action"},
+		Limit:      5,
+		Sort:       "created_at_asc",
+		Facets:     []string{"company_id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "(value:>1000) AND (attribute:Balance)"; filters.Query != want {
+		t.Errorf("resolved query %q, want %q", filters.Query, want)
+	}
+	if !reflect.DeepEqual(filters.EventTypes, []string{"CumulativeMetric"}) {
+		t.Errorf("resolved event types %v, want the saved ones", filters.EventTypes)
+	}
+	if filters.Limit != 5 || filters.Sort != "created_at_asc" || !reflect.DeepEqual(filters.Facets, []string{"company_id"}) {
+		t.Errorf("paging, sort and facets not taken from the request: %+v", filters)
+	}
+
+	updated, err := reloaded.Update(saved.ID, models.SavedSearchRequest{Name: "Renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Renamed" || updated.Query != "" || updated.Owner != "api_key:k1" || !updated.CreatedAt.Equal(saved.CreatedAt) {
+		t.Errorf("update gave %+v", updated)
+	}
+
+	if err := reloaded.Delete(saved.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.ResolveFilters(saved.ID, models.FilterParams{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted search resolved: %v", err)
+	}
+	if err := reloaded.Delete(saved.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete: got %v, want not found", err)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// SchedulerJob runs at the minutes matched by its cron schedule.
+type SchedulerJob func(ctx context.Context) error
+
+type scheduledJob struct {
+	schedule *CronSchedule
+	location *time.Location
+	run      SchedulerJob
+	running  bool
+}
+
+// Scheduler wakes up at every minute boundary and starts the jobs whose cron
+// schedule matches that minute in their time zone. A job still running from
+// a previous minute is not started again.
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs map[string]*scheduledJob
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*scheduledJob)}
+}
+
+// Set adds or replaces the job with the given name.
+func (s *Scheduler) Set(name string, schedule *CronSchedule, location *time.Location, run SchedulerJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := &scheduledJob{schedule: schedule, location: location, run: run}
+	if previous, ok := s.jobs[name]; ok {
+		job.running = previous.running
+	}
+	s.jobs[name] = job
+}
+
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, name)
+}
+
+// Run dispatches jobs until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.dispatch(ctx, next)
+		}
+	}
+}
+
+func (s *Scheduler) dispatch(ctx context.Context, minute time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, job := range s.jobs {
+		if job.running || !job.schedule.Matches(minute.In(job.location)) {
+			continue
+		}
+
+		job.running = true
+		go func(name string, job *scheduledJob) {
+			if err := job.run(ctx); err != nil {
+				log.Printf("Warning: scheduled job %s failed: %v", name, err)
+			}
+
+			s.mu.Lock()
+			job.running = false
+			if current, ok := s.jobs[name]; ok {
+				current.running = false
+			}
+			s.mu.Unlock()
+		}(name, job)
+	}
+}
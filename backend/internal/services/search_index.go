@@ -0,0 +1,182 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Field weights used when ranking hits. A match in the attribute name says
+// more about an event than a match somewhere in its free-text content.
+const (
+	weightContent   = 1.0
+	weightAttribute = 2.0
+	weightValue     = 1.0
+	weightCompany   = 1.5
+
+	// exactTermBoost favours documents containing the query token itself over
+	// documents that only contain longer tokens starting with it.
+	exactTermBoost = 1.5
+)
+
+type posting struct {
+	doc    int32
+	weight float32 // sum of field weights for every occurrence in the document
+}
+
+// SearchIndex is an inverted index over the searchable text of a slice of
+// events. Terms are kept sorted so prefix lookups are a binary search.
+type SearchIndex struct {
+	terms    []string
+	postings [][]posting
+	docCount int
+}
+
+type SearchHit struct {
+	Doc   int
+	Score float64
+}
+
+func NewSearchIndex(events []models.UsageEvent) *SearchIndex {
+	termPostings := make(map[string][]posting)
+	docTerms := make(map[string]float32)
+
+	for i := range events {
+		event := &events[i]
+		clear(docTerms)
+		addTokens := func(text string, weight float32) {
+			tokenize(text, func(token string, _ int) {
+				docTerms[token] += weight
+			})
+		}
+
+		addTokens(event.Content, weightContent)
+		addTokens(event.Attribute, weightAttribute)
+		addTokens(event.Value, weightValue)
+		addTokens(event.CompanyID, weightCompany)
+
+		for term, weight := range docTerms {
+			termPostings[term] = append(termPostings[term], posting{doc: int32(i), weight: weight})
+		}
+	}
+
+	index := &SearchIndex{
+		terms:    make([]string, 0, len(termPostings)),
+		docCount: len(events),
+	}
+	for term := range termPostings {
+		index.terms = append(index.terms, term)
+	}
+	sort.Strings(index.terms)
+
+	index.postings = make([][]posting, len(index.terms))
+	for i, term := range index.terms {
+		// Postings were appended in document order, so they are already sorted
+		index.postings[i] = termPostings[term]
+	}
+
+	return index
+}
+
+// Search returns the documents containing every token of the query, ordered
+// by document number. Tokens match indexed tokens they are a prefix of, or
+// only identical tokens when exact is set. The tokens may be anywhere in a
+// document, so the hits of a several-word query are candidates for a phrase
+// match rather than matches.
+func (idx *SearchIndex) Search(query string, exact bool) []SearchHit {
+	var tokens []string
+	tokenize(query, func(token string, _ int) {
+		tokens = append(tokens, token)
+	})
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	var scores map[int32]float64
+	for _, token := range tokens {
+		tokenScores := idx.prefixScores(token, exact)
+		if len(tokenScores) == 0 {
+			return nil
+		}
+
+		if scores == nil {
+			scores = tokenScores
+			continue
+		}
+
+		// Intersect with the documents matched by the previous tokens
+		for doc, score := range scores {
+			if tokenScore, ok := tokenScores[doc]; ok {
+				scores[doc] = score + tokenScore
+			} else {
+				delete(scores, doc)
+			}
+		}
+		if len(scores) == 0 {
+			return nil
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for doc, score := range scores {
+		hits = append(hits, SearchHit{Doc: int(doc), Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Doc < hits[j].Doc
+	})
+
+	return hits
+}
+
+// prefixScores scores every document holding a term that starts with token
+// (or equals it, when exact) using a tf-idf weighting.
+func (idx *SearchIndex) prefixScores(token string, exact bool) map[int32]float64 {
+	start := sort.SearchStrings(idx.terms, token)
+	scores := make(map[int32]float64)
+
+	for i := start; i < len(idx.terms) && strings.HasPrefix(idx.terms[i], token); i++ {
+		if exact && idx.terms[i] != token {
+			break
+		}
+
+		termPostings := idx.postings[i]
+		idf := math.Log(1 + float64(idx.docCount)/float64(len(termPostings)))
+
+		boost := 1.0
+		if idx.terms[i] == token {
+			boost = exactTermBoost
+		}
+
+		for _, p := range termPostings {
+			score := (1 + math.Log(float64(p.weight))) * idf * boost
+			if score > scores[p.doc] {
+				scores[p.doc] = score
+			}
+		}
+	}
+
+	return scores
+}
+
+// tokenize splits text into lowercase runs of letters and digits, reporting
+// each token with its byte offset in the original text.
+func tokenize(text string, emit func(token string, offset int)) {
+	scanWords(text, func(word string, offset int) {
+		emit(strings.ToLower(word), offset)
+	})
+}
+
+// isSearchable reports whether the search text contains anything the index
+// can look up; punctuation-only searches fall back to a substring scan.
+func isSearchable(text string) bool {
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		if isWordRune(r) {
+			return true
+		}
+		text = text[size:]
+	}
+	return false
+}
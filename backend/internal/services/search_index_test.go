@@ -0,0 +1,154 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+var (
+	benchCompanies = []string{"Sample Company", "Facebook", "Assembly", "GitHub", "Acme Corp", "Globex", "Initech", "Umbrella"}
+	benchUsers     = []string{"wes.cherveny", "maddie.sommerfeld", "andrew.crook", "ebarrios.dq", "kenneth.jones", "wkinney", "aaizenberg", "dq45860"}
+	benchDomains   = []string{"sample.com", "gmail.com", "company2.org", "assembly.edu", "fieldmuseum.org", "hes.com"}
+	benchRoutes    = []string{"/work-orders", "/assets", "/locations", "/purchase-orders", "/reports", "/settings"}
+	benchMetrics   = []string{"Total Bank Balance Today", "Max Trailing 60-Day Settled Card Spend", "Max Average 30-Day Total Bank Balance"}
+
+	// searchQueries cover exact words, prefixes, multi-word searches, e-mail
+	// addresses and a search without hits.
+	searchQueries = []string{"wes.cherveny", "facebook", "work-orders", "bank balance", "fieldmus", "gmail.com", "nomatch"}
+)
+
+// generateEvents builds a deterministic dataset shaped like the CSV exports:
+// mostly user activity with e-mail addresses and routes in the content, and
+// some cumulative metrics with dollar values.
+func generateEvents(seed int64, count int) []models.UsageEvent {
+	rng := rand.New(rand.NewSource(seed))
+
+	companyIDs := make([]string, len(benchCompanies))
+	for i := range benchCompanies {
+		companyIDs[i] = fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", rng.Uint32(), rng.Intn(1<<16), rng.Intn(1<<16), rng.Intn(1<<16), rng.Int63n(1<<48))
+	}
+
+	base := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	events := make([]models.UsageEvent, count)
+	for i := range events {
+		company := rng.Intn(len(benchCompanies))
+		createdAt := base.Add(time.Duration(rng.Int63n(int64(60 * 24 * time.Hour))))
+
+		event := models.UsageEvent{
+			ID:                fmt.Sprintf("%032x", i),
+			CreatedAt:         createdAt,
+			CompanyID:         companyIDs[company],
+			UpdatedAt:         createdAt,
+			OriginalTimestamp: createdAt,
+		}
+
+		if rng.Intn(10) == 0 {
+			metric := benchMetrics[rng.Intn(len(benchMetrics))]
+			event.Type = "CumulativeMetric"
+			event.Content = "at risk - Bank Balance Degradation - " + metric
+			event.Attribute = metric
+			event.Value = fmt.Sprintf("$%d.00", rng.Intn(500000))
+		} else {
+			email := benchUsers[rng.Intn(len(benchUsers))] + "@" + benchDomains[rng.Intn(len(benchDomains))]
+			event.Type = "Action"
+			event.Content = fmt.Sprintf("User active CMMS - %s %s %s/%d", benchCompanies[company], email, benchRoutes[rng.Intn(len(benchRoutes))], rng.Intn(3000000))
+			event.Attribute = "UserActiveCMMS"
+			event.Value = "null"
+		}
+
+		events[i] = event
+	}
+	return events
+}
+
+// indexedFilterService returns a filter service whose search index covers
+// events, as after a data load.
+func indexedFilterService(events []models.UsageEvent) *FilterService {
+	service := NewFilterService()
+	service.SetDataset(events, "test", NewSearchIndex(events))
+	return service
+}
+
+func eventIDs(events []models.UsageEvent) []string {
+	ids := make([]string, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TestIndexedSearchMatchesScan checks that searches answered from the index
+// return the same events and facet counts as a scan over every event.
+func TestIndexedSearchMatchesScan(t *testing.T) {
+	events := generateEvents(42, 5000)
+	scan := NewFilterService()
+	indexed := indexedFilterService(events)
+
+	for _, query := range searchQueries {
+		for _, wholeWord := range []bool{false, true} {
+			filters := models.FilterParams{
+				SearchText: query,
+				WholeWord:  wholeWord,
+				EventTypes: []string{"Action", "CumulativeMetric"},
+				Facets:     []string{"company_id", "type", "attribute"},
+			}
+
+			want, err := scan.ApplyFilters(events, filters)
+			if err != nil {
+				t.Fatalf("scan %q: %v", query, err)
+			}
+			got, err := indexed.ApplyFilters(events, filters)
+			if err != nil {
+				t.Fatalf("index %q: %v", query, err)
+			}
+
+			if got.FilteredCount != want.FilteredCount {
+				t.Errorf("%q (whole word %v): index found %d events, scan %d", query, wholeWord, got.FilteredCount, want.FilteredCount)
+				continue
+			}
+			if !reflect.DeepEqual(eventIDs(got.Events), eventIDs(want.Events)) {
+				t.Errorf("%q (whole word %v): index and scan returned different events", query, wholeWord)
+			}
+			if !reflect.DeepEqual(got.Facets, want.Facets) {
+				t.Errorf("%q (whole word %v): facets differ\nindex: %v\nscan:  %v", query, wholeWord, got.Facets, want.Facets)
+			}
+		}
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	events := generateEvents(42, 200000)
+	filterServices := map[string]*FilterService{
+		"scan":  NewFilterService(),
+		"index": indexedFilterService(events),
+	}
+
+	for _, query := range searchQueries {
+		for _, name := range []string{"scan", "index"} {
+			service := filterServices[name]
+			filters := models.FilterParams{SearchText: query, Sort: "created_at:desc", Limit: 50}
+			b.Run(query+"/"+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := service.ApplyFilters(events, filters); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkNewSearchIndex(b *testing.B) {
+	events := generateEvents(42, 200000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		NewSearchIndex(events)
+	}
+}
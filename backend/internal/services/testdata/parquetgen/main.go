@@ -0,0 +1,179 @@
+// Command parquetgen writes testdata/arrow_events.parquet with the Apache
+// Arrow Parquet implementation, so the export tests check their reader
+// against a file this repository did not write. It is a separate module to
+// keep Arrow out of the backend's dependencies; run it from this directory:
+//
+//	go run .
+//
+// To read any Parquet file, such as an export, back with Arrow:
+//
+//	go run . check FILE...
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// The rows of fixtureEvents in export_parquet_test.go, in the columns of a
+// default Parquet export. Empty strings are written as nulls.
+var rows = []struct {
+	company, eventType, content, attribute, value string
+	valueNumber                                   *float64
+}{
+	{"0196217a-30d6-77e9-be9e-75b799fb4297", "Action", "User active CMMS - Sample Company wes.cherveny@sample.com /work-orders/12345", "UserActiveCMMS", "null", nil},
+	{"0196217a-30d6-77e9-be9e-75b799fb4297", "CumulativeMetric", "at risk - Bank Balance Degradation - Total Bank Balance Today", "Total Bank Balance Today", "$100,187.00", number(100187)},
+	{"0196217a-30d6-77e9-be9e-75b799fb4297", "CumulativeMetric", "Max Trailing 60-Day Settled Card Spend", "Max Trailing 60-Day Settled Card Spend", "(250.5)", number(-250.5)},
+	{"0196217a-30d6-77e9-be9e-75b799fb4297", "Action", "Usuário ativo – Zürich café ☕", "UserActiveCMMS", "", nil},
+	{"", "Action", "", "", "42", number(42)},
+}
+
+// dictionaryColumns are dictionary encoded, as the export writer does.
+var dictionaryColumns = []string{"company_id", "company_name", "type", "attribute"}
+
+func number(v float64) *float64 { return &v }
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		for _, path := range os.Args[2:] {
+			if err := check(path); err != nil {
+				log.Fatalf("%s: %v", path, err)
+			}
+		}
+		return
+	}
+	if err := generate("../arrow_events.parquet"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(path string) error {
+	timestamp := &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "created_at", Type: timestamp, Nullable: true},
+		{Name: "company_id", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "company_name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "type", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "content", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "attribute", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "updated_at", Type: timestamp, Nullable: true},
+		{Name: "original_timestamp", Type: timestamp, Nullable: true},
+		{Name: "value", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "value_number", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	text := func(i int, v string) {
+		if v == "" {
+			builder.Field(i).AppendNull()
+		} else {
+			builder.Field(i).(*array.StringBuilder).Append(v)
+		}
+	}
+	micros := func(i int, v time.Time) {
+		if v.IsZero() {
+			builder.Field(i).AppendNull()
+		} else {
+			builder.Field(i).(*array.TimestampBuilder).Append(arrow.Timestamp(v.UnixMicro()))
+		}
+	}
+
+	base := time.Date(2025, 5, 1, 9, 30, 0, 0, time.UTC)
+	for i, row := range rows {
+		createdAt := base.Add(time.Duration(i) * 90 * time.Minute)
+		original := createdAt
+		if i == 4 {
+			original = time.Time{}
+		}
+		text(0, fmt.Sprintf("evt-%02d", i))
+		micros(1, createdAt)
+		text(2, row.company)
+		text(3, "")
+		text(4, row.eventType)
+		text(5, row.content)
+		text(6, row.attribute)
+		micros(7, createdAt.Add(time.Minute))
+		micros(8, original)
+		text(9, row.value)
+		if row.valueNumber == nil {
+			builder.Field(10).AppendNull()
+		} else {
+			builder.Field(10).(*array.Float64Builder).Append(*row.valueNumber)
+		}
+	}
+	record := builder.NewRecord()
+	defer record.Release()
+
+	options := []parquet.WriterProperty{
+		parquet.WithCompression(compress.Codecs.Gzip),
+		parquet.WithDataPageVersion(parquet.DataPageV1),
+		parquet.WithDictionaryDefault(false),
+	}
+	for _, column := range dictionaryColumns {
+		options = append(options, parquet.WithDictionaryFor(column, true))
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer, err := pqarrow.NewFileWriter(schema, out, parquet.NewWriterProperties(options...), pqarrow.DefaultWriterProps())
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := writer.Write(record); err != nil {
+		writer.Close()
+		return err
+	}
+	// Closing the writer closes the file
+	return writer.Close()
+}
+
+// check prints a file's schema and rows as Arrow reads them.
+func check(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader, err := file.NewParquetReader(f)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	fmt.Println(reader.MetaData().Schema)
+
+	fileReader, err := pqarrow.NewFileReader(reader, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		return err
+	}
+	table, err := fileReader.ReadTable(context.Background())
+	if err != nil {
+		return err
+	}
+	defer table.Release()
+
+	tableReader := array.NewTableReader(table, 0)
+	defer tableReader.Release()
+	for tableReader.Next() {
+		record := tableReader.Record()
+		for c, column := range record.Columns() {
+			fmt.Printf("%s: %v\n", record.ColumnName(c), column)
+		}
+	}
+	return tableReader.Err()
+}
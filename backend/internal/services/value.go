@@ -0,0 +1,39 @@
+package services
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseNumericValue converts raw event values such as "$100,187.00", "42" or
+// "12.5%" into a float. Empty and "null" values are reported as not numeric,
+// as are "NaN" and "Inf", which would break sorting and range comparisons.
+func parseNumericValue(raw string) (float64, bool) {
+	value := strings.TrimSpace(raw)
+	if value == "" || strings.EqualFold(value, "null") {
+		return 0, false
+	}
+
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+	}
+
+	value = strings.NewReplacer("$", "", ",", "", "%", "", " ", "").Replace(value)
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+
+	if negative {
+		number = -number
+	}
+	return number, true
+}
+
+func isNullValue(raw string) bool {
+	value := strings.TrimSpace(raw)
+	return value == "" || strings.EqualFold(value, "null")
+}
@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestParseNumericValue(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want float64
+		ok   bool
+	}{
+		{"42", 42, true},
+		{"$100,187.00", 100187, true},
+		{"12.5%", 12.5, true},
+		{"(250)", -250, true},
+		{"", 0, false},
+		{"null", 0, false},
+		{"abc", 0, false},
+		{"NaN", 0, false},
+		{"nan", 0, false},
+		{"Inf", 0, false},
+		{"-Inf", 0, false},
+		{"+Infinity", 0, false},
+		{"1e400", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseNumericValue(tt.raw)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseNumericValue(%q) = %v, %v; want %v, %v", tt.raw, got, ok, tt.want, tt.ok)
+		}
+	}
+}
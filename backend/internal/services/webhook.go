@@ -0,0 +1,137 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 3
+)
+
+// WebhookNotifier posts Slack-compatible messages: Slack renders "text" and
+// "attachments", other receivers can read the structured "alert" object.
+type WebhookNotifier struct {
+	client  *http.Client
+	backoff time.Duration
+}
+
+func NewWebhookNotifier() *WebhookNotifier {
+	return &WebhookNotifier{
+		client:  &http.Client{Timeout: webhookTimeout},
+		backoff: time.Second,
+	}
+}
+
+type webhookPayload struct {
+	Text        string              `json:"text"`
+	Attachments []webhookAttachment `json:"attachments,omitempty"`
+	Alert       *models.Alert       `json:"alert,omitempty"`
+}
+
+type webhookAttachment struct {
+	Color  string         `json:"color"`
+	Fields []webhookField `json:"fields"`
+	Ts     int64          `json:"ts"`
+}
+
+type webhookField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func alertPayload(alert models.Alert, companyName string) webhookPayload {
+	color, prefix := "#d00000", ":rotating_light: [FIRING]"
+	if alert.State == models.AlertResolved {
+		color, prefix = "#2eb886", ":white_check_mark: [RESOLVED]"
+	}
+
+	company := alert.CompanyID
+	if companyName != "" {
+		company = companyName + " (" + alert.CompanyID + ")"
+	}
+
+	return webhookPayload{
+		Text: fmt.Sprintf("%s %s: %s", prefix, alert.RuleName, alert.Message),
+		Attachments: []webhookAttachment{{
+			Color: color,
+			Fields: []webhookField{
+				{Title: "Rule", Value: alert.RuleName, Short: true},
+				{Title: "Company", Value: company, Short: true},
+				{Title: "Value", Value: fmt.Sprintf("%g", alert.Value), Short: true},
+				{Title: "State", Value: alert.State, Short: true},
+			},
+			Ts: time.Now().Unix(),
+		}},
+		Alert: &alert,
+	}
+}
+
+// Send posts payload to every URL, retrying failed deliveries with a growing
+// backoff. Each URL's outcome is returned.
+func (n *WebhookNotifier) Send(ctx context.Context, urls []string, payload interface{}) []models.WebhookDelivery {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		deliveries := make([]models.WebhookDelivery, len(urls))
+		for i, url := range urls {
+			deliveries[i] = models.WebhookDelivery{URL: url, Error: err.Error()}
+		}
+		return deliveries
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(urls))
+	for _, url := range urls {
+		deliveries = append(deliveries, n.post(ctx, url, body))
+	}
+	return deliveries
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, url string, body []byte) models.WebhookDelivery {
+	delivery := models.WebhookDelivery{URL: url}
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				delivery.Error = ctx.Err().Error()
+				return delivery
+			case <-time.After(n.backoff * time.Duration(attempt-1)):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			delivery.Error = err.Error()
+			return delivery
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			delivery.Error = err.Error()
+			continue
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		delivery.StatusCode = resp.StatusCode
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			delivery.Error = ""
+			return delivery
+		}
+		delivery.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			// Client errors will not go away by retrying
+			return delivery
+		}
+	}
+	return delivery
+}
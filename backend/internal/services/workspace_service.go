@@ -0,0 +1,451 @@
+package services
+
+import (
+	"assembly-dashboard-backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidWorkspace = errors.New("invalid workspace")
+	ErrWorkspaceExists  = errors.New("workspace already exists")
+	ErrDefaultWorkspace = errors.New("the default workspace is configured by environment and cannot be changed")
+)
+
+var workspaceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// IsWorkspaceID reports whether id can name a workspace: lower-case letters,
+// digits and dashes, as it is used in URLs and directory names.
+func IsWorkspaceID(id string) bool {
+	return workspaceIDPattern.MatchString(id)
+}
+
+// WorkspaceOptions are the settings every workspace is opened with.
+type WorkspaceOptions struct {
+	DataPath        string // data of the default workspace
+	StatePath       string // state of the default workspace; others keep theirs in StatePath/workspaces/<id>
+	DataRoot        string // directory the data paths of other workspaces are under
+	RedactionConfig string // redaction policies of the default workspace; others read redaction.json in their state
+	RedactionSalt   string
+	AlertWebhooks   []string      // default workspace's webhooks for rules without their own
+	AlertInterval   time.Duration // zero evaluates alerts on data loads only
+	ExportTTL       time.Duration
+	ExportWorkers   int
+	AuditRetention  time.Duration
+	Notifier        *WebhookNotifier
+	Mailer          Mailer
+	MailFrom        string
+}
+
+// Workspace is an open workspace: its settings and the services holding its
+// data. Workspaces share nothing but the mailer and webhook notifier, so one
+// tenant's events, indexes and state are never seen by another.
+type Workspace struct {
+	models.Workspace
+
+	Directory     *CompanyDirectory
+	Annotations   *AnnotationService
+	Analytics     *AnalyticsService
+	SavedSearches *SavedSearchService
+	Segments      *DynamicSegmentService
+	Alerts        *AlertService
+	Digests       *DigestService
+	ExportJobs    *ExportJobService
+	Audit         *ExportAuditLog
+	Redactor      *Redactor
+
+	// Handler serves the workspace's routes
+	Handler http.Handler
+
+	stop context.CancelFunc
+}
+
+// WorkspaceService keeps the workspaces, their settings in path and an open
+// set of services for each. routes builds the HTTP handler of a workspace
+// once its services are open.
+type WorkspaceService struct {
+	mu         sync.RWMutex
+	path       string
+	options    WorkspaceOptions
+	routes     func(*Workspace) http.Handler
+	workspaces map[string]*Workspace
+}
+
+func NewWorkspaceService(path string, options WorkspaceOptions, routes func(*Workspace) http.Handler) (*WorkspaceService, error) {
+	s := &WorkspaceService{
+		path:       path,
+		options:    options,
+		routes:     routes,
+		workspaces: make(map[string]*Workspace),
+	}
+
+	now := time.Now().UTC()
+	defaultWorkspace, err := s.open(models.Workspace{
+		ID:            models.DefaultWorkspace,
+		Name:          "Default",
+		DataPath:      options.DataPath,
+		AlertWebhooks: options.AlertWebhooks,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.workspaces[models.DefaultWorkspace] = defaultWorkspace
+
+	var stored []models.Workspace
+	if err := loadJSONFile(path, &stored); err != nil {
+		return nil, err
+	}
+	for _, record := range stored {
+		workspace, err := s.open(record)
+		if err != nil {
+			return nil, fmt.Errorf("workspace %s: %w", record.ID, err)
+		}
+		s.workspaces[record.ID] = workspace
+	}
+
+	return s, nil
+}
+
+// stateDir is where a workspace keeps its saved searches, alerts, exports and
+// other state.
+func (s *WorkspaceService) stateDir(id string) string {
+	if id == models.DefaultWorkspace {
+		return s.options.StatePath
+	}
+	return filepath.Join(s.options.StatePath, "workspaces", id)
+}
+
+// open creates the services of a workspace, loads its data and starts its
+// background work: alert evaluation, digests and export workers.
+func (s *WorkspaceService) open(record models.Workspace) (*Workspace, error) {
+	state := s.stateDir(record.ID)
+	workspace := &Workspace{Workspace: record}
+
+	var err error
+	if workspace.Directory, err = NewCompanyDirectory(filepath.Join(state, "company_metadata.json")); err != nil {
+		return nil, fmt.Errorf("failed to load company metadata: %w", err)
+	}
+	if workspace.Annotations, err = NewAnnotationService(filepath.Join(state, "annotations.json")); err != nil {
+		return nil, fmt.Errorf("failed to load annotations: %w", err)
+	}
+	workspace.Analytics = NewAnalyticsService(workspace.Directory, workspace.Annotations)
+
+	if workspace.SavedSearches, err = NewSavedSearchService(filepath.Join(state, "saved_searches.json")); err != nil {
+		return nil, fmt.Errorf("failed to load saved searches: %w", err)
+	}
+	workspace.Segments, err = NewDynamicSegmentService(
+		filepath.Join(state, "dynamic_segments.json"),
+		filepath.Join(state, "segment_history.json"),
+		workspace.Directory,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dynamic segments: %w", err)
+	}
+	workspace.Alerts, err = NewAlertService(
+		filepath.Join(state, "alert_rules.json"),
+		filepath.Join(state, "alert_state.json"),
+		workspace.Directory,
+		s.options.Notifier,
+		record.AlertWebhooks,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load alert rules: %w", err)
+	}
+
+	scheduler := NewScheduler()
+	workspace.Digests, err = NewDigestService(
+		filepath.Join(state, "digests.json"),
+		workspace.Analytics,
+		workspace.Directory,
+		scheduler,
+		s.options.Mailer,
+		s.options.MailFrom,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load digest schedules: %w", err)
+	}
+
+	redactionConfig := filepath.Join(state, "redaction.json")
+	if record.ID == models.DefaultWorkspace && s.options.RedactionConfig != "" {
+		redactionConfig = s.options.RedactionConfig
+	}
+	if workspace.Redactor, err = NewRedactor(redactionConfig, s.options.RedactionSalt); err != nil {
+		return nil, fmt.Errorf("failed to load redaction policies: %w", err)
+	}
+
+	if workspace.Audit, err = NewExportAuditLog(filepath.Join(state, "export_audit.log"), s.options.AuditRetention); err != nil {
+		return nil, fmt.Errorf("failed to open export audit log: %w", err)
+	}
+	if err := workspace.Audit.Prune(context.Background()); err != nil {
+		log.Printf("Warning: failed to prune export audit log of workspace %s: %v", record.ID, err)
+	}
+	workspace.ExportJobs, err = NewExportJobService(filepath.Join(state, "exports"), s.options.ExportTTL, workspace.Analytics, workspace.Audit, workspace.Redactor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load export jobs: %w", err)
+	}
+
+	workspace.Analytics.OnDataLoad(workspace.Directory.InferNames)
+	workspace.Analytics.OnDataLoad(workspace.Segments.Evaluate)
+	workspace.Analytics.OnDataLoad(workspace.Alerts.OnDataLoad)
+
+	if err := workspace.Analytics.Initialize(record.DataPath); err != nil {
+		log.Printf("Warning: workspace %s: %v", record.ID, err)
+		log.Printf("Workspace %s will use mock data", record.ID)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	workspace.stop = stop
+	if s.options.AlertInterval > 0 {
+		go workspace.Alerts.RunEvery(ctx, s.options.AlertInterval)
+	}
+	// Expired export files are removed every few minutes, and audit entries
+	// past their retention once a day
+	exportCleanup, _ := ParseCron("*/5 * * * *")
+	scheduler.Set("export-cleanup", exportCleanup, time.UTC, workspace.ExportJobs.Cleanup)
+	auditPrune, _ := ParseCron("30 3 * * *")
+	scheduler.Set("export-audit-retention", auditPrune, time.UTC, workspace.Audit.Prune)
+	go scheduler.Run(ctx)
+	go workspace.ExportJobs.Run(ctx, s.options.ExportWorkers)
+
+	workspace.Handler = s.routes(workspace)
+	return workspace, nil
+}
+
+// close stops a workspace's background work, cancelling exports in progress.
+func (w *Workspace) close() {
+	w.stop()
+}
+
+// Get returns an open workspace.
+func (s *WorkspaceService) Get(id string) (*Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		return nil, fmt.Errorf("workspace %s: %w", id, ErrNotFound)
+	}
+	return workspace, nil
+}
+
+// Exists reports whether a workspace exists.
+func (s *WorkspaceService) Exists(id string) bool {
+	_, err := s.Get(id)
+	return err == nil
+}
+
+// List returns the workspaces, the default one first and the rest by ID,
+// with the datasets they have loaded.
+func (s *WorkspaceService) List() []models.Workspace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspaces := make([]models.Workspace, 0, len(s.workspaces))
+	for _, workspace := range s.workspaces {
+		workspaces = append(workspaces, workspace.info())
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		if (workspaces[i].ID == models.DefaultWorkspace) != (workspaces[j].ID == models.DefaultWorkspace) {
+			return workspaces[i].ID == models.DefaultWorkspace
+		}
+		return workspaces[i].ID < workspaces[j].ID
+	})
+	return workspaces
+}
+
+// Info describes a workspace and the dataset it has loaded.
+func (s *WorkspaceService) Info(id string) (models.Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		return models.Workspace{}, fmt.Errorf("workspace %s: %w", id, ErrNotFound)
+	}
+	return workspace.info(), nil
+}
+
+// info must be called with the service's lock held, as updates change the
+// settings in place.
+func (w *Workspace) info() models.Workspace {
+	info := w.Workspace
+	dataset := w.Analytics.GetDatasetInfo()
+	info.Dataset = &dataset
+	return info
+}
+
+// Create adds a workspace and opens it. Its data directory is created if it
+// does not exist yet, so CSV files can be dropped in and reloaded.
+func (s *WorkspaceService) Create(request models.WorkspaceRequest) (models.Workspace, error) {
+	id := strings.TrimSpace(request.ID)
+	if id == models.DefaultWorkspace {
+		return models.Workspace{}, fmt.Errorf("workspace %s: %w", id, ErrWorkspaceExists)
+	}
+	dataPath, err := s.resolveDataPath(request.DataPath, id)
+	if err != nil {
+		return models.Workspace{}, err
+	}
+	if err := os.MkdirAll(dataPath, 0o755); err != nil {
+		return models.Workspace{}, fmt.Errorf("failed to create data directory %s: %w", dataPath, err)
+	}
+
+	now := time.Now().UTC()
+	record := models.Workspace{
+		ID:            id,
+		Name:          strings.TrimSpace(request.Name),
+		DataPath:      dataPath,
+		AlertWebhooks: request.AlertWebhooks,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if record.Name == "" {
+		record.Name = id
+	}
+
+	if s.Exists(id) {
+		return models.Workspace{}, fmt.Errorf("workspace %s: %w", id, ErrWorkspaceExists)
+	}
+	// Loading the data can take a while, so the other workspaces keep
+	// serving requests in the meantime
+	workspace, err := s.open(record)
+	if err != nil {
+		return models.Workspace{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.workspaces[id]; exists {
+		workspace.close()
+		return models.Workspace{}, fmt.Errorf("workspace %s: %w", id, ErrWorkspaceExists)
+	}
+	s.workspaces[id] = workspace
+	if err := s.save(); err != nil {
+		workspace.close()
+		delete(s.workspaces, id)
+		return models.Workspace{}, err
+	}
+	return workspace.info(), nil
+}
+
+// Update replaces a workspace's settings, with the same defaults as Create.
+// A new data directory is loaded straight away; if it holds no usable data
+// yet, the workspace keeps the dataset it had until it is reloaded.
+func (s *WorkspaceService) Update(id string, request models.WorkspaceRequest) (models.Workspace, error) {
+	if id == models.DefaultWorkspace {
+		return models.Workspace{}, ErrDefaultWorkspace
+	}
+	dataPath, err := s.resolveDataPath(request.DataPath, id)
+	if err != nil {
+		return models.Workspace{}, err
+	}
+
+	s.mu.Lock()
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		s.mu.Unlock()
+		return models.Workspace{}, fmt.Errorf("workspace %s: %w", id, ErrNotFound)
+	}
+	previous := workspace.Workspace
+	workspace.Name = strings.TrimSpace(request.Name)
+	if workspace.Name == "" {
+		workspace.Name = id
+	}
+	workspace.DataPath = dataPath
+	workspace.AlertWebhooks = request.AlertWebhooks
+	workspace.UpdatedAt = time.Now().UTC()
+	if err := s.save(); err != nil {
+		workspace.Workspace = previous
+		s.mu.Unlock()
+		return models.Workspace{}, err
+	}
+	s.mu.Unlock()
+
+	workspace.Alerts.SetDefaultWebhooks(request.AlertWebhooks)
+	if dataPath != previous.DataPath {
+		if err := os.MkdirAll(dataPath, 0o755); err != nil {
+			log.Printf("Warning: failed to create data directory %s: %v", dataPath, err)
+		}
+		if err := workspace.Analytics.Initialize(dataPath); err != nil {
+			log.Printf("Warning: workspace %s: %v", id, err)
+		}
+	}
+	return s.Info(id)
+}
+
+// Delete closes a workspace, cancelling its exports in progress, and forgets
+// it. Its data and state directories are left on disk, so creating a
+// workspace with the same ID brings its state back.
+func (s *WorkspaceService) Delete(id string) error {
+	if id == models.DefaultWorkspace {
+		return ErrDefaultWorkspace
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		return fmt.Errorf("workspace %s: %w", id, ErrNotFound)
+	}
+	delete(s.workspaces, id)
+	if err := s.save(); err != nil {
+		s.workspaces[id] = workspace
+		return err
+	}
+	workspace.close()
+	return nil
+}
+
+// resolveDataPath turns a requested data path into a directory under the
+// data root. Paths may be relative to the root or absolute within it; an
+// empty path means the directory named after the workspace.
+func (s *WorkspaceService) resolveDataPath(requested, id string) (string, error) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		requested = id
+	}
+	root, err := filepath.Abs(s.options.DataRoot)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve workspace data root: %w", err)
+	}
+	path := requested
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(root, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: data_path must be a directory inside %s", ErrInvalidWorkspace, root)
+	}
+	return path, nil
+}
+
+// save must be called with the write lock held. The default workspace is
+// configured by environment and is not stored.
+func (s *WorkspaceService) save() error {
+	records := make([]models.Workspace, 0, len(s.workspaces))
+	for id, workspace := range s.workspaces {
+		if id != models.DefaultWorkspace {
+			record := workspace.Workspace
+			record.Dataset = nil
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+
+	return saveJSONFile(s.path, records)
+}
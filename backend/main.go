@@ -3,56 +3,343 @@ package main
 import (
 	"assembly-dashboard-backend/internal/config"
 	"assembly-dashboard-backend/internal/handlers"
+	"assembly-dashboard-backend/internal/models"
 	"assembly-dashboard-backend/internal/services"
+	"errors"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+// maxRequestBody is the largest request body accepted, matching the 1MB
+// limit on headers that already bounds GET requests.
+const maxRequestBody = 1 << 20
+
 func main() {
 	// Load configuration
 	cfg := config.Load()
 	gin.SetMode(cfg.GinMode)
 
-	// Initialize services
-	analyticsService := services.NewAnalyticsService()
+	exportTTL, err := time.ParseDuration(cfg.ExportTTL)
+	if err != nil || exportTTL <= 0 {
+		log.Fatalf("Invalid EXPORT_TTL %q", cfg.ExportTTL)
+	}
+	exportWorkers, err := strconv.Atoi(cfg.ExportWorkers)
+	if err != nil || exportWorkers < 1 {
+		log.Fatalf("Invalid EXPORT_WORKERS %q", cfg.ExportWorkers)
+	}
+	auditRetention, err := time.ParseDuration(cfg.ExportAuditRetention)
+	if err != nil || auditRetention <= 0 {
+		log.Fatalf("Invalid EXPORT_AUDIT_RETENTION %q", cfg.ExportAuditRetention)
+	}
+	// Alerts are evaluated on a schedule as well, if configured
+	var alertInterval time.Duration
+	if cfg.AlertInterval != "" {
+		alertInterval, err = time.ParseDuration(cfg.AlertInterval)
+		if err != nil || alertInterval <= 0 {
+			log.Fatalf("Invalid ALERT_INTERVAL %q", cfg.AlertInterval)
+		}
+	}
+	workspacesDataPath := cfg.WorkspacesDataPath
+	if workspacesDataPath == "" {
+		workspacesDataPath = filepath.Join(cfg.DataPath, "workspaces")
+	}
 
-	// Initialize data loading
-	if err := analyticsService.Initialize(cfg.DataPath); err != nil {
-		log.Printf("Warning: Failed to load CSV data: %v", err)
-		log.Println("Dashboard will use mock data")
+	authService, err := services.NewAuthService(filepath.Join(cfg.StatePath, "api_keys.json"), services.JWTConfig{
+		Secret:   []byte(cfg.JWTSecret),
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+	})
+	if err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+	// Without an admin key or tokens nobody could create keys, so a fresh
+	// install gets one admin key. Its secret goes to a file only the
+	// service's user can read rather than to the logs, which are usually
+	// collected and kept elsewhere.
+	if cfg.JWTSecret == "" && !authService.HasActiveAdmin() {
+		key, err := authService.CreateKey(models.APIKeyRequest{Name: "bootstrap-admin", Role: models.RoleAdmin}, "")
+		if err != nil {
+			log.Fatalf("Failed to create admin API key: %v", err)
+		}
+		path := filepath.Join(cfg.StatePath, "bootstrap_admin_key")
+		if err := writeSecretFile(path, key.Key); err != nil {
+			// A key nobody can read would block the next bootstrap
+			if _, revokeErr := authService.RevokeKey(key.ID); revokeErr != nil {
+				log.Printf("Warning: failed to revoke admin API key %s: %v", key.ID, revokeErr)
+			}
+			log.Fatalf("Failed to write admin API key: %v", err)
+		}
+		log.Printf("Created admin API key %s; its secret is in %s, delete the file once it is stored safely", key.ID, path)
 	}
+	authHandler := handlers.NewAuthHandler(authService)
 
-	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
+	// Initialize workspaces, each with its own services and data. The
+	// default one reads DATA_PATH and keeps its state in STATE_PATH.
+	workspaceService, err := services.NewWorkspaceService(filepath.Join(cfg.StatePath, "workspaces.json"), services.WorkspaceOptions{
+		DataPath:        cfg.DataPath,
+		StatePath:       cfg.StatePath,
+		DataRoot:        workspacesDataPath,
+		RedactionConfig: cfg.RedactionConfig,
+		RedactionSalt:   cfg.RedactionSalt,
+		AlertWebhooks:   splitList(cfg.AlertWebhooks),
+		AlertInterval:   alertInterval,
+		ExportTTL:       exportTTL,
+		ExportWorkers:   exportWorkers,
+		AuditRetention:  auditRetention,
+		Notifier:        services.NewWebhookNotifier(),
+		Mailer:          newMailer(cfg),
+		MailFrom:        cfg.SMTPFrom,
+	}, func(workspace *services.Workspace) http.Handler {
+		router := gin.New()
+		router.Use(gin.Recovery())
+		registerRoutes(router.Group("/api/v1/workspaces/"+workspace.ID), workspace, authHandler)
+		return router
+	})
+	if err != nil {
+		log.Fatalf("Failed to open workspaces: %v", err)
+	}
+	authHandler.SetWorkspaces(workspaceService)
+	defaultWorkspace, err := workspaceService.Get(models.DefaultWorkspace)
+	if err != nil {
+		log.Fatalf("Failed to open the default workspace: %v", err)
+	}
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceService)
 
 	// Initialize Gin router
 	router := gin.Default()
 
-	// CORS middleware
+	// CORS middleware. Credentials travel in headers rather than cookies, so
+	// browsers are not asked to send cookies along.
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
+		AllowOrigins:     splitList(cfg.CORSOrigins),
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Disposition"},
-		AllowCredentials: true,
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "Location", "X-Redaction-Policy"},
+		AllowCredentials: false,
 	}))
 
+	// JSON bodies are small; capping them keeps oversized filters and queries
+	// out of the parsers. Workspace routes are reached through this router.
+	router.Use(handlers.LimitBody(maxRequestBody))
+
 	// Routes
 	api := router.Group("/api/v1")
 	{
-		api.GET("/health", analyticsHandler.HealthCheck)
-		api.GET("/dashboard/summary", analyticsHandler.GetDashboardSummary)
-		api.GET("/events/search", analyticsHandler.SearchEvents)
-		api.POST("/export", analyticsHandler.ExportData)
+		api.GET("/health", handlers.HealthCheck)
+
+		viewer := api.Group("", authHandler.Authenticate, handlers.Require(models.RoleViewer))
+		admin := api.Group("", authHandler.Authenticate, handlers.Require(models.RoleAdmin))
+
+		viewer.GET("/auth/me", authHandler.GetCurrentPrincipal)
+		admin.GET("/auth/keys", authHandler.ListKeys)
+		admin.POST("/auth/keys", authHandler.CreateKey)
+		admin.GET("/auth/keys/:id", authHandler.GetKey)
+		admin.DELETE("/auth/keys/:id", authHandler.RevokeKey)
+
+		admin.GET("/workspaces", workspaceHandler.ListWorkspaces)
+		admin.POST("/workspaces", workspaceHandler.CreateWorkspace)
+		admin.GET("/workspaces/:ws", workspaceHandler.GetWorkspace)
+		admin.PUT("/workspaces/:ws", workspaceHandler.UpdateWorkspace)
+		admin.DELETE("/workspaces/:ws", workspaceHandler.DeleteWorkspace)
+		// Every workspace serves the routes below under its own prefix
+		api.Any("/workspaces/:ws/*path", authHandler.Authenticate, workspaceHandler.Dispatch)
+
+		registerRoutes(api, defaultWorkspace, authHandler)
 	}
 
 	// Start server
 	log.Printf("Server starting on port %s", cfg.Port)
 	log.Printf("Available endpoints:")
 	log.Printf("  GET  /api/v1/health")
+	log.Printf("  GET  /api/v1/auth/me")
+	log.Printf("  GET  /api/v1/auth/keys")
+	log.Printf("  POST /api/v1/auth/keys")
+	log.Printf("  GET  /api/v1/auth/keys/:id")
+	log.Printf("  DELETE /api/v1/auth/keys/:id")
+	log.Printf("  GET  /api/v1/workspaces")
+	log.Printf("  POST /api/v1/workspaces")
+	log.Printf("  GET  /api/v1/workspaces/:ws")
+	log.Printf("  PUT  /api/v1/workspaces/:ws")
+	log.Printf("  DELETE /api/v1/workspaces/:ws")
+	log.Printf("Workspace endpoints, for the default workspace as shown and for others under /api/v1/workspaces/:ws:")
 	log.Printf("  GET  /api/v1/dashboard/summary")
 	log.Printf("  GET  /api/v1/events/search")
 	log.Printf("  POST /api/v1/export")
+	log.Printf("  GET  /api/v1/exports")
+	log.Printf("  POST /api/v1/exports")
+	log.Printf("  GET  /api/v1/exports/audit")
+	log.Printf("  GET  /api/v1/exports/:id")
+	log.Printf("  GET  /api/v1/exports/:id/download")
+	log.Printf("  POST /api/v1/exports/:id/cancel")
+	log.Printf("  DELETE /api/v1/exports/:id")
+	log.Printf("  POST /api/v1/data/reload")
+	log.Printf("  GET  /api/v1/redaction")
+	log.Printf("  GET  /api/v1/segments")
+	log.Printf("  POST /api/v1/segments")
+	log.Printf("  GET  /api/v1/segments/:id")
+	log.Printf("  PUT  /api/v1/segments/:id")
+	log.Printf("  DELETE /api/v1/segments/:id")
+	log.Printf("  GET  /api/v1/companies")
+	log.Printf("  GET  /api/v1/companies/:id")
+	log.Printf("  GET  /api/v1/companies/:id/timeline")
+	log.Printf("  GET  /api/v1/companies/:id/report")
+	log.Printf("  POST /api/v1/companies/metadata")
+	log.Printf("  GET  /api/v1/annotations")
+	log.Printf("  POST /api/v1/annotations")
+	log.Printf("  GET  /api/v1/annotations/:id")
+	log.Printf("  DELETE /api/v1/annotations/:id")
+	log.Printf("  GET  /api/v1/alerts")
+	log.Printf("  GET  /api/v1/alerts/history")
+	log.Printf("  POST /api/v1/alerts/evaluate")
+	log.Printf("  GET  /api/v1/alerts/rules")
+	log.Printf("  POST /api/v1/alerts/rules")
+	log.Printf("  GET  /api/v1/alerts/rules/:id")
+	log.Printf("  PUT  /api/v1/alerts/rules/:id")
+	log.Printf("  DELETE /api/v1/alerts/rules/:id")
+	log.Printf("  POST /api/v1/alerts/rules/:id/test")
+	log.Printf("  GET  /api/v1/digests")
+	log.Printf("  POST /api/v1/digests")
+	log.Printf("  GET  /api/v1/digests/:id")
+	log.Printf("  PUT  /api/v1/digests/:id")
+	log.Printf("  DELETE /api/v1/digests/:id")
+	log.Printf("  POST /api/v1/digests/:id/send")
+	log.Printf("  GET  /api/v1/digests/:id/preview")
+	log.Printf("  GET  /api/v1/dynamic-segments")
+	log.Printf("  POST /api/v1/dynamic-segments")
+	log.Printf("  GET  /api/v1/dynamic-segments/:id")
+	log.Printf("  PUT  /api/v1/dynamic-segments/:id")
+	log.Printf("  DELETE /api/v1/dynamic-segments/:id")
+	log.Printf("  GET  /api/v1/dynamic-segments/:id/history")
 	log.Fatal(router.Run(":" + cfg.Port))
 }
+
+// registerRoutes adds the routes of a workspace to api. Every route needs
+// credentials that may use the workspace, and a role of at least viewer
+// (reading), analyst (exporting and editing) or admin.
+func registerRoutes(api *gin.RouterGroup, workspace *services.Workspace, authHandler *handlers.AuthHandler) {
+	analyticsHandler := handlers.NewAnalyticsHandler(workspace.Analytics, workspace.SavedSearches, workspace.ExportJobs, workspace.Audit, workspace.Redactor)
+	dynamicSegmentHandler := handlers.NewDynamicSegmentHandler(workspace.Segments)
+	companyHandler := handlers.NewCompanyHandler(workspace.Directory, workspace.Segments)
+	annotationHandler := handlers.NewAnnotationHandler(workspace.Annotations)
+	alertHandler := handlers.NewAlertHandler(workspace.Alerts)
+	digestHandler := handlers.NewDigestHandler(workspace.Digests)
+
+	member := handlers.RequireWorkspace(workspace.ID)
+	viewer := api.Group("", authHandler.Authenticate, member, handlers.Require(models.RoleViewer))
+	analyst := api.Group("", authHandler.Authenticate, member, handlers.Require(models.RoleAnalyst))
+	admin := api.Group("", authHandler.Authenticate, member, handlers.Require(models.RoleAdmin))
+
+	viewer.GET("/dashboard/summary", analyticsHandler.GetDashboardSummary)
+	viewer.GET("/events/search", analyticsHandler.SearchEvents)
+	analyst.POST("/export", analyticsHandler.ExportData)
+	analyst.GET("/exports", analyticsHandler.ListExports)
+	analyst.POST("/exports", analyticsHandler.CreateExport)
+	admin.GET("/exports/audit", analyticsHandler.GetExportAudit)
+	analyst.GET("/exports/:id", analyticsHandler.GetExport)
+	analyst.GET("/exports/:id/download", analyticsHandler.DownloadExport)
+	analyst.POST("/exports/:id/cancel", analyticsHandler.CancelExport)
+	analyst.DELETE("/exports/:id", analyticsHandler.DeleteExport)
+	admin.POST("/data/reload", analyticsHandler.ReloadData)
+	admin.GET("/redaction", analyticsHandler.GetRedactionConfig)
+
+	viewer.GET("/segments", analyticsHandler.ListSavedSearches)
+	analyst.POST("/segments", analyticsHandler.CreateSavedSearch)
+	viewer.GET("/segments/:id", analyticsHandler.GetSavedSearch)
+	analyst.PUT("/segments/:id", analyticsHandler.UpdateSavedSearch)
+	analyst.DELETE("/segments/:id", analyticsHandler.DeleteSavedSearch)
+
+	viewer.GET("/companies", companyHandler.ListCompanies)
+	viewer.GET("/companies/:id", companyHandler.GetCompany)
+	viewer.GET("/companies/:id/timeline", analyticsHandler.GetCompanyTimeline)
+	viewer.GET("/companies/:id/report", analyticsHandler.GetCompanyReport)
+	admin.POST("/companies/metadata", companyHandler.ImportMetadata)
+
+	viewer.GET("/annotations", annotationHandler.ListAnnotations)
+	analyst.POST("/annotations", annotationHandler.CreateAnnotation)
+	viewer.GET("/annotations/:id", annotationHandler.GetAnnotation)
+	analyst.DELETE("/annotations/:id", annotationHandler.DeleteAnnotation)
+
+	viewer.GET("/alerts", alertHandler.ListAlerts)
+	viewer.GET("/alerts/history", alertHandler.GetHistory)
+	analyst.POST("/alerts/evaluate", alertHandler.Evaluate)
+	viewer.GET("/alerts/rules", alertHandler.ListRules)
+	analyst.POST("/alerts/rules", alertHandler.CreateRule)
+	viewer.GET("/alerts/rules/:id", alertHandler.GetRule)
+	analyst.PUT("/alerts/rules/:id", alertHandler.UpdateRule)
+	analyst.DELETE("/alerts/rules/:id", alertHandler.DeleteRule)
+	analyst.POST("/alerts/rules/:id/test", alertHandler.TestRule)
+
+	viewer.GET("/digests", digestHandler.ListDigests)
+	analyst.POST("/digests", digestHandler.CreateDigest)
+	viewer.GET("/digests/:id", digestHandler.GetDigest)
+	analyst.PUT("/digests/:id", digestHandler.UpdateDigest)
+	analyst.DELETE("/digests/:id", digestHandler.DeleteDigest)
+	analyst.POST("/digests/:id/send", digestHandler.SendDigest)
+	viewer.GET("/digests/:id/preview", digestHandler.PreviewDigest)
+
+	viewer.GET("/dynamic-segments", dynamicSegmentHandler.ListSegments)
+	analyst.POST("/dynamic-segments", dynamicSegmentHandler.CreateSegment)
+	viewer.GET("/dynamic-segments/:id", dynamicSegmentHandler.GetSegment)
+	analyst.PUT("/dynamic-segments/:id", dynamicSegmentHandler.UpdateSegment)
+	analyst.DELETE("/dynamic-segments/:id", dynamicSegmentHandler.DeleteSegment)
+	viewer.GET("/dynamic-segments/:id/history", dynamicSegmentHandler.GetSegmentHistory)
+}
+
+// newMailer sends digests over SMTP when a host is configured, and writes
+// them to disk otherwise.
+func newMailer(cfg *config.Config) services.Mailer {
+	if cfg.DigestDryRun != "" {
+		log.Printf("Digests will be written to %s (dry run)", cfg.DigestDryRun)
+		return &services.DryRunMailer{Dir: cfg.DigestDryRun}
+	}
+	if cfg.SMTPHost == "" {
+		dir := filepath.Join(cfg.StatePath, "outbox")
+		log.Printf("SMTP_HOST not set; digests will be written to %s", dir)
+		return &services.DryRunMailer{Dir: dir}
+	}
+	return &services.SMTPMailer{
+		Addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+	}
+}
+
+// writeSecretFile writes secret to path readable by its owner only,
+// replacing any file left from an earlier install.
+func writeSecretFile(path, secret string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(secret + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// splitList parses a comma-separated configuration value.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,11 +1,44 @@
 package utils
 
-import "github.com/gin-gonic/gin"
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
 
 type APIResponse struct {
-	Status  string      `json:"status"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    interface{}  `json:"data,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a machine-readable description of one problem with a request.
+// Field is empty for errors that are not tied to a particular parameter.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every problem found in a request so clients can
+// fix them all at once instead of one round trip per typo.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, err := range v {
+		if err.Field != "" {
+			messages[i] = err.Field + ": " + err.Message
+		} else {
+			messages[i] = err.Message
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (v *ValidationErrors) Add(field, code, message string) {
+	*v = append(*v, FieldError{Field: field, Code: code, Message: message})
 }
 
 func JSONResponse(c *gin.Context, statusCode int, message string, data interface{}) {
@@ -21,3 +54,13 @@ func JSONResponse(c *gin.Context, statusCode int, message string, data interface
 
 	c.JSON(statusCode, response)
 }
+
+// ErrorResponse writes the error envelope shared by every endpoint:
+// {"status": "error", "message": ..., "errors": [{field, code, message}]}.
+func ErrorResponse(c *gin.Context, statusCode int, message string, errs ...FieldError) {
+	c.JSON(statusCode, APIResponse{
+		Status:  "error",
+		Message: message,
+		Errors:  errs,
+	})
+}
@@ -1,8 +1,61 @@
-import React from 'react';
+import React, { useEffect, useState } from 'react';
 import { Dashboard } from './components/layout/Dashboard';
+import { SignIn } from './components/auth/SignIn';
+import { LoadingSpinner } from './components/common/LoadingSpinner';
+import { Principal } from './types/usage';
+import {
+  apiService,
+  hasCredential,
+  setSignedOutHandler,
+  signOut,
+} from './services/api';
 
 function App() {
-  return <Dashboard />;
+  const [principal, setPrincipal] = useState<Principal | null>(null);
+  const [restoring, setRestoring] = useState(hasCredential());
+  const [message, setMessage] = useState<string | undefined>();
+
+  useEffect(() => {
+    setSignedOutHandler(() => {
+      setPrincipal(null);
+      setMessage('Your session has ended. Please sign in again.');
+    });
+
+    // A credential stored earlier in this tab survives a page reload
+    if (hasCredential()) {
+      apiService
+        .me()
+        .then(setPrincipal)
+        .catch(() => signOut())
+        .finally(() => setRestoring(false));
+    }
+  }, []);
+
+  if (restoring) {
+    return <LoadingSpinner message="Signing in..." />;
+  }
+
+  if (!principal) {
+    return (
+      <SignIn
+        message={message}
+        onSignIn={(p) => {
+          setMessage(undefined);
+          setPrincipal(p);
+        }}
+      />
+    );
+  }
+
+  return (
+    <Dashboard
+      principal={principal}
+      onSignOut={() => {
+        signOut();
+        setPrincipal(null);
+      }}
+    />
+  );
 }
 
 export default App;
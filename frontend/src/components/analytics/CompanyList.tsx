@@ -120,7 +120,9 @@ export const CompanyList: React.FC<CompanyListProps> = ({
       {companies.map((company) => (
         <CompanyItem key={company.company_id}>
           <div className="company-header">
-            <span className="company-id">{company.company_id}</span>
+            <span className="company-id" title={company.company_id}>
+              {company.company?.name || company.company_id}
+            </span>
             <span className="event-count">{company.event_count} events</span>
           </div>
           <div className="last-activity">
@@ -0,0 +1,118 @@
+import React, { useState } from "react";
+import styled from "styled-components";
+import { Principal } from "../../types/usage";
+import { apiService } from "../../services/api";
+
+const Container = styled.div`
+  max-width: 420px;
+  margin: 80px auto;
+  padding: 30px;
+  background: white;
+  border-radius: 8px;
+  box-shadow: 0 2px 10px rgba(0, 0, 0, 0.1);
+  border: 1px solid #e1e8ed;
+  font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", "Roboto",
+    sans-serif;
+
+  h1 {
+    color: #2c3e50;
+    font-size: 1.5rem;
+    margin-bottom: 10px;
+  }
+
+  p {
+    color: #7f8c8d;
+    font-size: 0.9rem;
+    margin-bottom: 20px;
+  }
+`;
+
+const Input = styled.input`
+  width: 100%;
+  box-sizing: border-box;
+  padding: 10px;
+  border: 1px solid #e1e8ed;
+  border-radius: 4px;
+  font-family: monospace;
+  font-size: 0.9rem;
+  margin-bottom: 15px;
+`;
+
+const Button = styled.button`
+  background: #3498db;
+  color: white;
+  border: none;
+  padding: 10px 20px;
+  border-radius: 4px;
+  cursor: pointer;
+  font-size: 1rem;
+  transition: opacity 0.2s ease;
+
+  &:hover {
+    opacity: 0.8;
+  }
+
+  &:disabled {
+    opacity: 0.5;
+    cursor: not-allowed;
+  }
+`;
+
+const ErrorMessage = styled.div`
+  background: #fee;
+  color: #c53030;
+  padding: 10px;
+  border-radius: 4px;
+  border: 1px solid #fed7d7;
+  margin-bottom: 15px;
+  font-size: 0.9rem;
+`;
+
+interface SignInProps {
+  message?: string;
+  onSignIn: (principal: Principal) => void;
+}
+
+// SignIn asks for the API key or token issued to the user. Nothing is
+// stored until the API has accepted it.
+export const SignIn: React.FC<SignInProps> = ({ message, onSignIn }) => {
+  const [credential, setCredential] = useState("");
+  const [error, setError] = useState<string | null>(message ?? null);
+  const [submitting, setSubmitting] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setSubmitting(true);
+    setError(null);
+    try {
+      onSignIn(await apiService.signIn(credential.trim()));
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Sign-in failed");
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <Container>
+      <h1>Sign in</h1>
+      <p>
+        Paste the API key or token you were given. It is kept for this browser
+        tab only.
+      </p>
+      {error && <ErrorMessage>{error}</ErrorMessage>}
+      <form onSubmit={handleSubmit}>
+        <Input
+          type="password"
+          autoComplete="off"
+          placeholder="adk_… or token"
+          value={credential}
+          onChange={(e) => setCredential(e.target.value)}
+        />
+        <Button type="submit" disabled={submitting || !credential.trim()}>
+          {submitting ? "Signing in..." : "Sign in"}
+        </Button>
+      </form>
+    </Container>
+  );
+};
@@ -178,6 +178,22 @@ const ActionButton = styled.button<{ $variant?: "primary" | "secondary" }>`
   `}
 `;
 
+const SearchOptions = styled.div`
+  display: flex;
+  gap: 16px;
+  margin-top: 8px;
+
+  label {
+    display: flex;
+    align-items: center;
+    gap: 6px;
+    font-size: 0.85rem;
+    font-weight: normal;
+    color: #7f8c8d;
+    cursor: pointer;
+  }
+`;
+
 interface FilterPanelProps {
   filters: FilterParams;
   availableFilters: AvailableFilters;
@@ -250,6 +266,31 @@ export const FilterPanel: React.FC<FilterPanelProps> = ({
               handleFilterChange("search_text", e.target.value || undefined)
             }
           />
+          <SearchOptions>
+            <label>
+              <input
+                type="checkbox"
+                checked={filters.case_sensitive || false}
+                onChange={(e) =>
+                  handleFilterChange(
+                    "case_sensitive",
+                    e.target.checked || undefined
+                  )
+                }
+              />
+              Match case
+            </label>
+            <label>
+              <input
+                type="checkbox"
+                checked={filters.whole_word || false}
+                onChange={(e) =>
+                  handleFilterChange("whole_word", e.target.checked || undefined)
+                }
+              />
+              Whole words
+            </label>
+          </SearchOptions>
         </FilterGroup>
 
         <FilterGroup>
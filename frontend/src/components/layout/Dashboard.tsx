@@ -6,6 +6,7 @@ import {
   FilteredResults,
   AvailableFilters,
   ExportRequest,
+  Principal,
 } from "../../types/usage";
 import { apiService } from "../../services/api";
 import { LoadingSpinner } from "../common/LoadingSpinner";
@@ -50,6 +51,22 @@ const Header = styled.header`
   }
 `;
 
+const SessionInfo = styled.div`
+  margin-top: 10px;
+  color: #7f8c8d;
+  font-size: 0.9rem;
+
+  button {
+    background: none;
+    border: none;
+    color: #2980b9;
+    cursor: pointer;
+    font-size: 0.9rem;
+    padding: 0;
+    margin-left: 8px;
+  }
+`;
+
 const ControlsSection = styled.div`
   background: white;
   padding: 20px;
@@ -259,7 +276,15 @@ const DASHBOARD_TABS: DashboardTab[] = [
   { id: "search", label: "Search & Filter" },
 ];
 
-export const Dashboard: React.FC = () => {
+interface DashboardProps {
+  principal: Principal;
+  onSignOut: () => void;
+}
+
+export const Dashboard: React.FC<DashboardProps> = ({
+  principal,
+  onSignOut,
+}) => {
   // Core dashboard state
   const [summary, setSummary] = useState<DashboardSummary | null>(null);
   const [loading, setLoading] = useState(true);
@@ -424,6 +449,13 @@ export const Dashboard: React.FC = () => {
     }
   };
 
+  const sessionInfo = (
+    <SessionInfo>
+      Signed in as {principal.subject} ({principal.role}){" "}
+      <button onClick={onSignOut}>Sign out</button>
+    </SessionInfo>
+  );
+
   if (loading) {
     return <LoadingSpinner message="Loading dashboard data..." />;
   }
@@ -432,6 +464,7 @@ export const Dashboard: React.FC = () => {
     return (
       <DashboardContainer>
         <ErrorMessage>Error: {error}</ErrorMessage>
+        {sessionInfo}
       </DashboardContainer>
     );
   }
@@ -440,6 +473,7 @@ export const Dashboard: React.FC = () => {
     return (
       <DashboardContainer>
         <ErrorMessage>No dashboard data available</ErrorMessage>
+        {sessionInfo}
       </DashboardContainer>
     );
   }
@@ -453,6 +487,7 @@ export const Dashboard: React.FC = () => {
           📊 Real-time data from CSV files • Last updated:{" "}
           {new Date().toLocaleString()}
         </div>
+        {sessionInfo}
       </Header>
 
       <ControlsSection>
@@ -562,7 +597,9 @@ export const Dashboard: React.FC = () => {
                       <div className="event-value">Value: {event.value}</div>
                     )}
                     <div className="event-company">
-                      Company: {event.company_id}
+                      Company:{" "}
+                      {summary.companies?.[event.company_id]?.name ||
+                        event.company_id}
                     </div>
                   </div>
                 ))
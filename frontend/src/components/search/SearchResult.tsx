@@ -1,6 +1,11 @@
 import React from "react";
 import styled from "styled-components";
-import { FilteredResults, FilterParams } from "../../types/usage";
+import {
+  FilteredResults,
+  FilterParams,
+  FieldMatch,
+  MatchRange,
+} from "../../types/usage";
 
 const ResultsContainer = styled.div`
   background: white;
@@ -190,13 +195,40 @@ export const SearchResults: React.FC<SearchResultsProps> = ({
     }
   };
 
-  const highlightSearchText = (text: string, searchText?: string): string => {
-    if (!searchText) return text;
+  // Match ranges from the API are character (code point) offsets
+  const highlightMatches = (
+    text: string,
+    ranges?: MatchRange[]
+  ): React.ReactNode => {
+    if (!ranges || ranges.length === 0) return text;
+
+    const chars = Array.from(text);
+    const parts: React.ReactNode[] = [];
+    let position = 0;
+
+    ranges.forEach((range, index) => {
+      if (range.start > position) {
+        parts.push(chars.slice(position, range.start).join(""));
+      }
+      parts.push(
+        <mark key={index}>{chars.slice(range.start, range.end).join("")}</mark>
+      );
+      position = range.end;
+    });
+
+    if (position < chars.length) {
+      parts.push(chars.slice(position).join(""));
+    }
 
-    const regex = new RegExp(`(${searchText})`, "gi");
-    return text.replace(regex, "<mark>$1</mark>");
+    return parts;
   };
 
+  const fieldRanges = (
+    matches: FieldMatch[] | undefined,
+    field: FieldMatch["field"]
+  ): MatchRange[] | undefined =>
+    matches?.find((match) => match.field === field)?.ranges;
+
   const hasActiveFilters = Object.keys(filters).some((key) => {
     const value = filters[key as keyof FilterParams];
     return (
@@ -259,49 +291,63 @@ export const SearchResults: React.FC<SearchResultsProps> = ({
         </EmptyState>
       ) : (
         <EventList>
-          {results.events.map((event) => (
-            <EventItem key={event.id}>
-              <EventHeader>
-                <EventType $type={event.type}>{event.type}</EventType>
-                <EventTime>{formatDate(event.created_at)}</EventTime>
-              </EventHeader>
-
-              <EventContent
-                dangerouslySetInnerHTML={{
-                  __html: highlightSearchText(
+          {results.events.map((event) => {
+            const matches = results.matches?.[event.id];
+            return (
+              <EventItem key={event.id}>
+                <EventHeader>
+                  <EventType $type={event.type}>{event.type}</EventType>
+                  <EventTime>{formatDate(event.created_at)}</EventTime>
+                </EventHeader>
+
+                <EventContent>
+                  {highlightMatches(
                     event.content,
-                    filters.search_text
-                  ),
-                }}
-              />
-
-              <EventDetails>
-                <div className="detail">
-                  <span className="label">Company:</span>
-                  <span className="value">{event.company_id}</span>
-                </div>
-                <div className="detail">
-                  <span className="label">Attribute:</span>
-                  <span className="value">{event.attribute}</span>
-                </div>
-                {event.value && (
+                    fieldRanges(matches, "content")
+                  )}
+                </EventContent>
+
+                <EventDetails>
                   <div className="detail">
-                    <span className="label">Value:</span>
-                    <span
-                      className="value"
-                      style={{ color: "#27ae60", fontWeight: "600" }}
-                    >
-                      {event.value}
+                    <span className="label">Company:</span>
+                    <span className="value">
+                      {highlightMatches(
+                        event.company_id,
+                        fieldRanges(matches, "company_id")
+                      )}
                     </span>
                   </div>
-                )}
-                <div className="detail">
-                  <span className="label">ID:</span>
-                  <span className="value">{event.id.slice(0, 8)}...</span>
-                </div>
-              </EventDetails>
-            </EventItem>
-          ))}
+                  <div className="detail">
+                    <span className="label">Attribute:</span>
+                    <span className="value">
+                      {highlightMatches(
+                        event.attribute,
+                        fieldRanges(matches, "attribute")
+                      )}
+                    </span>
+                  </div>
+                  {event.value && (
+                    <div className="detail">
+                      <span className="label">Value:</span>
+                      <span
+                        className="value"
+                        style={{ color: "#27ae60", fontWeight: "600" }}
+                      >
+                        {highlightMatches(
+                          event.value,
+                          fieldRanges(matches, "value")
+                        )}
+                      </span>
+                    </div>
+                  )}
+                  <div className="detail">
+                    <span className="label">ID:</span>
+                    <span className="value">{event.id.slice(0, 8)}...</span>
+                  </div>
+                </EventDetails>
+              </EventItem>
+            );
+          })}
         </EventList>
       )}
     </ResultsContainer>
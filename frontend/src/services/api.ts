@@ -4,9 +4,69 @@ import {
   FilteredResults,
   ExportRequest,
   ApiResponse,
+  Principal,
 } from "../types/usage";
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || "http://localhost:8080";
+const WORKSPACE = import.meta.env.VITE_WORKSPACE || "";
+
+// The API key or token the user signed in with. It lives in sessionStorage,
+// so it is gone when the tab is closed and is never part of the bundle.
+const CREDENTIAL_KEY = "assembly-dashboard.credential";
+
+// Workspace routes live under /api/v1/workspaces/<id>; the default workspace
+// is served from /api/v1 directly
+const API_PREFIX = WORKSPACE
+  ? `/api/v1/workspaces/${encodeURIComponent(WORKSPACE)}`
+  : "/api/v1";
+
+// Credentials sent with every request
+function authHeaders(): Record<string, string> {
+  const credential = sessionStorage.getItem(CREDENTIAL_KEY);
+  return credential ? { Authorization: `Bearer ${credential}` } : {};
+}
+
+// Called when the API rejects the stored credential, e.g. because the key
+// was revoked or the token expired
+let onSignedOut: () => void = () => {};
+
+export function setSignedOutHandler(handler: () => void) {
+  onSignedOut = handler;
+}
+
+export function hasCredential(): boolean {
+  return sessionStorage.getItem(CREDENTIAL_KEY) !== null;
+}
+
+export function signOut() {
+  sessionStorage.removeItem(CREDENTIAL_KEY);
+}
+
+// Checks the response status, signing the user out when the credential is
+// no longer accepted
+async function checkResponse(response: Response): Promise<void> {
+  if (response.status === 401 && hasCredential()) {
+    signOut();
+    onSignedOut();
+  }
+  if (!response.ok) {
+    throw await apiError(response);
+  }
+}
+
+// Builds an Error from the API error envelope, falling back to the status code
+async function apiError(response: Response): Promise<Error> {
+  try {
+    const body: ApiResponse<unknown> = await response.json();
+    const details = body.errors
+      ?.map((e) => (e.field ? `${e.field}: ${e.message}` : e.message))
+      .join("; ");
+    if (details) return new Error(`${body.message}: ${details}`);
+    return new Error(body.message || `API Error: ${response.status}`);
+  } catch {
+    return new Error(`API Error: ${response.status}`);
+  }
+}
 
 export class ApiService {
   private baseUrl: string;
@@ -15,29 +75,28 @@ export class ApiService {
     this.baseUrl = baseUrl;
   }
 
-  async get<T>(endpoint: string): Promise<T> {
-    const response = await fetch(`${this.baseUrl}/api/v1${endpoint}`);
+  async get<T>(endpoint: string, prefix: string = API_PREFIX): Promise<T> {
+    const response = await fetch(`${this.baseUrl}${prefix}${endpoint}`, {
+      headers: authHeaders(),
+    });
 
-    if (!response.ok) {
-      throw new Error(`API Error: ${response.status}`);
-    }
+    await checkResponse(response);
 
     const result: ApiResponse<T> = await response.json();
     return result.data;
   }
 
   async post<T>(endpoint: string, data: any): Promise<T> {
-    const response = await fetch(`${this.baseUrl}/api/v1${endpoint}`, {
+    const response = await fetch(`${this.baseUrl}${API_PREFIX}${endpoint}`, {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
+        ...authHeaders(),
       },
       body: JSON.stringify(data),
     });
 
-    if (!response.ok) {
-      throw new Error(`API Error: ${response.status}`);
-    }
+    await checkResponse(response);
 
     const result: ApiResponse<T> = await response.json();
     return result.data;
@@ -47,17 +106,16 @@ export class ApiService {
     endpoint: string,
     data: any
   ): Promise<{ blob: Blob; filename: string }> {
-    const response = await fetch(`${this.baseUrl}/api/v1${endpoint}`, {
+    const response = await fetch(`${this.baseUrl}${API_PREFIX}${endpoint}`, {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
+        ...authHeaders(),
       },
       body: JSON.stringify(data),
     });
 
-    if (!response.ok) {
-      throw new Error(`API Error: ${response.status}`);
-    }
+    await checkResponse(response);
 
     const blob = await response.blob();
     const contentDisposition = response.headers.get("Content-Disposition");
@@ -68,6 +126,26 @@ export class ApiService {
     return { blob, filename };
   }
 
+  // Signs in with an API key or token: it is kept for the session only if
+  // the API accepts it
+  async signIn(credential: string): Promise<Principal> {
+    const response = await fetch(`${this.baseUrl}/api/v1/auth/me`, {
+      headers: { Authorization: `Bearer ${credential}` },
+    });
+    if (!response.ok) {
+      throw await apiError(response);
+    }
+
+    const result: ApiResponse<Principal> = await response.json();
+    sessionStorage.setItem(CREDENTIAL_KEY, credential);
+    return result.data;
+  }
+
+  // The principal of the stored credential
+  async me(): Promise<Principal> {
+    return this.get<Principal>("/auth/me", "/api/v1");
+  }
+
   async getDashboardSummary(): Promise<DashboardSummary> {
     return this.get<DashboardSummary>("/dashboard/summary");
   }
@@ -81,9 +159,44 @@ export class ApiService {
       queryParams.set("company_ids", filters.company_ids.join(","));
     if (filters.event_types?.length)
       queryParams.set("event_types", filters.event_types.join(","));
+    if (filters.date_field) queryParams.set("date_field", filters.date_field);
+    if (filters.exclude_company_ids?.length)
+      queryParams.set(
+        "exclude_company_ids",
+        filters.exclude_company_ids.join(",")
+      );
+    if (filters.exclude_event_types?.length)
+      queryParams.set(
+        "exclude_event_types",
+        filters.exclude_event_types.join(",")
+      );
+    if (filters.csm_owners?.length)
+      queryParams.set("csm_owners", filters.csm_owners.join(","));
+    if (filters.plans?.length) queryParams.set("plans", filters.plans.join(","));
+    if (filters.regions?.length)
+      queryParams.set("regions", filters.regions.join(","));
+    if (filters.attributes?.length)
+      queryParams.set("attributes", filters.attributes.join(","));
+    if (filters.exclude_attributes?.length)
+      queryParams.set("exclude_attributes", filters.exclude_attributes.join(","));
+    if (filters.value_min !== undefined)
+      queryParams.set("value_min", filters.value_min.toString());
+    if (filters.value_max !== undefined)
+      queryParams.set("value_max", filters.value_max.toString());
+    if (filters.is_null !== undefined)
+      queryParams.set("is_null", filters.is_null.toString());
     if (filters.search_text) queryParams.set("search", filters.search_text);
+    if (filters.query) queryParams.set("q", filters.query);
+    if (filters.case_sensitive) queryParams.set("case_sensitive", "true");
+    if (filters.whole_word) queryParams.set("whole_word", "true");
     if (filters.limit) queryParams.set("limit", filters.limit.toString());
     if (filters.offset) queryParams.set("offset", filters.offset.toString());
+    if (filters.sort) queryParams.set("sort", filters.sort);
+    if (filters.cursor) queryParams.set("cursor", filters.cursor);
+    if (filters.facets?.length)
+      queryParams.set("facets", filters.facets.join(","));
+    if (filters.facet_date_bucket)
+      queryParams.set("facet_date_bucket", filters.facet_date_bucket);
 
     const endpoint = `/events/search${
       queryParams.toString() ? `?${queryParams.toString()}` : ""
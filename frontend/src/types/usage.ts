@@ -13,24 +13,244 @@ export interface UsageEvent {
 export interface FilterParams {
   start_date?: string;
   end_date?: string;
+  date_field?: "created_at" | "updated_at" | "original_timestamp";
   company_ids?: string[];
   event_types?: string[];
+  exclude_company_ids?: string[];
+  csm_owners?: string[];
+  plans?: string[];
+  regions?: string[];
+  exclude_event_types?: string[];
+  attributes?: string[];
+  exclude_attributes?: string[];
+  value_min?: number;
+  value_max?: number;
+  is_null?: boolean;
   search_text?: string;
+  query?: string;
+  case_sensitive?: boolean;
+  whole_word?: boolean;
   limit?: number;
   offset?: number;
+  sort?: string;
+  cursor?: string;
+  facets?: string[];
+  facet_date_bucket?: "day" | "week" | "month";
 }
 export interface FilteredResults {
   events: UsageEvent[];
   total_count: number;
   filtered_count: number;
+  sort: string;
+  next_cursor?: string;
+  dataset_version?: string;
+  facets?: Record<string, FacetCount[]>;
+  matches?: Record<string, FieldMatch[]>;
+  companies?: Record<string, Company>;
+}
+export interface Company {
+  id: string;
+  name?: string;
+  name_source?: "metadata" | "content";
+  plan?: string;
+  csm_owner?: string;
+  arr?: number;
+  region?: string;
+}
+export interface MatchRange {
+  start: number;
+  end: number;
+}
+export interface FieldMatch {
+  field: "content" | "attribute" | "value" | "company_id";
+  ranges: MatchRange[];
+}
+export interface FacetCount {
+  value: string;
+  count: number;
 }
 export interface ExportRequest {
-  format: "csv" | "json";
+  format: "csv" | "json" | "ndjson" | "xlsx" | "parquet";
+  kind?: "events" | "companies" | "timeseries" | "trends" | "cohorts";
   filters: FilterParams;
+  segment_id?: string;
+  include_annotations?: boolean;
+  compress?: boolean;
+  columns?: ExportColumn[];
+  headers?: Partial<Record<ExportColumn, string>>;
+  timestamp_format?: "rfc3339" | "rfc3339nano" | "datetime" | "date" | "unix" | "unix_ms";
+  timezone?: string;
+  delimiter?: string;
+  quote?: "minimal" | "all" | "none";
+  include_header?: boolean;
+}
+export type ExportColumn =
+  | "id"
+  | "created_at"
+  | "company_id"
+  | "company_name"
+  | "type"
+  | "content"
+  | "attribute"
+  | "updated_at"
+  | "original_timestamp"
+  | "value"
+  | "value_number"
+  | "user_email"
+  | "route"
+  | "annotations";
+export interface ExportJob {
+  id: string;
+  status: "queued" | "running" | "completed" | "failed" | "cancelled";
+  request: ExportRequest;
+  filename?: string;
+  content_type?: string;
+  total_rows: number;
+  rows_written: number;
+  progress: number;
+  size_bytes?: number;
+  error?: string;
+  created_at: string;
+  started_at?: string;
+  completed_at?: string;
+  expires_at: string;
+  requested_by?: string;
+  owner?: string;
+  client_ip?: string;
+  redaction?: string;
+  scope?: string[];
+}
+export interface ExportAuditEntry {
+  id: string;
+  time: string;
+  action: "export" | "job" | "download";
+  requester?: string;
+  key_id?: string;
+  client_ip?: string;
+  job_id?: string;
+  format: ExportRequest["format"];
+  kind?: ExportRequest["kind"];
+  filters: ExportRequest["filters"];
+  segment_id?: string;
+  columns?: ExportRequest["columns"];
+  rows: number;
+  filename?: string;
+  redaction?: string;
+  status?: "completed" | "failed" | "cancelled";
+  error?: string;
+}
+export interface RedactionPolicy {
+  name: string;
+  emails?: "mask" | "hash";
+  strip_url_ids?: boolean;
+}
+export interface RedactionConfig {
+  default?: string;
+  policies?: Record<string, RedactionPolicy>;
+  endpoints?: Partial<Record<"search" | "summary" | "export" | "report", string>>;
+  roles?: Record<string, string>;
+}
+export interface Annotation {
+  id: string;
+  company_id?: string;
+  start_date?: string;
+  end_date?: string;
+  text: string;
+  author?: string;
+  created_at: string;
+}
+export interface CompanyTimeline {
+  company: Company;
+  total_events: number;
+  time_series_data: TimeSeriesPoint[];
+  daily_trends: Record<string, TimeSeriesPoint[]>;
+  annotations: Annotation[];
+}
+export interface CompanyReport {
+  company: Company;
+  health?: CompanyAggregate;
+  from: string;
+  to: string;
+  generated_at: string;
+  total_events: number;
+  previous_events: number;
+  active_days: number;
+  active_users: number;
+  features_used: number;
+  daily_activity: TimeSeriesPoint[];
+  top_features: { name: string; count: number }[];
+  top_users: { email: string; events: number; last_seen: string }[];
+  metric_trends: MetricTrend[];
+  risk_signals: RiskSignal[];
+  annotations: Annotation[];
+}
+export interface MetricTrend {
+  name: string;
+  points: { time: string; value: number }[];
+  first: number;
+  latest: number;
+  change_percent: number | null;
+}
+export interface RiskSignal {
+  time: string;
+  signal: string;
+  metric?: string;
+  value?: string;
+}
+export interface SavedSearch {
+  id: string;
+  name: string;
+  owner?: string;
+  filters: FilterParams;
+  query?: string;
+  created_at: string;
+  updated_at: string;
+}
+export interface CompanyAggregate {
+  company_id: string;
+  company?: Company;
+  event_count: number;
+  events_last_7_days: number;
+  events_prior_7_days: number;
+  events_last_30_days: number;
+  actions_last_7_days: number;
+  at_risk_metrics: number;
+  last_activity: string;
+  days_since_activity: number;
+  health_score: number;
+  health_score_change: number;
+  as_of: string;
+}
+export interface SegmentCondition {
+  metric: string;
+  op: ">" | ">=" | "<" | "<=" | "=" | "!=";
+  value: number;
+}
+export interface DynamicSegment {
+  id: string;
+  name: string;
+  description?: string;
+  match: "all" | "any";
+  conditions: SegmentCondition[];
+  members: string[];
+  dataset_version?: string;
+  evaluated_at: string;
+  created_at: string;
+  updated_at: string;
+}
+export interface SegmentMembershipChange {
+  segment_id: string;
+  company_id: string;
+  change: "entered" | "exited";
+  dataset_version?: string;
+  at: string;
 }
 export interface AvailableFilters {
   companies: string[];
   event_types: string[];
+  csm_owners?: string[];
+  plans?: string[];
+  regions?: string[];
   date_range: {
     min: string;
     max: string;
@@ -43,6 +263,7 @@ export interface TimeSeriesPoint {
 }
 export interface CompanyAnalytics {
   company_id: string;
+  company?: Company;
   event_count: number;
   last_activity: string;
   event_types: Record<string, number>;
@@ -60,9 +281,115 @@ export interface DashboardSummary {
   top_companies: CompanyAnalytics[];
   daily_trends: Record<string, TimeSeriesPoint[]>;
   available_filters: AvailableFilters;
+  companies?: Record<string, Company>;
+  annotations?: Annotation[];
+}
+export interface ApiFieldError {
+  field?: string;
+  code: string;
+  message: string;
 }
 export interface ApiResponse<T> {
   status: string;
   message: string;
   data: T;
+  errors?: ApiFieldError[];
+}
+export interface AlertRule {
+  id: string;
+  name: string;
+  kind: "inactive_company" | "new_at_risk_event" | "daily_drop";
+  threshold: number;
+  company_ids?: string[];
+  cooldown_minutes: number;
+  webhooks?: string[];
+  enabled: boolean;
+  created_at: string;
+  updated_at: string;
+}
+export interface Alert {
+  rule_id: string;
+  rule_name: string;
+  company_id: string;
+  state: "firing" | "resolved";
+  value: number;
+  message: string;
+  fired_at: string;
+  resolved_at?: string;
+  last_notified_at?: string;
+  delivery_error?: string;
+}
+export interface DigestSchedule {
+  id: string;
+  name: string;
+  cron: string;
+  timezone: string;
+  recipients: string[];
+  csm_owner?: string;
+  company_ids?: string[];
+  enabled: boolean;
+  next_run_at?: string;
+  last_run_at?: string;
+  last_error?: string;
+  last_output?: string;
+  created_at: string;
+  updated_at: string;
+}
+export interface DigestMover {
+  company_id: string;
+  name: string;
+  events_this_week: number;
+  events_last_week: number;
+  change: number;
+}
+export interface Digest {
+  title: string;
+  period_start: string;
+  period_end: string;
+  companies: number;
+  events_this_week: number;
+  events_last_week: number;
+  change_percent?: number;
+  top_movers: DigestMover[];
+  at_risk: CompanyAggregate[];
+  inactive: CompanyAggregate[];
+}
+export type Role = "viewer" | "analyst" | "admin";
+export interface Principal {
+  subject: string;
+  role: Role;
+  method: "api_key" | "jwt";
+  key_id?: string;
+  expires_at?: string;
+  company_ids?: string[];
+  workspaces?: string[];
+}
+export interface ApiKey {
+  id: string;
+  name: string;
+  role: Role;
+  prefix: string;
+  company_ids?: string[];
+  workspaces?: string[];
+  created_by?: string;
+  created_at: string;
+  expires_at?: string;
+  last_used_at?: string;
+  revoked_at?: string;
+}
+export interface CreatedApiKey extends ApiKey {
+  key: string;
+}
+export interface Workspace {
+  id: string;
+  name: string;
+  data_path: string;
+  alert_webhooks?: string[];
+  created_at: string;
+  updated_at: string;
+  dataset?: {
+    version: string;
+    event_count: number;
+    loaded_at: string;
+  };
 }
@@ -1,5 +1,6 @@
 interface ImportMetaEnv {
   readonly VITE_API_URL: string
+  readonly VITE_WORKSPACE: string
 }
 
 interface ImportMeta {